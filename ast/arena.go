@@ -0,0 +1,127 @@
+package ast
+
+// Hands out nodes from big chunks instead of allocating every node on its
+// own, the parser uses it when one is given (see parser.NewWithArena)
+// Large programs then need a few hundred allocations instead of hundreds
+// of thousands, and the garbage collector frees the whole chunk at once
+// when the program is no longer used
+// Only the most common node types are covered, the others are rare enough
+// An Arena is not safe for concurrent use, a nil *Arena allocates normally
+type Arena struct {
+	identifiers slab[Identifier]
+	integers    slab[IntegerLiteral]
+	strings     slab[StringLiteral]
+	booleans    slab[Boolean]
+	prefixes    slab[PrefixExpression]
+	infixes     slab[InfixExpression]
+	calls       slab[CallExpression]
+	indexes     slab[IndexExpression]
+	expressions slab[ExpressionStatement]
+	lets        slab[LetStatement]
+	returns     slab[ReturnStatement]
+	blocks      slab[BlockStatement]
+}
+
+// Number of nodes per chunk
+const arenaChunkSize = 256
+
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+type slab[T any] struct {
+	free []T
+}
+
+func (s *slab[T]) alloc() *T {
+	if len(s.free) == 0 {
+		s.free = make([]T, arenaChunkSize)
+	}
+	node := &s.free[0]
+	s.free = s.free[1:]
+	return node
+}
+
+func (a *Arena) Identifier() *Identifier {
+	if a == nil {
+		return &Identifier{}
+	}
+	return a.identifiers.alloc()
+}
+
+func (a *Arena) IntegerLiteral() *IntegerLiteral {
+	if a == nil {
+		return &IntegerLiteral{}
+	}
+	return a.integers.alloc()
+}
+
+func (a *Arena) StringLiteral() *StringLiteral {
+	if a == nil {
+		return &StringLiteral{}
+	}
+	return a.strings.alloc()
+}
+
+func (a *Arena) Boolean() *Boolean {
+	if a == nil {
+		return &Boolean{}
+	}
+	return a.booleans.alloc()
+}
+
+func (a *Arena) PrefixExpression() *PrefixExpression {
+	if a == nil {
+		return &PrefixExpression{}
+	}
+	return a.prefixes.alloc()
+}
+
+func (a *Arena) InfixExpression() *InfixExpression {
+	if a == nil {
+		return &InfixExpression{}
+	}
+	return a.infixes.alloc()
+}
+
+func (a *Arena) CallExpression() *CallExpression {
+	if a == nil {
+		return &CallExpression{}
+	}
+	return a.calls.alloc()
+}
+
+func (a *Arena) IndexExpression() *IndexExpression {
+	if a == nil {
+		return &IndexExpression{}
+	}
+	return a.indexes.alloc()
+}
+
+func (a *Arena) ExpressionStatement() *ExpressionStatement {
+	if a == nil {
+		return &ExpressionStatement{}
+	}
+	return a.expressions.alloc()
+}
+
+func (a *Arena) LetStatement() *LetStatement {
+	if a == nil {
+		return &LetStatement{}
+	}
+	return a.lets.alloc()
+}
+
+func (a *Arena) ReturnStatement() *ReturnStatement {
+	if a == nil {
+		return &ReturnStatement{}
+	}
+	return a.returns.alloc()
+}
+
+func (a *Arena) BlockStatement() *BlockStatement {
+	if a == nil {
+		return &BlockStatement{}
+	}
+	return a.blocks.alloc()
+}
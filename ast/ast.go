@@ -9,6 +9,8 @@ import (
 // Every type of Node have this as the default
 type Node interface {
 	TokenLiteral() string
+	// Where the node starts in the source, see token.Position
+	Pos() token.Position
 	// Implement a string method to print AST nodes which is nice for debugging
 	String() string
 }
@@ -24,14 +26,17 @@ type Expression interface {
 	expressionNode()
 }
 
+// Also used for const x = 5; which can't be reassigned later
 type LetStatement struct {
-	Token token.Token // the LET token
+	Token token.Token // the LET or CONST token
 	Name  *Identifier
 	Value Expression
+	Const bool
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -55,6 +60,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *ReturnStatement) Pos() token.Position  { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -69,13 +75,51 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// for (x in [1, 2, 3]) { ... } or for (key, value in hash) { ... }
+type ForStatement struct {
+	Token    token.Token // the FOR token
+	Key      *Identifier // nil when only one variable is given
+	Value    *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+	// Names of the slots of an iteration, filled in by the resolver
+	Locals []string
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Key != nil {
+		out.WriteString(fs.Key.String() + ", ")
+	}
+	out.WriteString(fs.Value.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
 type Identifier struct {
 	Token token.Token // The IDENT token
 	Value string
+
+	// Set by the resolver for names bound inside a function or loop body:
+	// the binding is slot Index of the environment Depth levels up
+	// Everything else (globals, builtins) is looked up by name
+	Resolved bool
+	Depth    int
+	Index    int
 }
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 type ExpressionStatement struct {
@@ -85,6 +129,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExpressionStatement) Pos() token.Position  { return es.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -99,6 +144,7 @@ type IntegerLiteral struct {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 type PrefixExpression struct {
@@ -109,6 +155,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -129,6 +176,7 @@ type InfixExpression struct {
 
 func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *InfixExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -148,6 +196,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IfExpression struct {
@@ -159,6 +208,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -178,10 +228,13 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	// Where the closing } is, the formatter keeps comments in front of it inside
+	Rbrace token.Position
 }
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -192,14 +245,22 @@ func (bs *BlockStatement) String() string {
 	return out.String()
 }
 
+// fn*(...) { ... } is a generator function which can yield values
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Generator  bool
+	// The name of the let the function is bound to, empty when there is none
+	Name string
+	// Names of the slots of a call, the parameters come first
+	// Filled in by the resolver
+	Locals []string
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -209,6 +270,9 @@ func (fl *FunctionLiteral) String() string {
 	}
 
 	out.WriteString(fl.TokenLiteral())
+	if fl.Generator {
+		out.WriteString("*")
+	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(")")
@@ -217,14 +281,56 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// Hands a value to the consumer of a generator and pauses it
+type YieldExpression struct {
+	Token token.Token // the YIELD token
+	Value Expression
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) Pos() token.Position  { return ye.Token.Pos }
+func (ye *YieldExpression) String() string {
+	return ye.TokenLiteral() + " " + ye.Value.String()
+}
+
+// Runs a function without arguments in its own goroutine
+type SpawnExpression struct {
+	Token    token.Token // the SPAWN token
+	Function Expression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpawnExpression) String() string {
+	return se.TokenLiteral() + " " + se.Function.String()
+}
+
+// Defers the evaluation of Value until the result is forced
+type LazyExpression struct {
+	Token token.Token // the LAZY token
+	Value Expression
+}
+
+func (le *LazyExpression) expressionNode()      {}
+func (le *LazyExpression) TokenLiteral() string { return le.Token.Literal }
+func (le *LazyExpression) Pos() token.Position  { return le.Token.Pos }
+func (le *LazyExpression) String() string {
+	return le.TokenLiteral() + " " + le.Value.String()
+}
+
 type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	// Set by the parser when the call is part of a longer chain, see Chained
+	Chained bool
 }
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -241,10 +347,169 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
+func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
+// A string with embedded expressions (e.g. "sum is ${a + b}")
+// Parts are StringLiterals for the text and the parsed embedded expressions
+type TemplateLiteral struct {
+	Token token.Token // the TEMPLATE token
+	Parts []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) Pos() token.Position  { return tl.Token.Pos }
+func (tl *TemplateLiteral) String() string       { return tl.Token.Literal }
+
+type ArrayLiteral struct {
+	Token    token.Token // the [ token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token token.Token // the [ token
+	Left  Expression
+	Index Expression
+	// Set by the parser when the index is part of a longer chain, see Chained
+	Chained bool
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// Changes the value of an existing binding (e.g. x = x + 1)
+type AssignExpression struct {
+	Token token.Token // the = token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() token.Position  { return ae.Token.Pos }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ae.Name.String())
+	out.WriteString(" = ")
+	out.WriteString(ae.Value.String())
+
+	return out.String()
+}
+
+type HashLiteral struct {
+	Token token.Token // the { token
+	Pairs map[Expression]Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, key := range SortedKeys(hl) {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// import("path/to/lib.monkey")
+type ImportExpression struct {
+	Token token.Token // the IMPORT token
+	Path  Expression
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) Pos() token.Position  { return ie.Token.Pos }
+func (ie *ImportExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("import(")
+	out.WriteString(ie.Path.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+// Access a binding of a value by name (e.g. lib.add)
+// Optional member access (e.g. user?.name) results in null when the object
+// is null, and so does the rest of the chain (user?.address.city)
+type MemberExpression struct {
+	Token    token.Token // the . or ?. token
+	Object   Expression
+	Property *Identifier
+	Optional bool
+	// Set by the parser when the member is part of a longer chain, see Chained
+	Chained bool
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) Pos() token.Position  { return me.Token.Pos }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(me.Token.Literal)
+	out.WriteString(me.Property.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // Will be the Root node of the AST
 // The AST is a series of Statements
 type Program struct {
 	Statements []Statement
+	// Every // comment of the source in order, the evaluator ignores them
+	Comments []token.Token
 }
 
 func (p *Program) String() string {
@@ -257,6 +522,13 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) TokenLiteral() string {
 	if len(p.Statements) > 0 {
 		return p.Statements[0].TokenLiteral()
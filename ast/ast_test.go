@@ -2,6 +2,7 @@ package ast
 
 import (
 	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +29,133 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestSexp(t *testing.T) {
+	// let add = fn(a, b) { a + b * 2 };
+	plus := &InfixExpression{
+		Left:     &Identifier{Value: "a"},
+		Operator: "+",
+		Right: &InfixExpression{
+			Left:     &Identifier{Value: "b"},
+			Operator: "*",
+			Right:    &IntegerLiteral{Value: 2},
+		},
+	}
+	fn := &FunctionLiteral{
+		Parameters: []*Identifier{{Value: "a"}, {Value: "b"}},
+		Body:       &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: plus}}},
+	}
+	program := &Program{Statements: []Statement{&LetStatement{Name: &Identifier{Value: "add"}, Value: fn}}}
+
+	expected := "(program (let add (fn (a b) (block (+ a (* b 2))))))"
+	if got := Sexp(program); got != expected {
+		t.Errorf("Sexp wrong. expected=%q, got=%q", expected, got)
+	}
+
+	// too wide for one line, the children go below their parent
+	call := &CallExpression{Function: &Identifier{Value: "describe"}}
+	for i := 0; i < 3; i++ {
+		call.Arguments = append(call.Arguments, &StringLiteral{Value: "a rather long argument"})
+	}
+	expected = `(call
+  describe
+  "a rather long argument"
+  "a rather long argument"
+  "a rather long argument")`
+	if got := Sexp(call); got != expected {
+		t.Errorf("Sexp wrong. expected=%q, got=%q", expected, got)
+	}
+
+	if got := Sexp(&FunctionLiteral{Parameters: []*Identifier{}, Body: &BlockStatement{}}); got != "(fn () (block))" {
+		t.Errorf("Sexp of an empty function wrong. got=%q", got)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	// let f = fn(x) { x + y }; f(1)
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Name: ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("x")},
+					Body: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &InfixExpression{Left: ident("x"), Operator: "+", Right: ident("y")}},
+					}},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{Function: ident("f"), Arguments: []Expression{&IntegerLiteral{Value: 1}}}},
+		},
+	}
+
+	names := []string{}
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		return true
+	})
+	if strings.Join(names, " ") != "f x x y f" {
+		t.Errorf("wrong identifiers visited. expected=%q, got=%q", "f x x y f", strings.Join(names, " "))
+	}
+
+	// false skips the children of a node
+	names = names[:0]
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, fn := node.(*FunctionLiteral)
+		return !fn
+	})
+	if strings.Join(names, " ") != "f f" {
+		t.Errorf("wrong identifiers visited. expected=%q, got=%q", "f f", strings.Join(names, " "))
+	}
+}
+
+func TestJSON(t *testing.T) {
+	// -x
+	exp := &PrefixExpression{
+		Token:    token.Token{Type: token.MINUS, Literal: "-", Pos: token.Position{Line: 1, Column: 1}},
+		Operator: "-",
+		Right:    &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 2}}, Value: "x"},
+	}
+
+	out, err := JSON(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "node": "PrefixExpression",
+  "operator": "-",
+  "pos": "1:1",
+  "right": {
+    "name": "x",
+    "node": "Identifier",
+    "pos": "1:2"
+  }
+}`
+	if string(out) != expected {
+		t.Errorf("wrong JSON.\nexpected=%s\ngot=%s", expected, out)
+	}
+}
+
+func TestDot(t *testing.T) {
+	exp := &InfixExpression{Operator: "+", Left: &IntegerLiteral{Value: 1}, Right: &IntegerLiteral{Value: 2}}
+
+	expected := `digraph ast {
+  node [shape=box, fontname=monospace];
+  n0 [label="+"];
+  n1 [label="1"];
+  n0 -> n1;
+  n2 [label="2"];
+  n0 -> n2;
+}
+`
+	if dot := Dot(exp); dot != expected {
+		t.Errorf("wrong graph.\nexpected=%s\ngot=%s", expected, dot)
+	}
+}
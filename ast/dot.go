@@ -0,0 +1,102 @@
+package ast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Renders the tree as a Graphviz graph, e.g. for slides:
+// monkey ast -format=dot script.monkey | dot -Tsvg > ast.svg
+func Dot(node Node) string {
+	g := &dotGraph{}
+	g.b.WriteString("digraph ast {\n")
+	g.b.WriteString("  node [shape=box, fontname=monospace];\n")
+	Walk(g, node)
+	g.b.WriteString("}\n")
+	return g.b.String()
+}
+
+// Walks the tree and remembers the parents to draw the edges from
+type dotGraph struct {
+	b       strings.Builder
+	nodes   int
+	parents []int
+}
+
+func (g *dotGraph) Visit(node Node) Visitor {
+	if node == nil {
+		g.parents = g.parents[:len(g.parents)-1]
+		return nil
+	}
+
+	id := g.nodes
+	g.nodes++
+	fmt.Fprintf(&g.b, "  n%d [label=%s];\n", id, strconv.Quote(dotLabel(node)))
+	if len(g.parents) > 0 {
+		fmt.Fprintf(&g.b, "  n%d -> n%d;\n", g.parents[len(g.parents)-1], id)
+	}
+	g.parents = append(g.parents, id)
+	return g
+}
+
+// The kind of the node and what tells it apart from others of the kind
+func dotLabel(node Node) string {
+	switch node := node.(type) {
+	case *Program:
+		return "program"
+	case *LetStatement:
+		return node.Token.Literal
+	case *ReturnStatement:
+		return "return"
+	case *ExpressionStatement:
+		return "expression"
+	case *BlockStatement:
+		return "block"
+	case *ForStatement:
+		return "for"
+	case *Identifier:
+		return node.Value
+	case *IntegerLiteral:
+		return strconv.FormatInt(node.Value, 10)
+	case *Boolean:
+		return strconv.FormatBool(node.Value)
+	case *StringLiteral:
+		return strconv.Quote(node.Value)
+	case *TemplateLiteral:
+		return "template"
+	case *PrefixExpression:
+		return node.Operator
+	case *InfixExpression:
+		return node.Operator
+	case *IfExpression:
+		return "if"
+	case *FunctionLiteral:
+		if node.Generator {
+			return "fn*"
+		}
+		return "fn"
+	case *CallExpression:
+		return "call"
+	case *ArrayLiteral:
+		return "array"
+	case *HashLiteral:
+		return "hash"
+	case *IndexExpression:
+		return "index"
+	case *AssignExpression:
+		return "="
+	case *ImportExpression:
+		return "import"
+	case *MemberExpression:
+		return node.Token.Literal
+	case *YieldExpression:
+		return "yield"
+	case *SpawnExpression:
+		return "spawn"
+	case *LazyExpression:
+		return "lazy"
+	default:
+		return node.TokenLiteral()
+	}
+}
@@ -0,0 +1,133 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Renders the tree as indented JSON for other tools, every node is an object
+// with its kind in "node", its position in "pos" ("line:column") and its
+// children under the names of the fields
+func JSON(node Node) ([]byte, error) {
+	return json.MarshalIndent(toJSON(node), "", "  ")
+}
+
+func toJSON(node Node) any {
+	if node == nil {
+		return nil
+	}
+
+	obj := map[string]any{"node": strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")}
+	if pos := node.Pos(); pos.IsValid() {
+		obj["pos"] = pos.String()
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		obj["statements"] = statementsJSON(node.Statements)
+	case *LetStatement:
+		obj["const"] = node.Const
+		obj["name"] = toJSON(node.Name)
+		obj["value"] = expressionJSON(node.Value)
+	case *ReturnStatement:
+		obj["value"] = expressionJSON(node.ReturnValue)
+	case *ExpressionStatement:
+		obj["expression"] = expressionJSON(node.Expression)
+	case *BlockStatement:
+		obj["statements"] = statementsJSON(node.Statements)
+	case *ForStatement:
+		if node.Key != nil {
+			obj["key"] = toJSON(node.Key)
+		}
+		obj["value"] = toJSON(node.Value)
+		obj["iterable"] = expressionJSON(node.Iterable)
+		obj["body"] = toJSON(node.Body)
+	case *Identifier:
+		obj["name"] = node.Value
+	case *IntegerLiteral:
+		obj["value"] = node.Value
+	case *Boolean:
+		obj["value"] = node.Value
+	case *StringLiteral:
+		obj["value"] = node.Value
+	case *TemplateLiteral:
+		obj["parts"] = expressionsJSON(node.Parts)
+	case *PrefixExpression:
+		obj["operator"] = node.Operator
+		obj["right"] = expressionJSON(node.Right)
+	case *InfixExpression:
+		obj["operator"] = node.Operator
+		obj["left"] = expressionJSON(node.Left)
+		obj["right"] = expressionJSON(node.Right)
+	case *IfExpression:
+		obj["condition"] = expressionJSON(node.Condition)
+		obj["consequence"] = toJSON(node.Consequence)
+		if node.Alternative != nil {
+			obj["alternative"] = toJSON(node.Alternative)
+		}
+	case *FunctionLiteral:
+		params := make([]any, len(node.Parameters))
+		for i, param := range node.Parameters {
+			params[i] = toJSON(param)
+		}
+		obj["parameters"] = params
+		obj["generator"] = node.Generator
+		obj["body"] = toJSON(node.Body)
+	case *CallExpression:
+		obj["function"] = expressionJSON(node.Function)
+		obj["arguments"] = expressionsJSON(node.Arguments)
+	case *ArrayLiteral:
+		obj["elements"] = expressionsJSON(node.Elements)
+	case *HashLiteral:
+		pairs := []any{}
+		for _, key := range SortedKeys(node) {
+			pairs = append(pairs, map[string]any{"key": expressionJSON(key), "value": expressionJSON(node.Pairs[key])})
+		}
+		obj["pairs"] = pairs
+	case *IndexExpression:
+		obj["left"] = expressionJSON(node.Left)
+		obj["index"] = expressionJSON(node.Index)
+	case *AssignExpression:
+		obj["name"] = toJSON(node.Name)
+		obj["value"] = expressionJSON(node.Value)
+	case *ImportExpression:
+		obj["path"] = expressionJSON(node.Path)
+	case *MemberExpression:
+		obj["object"] = expressionJSON(node.Object)
+		obj["property"] = toJSON(node.Property)
+		obj["optional"] = node.Optional
+	case *YieldExpression:
+		obj["value"] = expressionJSON(node.Value)
+	case *SpawnExpression:
+		obj["function"] = expressionJSON(node.Function)
+	case *LazyExpression:
+		obj["value"] = expressionJSON(node.Value)
+	}
+
+	return obj
+}
+
+// A nil Expression in a Node interface isn't nil, these keep it null
+func expressionJSON(exp Expression) any {
+	if exp == nil {
+		return nil
+	}
+	return toJSON(exp)
+}
+
+func expressionsJSON(exps []Expression) []any {
+	items := make([]any, len(exps))
+	for i, exp := range exps {
+		items[i] = expressionJSON(exp)
+	}
+	return items
+}
+
+func statementsJSON(stmts []Statement) []any {
+	items := make([]any, len(stmts))
+	for i, stmt := range stmts {
+		items[i] = toJSON(stmt)
+	}
+	return items
+}
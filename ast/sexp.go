@@ -0,0 +1,178 @@
+package ast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// How wide a node may get before its children are put on their own lines
+const sexpWidth = 60
+
+// Renders the tree as an s-expression, e.g. (let x (+ 1 2)), a debug view
+// which shows how the parser grouped the input (String() hides that)
+// Nodes which don't fit on a line get their children indented below them
+func Sexp(node Node) string {
+	var b strings.Builder
+	toSexp(node).write(&b, 0)
+	return b.String()
+}
+
+// Either an atom (a name, a literal) or a list with the operator first
+type sexp struct {
+	atom string
+	list []*sexp
+}
+
+func atom(s string) *sexp {
+	return &sexp{atom: s}
+}
+
+func list(head string, items ...*sexp) *sexp {
+	return &sexp{list: append([]*sexp{atom(head)}, items...)}
+}
+
+func toSexp(node Node) *sexp {
+	switch node := node.(type) {
+	case *Program:
+		items := make([]*sexp, len(node.Statements))
+		for i, stmt := range node.Statements {
+			items[i] = toSexp(stmt)
+		}
+		return list("program", items...)
+	case *LetStatement:
+		head := "let"
+		if node.Const {
+			head = "const"
+		}
+		return list(head, toSexp(node.Name), toSexp(node.Value))
+	case *ReturnStatement:
+		return list("return", toSexp(node.ReturnValue))
+	case *ExpressionStatement:
+		return toSexp(node.Expression)
+	case *BlockStatement:
+		if node == nil {
+			return atom("nil")
+		}
+		items := make([]*sexp, len(node.Statements))
+		for i, stmt := range node.Statements {
+			items[i] = toSexp(stmt)
+		}
+		return list("block", items...)
+	case *ForStatement:
+		vars := []*sexp{}
+		if node.Key != nil {
+			vars = append(vars, toSexp(node.Key))
+		}
+		vars = append(vars, toSexp(node.Value))
+		return list("for", &sexp{list: vars}, toSexp(node.Iterable), toSexp(node.Body))
+	case *Identifier:
+		return atom(node.Value)
+	case *IntegerLiteral:
+		return atom(strconv.FormatInt(node.Value, 10))
+	case *Boolean:
+		return atom(strconv.FormatBool(node.Value))
+	case *StringLiteral:
+		return atom(strconv.Quote(node.Value))
+	case *PrefixExpression:
+		return list(node.Operator, toSexp(node.Right))
+	case *InfixExpression:
+		return list(node.Operator, toSexp(node.Left), toSexp(node.Right))
+	case *IfExpression:
+		items := []*sexp{toSexp(node.Condition), toSexp(node.Consequence)}
+		if node.Alternative != nil {
+			items = append(items, toSexp(node.Alternative))
+		}
+		return list("if", items...)
+	case *FunctionLiteral:
+		head := "fn"
+		if node.Generator {
+			head = "fn*"
+		}
+		params := make([]*sexp, len(node.Parameters))
+		for i, param := range node.Parameters {
+			params[i] = toSexp(param)
+		}
+		return list(head, &sexp{list: params}, toSexp(node.Body))
+	case *YieldExpression:
+		return list("yield", toSexp(node.Value))
+	case *SpawnExpression:
+		return list("spawn", toSexp(node.Function))
+	case *LazyExpression:
+		return list("lazy", toSexp(node.Value))
+	case *CallExpression:
+		items := []*sexp{toSexp(node.Function)}
+		for _, arg := range node.Arguments {
+			items = append(items, toSexp(arg))
+		}
+		return list("call", items...)
+	case *TemplateLiteral:
+		items := make([]*sexp, len(node.Parts))
+		for i, part := range node.Parts {
+			items[i] = toSexp(part)
+		}
+		return list("template", items...)
+	case *ArrayLiteral:
+		items := make([]*sexp, len(node.Elements))
+		for i, el := range node.Elements {
+			items[i] = toSexp(el)
+		}
+		return list("array", items...)
+	case *IndexExpression:
+		return list("index", toSexp(node.Left), toSexp(node.Index))
+	case *AssignExpression:
+		return list("=", toSexp(node.Name), toSexp(node.Value))
+	case *HashLiteral:
+		// Pairs is a map, sorting keeps the output the same every time
+		pairs := make([]*sexp, 0, len(node.Pairs))
+		for key, value := range node.Pairs {
+			pairs = append(pairs, list("pair", toSexp(key), toSexp(value)))
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return pairs[i].flat() < pairs[j].flat()
+		})
+		return list("hash", pairs...)
+	case *ImportExpression:
+		return list("import", toSexp(node.Path))
+	case *MemberExpression:
+		head := "."
+		if node.Optional {
+			head = "?."
+		}
+		return list(head, toSexp(node.Object), toSexp(node.Property))
+	case nil:
+		return atom("nil")
+	default:
+		return atom(node.String())
+	}
+}
+
+func (s *sexp) flat() string {
+	if s.list == nil {
+		return s.atom
+	}
+
+	items := make([]string, len(s.list))
+	for i, item := range s.list {
+		items[i] = item.flat()
+	}
+	return "(" + strings.Join(items, " ") + ")"
+}
+
+func (s *sexp) write(b *strings.Builder, indent int) {
+	flat := s.flat()
+	if len(s.list) == 0 || indent+len(flat) <= sexpWidth {
+		b.WriteString(flat)
+		return
+	}
+
+	// the head stays on the first line, e.g. "(let"
+	b.WriteString("(")
+	b.WriteString(s.list[0].flat())
+	for _, item := range s.list[1:] {
+		b.WriteString("\n")
+		b.WriteString(strings.Repeat("  ", indent/2+1))
+		item.write(b, indent+2)
+	}
+	b.WriteString(")")
+}
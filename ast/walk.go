@@ -0,0 +1,146 @@
+package ast
+
+import "sort"
+
+// Walk calls Visit for every node it comes across, like go/ast
+// When Visit returns a Visitor w, the children of the node are walked
+// with w and w.Visit(nil) is called after them
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Visits node and everything below it in the order of the source
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+	case *LetStatement:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+	case *ReturnStatement:
+		walkExpression(v, n.ReturnValue)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+	case *ForStatement:
+		if n.Key != nil {
+			Walk(v, n.Key)
+		}
+		Walk(v, n.Value)
+		walkExpression(v, n.Iterable)
+		Walk(v, n.Body)
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *IfExpression:
+		walkExpression(v, n.Condition)
+		Walk(v, n.Consequence)
+		if n.Alternative != nil {
+			Walk(v, n.Alternative)
+		}
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			Walk(v, param)
+		}
+		Walk(v, n.Body)
+	case *CallExpression:
+		walkExpression(v, n.Function)
+		for _, arg := range n.Arguments {
+			walkExpression(v, arg)
+		}
+	case *IndexExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Index)
+	case *MemberExpression:
+		walkExpression(v, n.Object)
+		Walk(v, n.Property)
+	case *AssignExpression:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			walkExpression(v, el)
+		}
+	case *HashLiteral:
+		for _, key := range SortedKeys(n) {
+			walkExpression(v, key)
+			walkExpression(v, n.Pairs[key])
+		}
+	case *TemplateLiteral:
+		for _, part := range n.Parts {
+			walkExpression(v, part)
+		}
+	case *ImportExpression:
+		walkExpression(v, n.Path)
+	case *YieldExpression:
+		walkExpression(v, n.Value)
+	case *SpawnExpression:
+		walkExpression(v, n.Function)
+	case *LazyExpression:
+		walkExpression(v, n.Value)
+	}
+
+	v.Visit(nil)
+}
+
+// Programs with parser errors can have nil expressions in them
+func walkExpression(v Visitor, exp Expression) {
+	if exp != nil {
+		Walk(v, exp)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Walks the tree and calls f for every node, the children of a node are
+// skipped when f returns false. f(nil) is called after the children
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Whether node is the object, left side or function of another member,
+// index or call expression. A ?. which finds null skips the rest of the
+// chain, the expression which isn't chained is where it ends
+func Chained(node Expression) bool {
+	switch node := node.(type) {
+	case *MemberExpression:
+		return node.Chained
+	case *IndexExpression:
+		return node.Chained
+	case *CallExpression:
+		return node.Chained
+	default:
+		return false
+	}
+}
+
+// The keys of the hash in the order they were written in, Pairs is a map
+func SortedKeys(hash *HashLiteral) []Expression {
+	keys := make([]Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].Pos(), keys[j].Pos()
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return keys
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+)
+
+// monkey ast prints the tree the parser made of a file, as an s-expression
+// for people, as JSON for tools or as a Graphviz graph for pictures
+func (s *streams) ast(args []string) int {
+	flags := s.flagSet("ast")
+	format := flags.String("format", "sexpr", "the output format: sexpr, json or dot")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) > 1 {
+		fmt.Fprintln(s.stderr, "usage: monkey "+commands["ast"].usage)
+		return exitUsage
+	}
+	if *format != "sexpr" && *format != "json" && *format != "dot" {
+		fmt.Fprintf(s.stderr, "unknown format %q, use sexpr, json or dot\n", *format)
+		return exitUsage
+	}
+
+	path := "-"
+	if len(paths) == 1 {
+		path = paths[0]
+	}
+	name, source, ok := s.readSource(path)
+	if !ok {
+		return exitError
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		s.printParseErrors(name, p.Diagnostics())
+		return exitUsage
+	}
+
+	switch *format {
+	case "json":
+		out, err := ast.JSON(program)
+		if err != nil {
+			fmt.Fprintln(s.stderr, err)
+			return exitError
+		}
+		fmt.Fprintf(s.stdout, "%s\n", out)
+	case "dot":
+		fmt.Fprint(s.stdout, ast.Dot(program))
+	default:
+		fmt.Fprintln(s.stdout, ast.Sexp(program))
+	}
+	return exitOK
+}
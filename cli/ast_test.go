@@ -0,0 +1,36 @@
+package cli
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAst(t *testing.T) {
+	path := writeScript(t, "script.monkey", "let x = 1 + 2;")
+
+	stdout, _, code := runMain("", "ast", path)
+	if stdout != "(program (let x (+ 1 2)))\n" || code != 0 {
+		t.Errorf("monkey ast: expected the s-expression and exit 0, got=%q and %d", stdout, code)
+	}
+
+	// the flag can come after the file
+	stdout, _, code = runMain("", "ast", path, "--format=json")
+	var tree map[string]any
+	if err := json.Unmarshal([]byte(stdout), &tree); err != nil || code != 0 {
+		t.Fatalf("monkey ast --format=json: expected JSON and exit 0, got=%q and %d (%v)", stdout, code, err)
+	}
+	if tree["node"] != "Program" {
+		t.Errorf("expected a Program node, got=%v", tree["node"])
+	}
+
+	stdout, _, code = runMain("puts(1)", "ast", "-format=dot")
+	if !strings.HasPrefix(stdout, "digraph ast {\n") || code != 0 {
+		t.Errorf("monkey ast -format=dot: expected a graph and exit 0, got=%q and %d", stdout, code)
+	}
+
+	_, stderr, code := runMain("", "ast", "-format=xml", path)
+	if code != 2 || stderr == "" {
+		t.Errorf("expected an error and exit 2 for an unknown format, got=%q and %d", stderr, code)
+	}
+}
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// What one benchmark came to, -save writes a list of them as JSON
+type benchResult struct {
+	Name       string  `json:"name"`
+	Runs       int     `json:"runs"`
+	NsPerOp    float64 `json:"ns_per_op"`
+	NodesPerOp int64   `json:"nodes_per_op"`
+}
+
+// monkey bench evaluates the script and then calls every function it
+// registered with bench(name, fn) until -time is used up, like go test -bench
+// The nodes are counted in a run of their own, so counting doesn't slow
+// down the timed runs
+func (s *streams) bench(args []string) int {
+	flags := s.flagSet("bench")
+	run := flags.String("run", "", "only run the benchmarks whose name matches this regular expression")
+	benchTime := flags.Duration("time", time.Second, "how long to run each benchmark")
+	save := flags.String("save", "", "write the results as JSON to this file, e.g. as a baseline")
+	compare := flags.String("compare", "", "compare the results with a baseline written by -save")
+	noPrelude := flags.Bool("no-prelude", false, "do not load the standard library written in Monkey")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) != 1 {
+		fmt.Fprintln(s.stderr, "usage: monkey "+commands["bench"].usage)
+		return exitUsage
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(s.stderr, "invalid -run: %s\n", err)
+			return exitUsage
+		}
+	}
+
+	var baseline map[string]benchResult
+	if *compare != "" {
+		if baseline, err = readBaseline(*compare); err != nil {
+			fmt.Fprintln(s.stderr, err)
+			return exitError
+		}
+	}
+
+	// the benchmarks get the modules the file imported instead of
+	// loading them again on every run
+	modules := evaluator.NewModules()
+	name, benchmarks, code := s.loadBenchmarks(paths[0], *noPrelude, modules)
+	if code != exitOK {
+		return code
+	}
+	if len(benchmarks) == 0 {
+		fmt.Fprintf(s.stderr, "%s: no benchmarks, register them with bench(name, fn)\n", name)
+		return exitError
+	}
+
+	w := tabwriter.NewWriter(s.stdout, 0, 0, 2, ' ', 0)
+	if baseline != nil {
+		fmt.Fprintln(w, "NAME\tRUNS\tNS/OP\tNODES/OP\tTIME\tNODES")
+	} else {
+		fmt.Fprintln(w, "NAME\tRUNS\tNS/OP\tNODES/OP")
+	}
+
+	opts := s.withConfig(evaluator.Options{Builtins: evaluator.BuiltinsWithOutput(nil, io.Discard), Modules: modules})
+	results := []benchResult{}
+	for _, bm := range benchmarks {
+		if filter != nil && !filter.MatchString(bm.Name) {
+			continue
+		}
+		result, err := runBenchmark(bm, *benchTime, opts)
+		if err != nil {
+			w.Flush()
+			s.printRuntimeError(name, err)
+			return exitError
+		}
+		results = append(results, result)
+
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%d", result.Name, result.Runs, result.NsPerOp, result.NodesPerOp)
+		if baseline != nil {
+			if old, ok := baseline[result.Name]; ok {
+				fmt.Fprintf(w, "\t%s\t%s", change(old.NsPerOp, result.NsPerOp), change(float64(old.NodesPerOp), float64(result.NodesPerOp)))
+			} else {
+				fmt.Fprint(w, "\tnew\tnew")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	if *save != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*save, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not save the results: %s\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// Evaluates the script like monkey run and returns what it registered,
+// name is the one of readSource
+func (s *streams) loadBenchmarks(path string, noPrelude bool, modules *evaluator.Modules) (name string, benchmarks []evaluator.TestCase, code int) {
+	name, source, ok := s.readSource(path)
+	if !ok {
+		return path, nil, exitError
+	}
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		s.printParseErrors(name, p.Diagnostics())
+		return name, nil, exitUsage
+	}
+
+	module := &object.Module{Name: name, Path: name}
+	if abs, err := filepath.Abs(name); err == nil {
+		module.Path = abs
+	}
+	env := object.NewModuleEnvironment(module)
+	if err := loadPrelude(env, noPrelude); err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return name, nil, exitError
+	}
+
+	benchmarks = []evaluator.TestCase{}
+	for builtinName, builtin := range evaluator.BenchBuiltins(func(bm evaluator.TestCase) { benchmarks = append(benchmarks, bm) }) {
+		env.SetConst(builtinName, builtin)
+	}
+
+	opts := s.options()
+	opts.Modules = modules
+	result := evaluator.EvalWithOptions(context.Background(), program, object.NewEnclosedEnvironment(env), opts)
+	if err, ok := result.(*object.Error); ok {
+		s.printRuntimeError(name, err)
+		return name, nil, exitError
+	}
+	return name, benchmarks, exitOK
+}
+
+// The output of the benchmarks is thrown away, only the first run which
+// counts the nodes can fail, the function does the same every time
+func runBenchmark(bm evaluator.TestCase, benchTime time.Duration, opts evaluator.Options) (benchResult, *object.Error) {
+	ctx := context.Background()
+	var nodes atomic.Int64
+	counting := opts
+	counting.BeforeEval = func(ast.Node, *object.Environment) { nodes.Add(1) }
+	if err, ok := evaluator.ApplyWithOptions(ctx, bm.Fn, nil, counting).(*object.Error); ok {
+		return benchResult{}, err
+	}
+
+	runs := 1
+	for {
+		start := time.Now()
+		for i := 0; i < runs; i++ {
+			evaluator.ApplyWithOptions(ctx, bm.Fn, nil, opts)
+		}
+		elapsed := time.Since(start)
+		if elapsed >= benchTime || runs >= 1e9 {
+			return benchResult{
+				Name:       bm.Name,
+				Runs:       runs,
+				NsPerOp:    float64(elapsed.Nanoseconds()) / float64(runs),
+				NodesPerOp: nodes.Load(),
+			}, nil
+		}
+		runs = nextRuns(runs, elapsed, benchTime)
+	}
+}
+
+// Aims a bit past benchTime so the next round is most likely the last,
+// but grows at most 100 times in case the last round was too fast to measure
+func nextRuns(runs int, elapsed, benchTime time.Duration) int {
+	next := runs * 100
+	if elapsed > 0 {
+		next = int(float64(runs) * float64(benchTime) / float64(elapsed) * 1.2)
+	}
+	next = min(next, runs*100, 1e9)
+	return max(next, runs+1)
+}
+
+func readBaseline(path string) (map[string]benchResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the baseline: %w", err)
+	}
+	results := []benchResult{}
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("%s is not a baseline written by -save: %w", path, err)
+	}
+
+	baseline := map[string]benchResult{}
+	for _, result := range results {
+		baseline[result.Name] = result
+	}
+	return baseline, nil
+}
+
+// +12.5% for slower or more, -3.0% for faster or less
+func change(before, after float64) string {
+	if before == 0 {
+		return "~"
+	}
+	return fmt.Sprintf("%+.1f%%", (after-before)/before*100)
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestBench(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "bench.monkey")
+	source := `bench("add", fn() { 1 + 2 });
+bench("sum", fn() { let s = 0; for (i in 0..10) { s = s + i }; s });
+`
+	if err := os.WriteFile(script, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	baseline := filepath.Join(dir, "baseline.json")
+
+	stdout, stderr, code := runMain("", "bench", "-time", "1ms", "-save", baseline, script)
+	if code != 0 {
+		t.Fatalf("expected exit 0, got=%d: %s", code, stderr)
+	}
+	// the body, the statement, the infix expression and both integers
+	if !regexp.MustCompile(`(?m)^add +\d+ +\d+ +5\n`).MatchString(stdout) {
+		t.Errorf("expected 5 nodes/op for add, got=%q", stdout)
+	}
+
+	data, err := os.ReadFile(baseline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []benchResult{}
+	if err := json.Unmarshal(data, &results); err != nil || len(results) != 2 || results[1].Name != "sum" || results[1].Runs == 0 {
+		t.Fatalf("wrong baseline %s: %v", data, err)
+	}
+
+	stdout, _, code = runMain("", "bench", "-time", "1ms", "-run", "sum", "-compare", baseline, script)
+	if code != 0 || strings.Contains(stdout, "add") {
+		t.Errorf("expected only sum to run, got=%q and %d", stdout, code)
+	}
+	if !regexp.MustCompile(`(?m)^sum .*%  +\+0\.0%\n`).MatchString(stdout) {
+		t.Errorf("expected the same node count as the baseline, got=%q", stdout)
+	}
+
+	_, stderr, code = runMain(`bench("bad", fn() { 1 + true })`, "bench", "-time", "1ms", "-")
+	if code != 1 || !strings.Contains(stderr, "stdin:1:23: type mismatch: INTEGER + BOOLEAN") {
+		t.Errorf("expected the error of the benchmark, got=%q and %d", stderr, code)
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/lint"
+	"monkey/object"
+	"monkey/parser"
+)
+
+// monkey check parses the files without running them and prints every
+// error as path:line:column: message, the exit code is 1 when there was one
+// With -resolve names which are bound nowhere are errors too
+func (s *streams) check(args []string) int {
+	flags := s.flagSet("check")
+	resolve := flags.Bool("resolve", false, "also report names which are not defined")
+	noPrelude := flags.Bool("no-prelude", false, "with -resolve, the names of the prelude are not defined")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	var defined func(name string) bool
+	if *resolve {
+		if defined, err = definedNames(*noPrelude); err != nil {
+			fmt.Fprintln(s.stderr, err)
+			return exitError
+		}
+	}
+
+	files := []string{}
+	for _, path := range paths {
+		if path == "-" {
+			files = append(files, path)
+			continue
+		}
+		found, err := monkeyFiles([]string{path})
+		if err != nil {
+			fmt.Fprintln(s.stderr, err)
+			return exitError
+		}
+		files = append(files, found...)
+	}
+
+	code := exitOK
+	for _, path := range files {
+		name, source, ok := s.readSource(path)
+		if !ok {
+			code = exitError
+			continue
+		}
+
+		p := parser.New(lexer.New(source))
+		program := p.ParseProgram()
+		for _, err := range p.Diagnostics() {
+			fmt.Fprintf(s.stdout, "%s:%s\n", name, err)
+			code = exitError
+		}
+		if len(p.Errors()) != 0 || defined == nil {
+			continue
+		}
+		for _, d := range lint.Undefined(program, defined) {
+			fmt.Fprintf(s.stdout, "%s:%s: %s\n", name, d.Pos, d.Message)
+			code = exitError
+		}
+	}
+	return code
+}
+
+// What a script can use without defining it: the builtins, ARGV and
+// the prelude
+func definedNames(noPrelude bool) (func(name string) bool, error) {
+	names := map[string]bool{"ARGV": true}
+	for _, name := range object.DefaultBuiltins.Names() {
+		names[name] = true
+	}
+	for _, name := range evaluator.SystemBuiltinNames() {
+		names[name] = true
+	}
+
+	env := object.NewEnvironment()
+	if err := loadPrelude(env, noPrelude); err != nil {
+		return nil, err
+	}
+	for _, name := range env.Names() {
+		names[name] = true
+	}
+
+	return func(name string) bool { return names[name] }, nil
+}
@@ -0,0 +1,31 @@
+package cli
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	good := writeScript(t, "good.monkey", "let f = fn(x) { x + 1 };\nputs(map([1], f))")
+	bad := writeScript(t, "bad.monkey", "let x = 1;\nlet y = (x;\nlet z = ;")
+
+	stdout, _, code := runMain("", "check", good)
+	if stdout != "" || code != 0 {
+		t.Errorf("monkey check on a good file: expected no output and exit 0, got=%q and %d", stdout, code)
+	}
+
+	stdout, _, code = runMain("", "check", good, bad)
+	expected := bad + ":2:11: expected next token to be ), got ; instead\n" +
+		bad + ":3:9: no prefix parse function for ; found\n"
+	if stdout != expected || code != 1 {
+		t.Errorf("monkey check: expected %q and exit 1, got=%q and %d", expected, stdout, code)
+	}
+
+	stdout, _, code = runMain("puts(nope)", "check", "-resolve")
+	if stdout != "stdin:1:6: undefined: nope\n" || code != 1 {
+		t.Errorf("monkey check -resolve: expected an undefined name and exit 1, got=%q and %d", stdout, code)
+	}
+
+	// map is only defined by the prelude
+	stdout, _, _ = runMain("map([], puts)", "check", "-resolve", "-no-prelude")
+	if stdout != "stdin:1:1: undefined: map\n" {
+		t.Errorf("monkey check -resolve -no-prelude: expected map to be undefined, got=%q", stdout)
+	}
+}
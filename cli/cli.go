@@ -0,0 +1,221 @@
+// The monkey command: without arguments it starts the REPL, everything
+// else is a subcommand like run
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/config"
+	"monkey/evaluator"
+	"monkey/object"
+	"os"
+	"strings"
+)
+
+// Where a command reads and writes, the real ones in main and
+// strings in the tests
+type streams struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	// The monkey.toml of the project, nil without one
+	config *config.Config
+}
+
+type command struct {
+	// e.g. "run [flags] <script> [args...]"
+	usage string
+	help  string
+	run   func(s *streams, args []string) int
+}
+
+// Filled in init, like the commands of the REPL
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"help": {
+			usage: "help [command]",
+			help:  "show the usage of monkey or a command",
+			run:   (*streams).help,
+		},
+		"version": {
+			usage: "version",
+			help:  "print the version",
+			run:   (*streams).version,
+		},
+		"run": {
+			usage: "run [flags] <script>",
+			help:  "run a script file or a program compiled by monkey compile",
+			run:   (*streams).run,
+		},
+		"compile": {
+			usage: "compile [-o file] [-no-prelude] [-O] <script>",
+			help:  "compile a script to bytecode which monkey run can run",
+			run:   (*streams).compile,
+		},
+		"disasm": {
+			usage: "disasm [-prelude] [-O] [script]",
+			help:  "print the bytecode of a script or a compiled program",
+			run:   (*streams).disasm,
+		},
+		"fmt": {
+			usage: "fmt [-w] [-d] [paths...]",
+			help:  "format files in the canonical style",
+			run:   (*streams).formatFiles,
+		},
+		"lint": {
+			usage: "lint [-json] [paths...]",
+			help:  "report likely mistakes like unused variables",
+			run:   (*streams).lint,
+		},
+		"ast": {
+			usage: "ast [-format=sexpr|json|dot] [script]",
+			help:  "print the syntax tree of a script",
+			run:   (*streams).ast,
+		},
+		"tokens": {
+			usage: "tokens [-comments] [script]",
+			help:  "print the tokens of a script with their positions",
+			run:   (*streams).tokens,
+		},
+		"check": {
+			usage: "check [-resolve] [paths...]",
+			help:  "report the errors of scripts without running them",
+			run:   (*streams).check,
+		},
+		"test": {
+			usage: "test [-v] [-run regexp] [paths...]",
+			help:  "run the tests of the *_test.monkey files",
+			run:   (*streams).test,
+		},
+		"bench": {
+			usage: "bench [-time d] [-run regexp] [-save file] [-compare file] <script>",
+			help:  "time the functions a script registers with bench(name, fn)",
+			run:   (*streams).bench,
+		},
+		"translate": {
+			usage: "translate [-o file] [-no-prelude] [-O] <script>",
+			help:  "translate a script or compiled program to Go, experimental, go build makes it a binary",
+			run:   (*streams).translate,
+		},
+		"doc": {
+			usage: "doc [-format=markdown|html] [-builtins] [paths...]",
+			help:  "print the documentation of the functions of scripts",
+			run:   (*streams).doc,
+		},
+	}
+}
+
+// Runs the monkey command with the arguments after the program name and
+// returns the exit code
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	s := &streams{stdin: stdin, stdout: stdout, stderr: stderr}
+	cfg, err := findConfig()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitUsage
+	}
+	s.config = cfg
+
+	if len(args) > 0 {
+		if cmd, ok := commands[args[0]]; ok {
+			return cmd.run(s, args[1:])
+		}
+		// monkey script.monkey is short for monkey run script.monkey
+		if !strings.HasPrefix(args[0], "-") || args[0] == "-" {
+			return s.run(args)
+		}
+	}
+
+	return s.repl(args)
+}
+
+// MONKEY_CONFIG names the configuration file, otherwise the first one
+// from the working directory up is used. MONKEY_CONFIG= turns it off
+func findConfig() (*config.Config, error) {
+	path, ok := os.LookupEnv("MONKEY_CONFIG")
+	if !ok {
+		var err error
+		if path, err = config.Find("."); err != nil {
+			return nil, err
+		}
+	}
+	if path == "" {
+		return nil, nil
+	}
+	return config.Load(path)
+}
+
+// The options of every evaluation, with puts writing to stdout
+func (s *streams) options() evaluator.Options {
+	return s.withConfig(evaluator.Options{Builtins: evaluator.BuiltinsWithOutput(nil, s.stdout)})
+}
+
+// Adds the limits, sandbox and module path of the configuration file to
+// opts, MONKEY_PATH comes after the module path of the file
+func (s *streams) withConfig(opts evaluator.Options) evaluator.Options {
+	opts = s.config.Options(opts)
+	opts.ModulePath = append(opts.ModulePath, evaluator.EnvModulePath()...)
+	return opts
+}
+
+// Reports whether the flag was given, even with an empty value
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Parses the flags even when they come after the arguments, e.g.
+// monkey ast script.monkey --format=json, and returns the arguments
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// Reads the file at path, - is stdin. The name is what errors should
+// start with
+func (s *streams) readSource(path string) (name, source string, ok bool) {
+	if path == "-" {
+		input, err := io.ReadAll(s.stdin)
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not read stdin: %s\n", err)
+			return "", "", false
+		}
+		return "stdin", string(input), true
+	}
+
+	input, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.stderr, "could not read the file: %s\n", err)
+		return "", "", false
+	}
+	return path, string(input), true
+}
+
+// Evaluates the prelude into env, unless noPrelude is set
+func loadPrelude(env *object.Environment, noPrelude bool) error {
+	if noPrelude {
+		return nil
+	}
+	if err := evaluator.LoadPrelude(env); err != nil {
+		return fmt.Errorf("could not load prelude: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// monkey compile writes the bytecode of a script to a .mbc file, monkey
+// run runs it with the VM without parsing the script again
+func (s *streams) compile(args []string) int {
+	flags := s.flagSet("compile")
+	output := flags.String("o", "", "the file to write, the script's name with .mbc by default")
+	noPrelude := flags.Bool("no-prelude", false, "do not compile the standard library written in Monkey into the program")
+	optimize := flags.Bool("O", false, "run the peephole optimizer over the bytecode")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) != 1 {
+		fmt.Fprintln(s.stderr, "usage: monkey "+commands["compile"].usage)
+		return exitUsage
+	}
+
+	name, source, ok := s.readSource(paths[0])
+	if !ok {
+		return exitError
+	}
+	out := *output
+	if out == "" {
+		if paths[0] == "-" {
+			fmt.Fprintln(s.stderr, "-o is needed to compile stdin")
+			return exitUsage
+		}
+		out = strings.TrimSuffix(paths[0], filepath.Ext(paths[0])) + ".mbc"
+	}
+
+	bytecode, code := s.compileSource(name, source, *noPrelude, *optimize)
+	if bytecode == nil {
+		return code
+	}
+
+	var buf bytes.Buffer
+	if err := compiler.Encode(&buf, bytecode); err != nil {
+		fmt.Fprintf(s.stderr, "%s: %s\n", name, err)
+		return exitError
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		fmt.Fprintf(s.stderr, "could not write the bytecode: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+// Compiles the prelude and then the script into one program, so the
+// program has the same functions as under the evaluator
+func (s *streams) compileSource(name, source string, noPrelude, optimize bool) (*compiler.Bytecode, int) {
+	// the line table keeps the file, errors of the .mbc point into the script
+	p := parser.New(lexer.NewFile(name, source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		s.printParseErrors(name, p.Diagnostics())
+		return nil, exitUsage
+	}
+
+	// the builtins which need a capability are compiled in too, whether
+	// they are allowed is up to the run
+	opts := s.options()
+	comp := compiler.NewWithOptions(compiler.Options{
+		Optimize: optimize,
+		Globals:  []string{"ARGV"},
+		Builtins: evaluator.BuiltinsWithSystem(opts.Builtins, opts),
+	})
+	if !noPrelude {
+		preludes, err := evaluator.PreludePrograms()
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not load prelude: %s\n", err)
+			return nil, exitError
+		}
+		for _, prelude := range preludes {
+			if err := comp.Compile(prelude.Program); err != nil {
+				fmt.Fprintf(s.stderr, "could not compile prelude: %s: %s\n", prelude.File, err)
+				return nil, exitError
+			}
+		}
+	}
+
+	if err := comp.Compile(program); err != nil {
+		if e, ok := err.(*object.Error); ok {
+			s.printRuntimeError(name, e)
+		} else {
+			fmt.Fprintf(s.stderr, "%s: %s\n", name, err)
+		}
+		return nil, exitUsage
+	}
+	return comp.Bytecode(), exitOK
+}
+
+// Runs a program compiled by monkey compile
+func (s *streams) runBytecode(sc script) int {
+	bytecode, err := compiler.Decode(strings.NewReader(sc.source))
+	if err != nil {
+		fmt.Fprintf(s.stderr, "%s: %s\n", sc.path, err)
+		return exitError
+	}
+
+	// the limits and sandbox of the configuration apply like under the
+	// evaluator, the max steps limit the instructions
+	opts := s.options()
+	builtins := evaluator.BuiltinsWithSystem(opts.Builtins, opts)
+	machine := vm.NewWithBuiltins(bytecode, builtins)
+	if sc.register {
+		machine = vm.NewRegisterVM(bytecode, builtins)
+	}
+
+	argv := make([]object.Object, len(sc.args))
+	for i, arg := range sc.args {
+		argv[i] = &object.String{Value: arg}
+	}
+	machine.SetGlobal("ARGV", &object.Array{Elements: argv})
+
+	limits := vm.Options{MaxInstructions: opts.MaxSteps, MaxDepth: opts.MaxDepth, MaxMemory: opts.MaxMemory}
+	if err := machine.RunWithOptions(context.Background(), limits); err != nil {
+		if err, ok := err.(*object.Error); ok {
+			if err.Exit {
+				return err.Code
+			}
+			s.printRuntimeError(sc.path, err)
+			return exitError
+		}
+		fmt.Fprintf(s.stderr, "%s: %s\n", sc.path, err)
+		return exitError
+	}
+	return exitOK
+}
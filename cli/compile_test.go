@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"monkey/code"
+	"monkey/compiler"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		source string
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{"let x = 1;\nputs(x + 1);\nx", nil, "2\n", "", 0},
+		// the prelude is compiled into the program
+		{"puts(map([1, 2], fn(x) { x * 2 }))", nil, "[2, 4]\n", "", 0},
+		// its functions loop instead of recursing, which would run out of frames
+		{"let a = [];\nfor (i in 0..2000) { a = push(a, i) }\nputs(sum(a), len(map(a, fn(x) { x })), len(repeat(\"a\", 5000)))",
+			nil, "1999000\n2000\n5000\n", "", 0},
+		{"puts(ARGV)", []string{"a", "b"}, "[a, b]\n", "", 0},
+		{"puts(1); exit(3); puts(2)", nil, "1\n", "", 3},
+		{"puts(1);\n1 + true", nil, "1\n", ":2:3: type mismatch: INTEGER + BOOLEAN\n", 1},
+	}
+
+	for _, tt := range tests {
+		path := writeScript(t, "script.monkey", tt.source)
+		if _, stderr, code := runMain("", "compile", path); code != 0 {
+			t.Fatalf("monkey compile %s: expected exit 0, got=%d and %q", path, code, stderr)
+		}
+
+		compiled := strings.TrimSuffix(path, ".monkey") + ".mbc"
+		for _, args := range [][]string{{"run", compiled}, {compiled}, {"run", "-register", compiled}} {
+			args = append(args, tt.args...)
+			stdout, stderr, code := runMain("", args...)
+			if stdout != tt.stdout || code != tt.code {
+				t.Errorf("monkey %q: expected %q and exit %d, got=%q and %d", args, tt.stdout, tt.code, stdout, code)
+			}
+			// errors point into the script the program was compiled from
+			if (tt.stderr == "" && stderr != "") || (tt.stderr != "" && !strings.HasPrefix(stderr, path+tt.stderr)) {
+				t.Errorf("monkey %q: expected error %q, got=%q", args, tt.stderr, stderr)
+			}
+		}
+	}
+}
+
+func TestCompileOutput(t *testing.T) {
+	path := writeScript(t, "script.monkey", "puts(len([1, 2]))")
+	out := filepath.Join(t.TempDir(), "out.bin")
+
+	if _, stderr, code := runMain("", "compile", "-o", out, "-no-prelude", path); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+	if stdout, _, code := runMain("", "run", out); stdout != "2\n" || code != 0 {
+		t.Errorf("expected 2 and exit 0, got=%q and %d", stdout, code)
+	}
+
+	// from stdin it needs -o
+	if _, stderr, code := runMain("1", "compile", "-"); code != 2 || !strings.Contains(stderr, "-o is needed") {
+		t.Errorf("expected an error for stdin without -o, got=%q and %d", stderr, code)
+	}
+	if _, _, code := runMain("1", "compile", "-o", out, "-"); code != 0 {
+		t.Errorf("expected exit 0 for stdin with -o, got=%d", code)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		stderr string
+	}{
+		{"let x = ;", ":1:9: no prefix parse function for ; found\n"},
+		{"const c = 1; c = 2", ":1:16: cannot reassign const c\n"},
+		{"let f = fn() {\n  nope\n};", ":2:3: undefined variable nope\n"},
+		{"fn*() { yield 1 }", ":1:1: generator functions are not supported by the VM\n"},
+		{"let x = 1;\nlet g = fn*() { yield x };", ":2:9: generator functions are not supported by the VM\n"},
+	}
+
+	for _, tt := range tests {
+		path := writeScript(t, "script.monkey", tt.source)
+		_, stderr, code := runMain("", "compile", path)
+		if code != 2 || !strings.Contains(stderr, path+tt.stderr) {
+			t.Errorf("monkey compile %q: expected %q and exit 2, got=%q and %d", tt.source, tt.stderr, stderr, code)
+		}
+		if _, err := os.Stat(strings.TrimSuffix(path, ".monkey") + ".mbc"); err == nil {
+			t.Errorf("monkey compile %q: expected no output file", tt.source)
+		}
+	}
+
+	// a compiled program of another version is refused
+	compiled := writeScript(t, "old.mbc", "MBC\x00\x09")
+	_, stderr, code := runMain("", "run", compiled)
+	if code != 1 || !strings.Contains(stderr, "compiled for bytecode version 9") {
+		t.Errorf("expected a version error, got=%q and %d", stderr, code)
+	}
+}
+
+// A program which would crash the VM isn't run
+func TestInvalidBytecode(t *testing.T) {
+	data := append([]byte(compiler.Magic), compiler.Version, 1, byte(code.OpPop), 0, 0, 0, 0, 0)
+	path := writeScript(t, "broken.mbc", string(data))
+
+	expected := "invalid bytecode in the main program: OpPop at 0 takes 1 values from a stack of 0"
+	for _, args := range [][]string{{"run", path}, {"run", "-register", path}} {
+		if _, stderr, exit := runMain("", args...); exit != 1 || !strings.Contains(stderr, expected) {
+			t.Errorf("monkey %q: expected %q and exit 1, got=%q and %d", args, expected, stderr, exit)
+		}
+	}
+}
+
+func TestCompiledMaxSteps(t *testing.T) {
+	t.Setenv("MONKEY_CONFIG", writeScript(t, "monkey.toml", "[limits]\nmax_steps = 1000\n"))
+
+	path := writeScript(t, "loop.monkey", "for (x in 0..9223372036854775807) { x }")
+	if _, stderr, code := runMain("", "compile", "-no-prelude", path); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+
+	_, stderr, code := runMain("", "run", strings.TrimSuffix(path, ".monkey")+".mbc")
+	if code != 1 || !strings.Contains(stderr, "instruction budget exceeded: more than 1000 instructions") {
+		t.Errorf("expected the budget of the configuration, got=%q and %d", stderr, code)
+	}
+}
+
+func TestCompiledStackTrace(t *testing.T) {
+	path := writeScript(t, "trace.monkey", "let f = fn(x) {\n  x + true\n};\nf(1)")
+	if _, stderr, code := runMain("", "compile", "-no-prelude", path); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+
+	// the positions are the ones of the script, not of the .mbc
+	compiled := strings.TrimSuffix(path, ".monkey") + ".mbc"
+	expected := path + ":2:5: type mismatch: INTEGER + BOOLEAN\n" +
+		"  at f (" + path + ":2:5)\n" +
+		"  at <main> (" + path + ":4:2)\n"
+	for _, args := range [][]string{{"run", compiled}, {"run", "-register", compiled}} {
+		if _, stderr, code := runMain("", args...); code != 1 || stderr != expected {
+			t.Errorf("monkey %q: expected %q and exit 1, got=%q and %d", args, expected, stderr, code)
+		}
+	}
+}
+
+func TestCompiledSystemBuiltinsAndLimits(t *testing.T) {
+	data := writeScript(t, "data.txt", "hello")
+	path := writeScript(t, "read.monkey", `puts(readFile("`+data+`"))`)
+	if _, stderr, code := runMain("", "compile", "-no-prelude", path); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+	compiled := strings.TrimSuffix(path, ".monkey") + ".mbc"
+	for _, args := range [][]string{{"run", compiled}, {"run", "-register", compiled}} {
+		if stdout, stderr, code := runMain("", args...); code != 0 || stdout != "hello\n" {
+			t.Errorf("monkey %q: expected %q and exit 0, got=%q, %q and %d", args, "hello\n", stdout, stderr, code)
+		}
+	}
+
+	deep := writeScript(t, "deep.monkey", "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100)")
+	if _, stderr, code := runMain("", "compile", "-no-prelude", deep); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+	big := writeScript(t, "big.monkey", `let s = ""; for (i in 0..100000) { s = s + "abc" }`)
+	if _, stderr, code := runMain("", "compile", "-no-prelude", big); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+
+	t.Setenv("MONKEY_CONFIG", writeScript(t, "monkey.toml", "[limits]\nmax_depth = 10\nmax_memory = 100000\n\n[sandbox]\ndisable = [\"filesystem\"]\n"))
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{compiled, "builtin readFile is disabled: no filesystem access"},
+		{strings.TrimSuffix(deep, ".monkey") + ".mbc", "call depth exceeded: more than 10 nested calls"},
+		{strings.TrimSuffix(big, ".monkey") + ".mbc", "memory limit exceeded: more than 100000 bytes allocated"},
+	}
+	for _, tt := range tests {
+		if _, stderr, code := runMain("", "run", tt.path); code != 1 || !strings.Contains(stderr, tt.expected) {
+			t.Errorf("%s: expected %q and exit 1, got=%q and %d", tt.path, tt.expected, stderr, code)
+		}
+	}
+}
+
+func TestCompiledPreludeErrorAndRecursion(t *testing.T) {
+	path := writeScript(t, "sum.monkey", "let xs = [1, \"a\"];\nsum(xs)")
+	if _, stderr, code := runMain("", "compile", path); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+	compiled := strings.TrimSuffix(path, ".monkey") + ".mbc"
+	_, stderr, code := runMain("", "run", compiled)
+	if code != 1 || !strings.HasPrefix(stderr, "<prelude>/list.monkey:") ||
+		!strings.HasSuffix(stderr, "  at <main> ("+path+":2:4)\n") {
+		t.Errorf("expected the error in the prelude's file and exit 1, got=%q and %d", stderr, code)
+	}
+
+	path = writeScript(t, "deep.monkey", "let f = fn(n) { if (n == 0) { n + true } else { f(n - 1) } };\nf(500)")
+	if _, stderr, code := runMain("", "compile", "-no-prelude", path); code != 0 {
+		t.Fatalf("expected exit 0, got=%d and %q", code, stderr)
+	}
+	compiled = strings.TrimSuffix(path, ".monkey") + ".mbc"
+	expected := path + ":1:33: type mismatch: INTEGER + BOOLEAN\n" +
+		"  at f (" + path + ":1:33)\n" +
+		"  at f (" + path + ":1:50)\n" +
+		"  ... 499 more\n" +
+		"  at <main> (" + path + ":2:2)\n"
+	if _, stderr, code := runMain("", "run", compiled); code != 1 || stderr != expected {
+		t.Errorf("expected %q and exit 1, got=%q and %d", expected, stderr, code)
+	}
+}
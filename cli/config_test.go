@@ -0,0 +1,28 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig(t *testing.T) {
+	path := writeScript(t, "monkey.toml", "[limits]\nmax_depth = 5\n\n[sandbox]\ndisable = [\"filesystem\"]\n")
+	t.Setenv("MONKEY_CONFIG", path)
+
+	script := writeScript(t, "deep.monkey", "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } };\nputs(f(3));\nf(10)")
+	stdout, stderr, code := runMain("", "run", "-no-prelude", script)
+	if stdout != "0\n" || code != 1 || !strings.Contains(stderr, "call depth exceeded: more than 5 nested calls") {
+		t.Errorf("expected the depth limit of the file, got=%q, %q and %d", stdout, stderr, code)
+	}
+
+	_, stderr, code = runMain("", "run", "-no-prelude", writeScript(t, "io.monkey", `readFile("x")`))
+	if code != 1 || !strings.Contains(stderr, "filesystem") {
+		t.Errorf("expected the filesystem to be disabled, got=%q and %d", stderr, code)
+	}
+
+	t.Setenv("MONKEY_CONFIG", writeScript(t, ".monkeyconfig", "[limits]\nmax_steps = lots\n"))
+	_, stderr, code = runMain("", "run", script)
+	if code != 2 || !strings.Contains(stderr, ".monkeyconfig:2: max_steps: invalid value lots") {
+		t.Errorf("expected the error of the configuration, got=%q and %d", stderr, code)
+	}
+}
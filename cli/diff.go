@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines of context around the changes of a hunk
+const diffContext = 3
+
+// One line of the edit from a to b: ' ' is in both, '-' only in a and
+// '+' only in b
+type edit struct {
+	op   byte
+	line string
+}
+
+// Compares a and b line by line in the format of diff -u, the result is
+// empty when they are the same
+func unifiedDiff(nameA, nameB, a, b string) string {
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	for start := 0; start < len(edits); {
+		// the next change and how far its hunk goes
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		from := max(start-diffContext, 0)
+		end := start
+		for unchanged := 0; end < len(edits) && unchanged <= 2*diffContext; end++ {
+			if edits[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		// trailing context beyond diffContext belongs to no hunk
+		for end > start && edits[end-1].op == ' ' {
+			end--
+		}
+		end = min(end+diffContext, len(edits))
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		writeHunk(&out, edits, from, end)
+		start = end
+	}
+	return out.String()
+}
+
+// @@ -1,4 +1,5 @@ and the lines of edits[from:end]
+func writeHunk(out *strings.Builder, edits []edit, from, end int) {
+	lineA, lineB := 1, 1
+	for _, e := range edits[:from] {
+		if e.op != '+' {
+			lineA++
+		}
+		if e.op != '-' {
+			lineB++
+		}
+	}
+
+	countA, countB := 0, 0
+	for _, e := range edits[from:end] {
+		if e.op != '+' {
+			countA++
+		}
+		if e.op != '-' {
+			countB++
+		}
+	}
+	// an empty range starts at the line in front of it
+	if countA == 0 {
+		lineA--
+	}
+	if countB == 0 {
+		lineB--
+	}
+
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", lineA, countA, lineB, countB)
+	for _, e := range edits[from:end] {
+		out.WriteByte(e.op)
+		out.WriteString(e.line)
+		out.WriteByte('\n')
+	}
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// The longest common subsequence of the lines is kept, everything else is
+// removed from a or added from b
+func diffLines(a, b []string) []edit {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := []edit{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	return edits
+}
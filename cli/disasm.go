@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"monkey/compiler"
+	"strings"
+)
+
+// monkey disasm prints the bytecode of a script or of a .mbc file, the
+// prelude is left out of scripts unless -prelude is given
+func (s *streams) disasm(args []string) int {
+	flags := s.flagSet("disasm")
+	prelude := flags.Bool("prelude", false, "compile the standard library written in Monkey into the listing")
+	optimize := flags.Bool("O", false, "list the bytecode after the peephole optimizer ran over it")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) > 1 {
+		fmt.Fprintln(s.stderr, "usage: monkey "+commands["disasm"].usage)
+		return exitUsage
+	}
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+
+	name, source, ok := s.readSource(paths[0])
+	if !ok {
+		return exitError
+	}
+
+	var bytecode *compiler.Bytecode
+	if compiler.IsBytecode([]byte(source)) {
+		if bytecode, err = compiler.Decode(strings.NewReader(source)); err != nil {
+			fmt.Fprintf(s.stderr, "%s: %s\n", name, err)
+			return exitError
+		}
+	} else {
+		var code int
+		if bytecode, code = s.compileSource(name, source, !*prelude, *optimize); bytecode == nil {
+			return code
+		}
+	}
+
+	if err := compiler.Disassemble(s.stdout, bytecode); err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisasm(t *testing.T) {
+	path := writeScript(t, "script.monkey", "let x = 1;\nputs(x)")
+	expected := `main (0 locals):
+  0000 OpConstant 0           ; 1
+  0003 OpSetGlobal 0          ; x
+  0006 OpGetBuiltin 0         ; puts
+  0008 OpGetGlobal 0          ; x
+  0011 OpCall 1
+  0013 OpPop
+constants:
+  0 1
+`
+
+	stdout, stderr, code := runMain("", "disasm", path)
+	if stdout != expected || code != 0 {
+		t.Errorf("expected the listing and exit 0, got=%q, %q and %d", stdout, stderr, code)
+	}
+
+	// the same for stdin
+	if stdout, _, _ := runMain("let x = 1;\nputs(x)", "disasm"); stdout != expected {
+		t.Errorf("expected the listing of stdin, got=%q", stdout)
+	}
+
+	// and for the compiled program
+	if _, stderr, code := runMain("", "compile", "-no-prelude", path); code != 0 {
+		t.Fatalf("monkey compile: expected exit 0, got=%d and %q", code, stderr)
+	}
+	compiled := strings.TrimSuffix(path, ".monkey") + ".mbc"
+	if stdout, _, _ := runMain("", "disasm", compiled); stdout != expected {
+		t.Errorf("expected the listing of the compiled program, got=%q", stdout)
+	}
+
+	// the prelude's functions come first
+	stdout, _, _ = runMain("", "disasm", "-prelude", path)
+	if !strings.Contains(stdout, "fn map") {
+		t.Errorf("expected the prelude in the listing, got=%q", stdout)
+	}
+
+	// -O lists the optimized program
+	stdout, _, _ = runMain("1; 2", "disasm", "-O")
+	if !strings.HasPrefix(stdout, "main (0 locals):\n  0000 OpConstant 1           ; 2\n  0003 OpPop\n") {
+		t.Errorf("expected the optimized listing, got=%q", stdout)
+	}
+
+	_, stderr, code = runMain("let x = ;", "disasm")
+	if code != 2 || !strings.Contains(stderr, "stdin:1:9: no prefix parse function for ; found") {
+		t.Errorf("expected a parser error and exit 2, got=%q and %d", stderr, code)
+	}
+}
@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"fmt"
+	"monkey/doc"
+	"monkey/lexer"
+	"monkey/parser"
+	"path/filepath"
+	"strings"
+)
+
+// monkey doc prints the documentation of the functions of a script or of
+// every file in a directory, the comments above their lets. Test files
+// are left out
+func (s *streams) doc(args []string) int {
+	flags := s.flagSet("doc")
+	format := flags.String("format", "markdown", "the output format: markdown or html")
+	builtins := flags.Bool("builtins", false, "document the builtins as well")
+	title := flags.String("title", "", "the heading of the page, the name of the path by default")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if *format != "markdown" && *format != "html" {
+		fmt.Fprintf(s.stderr, "unknown format %q, use markdown or html\n", *format)
+		return exitUsage
+	}
+	if len(paths) == 0 && !*builtins {
+		paths = []string{"."}
+	}
+
+	page := doc.Page{Title: *title}
+	if page.Title == "" {
+		page.Title = "Documentation"
+		if len(paths) == 1 {
+			if abs, err := filepath.Abs(paths[0]); err == nil {
+				page.Title = strings.TrimSuffix(filepath.Base(abs), filepath.Ext(abs))
+			}
+		}
+	}
+
+	files, err := monkeyFiles(paths)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+	for _, path := range files {
+		if strings.HasSuffix(path, testSuffix) {
+			continue
+		}
+		name, source, ok := s.readSource(path)
+		if !ok {
+			return exitError
+		}
+		p := parser.New(lexer.New(source))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			s.printParseErrors(name, p.Diagnostics())
+			return exitUsage
+		}
+		page.Files = append(page.Files, doc.Extract(name, program))
+	}
+	if *builtins {
+		page.Builtins = doc.Builtins()
+	}
+
+	if *format == "html" {
+		out, err := page.HTML()
+		if err != nil {
+			fmt.Fprintln(s.stderr, err)
+			return exitError
+		}
+		fmt.Fprint(s.stdout, out)
+		return exitOK
+	}
+	fmt.Fprint(s.stdout, page.Markdown())
+	return exitOK
+}
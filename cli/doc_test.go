@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDoc(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "strings")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"pad.monkey":      "// Pads s with spaces up to n characters\nlet pad = fn(s, n) { s };\n",
+		"pad_test.monkey": "// Not documented\nlet helper = fn() {};\n",
+	}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, _, code := runMain("", "doc", dir)
+	expected := "# strings\n\n## " + filepath.Join(dir, "pad.monkey") + "\n\n### `pad(s, n)`\n\nPads s with spaces up to n characters\n"
+	if stdout != expected || code != 0 {
+		t.Errorf("expected=%q, got=%q and %d", expected, stdout, code)
+	}
+
+	stdout, _, code = runMain("", "doc", "-format=html", "-title", "Strings", dir)
+	if code != 0 || !strings.Contains(stdout, "<h1>Strings</h1>") || !strings.Contains(stdout, "<code>pad(s, n)</code>") {
+		t.Errorf("wrong html page, got=%q and %d", stdout, code)
+	}
+
+	stdout, _, code = runMain("", "doc", "-builtins")
+	if code != 0 || !strings.HasPrefix(stdout, "# Documentation\n\n## Builtins\n") || !strings.Contains(stdout, "### `puts(values...)`") {
+		t.Errorf("expected only the builtins, got=%q and %d", stdout, code)
+	}
+
+	_, stderr, code := runMain("", "doc", "-format=pdf", dir)
+	if code != 2 || !strings.Contains(stderr, `unknown format "pdf"`) {
+		t.Errorf("expected an unknown format error, got=%q and %d", stderr, code)
+	}
+}
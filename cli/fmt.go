@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"monkey/format"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// monkey fmt prints the formatted files, -w writes them back instead and
+// -d only shows what would change. Without -w the exit code is 1 when a
+// file isn't formatted, so it can be used as a check
+func (s *streams) formatFiles(args []string) int {
+	flags := s.flagSet("fmt")
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	diff := flags.Bool("d", false, "print a diff instead of the formatted source")
+	if err := flags.Parse(args); err != nil {
+		return flagsFailed(err)
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(s.stderr, "can't use -w with stdin")
+			return exitUsage
+		}
+		source, err := io.ReadAll(s.stdin)
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not read stdin: %s\n", err)
+			return exitError
+		}
+		return s.formatFile("stdin", string(source), false, *diff)
+	}
+
+	paths, err := monkeyFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+
+	code := exitOK
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not read the file: %s\n", err)
+			code = max(code, exitError)
+			continue
+		}
+		code = max(code, s.formatFile(path, string(source), *write, *diff))
+	}
+	return code
+}
+
+func (s *streams) formatFile(path, source string, write, diff bool) int {
+	formatted, err := format.Source(source)
+	if err != nil {
+		var parseErr *format.ParseError
+		if errors.As(err, &parseErr) {
+			s.printParseErrors(path, parseErr.Errors)
+		}
+		return exitUsage
+	}
+
+	switch {
+	case diff:
+		fmt.Fprint(s.stdout, unifiedDiff(path, path+" (formatted)", source, formatted))
+	case !write:
+		fmt.Fprint(s.stdout, formatted)
+	}
+
+	if formatted == source {
+		return exitOK
+	}
+	if write {
+		if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+			fmt.Fprintf(s.stderr, "could not write the file: %s\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	return exitError
+}
+
+// The files of the paths, directories stand for all .monkey files in them
+func monkeyFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(path, ".monkey") {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFmt(t *testing.T) {
+	path := writeScript(t, "script.monkey", "let x=1\nputs( x )\n")
+	formatted := "let x = 1;\nputs(x);\n"
+
+	stdout, _, code := runMain("", "fmt", path)
+	if stdout != formatted || code != 1 {
+		t.Errorf("monkey fmt: expected %q and exit 1, got=%q and %d", formatted, stdout, code)
+	}
+
+	stdout, _, code = runMain("", "fmt", "-d", path)
+	diff := "--- " + path + "\n+++ " + path + " (formatted)\n@@ -1,2 +1,2 @@\n-let x=1\n-puts( x )\n+let x = 1;\n+puts(x);\n"
+	if stdout != diff || code != 1 {
+		t.Errorf("monkey fmt -d: expected %q and exit 1, got=%q and %d", diff, stdout, code)
+	}
+
+	stdout, _, code = runMain("", "fmt", "-w", path)
+	if source, _ := os.ReadFile(path); string(source) != formatted || stdout != "" || code != 0 {
+		t.Errorf("monkey fmt -w: expected %q in the file and exit 0, got=%q and %d", formatted, source, code)
+	}
+
+	// a formatted file is fine
+	stdout, _, code = runMain("", "fmt", "-d", path)
+	if stdout != "" || code != 0 {
+		t.Errorf("monkey fmt -d on a formatted file: expected no diff and exit 0, got=%q and %d", stdout, code)
+	}
+}
+
+func TestFmtStdin(t *testing.T) {
+	stdout, stderr, code := runMain("1+2", "fmt")
+	if stdout != "1 + 2;\n" || code != 1 {
+		t.Errorf("expected %q and exit 1, got=%q and %d (%s)", "1 + 2;\n", stdout, code, stderr)
+	}
+
+	_, stderr, code = runMain("let = 1", "fmt")
+	if code != 2 || !strings.HasPrefix(stderr, "stdin:1:5: ") {
+		t.Errorf("expected a parser error and exit 2, got=%q and %d", stderr, code)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\nnew\n12\n"
+	expected := "--- a\n+++ b\n" +
+		"@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n" +
+		"@@ -8,5 +9,5 @@\n 8\n 9\n 10\n-11\n+new\n 12\n"
+
+	if diff := unifiedDiff("a", "b", a, b); diff != expected {
+		t.Errorf("wrong diff.\nexpected=%q\ngot=%q", expected, diff)
+	}
+	if diff := unifiedDiff("a", "b", a, a); diff != "" {
+		t.Errorf("expected no diff for the same input, got=%q", diff)
+	}
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"monkey/version"
+	"sort"
+	"strings"
+)
+
+// A FlagSet for the command which prints its usage and help for -h
+func (s *streams) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(s.stderr)
+	flags.Usage = func() {
+		cmd := commands[name]
+		fmt.Fprintf(s.stderr, "usage: monkey %s\n\n%s\n", cmd.usage, cmd.description())
+		if hasFlags(flags) {
+			fmt.Fprintln(s.stderr, "\nflags:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// -h is no mistake, everything else the flag package complains about is
+func flagsFailed(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+func hasFlags(flags *flag.FlagSet) bool {
+	found := false
+	flags.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// The help with a capital letter, the list of commands has it lowercase
+func (c command) description() string {
+	if c.help == "" {
+		return ""
+	}
+	return strings.ToUpper(c.help[:1]) + c.help[1:]
+}
+
+// The usage of the monkey command itself, with its flags and the list of
+// commands
+func (s *streams) usage(flags *flag.FlagSet) {
+	fmt.Fprintln(s.stderr, "usage: monkey [flags] [script [args...]]")
+	fmt.Fprintln(s.stderr, "       monkey <command> [arguments]")
+	fmt.Fprintln(s.stderr, "\nWithout a script it starts the REPL, a script is the same as monkey run <script>")
+
+	fmt.Fprintln(s.stderr, "\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.stderr, "  %-9s %s\n", name, commands[name].help)
+	}
+	fmt.Fprintln(s.stderr, "\nUse monkey help <command> for more about a command.")
+
+	fmt.Fprintln(s.stderr, "\nflags:")
+	flags.PrintDefaults()
+}
+
+// monkey help fmt is the same as monkey fmt -h
+func (s *streams) help(args []string) int {
+	if len(args) == 0 {
+		return s.repl([]string{"-h"})
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok || len(args) > 1 {
+		fmt.Fprintf(s.stderr, "unknown command %q, monkey help lists them\n", args[0])
+		return exitUsage
+	}
+	return cmd.run(s, []string{"-h"})
+}
+
+func (s *streams) version(args []string) int {
+	fmt.Fprintln(s.stdout, version.String())
+	return exitOK
+}
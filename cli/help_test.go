@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"monkey/version"
+	"strings"
+	"testing"
+)
+
+func TestHelp(t *testing.T) {
+	for _, args := range [][]string{{"-h"}, {"--help"}, {"help"}} {
+		_, stderr, code := runMain("", args...)
+		if code != 0 || !strings.HasPrefix(stderr, "usage: monkey [flags]") {
+			t.Errorf("monkey %q: expected the usage and exit 0, got=%q and %d", args, stderr, code)
+		}
+		for name, cmd := range commands {
+			if !strings.Contains(stderr, name+" ") || !strings.Contains(stderr, cmd.help) {
+				t.Errorf("monkey %q: expected %s to be listed, got=%q", args, name, stderr)
+			}
+		}
+	}
+
+	for _, args := range [][]string{{"help", "fmt"}, {"fmt", "-h"}} {
+		_, stderr, code := runMain("", args...)
+		if code != 0 || !strings.HasPrefix(stderr, "usage: monkey fmt [-w] [-d] [paths...]\n\nFormat files") || !strings.Contains(stderr, "-w\t") {
+			t.Errorf("monkey %q: expected the usage of fmt and exit 0, got=%q and %d", args, stderr, code)
+		}
+	}
+
+	_, stderr, code := runMain("", "help", "nope")
+	if code != 2 || !strings.Contains(stderr, `unknown command "nope"`) {
+		t.Errorf("monkey help nope: expected an error and exit 2, got=%q and %d", stderr, code)
+	}
+
+	// a wrong flag is still a mistake
+	if _, _, code := runMain("", "fmt", "-nope"); code != 2 {
+		t.Errorf("monkey fmt -nope: expected exit 2, got=%d", code)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	for _, args := range [][]string{{"--version"}, {"version"}} {
+		stdout, _, code := runMain("", args...)
+		if stdout != version.String()+"\n" || code != 0 {
+			t.Errorf("monkey %q: expected %q and exit 0, got=%q and %d", args, version.String(), stdout, code)
+		}
+	}
+	if !strings.HasPrefix(version.String(), "monkey dev") {
+		t.Errorf("expected a dev version without ldflags, got=%q", version.String())
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/lexer"
+	"monkey/lint"
+	"monkey/parser"
+	"os"
+)
+
+// One diagnostic of monkey lint -json, a line each
+type lintResult struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// monkey lint prints path:line:column: rule: message for every problem,
+// the exit code is 1 when there was one
+func (s *streams) lint(args []string) int {
+	flags := s.flagSet("lint")
+	asJSON := flags.Bool("json", false, "print a JSON object per diagnostic")
+	if err := flags.Parse(args); err != nil {
+		return flagsFailed(err)
+	}
+
+	if flags.NArg() == 0 {
+		source, err := io.ReadAll(s.stdin)
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not read stdin: %s\n", err)
+			return exitError
+		}
+		return s.lintFile("stdin", string(source), *asJSON)
+	}
+
+	paths, err := monkeyFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+
+	code := exitOK
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not read the file: %s\n", err)
+			code = max(code, exitError)
+			continue
+		}
+		code = max(code, s.lintFile(path, string(source), *asJSON))
+	}
+	return code
+}
+
+func (s *streams) lintFile(path, source string, asJSON bool) int {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		s.printParseErrors(path, p.Diagnostics())
+		return exitUsage
+	}
+
+	diagnostics := lint.Check(program)
+	for _, d := range diagnostics {
+		if !asJSON {
+			fmt.Fprintf(s.stdout, "%s:%s\n", path, d)
+			continue
+		}
+		line, _ := json.Marshal(lintResult{File: path, Line: d.Pos.Line, Column: d.Pos.Column, Rule: d.Rule, Message: d.Message})
+		fmt.Fprintf(s.stdout, "%s\n", line)
+	}
+
+	if len(diagnostics) > 0 {
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,24 @@
+package cli
+
+import "testing"
+
+func TestLint(t *testing.T) {
+	path := writeScript(t, "script.monkey", "let f = fn() {\n  let a = 1;\n  2\n};\n")
+
+	stdout, _, code := runMain("", "lint", path)
+	expected := path + ":2:7: unused: a is declared but never used\n"
+	if stdout != expected || code != 1 {
+		t.Errorf("monkey lint: expected %q and exit 1, got=%q and %d", expected, stdout, code)
+	}
+
+	stdout, _, code = runMain("", "lint", "-json", path)
+	expected = `{"file":"` + path + `","line":2,"column":7,"rule":"unused","message":"a is declared but never used"}` + "\n"
+	if stdout != expected || code != 1 {
+		t.Errorf("monkey lint -json: expected %q and exit 1, got=%q and %d", expected, stdout, code)
+	}
+
+	stdout, _, code = runMain("let x = 1; puts(x)", "lint")
+	if stdout != "" || code != 0 {
+		t.Errorf("monkey lint on clean code: expected no output and exit 0, got=%q and %d", stdout, code)
+	}
+}
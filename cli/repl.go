@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/repl"
+	"net"
+	"os"
+	"os/user"
+	"time"
+)
+
+func (s *streams) repl(args []string) int {
+	flags := flag.NewFlagSet("monkey", flag.ContinueOnError)
+	flags.SetOutput(s.stderr)
+	flags.Usage = func() { s.usage(flags) }
+	showVersion := flags.Bool("version", false, "print the version and exit")
+	noPrelude := flags.Bool("no-prelude", false, "do not load the standard library written in Monkey")
+	program := flags.String("e", "", "run this program instead of starting the REPL, e.g. -e 'puts(1 + 2)'")
+	noColor := flags.Bool("no-color", false, "do not highlight the input and results")
+	serve := flags.String("serve", "", "serve sandboxed REPLs on this address (e.g. :4000) instead of reading stdin")
+	logSession := flags.String("log-session", "", "append the inputs and outputs of the session with timestamps to this file")
+	onVM := flags.Bool("vm", false, "compile the inputs of the REPL and run them on the VM, see :engine")
+	if err := flags.Parse(args); err != nil {
+		return flagsFailed(err)
+	}
+	if *showVersion {
+		return s.version(nil)
+	}
+
+	// Errors point into -e:1:5, imports are relative to the working directory
+	if isFlagSet(flags, "e") {
+		return s.runScript(script{path: "-e", source: *program, args: flags.Args()}, *noPrelude)
+	}
+	// A server never reads stdin, which is often /dev/null for one started
+	// by systemd, docker or nohup
+	if *serve != "" {
+		return s.serve(*serve, *noPrelude)
+	}
+	// Piped input is a program, not a conversation
+	if flags.Arg(0) == "-" {
+		return s.runStdin(scriptArgs(flags.Args()[1:]), *noPrelude, false)
+	}
+	if !repl.Interactive(s.stdin) {
+		return s.runStdin(scriptArgs(flags.Args()), *noPrelude, false)
+	}
+
+	if s.config != nil && s.config.REPL.NoPrelude {
+		*noPrelude = true
+	}
+	env := object.NewEnvironment()
+	if err := loadPrelude(env, *noPrelude); err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+
+	user, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+	banner := fmt.Sprintf("Hello %s! This is the Monkey programming language!\n", user.Username) +
+		"Feel free to type in commnads\n"
+
+	cfg := repl.Config{
+		Reader: s.stdin,
+		Writer: s.stdout,
+		Banner: banner,
+		Color:  repl.ColorTerminal(s.stdout),
+		Env:    env,
+		RCFile: repl.DefaultRCFile(),
+	}
+	s.config.ApplyREPL(&cfg)
+	cfg.Options = s.withConfig(cfg.Options)
+	if *noColor {
+		cfg.Color = false
+	}
+	if *onVM {
+		cfg.Engine = repl.VMEngine
+	}
+	// the VM gets the prelude compiled, it can't call the evaluator's functions
+	if !*noPrelude {
+		preludes, err := evaluator.PreludePrograms()
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not load prelude: %s\n", err)
+			return exitError
+		}
+		for _, prelude := range preludes {
+			cfg.VMPrelude = append(cfg.VMPrelude, prelude.Program)
+		}
+	}
+	if *logSession != "" {
+		f, err := os.OpenFile(*logSession, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Fprintf(s.stderr, "could not open the session log: %s\n", err)
+			return exitError
+		}
+		defer f.Close()
+		cfg.Transcript = f
+	}
+
+	repl.New(cfg).Run()
+	return exitOK
+}
+
+// Serves sandboxed REPLs on addr until listening fails
+func (s *streams) serve(addr string, noPrelude bool) int {
+	if s.config != nil && s.config.REPL.NoPrelude {
+		noPrelude = true
+	}
+	env := object.NewEnvironment()
+	if err := loadPrelude(env, noPrelude); err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintf(s.stderr, "could not listen: %s\n", err)
+		return exitError
+	}
+	err = repl.Serve(l, repl.ServerConfig{
+		Env:     env,
+		Options: s.withConfig(evaluator.Options{Disabled: evaluator.AllCapabilities}),
+		Timeout: 5 * time.Second,
+		Banner:  "This is the Monkey programming language!\n",
+	})
+	fmt.Fprintf(s.stderr, "stopped serving: %s\n", err)
+	return exitError
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stdin of a server started by systemd or docker isn't a terminal, it
+// still serves instead of running stdin as a program
+func TestServeWithPipedStdin(t *testing.T) {
+	stdout, stderr, code := runMain("puts(1)", "-serve", "256.0.0.1:1")
+	if code != exitError || !strings.Contains(stderr, "could not listen") || stdout != "" {
+		t.Errorf("expected -serve to listen, got=%q, %q and %d", stdout, stderr, code)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen: %s", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	// serves until the test binary exits
+	go runMain("", "-serve", addr, "-no-prelude")
+
+	var conn net.Conn
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("the server never listened: %s", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || !strings.Contains(banner, "Monkey") {
+		t.Errorf("expected the banner, got=%q and %v", banner, err)
+	}
+}
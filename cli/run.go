@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"path/filepath"
+)
+
+// A program to run and what it's started with
+type script struct {
+	// The path of the file, or -e and stdin, errors point into it
+	path   string
+	source string
+	// Everything after the script on the command line, ARGV in the program
+	args []string
+	// Runs a compiled program on the register VM instead of the stack VM
+	register bool
+	// Where the imports are cached, nil for a cache of the run's own
+	modules *evaluator.Modules
+}
+
+// How the monkey command can end, exit(n) in a program ends with n
+const (
+	exitOK = 0
+	// A runtime error, a missing file, ...
+	exitError = 1
+	// A parser error or wrong usage of the command
+	exitUsage = 2
+)
+
+func (s *streams) run(args []string) int {
+	flags := s.flagSet("run")
+	noPrelude := flags.Bool("no-prelude", false, "do not load the standard library written in Monkey")
+	watch := flags.Bool("watch", false, "run the script again whenever it or a module it imports changes")
+	register := flags.Bool("register", false, "run a compiled program on the register VM")
+	if err := flags.Parse(args); err != nil {
+		return flagsFailed(err)
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(s.stderr, "usage: monkey "+commands["run"].usage)
+		return exitUsage
+	}
+
+	path := flags.Arg(0)
+	if path == "-" {
+		if *watch {
+			fmt.Fprintln(s.stderr, "-watch needs a script file, stdin can't change")
+			return exitUsage
+		}
+		return s.runStdin(scriptArgs(flags.Args()[1:]), *noPrelude, *register)
+	}
+	if *watch {
+		return s.watch(path, scriptArgs(flags.Args()[1:]), *noPrelude, nil)
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.stderr, "could not read the script: %s\n", err)
+		return exitError
+	}
+
+	return s.runScript(script{path: path, source: string(source), args: scriptArgs(flags.Args()[1:]), register: *register}, *noPrelude)
+}
+
+// The arguments after the script, a -- in front of them only separates them
+// from the ones of monkey and isn't part of ARGV, e.g. monkey s.monkey -- -v
+func scriptArgs(args []string) []string {
+	if len(args) > 0 && args[0] == "--" {
+		return args[1:]
+	}
+	return args
+}
+
+// The whole input is read before anything runs, so it's evaluated like
+// a file and not line by line like in the REPL
+func (s *streams) runStdin(args []string, noPrelude, register bool) int {
+	source, err := io.ReadAll(s.stdin)
+	if err != nil {
+		fmt.Fprintf(s.stderr, "could not read stdin: %s\n", err)
+		return exitError
+	}
+	return s.runScript(script{path: "stdin", source: string(source), args: args, register: register}, noPrelude)
+}
+
+// Parses and evaluates the script like the file at its path, so imports
+// are relative to it. Compiled programs run in the VM
+func (s *streams) runScript(sc script, noPrelude bool) int {
+	if compiler.IsBytecode([]byte(sc.source)) {
+		return s.runBytecode(sc)
+	}
+
+	p := parser.New(lexer.New(sc.source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		s.printParseErrors(sc.path, p.Diagnostics())
+		return exitUsage
+	}
+
+	module := &object.Module{Name: sc.path, Path: sc.path}
+	if abs, err := filepath.Abs(sc.path); err == nil {
+		module.Path = abs
+	}
+	env := object.NewModuleEnvironment(module)
+	if err := loadPrelude(env, noPrelude); err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+
+	argv := make([]object.Object, len(sc.args))
+	for i, arg := range sc.args {
+		argv[i] = &object.String{Value: arg}
+	}
+	env.SetConst("ARGV", &object.Array{Elements: argv})
+
+	opts := s.options()
+	opts.Modules = sc.modules
+	result := evaluator.EvalWithOptions(context.Background(), program, object.NewEnclosedEnvironment(env), opts)
+	if err, ok := result.(*object.Error); ok {
+		if err.Exit {
+			return err.Code
+		}
+		s.printRuntimeError(sc.path, err)
+		return exitError
+	}
+	return exitOK
+}
+
+// script.monkey:1:9: no prefix parse function for ; found
+func (s *streams) printParseErrors(path string, errs []parser.Error) {
+	for _, err := range errs {
+		fmt.Fprintf(s.stderr, "%s:%s\n", path, err)
+	}
+}
+
+// script.monkey:3:7: identifier not found: x
+//
+// An error of the VM in a function is followed by the calls it's in, a
+// call repeating itself, like in a deep recursion, is printed only once
+//
+//	script.mbc:2:5: type mismatch: INTEGER + BOOLEAN
+//	  at f (script.mbc:2:5)
+//	  ... 99 more
+//	  at <main> (script.mbc:4:2)
+func (s *streams) printRuntimeError(path string, err *object.Error) {
+	if err.Pos.IsValid() {
+		fmt.Fprintf(s.stderr, "%s: %s\n", where(path, err.Pos), err.Message)
+	} else {
+		fmt.Fprintf(s.stderr, "%s: %s\n", path, err.Message)
+	}
+
+	if len(err.Trace) < 2 {
+		return
+	}
+	for i := 0; i < len(err.Trace); {
+		call := err.Trace[i]
+		if call.Pos.IsValid() {
+			fmt.Fprintf(s.stderr, "  at %s (%s)\n", call.Function, where(path, call.Pos))
+		} else {
+			fmt.Fprintf(s.stderr, "  at %s (%s)\n", call.Function, path)
+		}
+
+		repeats := 0
+		for i++; i < len(err.Trace) && err.Trace[i] == call; i++ {
+			repeats++
+		}
+		if repeats > 0 {
+			fmt.Fprintf(s.stderr, "  ... %d more\n", repeats)
+		}
+	}
+}
+
+// path:line:column, or the file of pos when it's in another one like the
+// prelude
+func where(path string, pos token.Position) string {
+	if pos.File != "" {
+		path = pos.File
+	}
+	return path + ":" + pos.String()
+}
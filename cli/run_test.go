@@ -0,0 +1,203 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs the monkey command like main does and returns what it wrote
+func runMain(stdin string, args ...string) (stdout, stderr string, code int) {
+	var out, errOut strings.Builder
+	code = Main(args, strings.NewReader(stdin), &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+func writeScript(t *testing.T, name, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		source string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{"let x = 1;\nputs(x + 1);\nx", "2\n", "", 0},
+		{"puts(map([1, 2], fn(x) { x * 2 }))", "[2, 4]\n", "", 0},
+		{"let f = fn(a) {\n  a + nope\n};\nf(1)", "", ":2:7: identifier not found: nope\n", 1},
+		{"puts(1);\n1 + true", "1\n", ":2:3: type mismatch: INTEGER + BOOLEAN\n", 1},
+		{"let x = ;", "", ":1:9: no prefix parse function for ; found\n", 2},
+	}
+
+	for _, tt := range tests {
+		path := writeScript(t, "script.monkey", tt.source)
+		for _, args := range [][]string{{"run", path}, {path}} {
+			stdout, stderr, code := runMain("", args...)
+			if stdout != tt.stdout || code != tt.code {
+				t.Errorf("monkey %q: expected %q and exit %d, got=%q and %d", args, tt.stdout, tt.code, stdout, code)
+			}
+			if (tt.stderr == "" && stderr != "") || (tt.stderr != "" && !strings.Contains(stderr, path+tt.stderr)) {
+				t.Errorf("monkey %q: expected error %q, got=%q", args, tt.stderr, stderr)
+			}
+		}
+	}
+}
+
+func TestRunImportsRelativeToTheScript(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "lib.monkey"), []byte("let double = fn(x) { x * 2 };"), 0644)
+	os.WriteFile(filepath.Join(dir, "main.monkey"), []byte(`let lib = import("lib"); puts(lib.double(21))`), 0644)
+
+	stdout, stderr, code := runMain("", filepath.Join(dir, "main.monkey"))
+	if stdout != "42\n" || code != 0 {
+		t.Errorf("wrong result. stdout=%q, stderr=%q, code=%d", stdout, stderr, code)
+	}
+}
+
+func TestRunMissingScript(t *testing.T) {
+	_, stderr, code := runMain("", "run", "nope.monkey")
+	if code == 0 || !strings.Contains(stderr, "could not read the script") {
+		t.Errorf("expected a failure. stderr=%q, code=%d", stderr, code)
+	}
+
+	_, stderr, code = runMain("", "run")
+	if code == 0 || !strings.Contains(stderr, "usage: monkey run") {
+		t.Errorf("expected the usage. stderr=%q, code=%d", stderr, code)
+	}
+}
+
+func TestEvalFlag(t *testing.T) {
+	tests := []struct {
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{[]string{"-e", "puts(1 + 2)"}, "3\n", "", 0},
+		{[]string{"-e", "let xs = [1, 2, 3]; puts(len(xs)); xs"}, "3\n", "", 0},
+		{[]string{"-e", ""}, "", "", 0},
+		{[]string{"-no-prelude", "-e", "map"}, "", "-e:1:1: identifier not found: map\n", 1},
+		{[]string{"-e", "1 +"}, "", "-e:1:4: no prefix parse function for EOF found\n", 2},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := runMain("", tt.args...)
+		if stdout != tt.stdout || stderr != tt.stderr || code != tt.code {
+			t.Errorf("monkey %q: expected %q, %q and exit %d, got=%q, %q and %d", tt.args, tt.stdout, tt.stderr, tt.code, stdout, stderr, code)
+		}
+	}
+}
+
+func TestStdin(t *testing.T) {
+	program := "let f = fn(x) {\n  x * 2\n};\nputs(f(21));\nputs(y)"
+	for _, args := range [][]string{nil, {"-"}, {"run", "-"}} {
+		stdout, stderr, code := runMain(program, args...)
+		if stdout != "42\n" || stderr != "stdin:5:6: identifier not found: y\n" || code != 1 {
+			t.Errorf("monkey %q: got=%q, %q and exit %d", args, stdout, stderr, code)
+		}
+	}
+}
+
+func TestARGV(t *testing.T) {
+	path := writeScript(t, "args.monkey", `puts(len(ARGV)); puts(ARGV)`)
+	tests := []struct {
+		stdin  string
+		args   []string
+		stdout string
+	}{
+		{"", []string{path}, "0\n[]\n"},
+		{"", []string{path, "-v", "two words"}, "2\n[-v, two words]\n"},
+		{"", []string{"run", "-no-prelude", path, "a"}, "1\n[a]\n"},
+		{"", []string{"-e", "puts(ARGV)", "a", "b"}, "[a, b]\n"},
+		{"puts(ARGV)", []string{"-", "x"}, "[x]\n"},
+		{"puts(ARGV)", []string{"run", "-", "y"}, "[y]\n"},
+		// -- only ends the arguments of monkey
+		{"", []string{path, "--", "a", "b"}, "2\n[a, b]\n"},
+		{"", []string{path, "--", "--"}, "1\n[--]\n"},
+		{"", []string{"run", "--", path, "-v"}, "1\n[-v]\n"},
+		{"puts(ARGV)", []string{"-", "--", "z"}, "[z]\n"},
+		{"", []string{path, "a", "--"}, "2\n[a, --]\n"},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := runMain(tt.stdin, tt.args...)
+		if stdout != tt.stdout || code != 0 {
+			t.Errorf("monkey %q: expected %q, got=%q (stderr=%q, exit %d)", tt.args, tt.stdout, stdout, stderr, code)
+		}
+	}
+
+	_, stderr, _ := runMain("", "-e", "ARGV = 1")
+	if !strings.Contains(stderr, "ARGV") {
+		t.Errorf("ARGV should be a constant. stderr=%q", stderr)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		program string
+		stdout  string
+		code    int
+	}{
+		{"puts(1)", "1\n", exitOK},
+		{"nope", "", exitError},
+		{"let = 1", "", exitUsage},
+		{"puts(1); exit(3); puts(2)", "1\n", 3},
+		{"let check = fn(ok) { if (!ok) { exit(4) } }; check(true); check(false); puts(1)", "", 4},
+		{"exit()", "", exitOK},
+		{"exit(\"no\")", "", exitError},
+		{"exit(300)", "", exitError},
+		{"exit(-1)", "", exitError},
+	}
+
+	for _, tt := range tests {
+		stdout, stderr, code := runMain("", "-e", tt.program)
+		if stdout != tt.stdout || code != tt.code {
+			t.Errorf("monkey -e %q: expected %q and exit %d, got=%q and %d (stderr=%q)", tt.program, tt.stdout, tt.code, stdout, code, stderr)
+		}
+		if tt.code != exitError && tt.code != exitUsage && stderr != "" {
+			t.Errorf("monkey -e %q: exit shouldn't print anything. stderr=%q", tt.program, stderr)
+		}
+	}
+
+	if _, _, code := runMain("", "run", "-nope", "x.monkey"); code != exitUsage {
+		t.Errorf("unknown flags should exit with %d, got=%d", exitUsage, code)
+	}
+}
+
+func TestRunModulePath(t *testing.T) {
+	project := t.TempDir()
+	shared := t.TempDir()
+	files := map[string]string{
+		filepath.Join(project, "main.monkey"):              `let util = import("util"); let json = import("json"); let log = import("log"); puts(util.name, json.name, log.name)`,
+		filepath.Join(project, "util.monkey"):              `let name = "util";`,
+		filepath.Join(project, "monkey.toml"):              "[modules]\npath = [\"vendor\"]\n",
+		filepath.Join(project, "vendor", "json.monkey"):    `let helpers = import("helpers"); let name = helpers.prefix + "json";`,
+		filepath.Join(project, "vendor", "helpers.monkey"): `let prefix = "vendored ";`,
+		filepath.Join(shared, "log.monkey"):                `let name = "log";`,
+		// the vendored json wins over the one in MONKEY_PATH
+		filepath.Join(shared, "json.monkey"): `let name = "shared json";`,
+	}
+	for path, source := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("MONKEY_CONFIG", filepath.Join(project, "monkey.toml"))
+	t.Setenv("MONKEY_PATH", shared)
+
+	stdout, stderr, code := runMain("", "run", "-no-prelude", filepath.Join(project, "main.monkey"))
+	if stdout != "util\nvendored json\nlog\n" || code != 0 {
+		t.Errorf("wrong modules imported, got=%q, %q and %d", stdout, stderr, code)
+	}
+}
@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Test files end with this, monkey test only runs them
+const testSuffix = "_test.monkey"
+
+// What the tests of one file came to
+type testSummary struct {
+	passed, failed int
+}
+
+// monkey test runs every *_test.monkey file it finds on its own: the file
+// is evaluated and then every test it registered with test(name, fn)
+// A file without tests is one test, it passes when it runs without an error
+func (s *streams) test(args []string) int {
+	flags := s.flagSet("test")
+	verbose := flags.Bool("v", false, "also list the tests which passed")
+	run := flags.String("run", "", "only run the tests whose name matches this regular expression")
+	noPrelude := flags.Bool("no-prelude", false, "do not load the standard library written in Monkey")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var filter *regexp.Regexp
+	if *run != "" {
+		if filter, err = regexp.Compile(*run); err != nil {
+			fmt.Fprintf(s.stderr, "invalid -run: %s\n", err)
+			return exitUsage
+		}
+	}
+
+	files, err := testFiles(paths)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return exitError
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(s.stderr, "no test files (*"+testSuffix+") found")
+		return exitError
+	}
+
+	total := testSummary{}
+	for _, path := range files {
+		summary := s.testFile(path, filter, *verbose, *noPrelude)
+		if summary.failed > 0 {
+			fmt.Fprintf(s.stdout, "FAIL %s (%d of %d failed)\n", path, summary.failed, summary.passed+summary.failed)
+		} else {
+			fmt.Fprintf(s.stdout, "ok   %s (%d passed)\n", path, summary.passed)
+		}
+		total.passed += summary.passed
+		total.failed += summary.failed
+	}
+
+	fmt.Fprintf(s.stdout, "%d passed, %d failed\n", total.passed, total.failed)
+	if total.failed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+func testFiles(paths []string) ([]string, error) {
+	found, err := monkeyFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, path := range found {
+		if strings.HasSuffix(path, testSuffix) {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// Every file gets its own environment and loads its imports again, so
+// nothing one file does can make the tests of another pass or fail
+func (s *streams) testFile(path string, filter *regexp.Regexp, verbose, noPrelude bool) testSummary {
+	summary := testSummary{}
+	report := func(name string, start time.Time, err *object.Error) {
+		elapsed := time.Since(start).Round(time.Microsecond)
+		if err == nil {
+			summary.passed++
+			if verbose {
+				fmt.Fprintf(s.stdout, "--- PASS: %s (%s)\n", name, elapsed)
+			}
+			return
+		}
+		summary.failed++
+		fmt.Fprintf(s.stdout, "--- FAIL: %s (%s)\n", name, elapsed)
+		if err.Pos.IsValid() {
+			fmt.Fprintf(s.stdout, "    %s:%s: %s\n", path, err.Pos, err.Message)
+		} else {
+			fmt.Fprintf(s.stdout, "    %s: %s\n", path, err.Message)
+		}
+	}
+
+	start := time.Now()
+	source, err := os.ReadFile(path)
+	if err != nil {
+		report(path, start, &object.Error{Message: err.Error()})
+		return summary
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, err := range p.Diagnostics() {
+			report(path, start, &object.Error{Message: err.Message, Pos: err.Pos})
+		}
+		return summary
+	}
+
+	module := &object.Module{Name: path, Path: path}
+	if abs, err := filepath.Abs(path); err == nil {
+		module.Path = abs
+	}
+	env := object.NewModuleEnvironment(module)
+	if err := loadPrelude(env, noPrelude); err != nil {
+		report(path, start, &object.Error{Message: err.Error()})
+		return summary
+	}
+
+	tests := []evaluator.TestCase{}
+	for name, builtin := range evaluator.TestBuiltins(func(tc evaluator.TestCase) { tests = append(tests, tc) }) {
+		env.SetConst(name, builtin)
+	}
+
+	// the tests share the modules the file imported, other files don't
+	ctx := context.Background()
+	opts := s.options()
+	opts.Modules = evaluator.NewModules()
+	result := evaluator.EvalWithOptions(ctx, program, object.NewEnclosedEnvironment(env), opts)
+	if err, ok := result.(*object.Error); ok {
+		report(path, start, err)
+		return summary
+	}
+	if len(tests) == 0 {
+		report(path, start, nil)
+		return summary
+	}
+
+	for _, tc := range tests {
+		if filter != nil && !filter.MatchString(tc.Name) {
+			continue
+		}
+		start := time.Now()
+		result := evaluator.ApplyWithOptions(ctx, tc.Fn, nil, opts)
+		err, _ := result.(*object.Error)
+		report(tc.Name, start, err)
+	}
+	return summary
+}
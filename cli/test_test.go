@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTestCommand(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib.monkey": "let counter = 0; let add = fn(a, b) { a + b };",
+		"math_test.monkey": `let lib = import("lib");
+test("adds", fn() { assertEq(lib.add(1, 2), 3) });
+test("wrong", fn() { assertEq(lib.add(1, 2), 4, "sum") });
+`,
+		"plain_test.monkey": `assert(true); puts("plain ran");`,
+		// not a test file, it would fail
+		"other.monkey": `fail()`,
+	}
+	for name, source := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stdout, _, code := runMain("", "test", dir)
+	for _, want := range []string{
+		"--- FAIL: wrong (",
+		"    " + filepath.Join(dir, "math_test.monkey") + ":3:30: sum: expected 4, got 3\n",
+		"FAIL " + filepath.Join(dir, "math_test.monkey") + " (1 of 2 failed)\n",
+		"plain ran\n",
+		"ok   " + filepath.Join(dir, "plain_test.monkey") + " (1 passed)\n",
+		"2 passed, 1 failed\n",
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected %q in the output, got=%q", want, stdout)
+		}
+	}
+	if strings.Contains(stdout, "--- PASS") {
+		t.Errorf("expected passing tests only with -v, got=%q", stdout)
+	}
+	if code != 1 {
+		t.Errorf("expected exit 1 when a test failed, got=%d", code)
+	}
+
+	stdout, _, code = runMain("", "test", "-v", "-run", "^adds$", dir)
+	if !strings.Contains(stdout, "--- PASS: adds (") || !strings.Contains(stdout, "2 passed, 0 failed\n") || code != 0 {
+		t.Errorf("monkey test -v -run: expected only adds to run and exit 0, got=%q and %d", stdout, code)
+	}
+
+	_, stderr, code := runMain("", "test", t.TempDir())
+	if code != 1 || !strings.Contains(stderr, "no test files") {
+		t.Errorf("expected an error for a directory without tests, got=%q and %d", stderr, code)
+	}
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"monkey/lexer"
+	"monkey/token"
+	"strconv"
+)
+
+// monkey tokens prints what the lexer makes of a file, a token per line:
+// 1:5     IDENT      "x"
+func (s *streams) tokens(args []string) int {
+	flags := s.flagSet("tokens")
+	comments := flags.Bool("comments", false, "also print the comments")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) > 1 {
+		fmt.Fprintln(s.stderr, "usage: monkey "+commands["tokens"].usage)
+		return exitUsage
+	}
+
+	path := "-"
+	if len(paths) == 1 {
+		path = paths[0]
+	}
+	_, source, ok := s.readSource(path)
+	if !ok {
+		return exitError
+	}
+
+	l := lexer.New(source)
+	printed := 0
+	for {
+		tok := l.NextToken()
+		// the comments in front of the token have been skipped by now
+		if *comments {
+			for _, comment := range l.Comments()[printed:] {
+				s.printToken(comment)
+			}
+			printed = len(l.Comments())
+		}
+		s.printToken(tok)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	return exitOK
+}
+
+func (s *streams) printToken(tok token.Token) {
+	fmt.Fprintf(s.stdout, "%-7s %-10s %s\n", tok.Pos, tok.Type, strconv.Quote(tok.Literal))
+}
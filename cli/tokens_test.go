@@ -0,0 +1,34 @@
+package cli
+
+import "testing"
+
+func TestTokens(t *testing.T) {
+	path := writeScript(t, "script.monkey", "let x = 1; // one\nx")
+
+	stdout, _, code := runMain("", "tokens", path)
+	expected := `1:1     LET        "let"
+1:5     IDENT      "x"
+1:7     =          "="
+1:9     INT        "1"
+1:10    ;          ";"
+2:1     IDENT      "x"
+2:2     EOF        ""
+`
+	if stdout != expected || code != 0 {
+		t.Errorf("monkey tokens: expected %q and exit 0, got=%q and %d", expected, stdout, code)
+	}
+
+	stdout, _, _ = runMain("", "tokens", path, "-comments")
+	expected = `1:1     LET        "let"
+1:5     IDENT      "x"
+1:7     =          "="
+1:9     INT        "1"
+1:10    ;          ";"
+1:12    COMMENT    "// one"
+2:1     IDENT      "x"
+2:2     EOF        ""
+`
+	if stdout != expected {
+		t.Errorf("monkey tokens -comments: expected %q, got=%q", expected, stdout)
+	}
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"fmt"
+	"monkey/compiler"
+	"monkey/gogen"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// monkey translate writes a Go program which does what monkey run does
+// with the script, see gogen. A .mbc file is translated as it is
+func (s *streams) translate(args []string) int {
+	flags := s.flagSet("translate")
+	output := flags.String("o", "", "the file to write, the script's name with .go by default, - is stdout")
+	noPrelude := flags.Bool("no-prelude", false, "do not translate the standard library written in Monkey into the program")
+	optimize := flags.Bool("O", false, "run the peephole optimizer over the bytecode before translating it")
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return flagsFailed(err)
+	}
+	if len(paths) != 1 {
+		fmt.Fprintln(s.stderr, "usage: monkey "+commands["translate"].usage)
+		return exitUsage
+	}
+
+	name, source, ok := s.readSource(paths[0])
+	if !ok {
+		return exitError
+	}
+	out := *output
+	if out == "" {
+		if paths[0] == "-" {
+			fmt.Fprintln(s.stderr, "-o is needed to translate stdin")
+			return exitUsage
+		}
+		out = strings.TrimSuffix(paths[0], filepath.Ext(paths[0])) + ".go"
+	}
+
+	var bytecode *compiler.Bytecode
+	if compiler.IsBytecode([]byte(source)) {
+		if bytecode, err = compiler.Decode(strings.NewReader(source)); err != nil {
+			fmt.Fprintf(s.stderr, "%s: %s\n", name, err)
+			return exitError
+		}
+	} else {
+		var code int
+		if bytecode, code = s.compileSource(name, source, *noPrelude, *optimize); bytecode == nil {
+			return code
+		}
+	}
+
+	program, err := gogen.Translate(bytecode, gogen.Options{Name: name})
+	if err != nil {
+		fmt.Fprintf(s.stderr, "%s: %s\n", name, err)
+		return exitError
+	}
+	if out == "-" {
+		s.stdout.Write(program)
+		return exitOK
+	}
+	if err := os.WriteFile(out, program, 0644); err != nil {
+		fmt.Fprintf(s.stderr, "could not write the Go program: %s\n", err)
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	path := writeScript(t, "script.monkey", "puts(map([1, 2], fn(x) { x * 2 }))")
+	if _, stderr, code := runMain("", "translate", path); code != 0 {
+		t.Fatalf("monkey translate %s: expected exit 0, got=%d and %q", path, code, stderr)
+	}
+
+	program, err := os.ReadFile(strings.TrimSuffix(path, ".monkey") + ".go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the prelude is translated into the program
+	for _, expected := range []string{"package main", `Name: "map"`, `os.Exit(report("` + path + `", err))`} {
+		if !strings.Contains(string(program), expected) {
+			t.Errorf("expected the Go program to contain %q, got:\n%s", expected, program)
+		}
+	}
+
+	path = writeScript(t, "len.monkey", "puts(len([1]))")
+	stdout, _, code := runMain("", "translate", "-o", "-", "-no-prelude", path)
+	if code != 0 || !strings.HasPrefix(stdout, "// Code generated by monkey translate") || strings.Contains(stdout, `Name: "map"`) {
+		t.Errorf("expected the program without the prelude on stdout, got=%q and %d", stdout, code)
+	}
+
+	// a compiled program is translated as it is
+	compiled := filepath.Join(t.TempDir(), "script.mbc")
+	if _, stderr, code := runMain("", "compile", "-o", compiled, "-no-prelude", path); code != 0 {
+		t.Fatalf("monkey compile: expected exit 0, got=%d and %q", code, stderr)
+	}
+	if stdout, stderr, code := runMain("", "translate", "-o", "-", compiled); code != 0 || !strings.Contains(stdout, `builtin("len")`) {
+		t.Errorf("monkey translate %s: expected the program and exit 0, got=%q, %q and %d", compiled, stdout, stderr, code)
+	}
+
+	if _, stderr, code := runMain("1", "translate", "-"); code != 2 || !strings.Contains(stderr, "-o is needed") {
+		t.Errorf("expected stdin to need -o, got=%q and %d", stderr, code)
+	}
+	if _, stderr, code := runMain("", "translate", "-o", "-", writeScript(t, "bad.monkey", "let a = 1;\na + nope")); code != 2 ||
+		!strings.Contains(stderr, ":2:5: undefined variable nope") {
+		t.Errorf("expected the compile error and exit 2, got=%q and %d", stderr, code)
+	}
+	if _, stderr, code := runMain("", "translate", "-o", "-", writeScript(t, "gen.monkey", "fn*() { yield 1 }")); code != 2 ||
+		!strings.Contains(stderr, "generator functions are not supported by the VM") {
+		t.Errorf("expected what the compiler can't compile to be refused, got=%q and %d", stderr, code)
+	}
+}
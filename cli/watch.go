@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+	"monkey/evaluator"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// How often monkey run -watch looks at the files, a variable for the tests
+var watchInterval = 250 * time.Millisecond
+
+// What a file looked like the last time, a missing file is the zero value
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Runs the script, then waits until it or one of its modules changes and
+// runs it again, until stop is closed (nil runs forever)
+// Every run starts without loaded modules, so changed ones are read again
+// Modules stay watched after a run which didn't get to import them, e.g.
+// because one of them has a parser error
+func (s *streams) watch(path string, args []string, noPrelude bool, stop <-chan struct{}) int {
+	// errors show the path like it was given, the modules are absolute
+	file := path
+	if abs, err := filepath.Abs(path); err == nil {
+		file = abs
+	}
+	watched := map[string]fileState{file: {}}
+
+	for {
+		for watchedFile := range watched {
+			watched[watchedFile] = stat(watchedFile)
+		}
+
+		code := exitError
+		modules := evaluator.NewModules()
+		if source, err := os.ReadFile(path); err != nil {
+			fmt.Fprintf(s.stderr, "could not read the script: %s\n", err)
+		} else {
+			code = s.runScript(script{path: path, source: string(source), args: args, modules: modules}, noPrelude)
+		}
+		for _, module := range modules.Loaded() {
+			if _, ok := watched[module]; !ok {
+				watched[module] = stat(module)
+			}
+		}
+		fmt.Fprintf(s.stderr, "[watch] exited with %d, waiting for changes\n", code)
+
+		changed, ok := waitForChange(watched, stop)
+		if !ok {
+			return code
+		}
+		fmt.Fprintf(s.stderr, "[watch] %s changed, running again\n", changed)
+	}
+}
+
+// Returns the first file which changed, or false once stop is closed
+func waitForChange(watched map[string]fileState, stop <-chan struct{}) (string, bool) {
+	files := make([]string, 0, len(watched))
+	for file := range watched {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return "", false
+		case <-ticker.C:
+		}
+
+		for _, file := range files {
+			if stat(file) != watched[file] {
+				return file, true
+			}
+		}
+	}
+}
+
+func stat(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
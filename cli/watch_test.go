@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The watch loop writes from its own goroutine while the test reads
+type lockedBuilder struct {
+	mu sync.Mutex
+	b  strings.Builder
+}
+
+func (l *lockedBuilder) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.Write(p)
+}
+
+func (l *lockedBuilder) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.b.String()
+}
+
+func TestWatch(t *testing.T) {
+	defer func(interval time.Duration) { watchInterval = interval }(watchInterval)
+	watchInterval = 5 * time.Millisecond
+
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.monkey")
+	main := filepath.Join(dir, "main.monkey")
+	write := func(path, source string) {
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(lib, "let n = 1;")
+	write(main, `let lib = import("lib"); puts(lib.n);`)
+
+	var stdout, stderr lockedBuilder
+	s := &streams{stdin: strings.NewReader(""), stdout: &stdout, stderr: &stderr}
+	stop := make(chan struct{})
+	done := make(chan int)
+	go func() { done <- s.watch(main, nil, true, stop) }()
+
+	waitFor := func(out *lockedBuilder, want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(out.String(), want) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %q in the output, got=%q", want, out.String())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitFor(&stdout, "1\n")
+	write(lib, "let n = 22;")
+	waitFor(&stdout, "22\n")
+
+	// the broken module can't be imported, it's still watched
+	write(lib, "let n = ;")
+	waitFor(&stderr, `could not import "lib"`)
+	write(lib, "let n = 333;")
+	waitFor(&stdout, "333\n")
+	waitFor(&stderr, "[watch] "+lib+" changed, running again\n")
+
+	close(stop)
+	if code := <-done; code != 0 {
+		t.Errorf("expected the exit code of the last run, got=%d", code)
+	}
+
+	_, stderr2, code := runMain("", "run", "-watch", "-")
+	if code != 2 || !strings.Contains(stderr2, "-watch needs a script file") {
+		t.Errorf("expected -watch to refuse stdin, got=%q and %d", stderr2, code)
+	}
+}
@@ -0,0 +1,412 @@
+// The bytecode of the compiler and the VM: an instruction is an opcode
+// byte followed by its operands, big endian
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type Instructions []byte
+
+type Opcode byte
+
+const (
+	// Pushes the constant with the index of the operand
+	OpConstant Opcode = iota
+	// Pops the value an expression statement left on the stack
+	OpPop
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+
+	OpTrue
+	OpFalse
+
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	// Its own opcode and not OpGreaterThan with swapped operands, so the
+	// left side is still evaluated first like in the evaluator
+	OpLessThan
+
+	OpMinus
+	OpBang
+
+	// 1..5, the integers as a Range
+	OpRange
+
+	// Both take the index of the global as their operand
+	OpGetGlobal
+	OpSetGlobal
+
+	// Jump to the absolute position of their operand, OpJumpNotTruthy pops
+	// the condition and only jumps when it's false or null
+	OpJumpNotTruthy
+	OpJump
+
+	OpNull
+
+	// Locals take a one byte operand, the slot in the current frame
+	OpGetLocal
+	OpSetLocal
+
+	// OpIter replaces the value on the stack with an iterator over it
+	// OpIterNext pushes the next element, the key and the value when the
+	// first operand is 2, or pops the iterator and jumps to the second
+	// operand once it's done
+	OpIter
+	OpIterNext
+
+	// The operand is the number of arguments, they are on the stack above
+	// the function
+	OpCall
+	// Returns the value on top of the stack, OpReturn returns null
+	OpReturnValue
+	OpReturn
+
+	// Wraps the function constant of the first operand and as many cells
+	// as the second one says into a closure
+	OpClosure
+	// Free variables are cells, they read or write the cell's value
+	OpGetFree
+	OpSetFree
+	// Push the cell of a local (turning the local into one if it isn't
+	// yet) or of a free variable, for OpClosure to capture
+	OpCaptureLocal
+	OpCaptureFree
+	// Unsets the locals from the first operand on, as many as the second
+	// one says. The end of a loop's iteration, so closures of the next
+	// iteration don't share its cells
+	OpClearLocals
+
+	// The operand is an index into the Builtins names of the bytecode
+	OpGetBuiltin
+
+	// Build an array or a hash of the values on the stack, the operand is
+	// how many there are. A hash takes them as key, value, key, value, ...
+	OpArray
+	OpHash
+	// Pops the index and the value it's taken from
+	OpIndex
+	// The first operand is the constant of the property's name, the second
+	// one is 1 for ?. which gives null for null instead of an error
+	OpMember
+	// Converts the operand's number of values into strings like str() and
+	// joins them
+	OpTemplate
+	// The left side of ??, jumps to the operand and keeps the value when
+	// it isn't null, otherwise pops it
+	OpJumpNotNull
+
+	// Superinstructions, the optimizer fuses the hot sequences they are
+	// named after into one so the VM dispatches once instead of three or
+	// two times. OpGetLocalConstantAdd takes the local and the constant
+	// of OpGetLocal and OpConstant and pushes their sum
+	OpGetLocalConstantAdd
+	OpGetLocalConstantSub
+	// A comparison followed by OpJumpNotTruthy: pops both sides and jumps
+	// to the operand unless the comparison is true
+	OpEqualJumpNotTruthy
+	OpNotEqualJumpNotTruthy
+	OpGreaterThanJumpNotTruthy
+	OpLessThanJumpNotTruthy
+)
+
+// The name of an opcode and how many bytes each of its operands takes
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+// What an operand refers to, so a listing can show e.g. the constant
+// instead of its index, see OperandKinds
+type OperandKind int
+
+const (
+	// How many values, arguments, ... the instruction takes
+	CountOperand OperandKind = iota
+	ConstantOperand
+	GlobalOperand
+	LocalOperand
+	FreeOperand
+	BuiltinOperand
+	// The absolute position of an instruction of the same function
+	JumpOperand
+	// 0 or 1
+	FlagOperand
+)
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+
+	OpAdd: {"OpAdd", []int{}},
+	OpSub: {"OpSub", []int{}},
+	OpMul: {"OpMul", []int{}},
+	OpDiv: {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpRange: {"OpRange", []int{}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpNull: {"OpNull", []int{}},
+
+	OpGetLocal: {"OpGetLocal", []int{1}},
+	OpSetLocal: {"OpSetLocal", []int{1}},
+
+	OpIter:     {"OpIter", []int{}},
+	OpIterNext: {"OpIterNext", []int{1, 2}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	OpClosure:      {"OpClosure", []int{2, 1}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+	OpClearLocals:  {"OpClearLocals", []int{1, 1}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	OpArray:       {"OpArray", []int{2}},
+	OpHash:        {"OpHash", []int{2}},
+	OpIndex:       {"OpIndex", []int{}},
+	OpMember:      {"OpMember", []int{2, 1}},
+	OpTemplate:    {"OpTemplate", []int{2}},
+	OpJumpNotNull: {"OpJumpNotNull", []int{2}},
+
+	OpGetLocalConstantAdd:      {"OpGetLocalConstantAdd", []int{1, 2}},
+	OpGetLocalConstantSub:      {"OpGetLocalConstantSub", []int{1, 2}},
+	OpEqualJumpNotTruthy:       {"OpEqualJumpNotTruthy", []int{2}},
+	OpNotEqualJumpNotTruthy:    {"OpNotEqualJumpNotTruthy", []int{2}},
+	OpGreaterThanJumpNotTruthy: {"OpGreaterThanJumpNotTruthy", []int{2}},
+	OpLessThanJumpNotTruthy:    {"OpLessThanJumpNotTruthy", []int{2}},
+}
+
+var operandKinds = map[Opcode][]OperandKind{
+	OpConstant:      {ConstantOperand},
+	OpGetGlobal:     {GlobalOperand},
+	OpSetGlobal:     {GlobalOperand},
+	OpJumpNotTruthy: {JumpOperand},
+	OpJump:          {JumpOperand},
+	OpGetLocal:      {LocalOperand},
+	OpSetLocal:      {LocalOperand},
+	OpIterNext:      {CountOperand, JumpOperand},
+	OpCall:          {CountOperand},
+	OpClosure:       {ConstantOperand, CountOperand},
+	OpGetFree:       {FreeOperand},
+	OpSetFree:       {FreeOperand},
+	OpCaptureLocal:  {LocalOperand},
+	OpCaptureFree:   {FreeOperand},
+	OpClearLocals:   {LocalOperand, CountOperand},
+	OpGetBuiltin:    {BuiltinOperand},
+	OpArray:         {CountOperand},
+	OpHash:          {CountOperand},
+	OpMember:        {ConstantOperand, FlagOperand},
+	OpTemplate:      {CountOperand},
+	OpJumpNotNull:   {JumpOperand},
+
+	OpGetLocalConstantAdd:      {LocalOperand, ConstantOperand},
+	OpGetLocalConstantSub:      {LocalOperand, ConstantOperand},
+	OpEqualJumpNotTruthy:       {JumpOperand},
+	OpNotEqualJumpNotTruthy:    {JumpOperand},
+	OpGreaterThanJumpNotTruthy: {JumpOperand},
+	OpLessThanJumpNotTruthy:    {JumpOperand},
+}
+
+// The operation of a superinstruction after OpGetLocal and OpConstant or
+// before OpJumpNotTruthy, e.g. OpAdd for OpGetLocalConstantAdd
+var fusedOperations = map[Opcode]Opcode{
+	OpGetLocalConstantAdd:      OpAdd,
+	OpGetLocalConstantSub:      OpSub,
+	OpEqualJumpNotTruthy:       OpEqual,
+	OpNotEqualJumpNotTruthy:    OpNotEqual,
+	OpGreaterThanJumpNotTruthy: OpGreaterThan,
+	OpLessThanJumpNotTruthy:    OpLessThan,
+}
+
+// What the operands of op are, in the order of its OperandWidths
+func OperandKinds(op Opcode) []OperandKind {
+	return operandKinds[op]
+}
+
+// The operation op does when it's a superinstruction, false when it isn't
+func FusedOperation(op Opcode) (Opcode, bool) {
+	operation, ok := fusedOperations[op]
+	return operation, ok
+}
+
+// How many values op takes from the stack and puts on it when it doesn't
+// jump, operands are the ones ReadInstruction gives
+func StackEffect(op Opcode, operands []int) (pops, pushes int) {
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNull,
+		OpGetGlobal, OpGetLocal, OpGetFree, OpGetBuiltin,
+		OpCaptureLocal, OpCaptureFree,
+		OpGetLocalConstantAdd, OpGetLocalConstantSub:
+		return 0, 1
+	case OpPop, OpSetGlobal, OpSetLocal, OpSetFree,
+		OpJumpNotTruthy, OpReturnValue, OpJumpNotNull:
+		return 1, 0
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual,
+		OpGreaterThan, OpLessThan, OpRange, OpIndex:
+		return 2, 1
+	case OpEqualJumpNotTruthy, OpNotEqualJumpNotTruthy,
+		OpGreaterThanJumpNotTruthy, OpLessThanJumpNotTruthy:
+		return 2, 0
+	case OpMinus, OpBang, OpIter, OpMember:
+		return 1, 1
+	case OpIterNext:
+		return 0, operands[0]
+	case OpCall:
+		return operands[0] + 1, 1
+	case OpClosure:
+		return operands[1], 1
+	case OpArray, OpHash, OpTemplate:
+		return operands[0], 1
+	default:
+		// OpJump, OpReturn, OpClearLocals
+		return 0, 0
+	}
+}
+
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Encodes an instruction, an unknown opcode gives an empty one
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// Decodes the operands at the start of ins, the opposite of Make
+// Also returns how many bytes they took
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// Decodes the instruction at pos and returns its definition, operands
+// and length including the opcode. Unknown opcodes and instructions
+// which are cut off are errors
+func ReadInstruction(ins Instructions, pos int) (*Definition, []int, int, error) {
+	def, err := Lookup(ins[pos])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	if pos+width > len(ins) {
+		return nil, nil, 0, fmt.Errorf("%s at %d is cut off", def.Name, pos)
+	}
+
+	operands, _ := ReadOperands(def, ins[pos+1:])
+	return def, operands, width, nil
+}
+
+// One instruction per line with its position, like
+//
+//	0000 OpConstant 1
+//	0003 OpPop
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for i := 0; i < len(ins); {
+		def, operands, width, err := ReadInstruction(ins, i)
+		if err != nil {
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			break
+		}
+
+		fmt.Fprintf(&out, "%04d %s\n", i, def.Format(operands))
+		i += width
+	}
+
+	return out.String()
+}
+
+// The name followed by the operands
+func (def *Definition) Format(operands []int) string {
+	if len(operands) != len(def.OperandWidths) {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d",
+			len(operands), len(def.OperandWidths))
+	}
+
+	out := def.Name
+	for _, o := range operands {
+		out += fmt.Sprintf(" %d", o)
+	}
+	return out
+}
+
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
@@ -0,0 +1,122 @@
+package code
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		op       Opcode
+		operands []int
+		expected []byte
+	}{
+		{OpConstant, []int{65534}, []byte{byte(OpConstant), 255, 254}},
+		{OpAdd, []int{}, []byte{byte(OpAdd)}},
+		{OpGetLocal, []int{255}, []byte{byte(OpGetLocal), 255}},
+		{OpIterNext, []int{2, 65534}, []byte{byte(OpIterNext), 2, 255, 254}},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		if len(instruction) != len(tt.expected) {
+			t.Errorf("instruction has wrong length. want=%d, got=%d",
+				len(tt.expected), len(instruction))
+		}
+
+		for i, b := range tt.expected {
+			if instruction[i] != tt.expected[i] {
+				t.Errorf("wrong byte at pos %d. want=%d, got=%d",
+					i, b, instruction[i])
+			}
+		}
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		op        Opcode
+		operands  []int
+		bytesRead int
+	}{
+		{OpConstant, []int{65535}, 2},
+		{OpGetLocal, []int{255}, 1},
+		{OpIterNext, []int{1, 65535}, 3},
+		{OpMember, []int{65535, 1}, 3},
+	}
+
+	for _, tt := range tests {
+		instruction := Make(tt.op, tt.operands...)
+
+		def, err := Lookup(byte(tt.op))
+		if err != nil {
+			t.Fatalf("definition not found: %q\n", err)
+		}
+
+		operandsRead, n := ReadOperands(def, instruction[1:])
+		if n != tt.bytesRead {
+			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
+		}
+
+		for i, want := range tt.operands {
+			if operandsRead[i] != want {
+				t.Errorf("operand wrong. want=%d, got=%d", want, operandsRead[i])
+			}
+		}
+	}
+}
+
+func TestInstructionsString(t *testing.T) {
+	instructions := []Instructions{
+		Make(OpAdd),
+		Make(OpGetLocal, 1),
+		Make(OpConstant, 2),
+		Make(OpConstant, 65535),
+		Make(OpClosure, 65535, 255),
+	}
+
+	expected := `0000 OpAdd
+0001 OpGetLocal 1
+0003 OpConstant 2
+0006 OpConstant 65535
+0009 OpClosure 65535 255
+`
+
+	concatted := Instructions{}
+	for _, ins := range instructions {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, concatted.String())
+	}
+}
+
+func TestReadInstructionErrors(t *testing.T) {
+	tests := []struct {
+		ins      Instructions
+		expected string
+	}{
+		{Instructions{255}, "opcode 255 undefined"},
+		{Make(OpConstant, 1)[:2], "OpConstant at 0 is cut off"},
+	}
+
+	for _, tt := range tests {
+		_, _, _, err := ReadInstruction(tt.ins, 0)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("expected %q, got=%v", tt.expected, err)
+		}
+	}
+
+	listing := Instructions(append(Make(OpPop), 255)).String()
+	if listing != "0000 OpPop\n0001 ERROR: opcode 255 undefined\n" {
+		t.Errorf("wrong listing for a bad opcode. got=%q", listing)
+	}
+}
+
+func TestOperandKinds(t *testing.T) {
+	for op, def := range definitions {
+		if kinds := OperandKinds(op); len(kinds) != len(def.OperandWidths) {
+			t.Errorf("%s has %d operands but %d kinds", def.Name, len(def.OperandWidths), len(kinds))
+		}
+	}
+}
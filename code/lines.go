@@ -0,0 +1,49 @@
+package code
+
+import (
+	"monkey/token"
+	"sort"
+)
+
+// The instructions from Offset on were compiled from the node at Pos
+type LineEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Maps the instructions of a function to where they come from in the
+// source, so the VM can tell where an error happened. Sorted by offset,
+// an instruction belongs to the last entry at or before it
+type LineTable []LineEntry
+
+// Records that the instructions from offset on come from pos, offset is
+// the end of the instructions so far. Nothing is added while the position
+// stays the same
+func (t LineTable) Add(offset int, pos token.Position) LineTable {
+	if !pos.IsValid() || (len(t) > 0 && t[len(t)-1].Pos == pos) {
+		return t
+	}
+	if len(t) > 0 && t[len(t)-1].Offset == offset {
+		return append(t[:len(t)-1], LineEntry{Offset: offset, Pos: pos})
+	}
+	return append(t, LineEntry{Offset: offset, Pos: pos})
+}
+
+// Drops the entries of the instructions from offset on, when they are
+// taken back
+func (t LineTable) Cut(offset int) LineTable {
+	for len(t) > 0 && t[len(t)-1].Offset >= offset {
+		t = t[:len(t)-1]
+	}
+	return t
+}
+
+// Where the instruction at offset comes from, the zero position when the
+// table doesn't know
+func (t LineTable) Position(offset int) token.Position {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return t[i-1].Pos
+}
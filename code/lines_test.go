@@ -0,0 +1,41 @@
+package code
+
+import (
+	"monkey/token"
+	"testing"
+)
+
+func TestLineTable(t *testing.T) {
+	a := token.Position{Line: 1, Column: 1}
+	b := token.Position{Line: 2, Column: 5}
+
+	var lines LineTable
+	lines = lines.Add(0, a)
+	lines = lines.Add(3, a)
+	lines = lines.Add(3, token.Position{})
+	lines = lines.Add(4, b)
+	lines = lines.Add(6, a)
+	// taken back and emitted again
+	lines = lines.Cut(6)
+	lines = lines.Add(6, b)
+
+	if len(lines) != 2 {
+		t.Fatalf("wrong entries. want 2, got=%v", lines)
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{-1, token.Position{}},
+		{0, a},
+		{3, a},
+		{4, b},
+		{100, b},
+	}
+	for _, tt := range tests {
+		if pos := lines.Position(tt.offset); pos != tt.expected {
+			t.Errorf("wrong position at %d. want=%s, got=%s", tt.offset, tt.expected, pos)
+		}
+	}
+}
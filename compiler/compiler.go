@@ -0,0 +1,763 @@
+// Compiles the AST into bytecode for the vm package, it's a faster way
+// to run a program than walking the tree like the evaluator does
+package compiler
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+type Compiler struct {
+	constants []object.Object
+	// Where a literal already sits in constants, so equal literals share
+	// one entry
+	constantIndexes map[constantKey]int
+
+	symbolTable *SymbolTable
+
+	// Where names which aren't defined in the program are looked up, the
+	// ones used get an index by their first use
+	builtins     *object.Builtins
+	builtinNames []string
+
+	// The globals used before a let defined them and where the first use
+	// is, a name still here after the program never gets a value
+	undefined map[string]token.Position
+	// Globals the host sets, see Options.Globals
+	hostGlobals map[string]bool
+
+	optimize bool
+
+	// One per function being compiled, the main program is the first
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// The position of the innermost node being compiled, what an emitted
+	// instruction is recorded with in the line table
+	pos token.Position
+
+	// The OpJumps of the ?. which skip the rest of the chains being
+	// compiled, the end of a chain changes the ones it added
+	chainSkips []int
+}
+
+type CompilationScope struct {
+	instructions code.Instructions
+	// The last two emitted instructions, an if looks at them to drop the
+	// OpPop of its blocks
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+	lines               code.LineTable
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// What the VM runs: the instructions and the constants they refer to
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	// The names of the globals by index, for the VM's error messages
+	Globals []string
+	// The local slots the loops of the main program need
+	NumLocals int
+	// The builtins by the index of OpGetBuiltin, the VM looks their
+	// functions up by name
+	Builtins []string
+	// Where the instructions of the main program come from
+	Lines code.LineTable
+}
+
+type constantKey struct {
+	kind    object.ObjectType
+	integer int64
+	str     string
+}
+
+// How to compile, the zero value is what New uses
+type Options struct {
+	// The builtins of the VM which runs the program,
+	// object.DefaultBuiltins when nil
+	Builtins *object.Builtins
+	// Folds constant expressions and runs the peephole optimizer over
+	// every function, see foldConstant and optimizeInstructions
+	Optimize bool
+	// Names the host gives a value with vm.SetGlobal before the program
+	// runs, e.g. ARGV, using them without a let isn't an error
+	Globals []string
+}
+
+func New() *Compiler {
+	return NewWithOptions(Options{})
+}
+
+func NewWithOptions(opts Options) *Compiler {
+	builtins := opts.Builtins
+	if builtins == nil {
+		builtins = object.DefaultBuiltins
+	}
+
+	hostGlobals := map[string]bool{}
+	for _, name := range opts.Globals {
+		hostGlobals[name] = true
+	}
+
+	mainScope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+
+	return &Compiler{
+		constants:       []object.Object{},
+		constantIndexes: map[constantKey]int{},
+		symbolTable:     NewSymbolTable(),
+		builtins:        builtins,
+		undefined:       map[string]token.Position{},
+		hostGlobals:     hostGlobals,
+		optimize:        opts.Optimize,
+		scopes:          []CompilationScope{mainScope},
+		scopeIndex:      0,
+	}
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	if pos := node.Pos(); pos.IsValid() {
+		outer := c.pos
+		c.pos = pos
+		defer func() { c.pos = outer }()
+	}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+		if err := c.undefinedError(); err != nil {
+			return err
+		}
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.InfixExpression:
+		if c.optimize && c.foldConstant(node) {
+			return nil
+		}
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		// The right side of ?? only runs when the left one is null
+		if node.Operator == "??" {
+			jumpPos := c.emit(code.OpJumpNotNull, 9999)
+			if err := c.Compile(node.Right); err != nil {
+				return err
+			}
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
+			return nil
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "+":
+			c.emit(code.OpAdd)
+		case "-":
+			c.emit(code.OpSub)
+		case "*":
+			c.emit(code.OpMul)
+		case "/":
+			c.emit(code.OpDiv)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		case "..":
+			c.emit(code.OpRange)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.PrefixExpression:
+		if c.optimize && c.foldConstant(node) {
+			return nil
+		}
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.IfExpression:
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+
+		// Emit an `OpJumpNotTruthy` with a bogus value, it's fixed once
+		// the consequence is compiled
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		if err := c.compileBlockValue(node.Consequence); err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+
+		afterConsequencePos := len(c.currentInstructions())
+		c.changeOperand(jumpNotTruthyPos, afterConsequencePos)
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			if err := c.compileBlockValue(node.Alternative); err != nil {
+				return err
+			}
+		}
+
+		afterAlternativePos := len(c.currentInstructions())
+		c.changeOperand(jumpPos, afterAlternativePos)
+
+	case *ast.LetStatement:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if c.symbolTable.isConst(node.Name.Value) {
+			return c.errorf("cannot reassign const %s", node.Name.Value)
+		}
+		var symbol Symbol
+		if node.Const {
+			symbol = c.symbolTable.DefineConst(node.Name.Value)
+		} else {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		if symbol.Scope == GlobalScope {
+			delete(c.undefined, node.Name.Value)
+		}
+		c.storeSymbol(symbol)
+
+	case *ast.AssignExpression:
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		symbol := c.resolve(node.Name.Value)
+		if symbol.Const {
+			return c.errorf("cannot reassign const %s", node.Name.Value)
+		}
+		// Like the evaluator, only a let can shadow a builtin
+		if symbol.Scope == BuiltinScope {
+			return c.errorf("identifier not found: %s", node.Name.Value)
+		}
+		// The assignment's value is the assigned one
+		c.storeSymbol(symbol)
+		c.loadSymbol(symbol)
+
+	case *ast.Identifier:
+		c.loadSymbol(c.resolve(node.Value))
+
+	case *ast.ForStatement:
+		if err := c.compileForStatement(node); err != nil {
+			return err
+		}
+
+	case *ast.FunctionLiteral:
+		if err := c.compileFunctionLiteral(node); err != nil {
+			return err
+		}
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+
+		c.emit(code.OpReturnValue)
+
+	case *ast.CallExpression:
+		skips := len(c.chainSkips)
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
+		c.endChain(node, skips)
+
+	case *ast.IntegerLiteral:
+		key := constantKey{kind: object.INTEGER_OBJ, integer: node.Value}
+		c.emit(code.OpConstant, c.addLiteral(key, object.NewInteger(node.Value)))
+
+	case *ast.StringLiteral:
+		key := constantKey{kind: object.STRING_OBJ, str: node.Value}
+		c.emit(code.OpConstant, c.addLiteral(key, &object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.TemplateLiteral:
+		for _, part := range node.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpTemplate, len(node.Parts))
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		// In the order they were written in like the evaluator, so the
+		// last of two equal keys wins and the bytecode is the same from
+		// one compilation to the next
+		for _, k := range ast.SortedKeys(node) {
+			if err := c.Compile(k); err != nil {
+				return err
+			}
+			if err := c.Compile(node.Pairs[k]); err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		skips := len(c.chainSkips)
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+
+		c.emit(code.OpIndex)
+		c.endChain(node, skips)
+
+	case *ast.MemberExpression:
+		skips := len(c.chainSkips)
+		if err := c.Compile(node.Object); err != nil {
+			return err
+		}
+
+		key := constantKey{kind: object.STRING_OBJ, str: node.Property.Value}
+		name := c.addLiteral(key, &object.String{Value: node.Property.Value})
+		switch {
+		case node.Optional && node.Chained:
+			// null jumps over the rest of the chain
+			jumpPos := c.emit(code.OpJumpNotNull, 9999)
+			c.emit(code.OpNull)
+			c.chainSkips = append(c.chainSkips, c.emit(code.OpJump, 9999))
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
+			c.emit(code.OpMember, name, 0)
+		case node.Optional:
+			// the end of a chain has nothing to skip
+			c.emit(code.OpMember, name, 1)
+		default:
+			c.emit(code.OpMember, name, 0)
+		}
+		c.endChain(node, skips)
+
+	default:
+		return unsupported(node)
+	}
+
+	return nil
+}
+
+// The end of a chain (e.g. the .c of a?.b.c) is where the ?. in it jump
+// to, skips is how many jumps there were before the chain
+func (c *Compiler) endChain(node ast.Expression, skips int) {
+	if ast.Chained(node) {
+		return
+	}
+	for _, pos := range c.chainSkips[skips:] {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.chainSkips = c.chainSkips[:skips]
+}
+
+// for (key, value in iterable) { body } becomes
+//
+//	iterable; OpIter
+//	next: OpIterNext 2 end; OpSetLocal value; OpSetLocal key; body
+//	      (OpClearLocals); OpJump next
+//	end: OpNull; OpPop
+//
+// The loop variables and the lets of the body are locals of a block
+// table, like the evaluator's scope of one iteration. A loop is a
+// statement which leaves null, also as the last statement of a block
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIter)
+
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+	for _, name := range node.Locals {
+		c.symbolTable.Define(name)
+	}
+
+	variables := 1
+	if node.Key != nil {
+		variables = 2
+	}
+	nextPos := c.emit(code.OpIterNext, variables, 9999)
+
+	value, _ := c.symbolTable.Resolve(node.Value.Value)
+	c.storeSymbol(value)
+	if node.Key != nil {
+		key, _ := c.symbolTable.Resolve(node.Key.Value)
+		c.storeSymbol(key)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	// Every iteration gets new variables, a closure of this one keeps
+	// seeing its own
+	if c.symbolTable.captured {
+		c.emit(code.OpClearLocals, c.symbolTable.base, c.symbolTable.NumDefinitions())
+	}
+	c.emit(code.OpJump, nextPos)
+
+	c.replaceInstruction(nextPos, code.Make(code.OpIterNext, variables, len(c.currentInstructions())))
+	c.symbolTable = c.symbolTable.Outer
+
+	c.emit(code.OpNull)
+	c.emit(code.OpPop)
+	return nil
+}
+
+// The parameters and the lets of the body are defined up front like the
+// resolver does it, so a function defined above a let can still use it
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	// a paused generator would need a goroutine or frames of its own
+	if node.Generator {
+		return &object.Error{Message: "generator functions are not supported by the VM", Pos: node.Pos()}
+	}
+
+	c.enterScope()
+
+	for _, name := range node.Locals {
+		c.symbolTable.Define(name)
+	}
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumLocals()
+	lines := c.scopes[c.scopeIndex].lines
+	instructions := c.leaveScope()
+	if c.optimize {
+		instructions, lines = c.optimizeInstructions(instructions, lines, false)
+	}
+
+	// The cells of the captured variables go on the stack for OpClosure
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		Name:          node.Name,
+		Lines:         lines,
+	}
+	fnIndex := c.addConstant(compiledFn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+	return nil
+}
+
+// A name which isn't defined (yet) is a builtin or else becomes a
+// global, a function can refer to one which is defined further down. If
+// it never is the program doesn't compile, see undefinedError
+func (c *Compiler) resolve(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+
+	global := c.symbolTable
+	for global.Outer != nil {
+		global = global.Outer
+	}
+	if _, ok := c.builtins.Lookup(name); ok {
+		c.builtinNames = append(c.builtinNames, name)
+		return global.DefineBuiltin(len(c.builtinNames)-1, name)
+	}
+	if !c.hostGlobals[name] {
+		c.undefined[name] = c.pos
+	}
+	return global.Define(name)
+}
+
+// The first use of a name no let of the program defines, the evaluator
+// would only find it once the code using it runs
+func (c *Compiler) undefinedError() error {
+	if len(c.undefined) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(c.undefined))
+	for name := range c.undefined {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := c.undefined[names[i]], c.undefined[names[j]]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return names[i] < names[j]
+	})
+	return &object.Error{Message: "undefined variable " + names[0], Pos: c.undefined[names[0]]}
+}
+
+// An error in the node being compiled, at its position like the errors
+// of the evaluator and the VM
+func (c *Compiler) errorf(format string, a ...interface{}) error {
+	return &object.Error{Message: fmt.Sprintf(format, a...), Pos: c.pos}
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	case BuiltinScope:
+		c.emit(code.OpGetBuiltin, s.Index)
+	}
+}
+
+func (c *Compiler) storeSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// Closures share a captured variable with the function defining it
+// instead of copying its value, like the evaluator's environments
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	}
+}
+
+// Leaves the value of the block's last statement on the stack, the
+// OpPop of an expression statement is taken back. A block which ends in
+// anything else, or is empty, gives null
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// The evaluator runs everything, the compiler only knows a part of the
+// language so far. The error is at the node like the ones of errorf
+func unsupported(node ast.Node) error {
+	name := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	return &object.Error{Message: fmt.Sprintf("compiling %s is not supported yet", name), Pos: node.Pos()}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	instructions := c.currentInstructions()
+	lines := c.scopes[c.scopeIndex].lines
+	if c.optimize {
+		instructions, lines = c.optimizeInstructions(instructions, lines, true)
+	}
+
+	return &Bytecode{
+		Instructions: instructions,
+		Constants:    c.constants,
+		Globals:      c.symbolTable.Names(),
+		NumLocals:    c.symbolTable.NumLocals(),
+		Builtins:     c.builtinNames,
+		Lines:        lines,
+	}
+}
+
+// Returns the index of the constant, OpConstant takes it as its operand
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// Like addConstant, but a literal seen before gets the index it had then
+func (c *Compiler) addLiteral(key constantKey, obj object.Object) int {
+	if index, ok := c.constantIndexes[key]; ok {
+		return index
+	}
+	index := c.addConstant(obj)
+	c.constantIndexes[key] = index
+	return index
+}
+
+// Appends an instruction and returns its position
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	last := c.scopes[c.scopeIndex].lastInstruction
+	previous := c.scopes[c.scopeIndex].previousInstruction
+
+	c.scopes[c.scopeIndex].instructions = c.currentInstructions()[:last.Position]
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Cut(last.Position)
+	c.scopes[c.scopeIndex].lastInstruction = previous
+}
+
+// A function's last expression statement is its value
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+// Only works for instructions of the same length, like changing the
+// operand of a jump
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	posNewInstruction := len(c.currentInstructions())
+	updatedInstructions := append(c.currentInstructions(), ins...)
+
+	c.scopes[c.scopeIndex].instructions = updatedInstructions
+	c.scopes[c.scopeIndex].lines = c.scopes[c.scopeIndex].lines.Add(posNewInstruction, c.pos)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions:        code.Instructions{},
+		lastInstruction:     EmittedInstruction{},
+		previousInstruction: EmittedInstruction{},
+	}
+	c.scopes = append(c.scopes, scope)
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
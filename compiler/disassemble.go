@@ -0,0 +1,109 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/object"
+	"strings"
+)
+
+// Writes a listing of the program for monkey disasm and the REPL's
+// :bytecode: the main program's instructions and then the constant pool
+// with the instructions of every function. An operand which refers to a
+// constant, a global or a builtin is followed by what it refers to
+func Disassemble(w io.Writer, b *Bytecode) error {
+	d := &disassembler{w: w, bytecode: b}
+
+	d.printf("main (%d locals):\n", b.NumLocals)
+	d.instructions(b.Instructions, "  ")
+
+	if len(b.Constants) > 0 {
+		d.printf("constants:\n")
+	}
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			d.printf("  %d %s\n", i, constantString(c))
+			continue
+		}
+
+		d.printf("  %d %s (%d parameters, %d locals):\n", i, constantString(fn), fn.NumParameters, fn.NumLocals)
+		d.instructions(fn.Instructions, "    ")
+	}
+
+	return d.err
+}
+
+type disassembler struct {
+	w        io.Writer
+	bytecode *Bytecode
+	err      error
+}
+
+func (d *disassembler) printf(format string, a ...interface{}) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, a...)
+	}
+}
+
+func (d *disassembler) instructions(ins code.Instructions, indent string) {
+	for i := 0; i < len(ins); {
+		def, operands, width, err := code.ReadInstruction(ins, i)
+		if err != nil {
+			d.printf("%s%04d ERROR: %s\n", indent, i, err)
+			return
+		}
+
+		notes := []string{}
+		for j, kind := range code.OperandKinds(code.Opcode(ins[i])) {
+			if note := d.note(kind, operands[j]); note != "" {
+				notes = append(notes, note)
+			}
+		}
+
+		if len(notes) == 0 {
+			d.printf("%s%04d %s\n", indent, i, def.Format(operands))
+		} else {
+			d.printf("%s%04d %-*s ; %s\n", indent, i, 24-len(indent), def.Format(operands), strings.Join(notes, ", "))
+		}
+		i += width
+	}
+}
+
+// What an operand refers to, empty when there's nothing to add
+func (d *disassembler) note(kind code.OperandKind, operand int) string {
+	names := []string{}
+	switch kind {
+	case code.ConstantOperand:
+		if operand < len(d.bytecode.Constants) {
+			return constantString(d.bytecode.Constants[operand])
+		}
+		return "missing constant"
+	case code.GlobalOperand:
+		names = d.bytecode.Globals
+	case code.BuiltinOperand:
+		names = d.bytecode.Builtins
+	default:
+		return ""
+	}
+
+	if operand < len(names) {
+		return names[operand]
+	}
+	return ""
+}
+
+func constantString(c object.Object) string {
+	switch c := c.(type) {
+	case *object.String:
+		return fmt.Sprintf("%q", c.Value)
+	case *object.CompiledFunction:
+		if c.Name != "" {
+			return "fn " + c.Name
+		}
+		return "fn"
+	default:
+		return c.Inspect()
+	}
+}
@@ -0,0 +1,41 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	compiler := New()
+	input := `let greet = fn(name) { "Hi " + name }; puts(greet("you"))`
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out strings.Builder
+	if err := Disassemble(&out, compiler.Bytecode()); err != nil {
+		t.Fatalf("disassemble error: %s", err)
+	}
+
+	expected := `main (0 locals):
+  0000 OpClosure 1 0          ; fn greet
+  0004 OpSetGlobal 0          ; greet
+  0007 OpGetBuiltin 0         ; puts
+  0009 OpGetGlobal 0          ; greet
+  0012 OpConstant 2           ; "you"
+  0015 OpCall 1
+  0017 OpCall 1
+  0019 OpPop
+constants:
+  0 "Hi "
+  1 fn greet (1 parameters, 1 locals):
+    0000 OpConstant 0         ; "Hi "
+    0003 OpGetLocal 0
+    0005 OpAdd
+    0006 OpReturnValue
+  2 "you"
+`
+	if out.String() != expected {
+		t.Errorf("wrong listing.\nwant=%s\ngot=%s", expected, out.String())
+	}
+}
@@ -0,0 +1,274 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+// The start of every encoded program, what .mbc files are recognized by
+const Magic = "MBC\x00"
+
+// Bumped whenever the encoding or the meaning of an opcode changes or
+// opcodes are added, a program of another version has to be compiled
+// again
+const Version = 4
+
+// The kinds of constants, the byte in front of each one
+const (
+	integerConstant  byte = 1
+	stringConstant   byte = 2
+	functionConstant byte = 3
+)
+
+// Reports whether data starts like an encoded program
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Writes the program in the binary format Decode reads:
+//
+//	magic, version
+//	instructions, number of locals of the main program
+//	constants: a kind byte each, functions with their instructions
+//	builtins: the names OpGetBuiltin refers to
+//	debug info: the names of the globals and the line table of the main
+//	program (functions carry their own)
+//
+// Numbers are varints, strings and instructions have their length in
+// front of them. A line table is its number of entries followed by the
+// offset of each one from the previous, its line, its column and its file
+func Encode(w io.Writer, b *Bytecode) error {
+	e := &encoder{}
+	e.buf = append(e.buf, Magic...)
+	e.uint(Version)
+
+	e.bytes(b.Instructions)
+	e.uint(uint64(b.NumLocals))
+
+	e.uint(uint64(len(b.Constants)))
+	for _, c := range b.Constants {
+		if err := e.constant(c); err != nil {
+			return err
+		}
+	}
+
+	e.strings(b.Builtins)
+	e.strings(b.Globals)
+	e.lines(b.Lines)
+
+	_, err := w.Write(e.buf)
+	return err
+}
+
+// Reads a program written by Encode, it has to pass Verify
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBytecode(data) {
+		return nil, errors.New("not a compiled monkey program")
+	}
+
+	d := &decoder{data: data, pos: len(Magic)}
+	if version := d.uint(); d.err == nil && version != Version {
+		return nil, fmt.Errorf("compiled for bytecode version %d, this monkey runs version %d", version, Version)
+	}
+
+	b := &Bytecode{}
+	b.Instructions = d.bytes()
+	b.NumLocals = d.int()
+
+	numConstants := d.length()
+	b.Constants = make([]object.Object, 0, numConstants)
+	for i := 0; i < numConstants && d.err == nil; i++ {
+		b.Constants = append(b.Constants, d.constant())
+	}
+
+	b.Builtins = d.strings()
+	b.Globals = d.strings()
+	b.Lines = d.lines()
+
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("unexpected data after the program")
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := Verify(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint(n uint64) {
+	e.buf = binary.AppendUvarint(e.buf, n)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) strings(s []string) {
+	e.uint(uint64(len(s)))
+	for _, str := range s {
+		e.bytes([]byte(str))
+	}
+}
+
+func (e *encoder) lines(t code.LineTable) {
+	e.uint(uint64(len(t)))
+	offset := 0
+	for _, entry := range t {
+		e.uint(uint64(entry.Offset - offset))
+		e.uint(uint64(entry.Pos.Line))
+		e.uint(uint64(entry.Pos.Column))
+		e.bytes([]byte(entry.Pos.File))
+		offset = entry.Offset
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.buf = append(e.buf, integerConstant)
+		e.buf = binary.AppendVarint(e.buf, obj.Value)
+	case *object.String:
+		e.buf = append(e.buf, stringConstant)
+		e.bytes([]byte(obj.Value))
+	case *object.CompiledFunction:
+		e.buf = append(e.buf, functionConstant)
+		e.bytes(obj.Instructions)
+		e.uint(uint64(obj.NumLocals))
+		e.uint(uint64(obj.NumParameters))
+		e.bytes([]byte(obj.Name))
+		e.lines(obj.Lines)
+	default:
+		return fmt.Errorf("can't encode a constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+// Stops at the first error, everything read after it is zero
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("corrupted bytecode at byte %d: %s", d.pos, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) uint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data[d.pos:])
+	if size <= 0 {
+		d.fail("bad number")
+		return 0
+	}
+	d.pos += size
+	return n
+}
+
+// A count or size, which can't be more than what's left of the data
+func (d *decoder) length() int {
+	n := d.uint()
+	if n > uint64(len(d.data)-d.pos) {
+		d.fail("length %d is longer than the rest", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) int() int {
+	n := d.uint()
+	if n > 1<<31 {
+		d.fail("number %d is too large", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.length()
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data[d.pos:])
+	d.pos += n
+	return b
+}
+
+func (d *decoder) strings() []string {
+	n := d.length()
+	s := make([]string, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		s = append(s, string(d.bytes()))
+	}
+	return s
+}
+
+func (d *decoder) lines() code.LineTable {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	t := make(code.LineTable, 0, n)
+	offset := 0
+	for i := 0; i < n && d.err == nil; i++ {
+		offset += d.int()
+		t = append(t, code.LineEntry{Offset: offset, Pos: token.Position{Line: d.int(), Column: d.int(), File: string(d.bytes())}})
+	}
+	return t
+}
+
+func (d *decoder) constant() object.Object {
+	if d.pos >= len(d.data) {
+		d.fail("missing constant")
+		return nil
+	}
+	kind := d.data[d.pos]
+	d.pos++
+
+	switch kind {
+	case integerConstant:
+		n, size := binary.Varint(d.data[d.pos:])
+		if size <= 0 {
+			d.fail("bad integer")
+			return nil
+		}
+		d.pos += size
+		return object.NewInteger(n)
+	case stringConstant:
+		return &object.String{Value: string(d.bytes())}
+	case functionConstant:
+		return &object.CompiledFunction{
+			Instructions:  code.Instructions(d.bytes()),
+			NumLocals:     d.int(),
+			NumParameters: d.int(),
+			Name:          string(d.bytes()),
+			Lines:         d.lines(),
+		}
+	default:
+		d.pos--
+		d.fail("unknown kind of constant %d", kind)
+		return nil
+	}
+}
@@ -0,0 +1,157 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	inputs := []string{
+		"1 + 2",
+		`let greet = fn(name) { "Hi " + name }; greet("you")`,
+		"let adder = fn(x) { fn(y) { x + y } }; adder(-2)(9223372036854775807)",
+		`for (i in 0..3) { puts(len([i])) }`,
+		"",
+	}
+
+	for _, input := range inputs {
+		compiler := New()
+		if err := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		original := compiler.Bytecode()
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, original); err != nil {
+			t.Fatalf("encode error for %q: %s", input, err)
+		}
+		if !IsBytecode(buf.Bytes()) {
+			t.Fatalf("encoded %q doesn't start with the magic header", input)
+		}
+
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("decode error for %q: %s", input, err)
+		}
+
+		if !bytes.Equal(decoded.Instructions, original.Instructions) {
+			t.Errorf("%q: wrong instructions.\nwant=%v\ngot=%v", input, original.Instructions, decoded.Instructions)
+		}
+		if decoded.NumLocals != original.NumLocals {
+			t.Errorf("%q: wrong number of locals. want=%d, got=%d", input, original.NumLocals, decoded.NumLocals)
+		}
+		if fmt.Sprint(decoded.Globals) != fmt.Sprint(original.Globals) ||
+			fmt.Sprint(decoded.Builtins) != fmt.Sprint(original.Builtins) {
+			t.Errorf("%q: wrong names. want=%v %v, got=%v %v", input,
+				original.Globals, original.Builtins, decoded.Globals, decoded.Builtins)
+		}
+		if fmt.Sprint(decoded.Lines) != fmt.Sprint(original.Lines) {
+			t.Errorf("%q: wrong line table. want=%v, got=%v", input, original.Lines, decoded.Lines)
+		}
+		if len(decoded.Constants) != len(original.Constants) {
+			t.Fatalf("%q: wrong number of constants. want=%d, got=%d", input, len(original.Constants), len(decoded.Constants))
+		}
+		for i, constant := range original.Constants {
+			if err := testDecodedConstant(constant, decoded.Constants[i]); err != nil {
+				t.Errorf("%q: constant %d: %s", input, i, err)
+			}
+		}
+	}
+}
+
+func testDecodedConstant(expected, actual object.Object) error {
+	switch expected := expected.(type) {
+	case *object.Integer:
+		return testIntegerObject(expected.Value, actual)
+	case *object.String:
+		return testStringObject(expected.Value, actual)
+	case *object.CompiledFunction:
+		fn, ok := actual.(*object.CompiledFunction)
+		if !ok {
+			return fmt.Errorf("not a function: %T", actual)
+		}
+		if !bytes.Equal(fn.Instructions, expected.Instructions) ||
+			fn.NumLocals != expected.NumLocals ||
+			fn.NumParameters != expected.NumParameters ||
+			fn.Name != expected.Name ||
+			fmt.Sprint(fn.Lines) != fmt.Sprint(expected.Lines) {
+			return fmt.Errorf("wrong function. want=%+v, got=%+v", expected, fn)
+		}
+	}
+	return nil
+}
+
+func TestDecodeErrors(t *testing.T) {
+	compiler := New()
+	if err := compiler.Compile(parse(`let f = fn(x) { x + "a" }; f`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, compiler.Bytecode()); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	encoded := buf.Bytes()
+
+	otherVersion := append([]byte{}, Magic...)
+	otherVersion = append(otherVersion, Version+1)
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a compiled monkey program"},
+		{otherVersion, fmt.Sprintf("compiled for bytecode version %d, this monkey runs version %d", Version+1, Version)},
+		{encoded[:len(encoded)-3], "corrupted bytecode"},
+		{append(append([]byte{}, encoded...), 0), "unexpected data after the program"},
+		{append(append([]byte{}, Magic...), Version, 200, 1), "longer than the rest"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected an error with %q, got=%v", tt.expected, err)
+		}
+	}
+
+	// every prefix of a program is an error and not a panic
+	for i := range encoded {
+		if _, err := Decode(bytes.NewReader(encoded[:i])); err == nil {
+			t.Errorf("expected an error for the first %d bytes", i)
+		}
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	b := &Bytecode{Constants: []object.Object{object.TRUE}}
+	err := Encode(&bytes.Buffer{}, b)
+	if err == nil || err.Error() != "can't encode a constant of type BOOLEAN" {
+		t.Errorf("expected an error for the boolean, got=%v", err)
+	}
+}
+
+// Compiling the same program again writes the same bytes, whatever order
+// Go's maps of the AST come out in
+func TestEncodeIsReproducible(t *testing.T) {
+	input := `let h = {"b": 1, "a": 2, "a": 3, "c": {"e": 4, "d": 5}}; h.a`
+
+	var first []byte
+	for i := 0; i < 20; i++ {
+		compiler := New()
+		if err := compiler.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, compiler.Bytecode()); err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+
+		if first == nil {
+			first = buf.Bytes()
+		} else if !bytes.Equal(buf.Bytes(), first) {
+			t.Fatalf("compilation %d was encoded differently", i)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package compiler
+
+import (
+	"monkey/ast"
+	"monkey/code"
+	"monkey/object"
+)
+
+// Constant folding, it runs with the optimizer: a prefix or infix
+// expression of literals is computed while compiling and only its value
+// is emitted, e.g. `2 * 3 + 1` becomes the constant 7. It only folds
+// what the VM computes the same way every time, an expression which
+// would be an error (a division by zero, a type mismatch) is left for
+// the VM to report
+func (c *Compiler) foldConstant(node ast.Expression) bool {
+	obj, ok := fold(node)
+	if !ok {
+		return false
+	}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		key := constantKey{kind: object.INTEGER_OBJ, integer: obj.Value}
+		c.emit(code.OpConstant, c.addLiteral(key, obj))
+	case *object.String:
+		key := constantKey{kind: object.STRING_OBJ, str: obj.Value}
+		c.emit(code.OpConstant, c.addLiteral(key, obj))
+	case *object.Boolean:
+		if obj.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	}
+	return true
+}
+
+// The value of a constant expression, false when it isn't one
+func fold(node ast.Expression) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return object.NewInteger(node.Value), true
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}, true
+	case *ast.Boolean:
+		return nativeBool(node.Value), true
+
+	case *ast.PrefixExpression:
+		right, ok := fold(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldPrefix(node.Operator, right)
+
+	case *ast.InfixExpression:
+		if node.Operator == "??" || node.Operator == ".." {
+			return nil, false
+		}
+		left, ok := fold(node.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := fold(node.Right)
+		if !ok {
+			return nil, false
+		}
+		return foldInfix(node.Operator, left, right)
+	}
+	return nil, false
+}
+
+func foldPrefix(operator string, right object.Object) (object.Object, bool) {
+	switch operator {
+	case "!":
+		// only false is falsy of the constants
+		return nativeBool(right == object.FALSE), true
+	case "-":
+		if right, ok := right.(*object.Integer); ok {
+			return object.NewInteger(-right.Value), true
+		}
+	}
+	return nil, false
+}
+
+// Integers overflow by wrapping around like in the VM
+func foldInfix(operator string, left, right object.Object) (object.Object, bool) {
+	switch left := left.(type) {
+	case *object.Integer:
+		right, ok := right.(*object.Integer)
+		if !ok {
+			break
+		}
+		switch operator {
+		case "+":
+			return object.NewInteger(left.Value + right.Value), true
+		case "-":
+			return object.NewInteger(left.Value - right.Value), true
+		case "*":
+			return object.NewInteger(left.Value * right.Value), true
+		case "/":
+			if right.Value != 0 {
+				return object.NewInteger(left.Value / right.Value), true
+			}
+		case ">":
+			return nativeBool(left.Value > right.Value), true
+		case "<":
+			return nativeBool(left.Value < right.Value), true
+		case "==":
+			return nativeBool(left.Value == right.Value), true
+		case "!=":
+			return nativeBool(left.Value != right.Value), true
+		}
+
+	case *object.String:
+		right, ok := right.(*object.String)
+		if !ok {
+			break
+		}
+		switch operator {
+		case "+":
+			return &object.String{Value: left.Value + right.Value}, true
+		case "==":
+			return nativeBool(left.Value == right.Value), true
+		case "!=":
+			return nativeBool(left.Value != right.Value), true
+		}
+
+	case *object.Boolean:
+		right, ok := right.(*object.Boolean)
+		if !ok {
+			break
+		}
+		switch operator {
+		case "==":
+			return nativeBool(left == right), true
+		case "!=":
+			return nativeBool(left != right), true
+		}
+	}
+	return nil, false
+}
+
+func nativeBool(b bool) *object.Boolean {
+	if b {
+		return object.TRUE
+	}
+	return object.FALSE
+}
@@ -0,0 +1,55 @@
+package compiler
+
+import "monkey/code"
+
+// The superinstructions of the sequences OpGetLocal, OpConstant and the
+// operation
+var localConstantOperations = map[code.Opcode]code.Opcode{
+	code.OpAdd: code.OpGetLocalConstantAdd,
+	code.OpSub: code.OpGetLocalConstantSub,
+}
+
+// The superinstructions of a comparison and the OpJumpNotTruthy after it
+var comparisonJumps = map[code.Opcode]code.Opcode{
+	code.OpEqual:       code.OpEqualJumpNotTruthy,
+	code.OpNotEqual:    code.OpNotEqualJumpNotTruthy,
+	code.OpGreaterThan: code.OpGreaterThanJumpNotTruthy,
+	code.OpLessThan:    code.OpLessThanJumpNotTruthy,
+}
+
+// The last pass of the optimizer, it replaces the hot sequences of a loop
+// or a recursive function like `i + 1` of a local or `n < 2` of an if by
+// their superinstructions. The first instruction of a sequence becomes
+// the superinstruction, so a jump to it still goes there. Nothing may
+// jump into the middle of one. Its position in the source is the one of
+// the operation, which is what can fail
+func fuseInstructions(list []*instruction) {
+	targets := jumpTargets(list)
+	live := liveInstructions(list)
+
+	for i := 0; i < len(live); i++ {
+		in := live[i]
+		next := live[i+1 : min(i+3, len(live))]
+
+		if len(next) == 2 && in.op == code.OpGetLocal && next[0].op == code.OpConstant &&
+			!targets[next[0].pos] && !targets[next[1].pos] {
+			if fused, ok := localConstantOperations[next[1].op]; ok {
+				in.op = fused
+				in.operands = []int{in.operands[0], next[0].operands[0]}
+				in.source = next[1].source
+				next[0].removed = true
+				next[1].removed = true
+				i += 2
+				continue
+			}
+		}
+
+		if fused, ok := comparisonJumps[in.op]; ok && len(next) > 0 &&
+			next[0].op == code.OpJumpNotTruthy && !targets[next[0].pos] {
+			in.op = fused
+			in.operands = []int{next[0].operands[0]}
+			next[0].removed = true
+			i++
+		}
+	}
+}
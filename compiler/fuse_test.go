@@ -0,0 +1,148 @@
+package compiler
+
+import (
+	"monkey/code"
+	"testing"
+)
+
+func TestSuperinstructions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(n) { n + 1; n - 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpGetLocalConstantAdd, 0, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocalConstantSub, 0, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// only a local and a constant in this order
+			input: "fn(n) { 1 + n; n * 2; n + n }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpMul),
+					code.Make(code.OpPop),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; if (x < 2) { 3 }",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThanJumpNotTruthy, 21),
+				// 0015
+				code.Make(code.OpConstant, 2),
+				// 0018
+				code.Make(code.OpJump, 22),
+				// 0021
+				code.Make(code.OpNull),
+				// 0022
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; if (x != 2) { 3 } else { if (x == 1) { 4 } }",
+			expectedConstants: []interface{}{1, 2, 3, 4},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpNotEqualJumpNotTruthy, 21),
+				// 0015
+				code.Make(code.OpConstant, 2),
+				// 0018
+				code.Make(code.OpJump, 37),
+				// 0021
+				code.Make(code.OpGetGlobal, 0),
+				// 0024
+				code.Make(code.OpConstant, 0),
+				// 0027
+				code.Make(code.OpEqualJumpNotTruthy, 36),
+				// 0030
+				code.Make(code.OpConstant, 3),
+				// 0033
+				code.Make(code.OpJump, 37),
+				// 0036
+				code.Make(code.OpNull),
+				// 0037
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the jump of ?? goes to OpJumpNotTruthy, so it stays apart
+			input: "fn(n) { if (n ?? n > 2) { 1 } }",
+			expectedConstants: []interface{}{
+				2,
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpGetLocal, 0),
+					// 0002
+					code.Make(code.OpJumpNotNull, 11),
+					// 0005
+					code.Make(code.OpGetLocal, 0),
+					// 0007
+					code.Make(code.OpConstant, 0),
+					// 0010
+					code.Make(code.OpGreaterThan),
+					// 0011
+					code.Make(code.OpJumpNotTruthy, 20),
+					// 0014
+					code.Make(code.OpConstant, 1),
+					// 0017
+					code.Make(code.OpJump, 21),
+					// 0020
+					code.Make(code.OpNull),
+					// 0021
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, tests, Options{Optimize: true})
+}
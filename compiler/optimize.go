@@ -0,0 +1,262 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"monkey/token"
+)
+
+// One instruction of the function being optimized, removed ones are
+// dropped when the instructions are encoded again
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	pos      int
+	removed  bool
+	// Where it comes from in the source, see code.LineTable
+	source token.Position
+}
+
+// The peephole optimizer, it runs over the instructions of a function
+// (or of the main program) once they are all emitted:
+//
+//   - a push without side effects right before an OpPop goes away with it
+//   - !! before a conditional jump and !!! are collapsed, the negation of
+//     a negated integer constant is the constant
+//   - a jump to an OpJump jumps to where that one goes
+//   - code after a return or a jump which nothing jumps to is dropped
+//   - at last hot sequences become superinstructions, see fuseInstructions
+//
+// Jump operands and the line table are moved to the new positions. In
+// the main program the last OpPop stays, its value is the result of the
+// program
+func (c *Compiler) optimizeInstructions(ins code.Instructions, lines code.LineTable, main bool) (code.Instructions, code.LineTable) {
+	list, ok := decodeInstructions(ins, lines)
+	if !ok {
+		return ins, lines
+	}
+
+	for changed := true; changed; {
+		changed = false
+		targets := jumpTargets(list)
+
+		// A jump to a removed instruction goes to the next one, which
+		// becomes a target itself
+		remove := func(removed ...*instruction) {
+			for _, r := range removed {
+				r.removed = true
+				if targets[r.pos] {
+					if next := instructionAt(list, r.pos); next != nil {
+						targets[next.pos] = true
+					}
+				}
+			}
+			changed = true
+		}
+
+		live := liveInstructions(list)
+		for i, in := range live {
+			if in.removed {
+				continue
+			}
+			next := followingInstructions(live, i, 3)
+
+			switch {
+			case isDeadAfter(live, i, targets):
+				remove(in)
+
+			case len(next) > 0 && next[0].op == code.OpPop && !targets[next[0].pos] &&
+				hasNoSideEffects(in) && !(main && isLast(live, next[0])):
+				remove(in, next[0])
+
+			case in.op == code.OpBang && len(next) > 1 && next[0].op == code.OpBang &&
+				(next[1].op == code.OpJumpNotTruthy || next[1].op == code.OpBang) &&
+				!targets[next[0].pos] && !targets[next[1].pos]:
+				remove(in, next[0])
+
+			case in.op == code.OpMinus && len(next) > 0 && next[0].op == code.OpMinus &&
+				!targets[in.pos] && !targets[next[0].pos] && i > 0 && c.isIntegerConstant(live[i-1]):
+				remove(in, next[0])
+
+			case isJump(in.op):
+				if target := finalTarget(list, in.operands[0]); target != in.operands[0] {
+					in.operands[0] = target
+					changed = true
+				}
+				// a jump to the next instruction does nothing
+				if in.op == code.OpJump && len(next) > 0 && instructionAt(list, in.operands[0]) == next[0] {
+					remove(in)
+				}
+			}
+		}
+	}
+
+	fuseInstructions(list)
+	return encodeInstructions(list)
+}
+
+func decodeInstructions(ins code.Instructions, lines code.LineTable) ([]*instruction, bool) {
+	list := []*instruction{}
+	for i := 0; i < len(ins); {
+		_, operands, width, err := code.ReadInstruction(ins, i)
+		if err != nil {
+			return nil, false
+		}
+		list = append(list, &instruction{op: code.Opcode(ins[i]), operands: operands, pos: i, source: lines.Position(i)})
+		i += width
+	}
+	return list, true
+}
+
+// The positions something jumps to, OpIterNext's end too
+func jumpTargets(list []*instruction) map[int]bool {
+	targets := map[int]bool{}
+	for _, in := range list {
+		if in.removed {
+			continue
+		}
+		for i, kind := range code.OperandKinds(in.op) {
+			if kind != code.JumpOperand {
+				continue
+			}
+			if target := instructionAt(list, in.operands[i]); target != nil {
+				targets[target.pos] = true
+			}
+		}
+	}
+	return targets
+}
+
+func liveInstructions(list []*instruction) []*instruction {
+	live := []*instruction{}
+	for _, in := range list {
+		if !in.removed {
+			live = append(live, in)
+		}
+	}
+	return live
+}
+
+func followingInstructions(live []*instruction, i, n int) []*instruction {
+	end := min(i+1+n, len(live))
+	next := []*instruction{}
+	for _, in := range live[i+1 : end] {
+		if !in.removed {
+			next = append(next, in)
+		}
+	}
+	return next
+}
+
+func isLast(live []*instruction, in *instruction) bool {
+	for i := len(live) - 1; i >= 0; i-- {
+		if !live[i].removed {
+			return live[i] == in
+		}
+	}
+	return false
+}
+
+// Nothing can reach an instruction after an unconditional return or jump
+// unless something jumps to it
+func isDeadAfter(live []*instruction, i int, targets map[int]bool) bool {
+	if targets[live[i].pos] {
+		return false
+	}
+	for j := i - 1; j >= 0; j-- {
+		if live[j].removed {
+			continue
+		}
+		switch live[j].op {
+		case code.OpReturnValue, code.OpReturn, code.OpJump:
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// Pushes which can't fail and change nothing else, OpGetGlobal can fail
+// for a name which isn't defined
+func hasNoSideEffects(in *instruction) bool {
+	switch in.op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull,
+		code.OpGetLocal, code.OpGetFree, code.OpGetBuiltin:
+		return true
+	case code.OpClosure:
+		return in.operands[1] == 0
+	}
+	return false
+}
+
+func (c *Compiler) isIntegerConstant(in *instruction) bool {
+	if in.removed || in.op != code.OpConstant {
+		return false
+	}
+	_, ok := c.constants[in.operands[0]].(*object.Integer)
+	return ok
+}
+
+func isJump(op code.Opcode) bool {
+	return op == code.OpJump || op == code.OpJumpNotTruthy || op == code.OpJumpNotNull
+}
+
+// Follows OpJumps from pos, a loop of jumps stops where it started
+func finalTarget(list []*instruction, pos int) int {
+	seen := map[int]bool{}
+	for !seen[pos] {
+		seen[pos] = true
+		in := instructionAt(list, pos)
+		if in == nil || in.op != code.OpJump {
+			return pos
+		}
+		pos = in.operands[0]
+	}
+	return pos
+}
+
+// The instruction at pos, or the first one after it which isn't removed
+func instructionAt(list []*instruction, pos int) *instruction {
+	for _, in := range list {
+		if in.pos >= pos && !in.removed {
+			return in
+		}
+	}
+	return nil
+}
+
+// Encodes the instructions which are left, a jump to a removed
+// instruction goes to the next one which isn't
+func encodeInstructions(list []*instruction) (code.Instructions, code.LineTable) {
+	newPos := map[int]int{}
+	pos := 0
+	for _, in := range list {
+		newPos[in.pos] = pos
+		if !in.removed {
+			pos += len(code.Make(in.op, in.operands...))
+		}
+	}
+	end := pos
+
+	out := code.Instructions{}
+	var lines code.LineTable
+	for _, in := range list {
+		if in.removed {
+			continue
+		}
+		lines = lines.Add(len(out), in.source)
+		operands := append([]int{}, in.operands...)
+		for i, kind := range code.OperandKinds(in.op) {
+			if kind != code.JumpOperand {
+				continue
+			}
+			if p, ok := newPos[operands[i]]; ok {
+				operands[i] = p
+			} else {
+				operands[i] = end
+			}
+		}
+		out = append(out, code.Make(in.op, operands...)...)
+	}
+	return out, lines
+}
@@ -0,0 +1,158 @@
+package compiler
+
+import (
+	"monkey/code"
+	"testing"
+)
+
+func TestOptimizer(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// the value of the last one is the program's
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				// can fail when x isn't defined, so it stays
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (!!true) { 1 }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let t = true; !!!t",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpBang),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// a negated string is still an error
+			input:             `--"a"`,
+			expectedConstants: []interface{}{"a"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { return 1; 2 }",
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the inner if's jump over its alternative goes to the end
+			input:             "if (true) { 1 } else { if (false) { 2 } else { 3 } }",
+			expectedConstants: []interface{}{1, 2, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 23),
+				// 0010
+				code.Make(code.OpFalse),
+				// 0011
+				code.Make(code.OpJumpNotTruthy, 20),
+				// 0014
+				code.Make(code.OpConstant, 1),
+				// 0017
+				code.Make(code.OpJump, 23),
+				// 0020
+				code.Make(code.OpConstant, 2),
+				// 0023
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// the loop's end moves to what comes after it
+			input:             "let s = 0; for (i in 0..3) { i; s = s + i }; s",
+			expectedConstants: []interface{}{0, 3},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpConstant, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpRange),
+				// 0013
+				code.Make(code.OpIter),
+				// 0014
+				code.Make(code.OpIterNext, 1, 36),
+				// 0018
+				code.Make(code.OpSetLocal, 0),
+				// 0020
+				code.Make(code.OpGetGlobal, 0),
+				// 0023
+				code.Make(code.OpGetLocal, 0),
+				// 0025
+				code.Make(code.OpAdd),
+				// 0026
+				code.Make(code.OpSetGlobal, 0),
+				// 0029
+				code.Make(code.OpGetGlobal, 0),
+				// 0032
+				code.Make(code.OpPop),
+				// 0033
+				code.Make(code.OpJump, 14),
+				// 0036
+				code.Make(code.OpGetGlobal, 0),
+				// 0039
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTestsWithOptions(t, tests, Options{Optimize: true})
+}
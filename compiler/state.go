@@ -0,0 +1,78 @@
+package compiler
+
+import (
+	"maps"
+	"monkey/object"
+)
+
+// What the inputs of a REPL session share: the globals and builtins the
+// earlier inputs defined and their constants, so the next input can use
+// them. The VM keeps the values of the globals, see vm.NewWithGlobalsState
+type State struct {
+	symbolTable     *SymbolTable
+	constants       []object.Object
+	constantIndexes map[constantKey]int
+	builtinNames    []string
+}
+
+func NewState() *State {
+	return &State{
+		symbolTable:     NewSymbolTable(),
+		constants:       []object.Object{},
+		constantIndexes: map[constantKey]int{},
+	}
+}
+
+// How many globals the inputs so far defined, the VM needs them in the
+// slots below
+func (s *State) NumGlobals() int {
+	return s.symbolTable.NumDefinitions()
+}
+
+// Defines a global the inputs can use without a let, e.g. the last
+// result of a REPL, the VM keeps its value in the slot returned
+func (s *State) DefineGlobal(name string) int {
+	return s.symbolTable.Define(name).Index
+}
+
+// Compiles the next input of a session. The compiler works on a copy of
+// state, an input which doesn't compile leaves it alone, State gives the
+// state after the input
+func NewWithState(state *State, opts Options) *Compiler {
+	c := NewWithOptions(opts)
+	c.symbolTable = state.symbolTable.copy()
+	c.constants = append([]object.Object{}, state.constants...)
+	c.constantIndexes = maps.Clone(state.constantIndexes)
+	c.builtinNames = append([]string{}, state.builtinNames...)
+	return c
+}
+
+// The state for the input after the compiled one
+func (c *Compiler) State() *State {
+	return &State{
+		symbolTable:     c.symbolTable,
+		constants:       c.constants,
+		constantIndexes: c.constantIndexes,
+		builtinNames:    c.builtinNames,
+	}
+}
+
+// The names of the globals by their slot, "" for a slot whose global was
+// forgotten
+func (s *State) Globals() []string {
+	return s.symbolTable.Names()
+}
+
+// A copy of the state without the global name, later inputs don't know it
+// anymore. Its slot isn't used again. False if there is no such global
+func (s *State) Forget(name string) (*State, bool) {
+	symbol, ok := s.symbolTable.store[name]
+	if !ok || symbol.Scope != GlobalScope {
+		return s, false
+	}
+
+	c := *s
+	c.symbolTable = s.symbolTable.copy()
+	delete(c.symbolTable.store, name)
+	return &c, true
+}
@@ -0,0 +1,191 @@
+package compiler
+
+import "maps"
+
+type SymbolScope string
+
+const (
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
+	// A local of an enclosing function which a closure captures
+	FreeScope SymbolScope = "FREE"
+)
+
+// What the compiler knows about a name: where its value is kept and at
+// which index, the operand of the load and store instructions
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+	Const bool
+}
+
+// One table per function, the outermost one holds the globals
+// A loop body gets a block table, its names are locals of the function
+// around it (or of the main program) in slots after the function's own
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	store          map[string]Symbol
+	numDefinitions int
+
+	block bool
+	// The first slot of a block table
+	base int
+	// The slots the function needs including its blocks, see NumLocals
+	numLocals int
+	// Whether a closure captures one of the names defined here
+	captured bool
+
+	// The symbols of Outer this function captures, in the order of their
+	// FreeScope indexes
+	FreeSymbols []Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{store: map[string]Symbol{}}
+}
+
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	if outer.block {
+		s.base = outer.base + outer.numDefinitions
+	} else if outer.Outer != nil {
+		s.base = outer.numDefinitions
+	}
+	return s
+}
+
+// A copy of a table of globals, defining names in it leaves s alone
+func (s *SymbolTable) copy() *SymbolTable {
+	c := *s
+	c.store = maps.Clone(s.store)
+	return &c
+}
+
+// The table of the function (or the main program) a block belongs to
+func (s *SymbolTable) frame() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
+// Defining a name twice gives the symbol of the first definition, like
+// the evaluator a let of the same name overwrites the value
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && symbol.Scope != BuiltinScope && symbol.Scope != FreeScope {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name, Index: s.base + s.numDefinitions}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.store[name] = symbol
+	s.numDefinitions++
+
+	if symbol.Scope == LocalScope {
+		frame := s.frame()
+		frame.numLocals = max(frame.numLocals, symbol.Index+1)
+	}
+	return symbol
+}
+
+// Defines a name and marks it as a const, see Define
+func (s *SymbolTable) DefineConst(name string) Symbol {
+	symbol := s.Define(name)
+	symbol.Const = true
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope, Const: original.Const}
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Looks the name up in this table and then in the enclosing ones, a
+// local of an enclosing function becomes a free symbol of every function
+// in between
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+	if s.block {
+		return s.Outer.Resolve(name)
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok {
+		return symbol, ok
+	}
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+	if symbol.Scope == LocalScope {
+		s.Outer.markCaptured(name)
+	}
+
+	return s.defineFree(symbol), true
+}
+
+// Marks the table the name was resolved in, the first one which has it
+func (s *SymbolTable) markCaptured(name string) {
+	for t := s; t != nil; t = t.Outer {
+		if _, ok := t.store[name]; ok {
+			t.captured = true
+			return
+		}
+	}
+}
+
+// The names of the definitions of this table by index, without the
+// ones of its blocks
+func (s *SymbolTable) Names() []string {
+	names := make([]string, s.numDefinitions)
+	for name, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			names[symbol.Index-s.base] = name
+		}
+	}
+	return names
+}
+
+func (s *SymbolTable) NumDefinitions() int {
+	return s.numDefinitions
+}
+
+// How many local slots a call of the function needs, the blocks of a
+// function share theirs once one loop is done. The globals of the main
+// program are not counted, only the locals of its loops
+func (s *SymbolTable) NumLocals() int {
+	return s.numLocals
+}
+
+// Whether the name is a const defined in this table itself
+func (s *SymbolTable) isConst(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Const
+}
@@ -0,0 +1,298 @@
+package compiler
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+)
+
+// Local operands are one byte
+const maxLocals = 256
+
+// Checks a program which didn't come from this compiler, e.g. one Decode
+// read from a .mbc file, so running it can't crash the VM: every
+// instruction decodes and its operands refer to constants, locals,
+// builtins and free variables which exist, jumps land on an instruction
+// of the same function. The stack has to add up like the compiler leaves
+// it, the same number of values on every path to an instruction and never
+// fewer than an instruction takes. OpIterNext has to find the iterator of
+// an OpIter, OpClosure the cells of OpCaptureLocal and OpCaptureFree, and
+// a function has to return instead of running past its end
+func Verify(b *Bytecode) error {
+	v := &verifier{b: b, free: map[int]int{}}
+
+	main := &object.CompiledFunction{Instructions: b.Instructions, NumLocals: b.NumLocals}
+	if err := v.function(main, -1); err != nil {
+		return err
+	}
+	for i, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if err := v.function(fn, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	// a closure needs a cell for every free variable its function uses
+	for _, cl := range v.closures {
+		if need := v.free[cl.constant]; cl.numFree < need {
+			return fmt.Errorf("invalid bytecode in %s: OpClosure at %d captures %d variables, the function uses %d",
+				cl.in, cl.pos, cl.numFree, need)
+		}
+	}
+	return nil
+}
+
+type verifier struct {
+	b *Bytecode
+	// How many free variables each function constant uses
+	free     map[int]int
+	closures []verifiedClosure
+}
+
+type verifiedClosure struct {
+	in       string
+	pos      int
+	constant int
+	numFree  int
+}
+
+// What a value on the stack is, only the instructions which take an
+// iterator or cells care
+type slotKind byte
+
+const (
+	valueSlot slotKind = iota
+	iteratorSlot
+	cellSlot
+)
+
+type verifiedInstruction struct {
+	op       code.Opcode
+	operands []int
+	pos      int
+	next     int
+}
+
+// index is the constant of the function, -1 for the main program
+func (v *verifier) function(fn *object.CompiledFunction, index int) error {
+	name := "the main program"
+	if index >= 0 {
+		name = fmt.Sprintf("function %d", index)
+		if fn.Name != "" {
+			name = fmt.Sprintf("function %s", fn.Name)
+		}
+	}
+	fail := func(format string, a ...interface{}) error {
+		return fmt.Errorf("invalid bytecode in %s: %s", name, fmt.Sprintf(format, a...))
+	}
+
+	if fn.NumLocals < 0 || fn.NumLocals > maxLocals {
+		return fail("%d locals, there can be at most %d", fn.NumLocals, maxLocals)
+	}
+	if fn.NumParameters < 0 || fn.NumParameters > fn.NumLocals {
+		return fail("%d parameters but %d locals", fn.NumParameters, fn.NumLocals)
+	}
+
+	ins := fn.Instructions
+	list := []*verifiedInstruction{}
+	byPos := map[int]*verifiedInstruction{}
+	for i := 0; i < len(ins); {
+		def, operands, width, err := code.ReadInstruction(ins, i)
+		if err != nil {
+			return fail("at %d: %s", i, err)
+		}
+		in := &verifiedInstruction{op: code.Opcode(ins[i]), operands: operands, pos: i, next: i + width}
+		list = append(list, in)
+		byPos[i] = in
+
+		if err := v.operands(fn, index, in); err != nil {
+			return fail("%s at %d: %s", def.Name, i, err)
+		}
+		i += width
+	}
+
+	for _, in := range list {
+		for j, kind := range code.OperandKinds(in.op) {
+			target := in.operands[j]
+			if _, ok := byPos[target]; kind == code.JumpOperand && !ok && target != len(ins) {
+				return fail("%s at %d: jump to %d is not an instruction", opName(in.op), in.pos, target)
+			}
+		}
+		if in.op == code.OpClosure {
+			v.closures = append(v.closures, verifiedClosure{in: name, pos: in.pos, constant: in.operands[0], numFree: in.operands[1]})
+		}
+	}
+
+	return v.stack(fn, index < 0, byPos, fail)
+}
+
+func (v *verifier) operands(fn *object.CompiledFunction, index int, in *verifiedInstruction) error {
+	for j, kind := range code.OperandKinds(in.op) {
+		operand := in.operands[j]
+		switch kind {
+		case code.ConstantOperand:
+			if operand >= len(v.b.Constants) {
+				return fmt.Errorf("constant %d doesn't exist, there are %d", operand, len(v.b.Constants))
+			}
+			constant := v.b.Constants[operand]
+			switch in.op {
+			case code.OpClosure:
+				if _, ok := constant.(*object.CompiledFunction); !ok {
+					return fmt.Errorf("constant %d is a %s, not a function", operand, constant.Type())
+				}
+			case code.OpMember:
+				if _, ok := constant.(*object.String); !ok {
+					return fmt.Errorf("constant %d is a %s, not a name", operand, constant.Type())
+				}
+			}
+
+		case code.LocalOperand:
+			last := operand
+			if in.op == code.OpClearLocals {
+				last = operand + in.operands[j+1] - 1
+			}
+			if last >= fn.NumLocals {
+				return fmt.Errorf("local %d doesn't exist, there are %d", last, fn.NumLocals)
+			}
+
+		case code.FreeOperand:
+			if index < 0 {
+				return fmt.Errorf("the main program has no free variables")
+			}
+			v.free[index] = max(v.free[index], operand+1)
+
+		case code.BuiltinOperand:
+			if operand >= len(v.b.Builtins) {
+				return fmt.Errorf("builtin %d doesn't exist, there are %d", operand, len(v.b.Builtins))
+			}
+
+		case code.FlagOperand:
+			if operand > 1 {
+				return fmt.Errorf("flag %d is not 0 or 1", operand)
+			}
+		}
+	}
+
+	switch in.op {
+	case code.OpHash:
+		if in.operands[0]%2 != 0 {
+			return fmt.Errorf("%d values are not pairs of keys and values", in.operands[0])
+		}
+	case code.OpIterNext:
+		if n := in.operands[0]; n != 1 && n != 2 {
+			return fmt.Errorf("%d loop variables, there can be 1 or 2", n)
+		}
+	case code.OpReturn:
+		if index < 0 {
+			return fmt.Errorf("the main program can only return a value")
+		}
+	}
+	return nil
+}
+
+// Follows every path through the function with what's on the stack, like
+// the register VM's translation does
+func (v *verifier) stack(fn *object.CompiledFunction, main bool, byPos map[int]*verifiedInstruction,
+	fail func(string, ...interface{}) error) error {
+	end := len(fn.Instructions)
+	stacks := map[int][]slotKind{}
+	work := []int{}
+
+	visit := func(pos int, stack []slotKind) error {
+		if pos == end {
+			if !main {
+				return fail("runs past its last instruction without returning")
+			}
+			return nil
+		}
+		known, ok := stacks[pos]
+		if !ok {
+			stacks[pos] = stack
+			work = append(work, pos)
+			return nil
+		}
+		if len(known) != len(stack) {
+			return fail("%d values on the stack at %d on one path and %d on another", len(known), pos, len(stack))
+		}
+		for i := range known {
+			if known[i] != stack[i] {
+				return fail("value %d on the stack at %d is different on two paths", i, pos)
+			}
+		}
+		return nil
+	}
+
+	if err := visit(0, []slotKind{}); err != nil {
+		return err
+	}
+	for len(work) > 0 {
+		in := byPos[work[len(work)-1]]
+		work = work[:len(work)-1]
+		stack := stacks[in.pos]
+
+		pops, pushes := code.StackEffect(in.op, in.operands)
+		if len(stack) < pops {
+			return fail("%s at %d takes %d values from a stack of %d", opName(in.op), in.pos, pops, len(stack))
+		}
+		taken := stack[len(stack)-pops:]
+
+		pushed := valueSlot
+		switch in.op {
+		case code.OpIterNext:
+			if len(stack) == 0 || stack[len(stack)-1] != iteratorSlot {
+				return fail("OpIterNext at %d has no iterator on the stack", in.pos)
+			}
+		case code.OpClosure:
+			for _, kind := range taken {
+				if kind != cellSlot {
+					return fail("OpClosure at %d captures values which aren't cells", in.pos)
+				}
+			}
+		case code.OpIter:
+			pushed = iteratorSlot
+		case code.OpCaptureLocal, code.OpCaptureFree:
+			pushed = cellSlot
+		}
+
+		after := append([]slotKind{}, stack[:len(stack)-pops]...)
+		for i := 0; i < pushes; i++ {
+			after = append(after, pushed)
+		}
+
+		var err error
+		switch in.op {
+		case code.OpJump:
+			err = visit(in.operands[0], after)
+		case code.OpJumpNotTruthy, code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+			code.OpGreaterThanJumpNotTruthy, code.OpLessThanJumpNotTruthy:
+			if err = visit(in.operands[0], after); err == nil {
+				err = visit(in.next, after)
+			}
+		case code.OpJumpNotNull:
+			// the value stays when it jumps
+			if err = visit(in.operands[0], stack); err == nil {
+				err = visit(in.next, after)
+			}
+		case code.OpIterNext:
+			// the iterator is popped when it's done
+			if err = visit(in.operands[1], stack[:len(stack)-1]); err == nil {
+				err = visit(in.next, after)
+			}
+		case code.OpReturnValue, code.OpReturn:
+		default:
+			err = visit(in.next, after)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func opName(op code.Opcode) string {
+	if def, err := code.Lookup(byte(op)); err == nil {
+		return def.Name
+	}
+	return fmt.Sprintf("opcode %d", op)
+}
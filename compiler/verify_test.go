@@ -0,0 +1,182 @@
+package compiler
+
+import (
+	"monkey/code"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	fn := func(numLocals, numParameters int, ins ...code.Instructions) *object.CompiledFunction {
+		return &object.CompiledFunction{
+			Instructions:  concatInstructions(ins),
+			NumLocals:     numLocals,
+			NumParameters: numParameters,
+			Name:          "f",
+		}
+	}
+
+	tests := []struct {
+		bytecode *Bytecode
+		expected string
+	}{
+		{
+			&Bytecode{Instructions: code.Instructions{200}},
+			"in the main program: at 0: opcode 200 undefined",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 1)[:2]},
+			"in the main program: at 0:",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpConstant, 1), Constants: []object.Object{object.NewInteger(1)}},
+			"OpConstant at 0: constant 1 doesn't exist, there are 1",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpClosure, 0, 0), Constants: []object.Object{object.NewInteger(1)}},
+			"OpClosure at 0: constant 0 is a INTEGER, not a function",
+		},
+		{
+			&Bytecode{
+				Instructions: concatInstructions([]code.Instructions{code.Make(code.OpNull), code.Make(code.OpMember, 0, 0)}),
+				Constants:    []object.Object{object.NewInteger(1)},
+			},
+			"OpMember at 1: constant 0 is a INTEGER, not a name",
+		},
+		{
+			&Bytecode{
+				Instructions: concatInstructions([]code.Instructions{code.Make(code.OpNull), code.Make(code.OpMember, 0, 2)}),
+				Constants:    []object.Object{&object.String{Value: "a"}},
+			},
+			"OpMember at 1: flag 2 is not 0 or 1",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetLocal, 1), NumLocals: 1},
+			"OpGetLocal at 0: local 1 doesn't exist, there are 1",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpClearLocals, 1, 2), NumLocals: 2},
+			"OpClearLocals at 0: local 2 doesn't exist, there are 2",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetFree, 0)},
+			"OpGetFree at 0: the main program has no free variables",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpGetBuiltin, 1), Builtins: []string{"len"}},
+			"OpGetBuiltin at 0: builtin 1 doesn't exist, there are 1",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpHash, 3)},
+			"OpHash at 0: 3 values are not pairs of keys and values",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpReturn)},
+			"OpReturn at 0: the main program can only return a value",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpJump, 1)},
+			"OpJump at 0: jump to 1 is not an instruction",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpJump, 4)},
+			"OpJump at 0: jump to 4 is not an instruction",
+		},
+		{
+			&Bytecode{Instructions: code.Make(code.OpPop)},
+			"OpPop at 0 takes 1 values from a stack of 0",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 5),
+				code.Make(code.OpNull),
+				code.Make(code.OpPop),
+			})},
+			"0 values on the stack at 5 on one path and 1 on another",
+		},
+		{
+			// a loop which leaves one more value every time around
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpJump, 0),
+			})},
+			"0 values on the stack at 0 on one path and 1 on another",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpIterNext, 1, 0),
+			})},
+			"OpIterNext at 1 has no iterator on the stack",
+		},
+		{
+			&Bytecode{Instructions: concatInstructions([]code.Instructions{
+				code.Make(code.OpNull),
+				code.Make(code.OpIter),
+				code.Make(code.OpIterNext, 3, 7),
+			})},
+			"OpIterNext at 2: 3 loop variables, there can be 1 or 2",
+		},
+		{
+			&Bytecode{
+				Instructions: concatInstructions([]code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpClosure, 0, 1),
+				}),
+				Constants: []object.Object{fn(0, 0, code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue))},
+			},
+			"OpClosure at 1 captures values which aren't cells",
+		},
+		{
+			&Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{fn(0, 0, code.Make(code.OpGetFree, 0), code.Make(code.OpReturnValue))},
+			},
+			"in the main program: OpClosure at 0 captures 0 variables, the function uses 1",
+		},
+		{
+			&Bytecode{Constants: []object.Object{fn(0, 0, code.Make(code.OpNull), code.Make(code.OpPop))}},
+			"in function f: runs past its last instruction without returning",
+		},
+		{
+			&Bytecode{Constants: []object.Object{fn(1, 2, code.Make(code.OpReturn))}},
+			"in function f: 2 parameters but 1 locals",
+		},
+		{
+			&Bytecode{Constants: []object.Object{fn(300, 0, code.Make(code.OpReturn))}},
+			"in function f: 300 locals, there can be at most 256",
+		},
+	}
+
+	for _, tt := range tests {
+		err := Verify(tt.bytecode)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected an error with %q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestVerifyCompiled(t *testing.T) {
+	inputs := []string{
+		`let f = fn(a, b) { if (a > b) { a } else { b } }; f(1, 2)`,
+		`let counter = fn() { let n = 0; fn() { n = n + 1; n } }; counter()()`,
+		`for (k, v in {"a": 1}) { if (v == 1) { puts(k) } }; [1, 2][0] ?? 3`,
+		`let h = {"a": {"b": 1}}; h.a?.b; puts("${h.a.b}")`,
+		`let x = 0; for (i in 0..10) { let y = i; x = x + fn() { y }() }; x`,
+		`let fib = fn(n) { if (n < 2) { return n } fib(n - 1) + fib(n - 2) }; fib(10)`,
+	}
+
+	for _, input := range inputs {
+		for _, opts := range []Options{{}, {Optimize: true}} {
+			compiler := NewWithOptions(opts)
+			if err := compiler.Compile(parse(input)); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			if err := Verify(compiler.Bytecode()); err != nil {
+				t.Errorf("%q (optimized %t) doesn't verify: %s", input, opts.Optimize, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,301 @@
+// Reads monkey.toml (or .monkeyconfig), the settings of a project:
+//
+//	[limits]
+//	max_steps = 1_000_000  # evaluated nodes, instructions of compiled programs
+//	max_memory = 67108864  # bytes
+//	max_depth = 1000       # nested function calls
+//
+//	[sandbox]
+//	enabled = true                           # disables every capability
+//	disable = ["filesystem", "environment"]  # or only some of them
+//
+//	[modules]
+//	path = ["lib", "vendor"]      # relative to the file
+//
+//	[repl]
+//	prompt = "λ "
+//	color = false
+//	page_height = 40
+//	rc_file = "~/.monkeyrc"
+//	prelude = false
+//
+// The monkey command uses the first one it finds from the working
+// directory up, programs embedding the interpreter can Load one and use
+// Options and ApplyREPL
+//
+// Imports are looked up next to the importing module first, then in the
+// directories of [modules] path and at last in MONKEY_PATH
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"monkey/evaluator"
+	"monkey/repl"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Tried in this order in every directory
+var FileNames = []string{"monkey.toml", ".monkeyconfig"}
+
+type Config struct {
+	// The file it was read from
+	Path string
+
+	MaxSteps  int64
+	MaxMemory int64
+	MaxDepth  int
+
+	Disabled evaluator.Capability
+
+	// Absolute, in the order of the file
+	ModulePath []string
+
+	REPL REPLConfig
+}
+
+// The zero value leaves the defaults of the REPL alone
+type REPLConfig struct {
+	Prompt string
+	// nil means color when the output is a terminal
+	Color      *bool
+	PageHeight int
+	RCFile     string
+	NoPrelude  bool
+}
+
+// Looks for a configuration file in dir and its parents, the path is
+// empty when there is none
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range FileNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+func Load(path string) (*Config, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse(string(src), filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", path, err)
+	}
+	cfg.Path = path
+	return cfg, nil
+}
+
+// Parses the contents of a configuration file, relative module paths are
+// resolved against dir. Unknown tables and keys are errors, they are
+// usually typos
+func Parse(src, dir string) (*Config, error) {
+	tables, err := parseTOML(src)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	for name, t := range tables {
+		for key, v := range t {
+			if err := cfg.set(name, key, v, dir); err != nil {
+				return nil, fmt.Errorf("%d: %s", v.line, err)
+			}
+		}
+	}
+	return cfg, nil
+}
+
+func (c *Config) set(tableName, key string, v value, dir string) error {
+	name := key
+	if tableName != "" {
+		name = tableName + "." + key
+	}
+
+	switch name {
+	case "limits.max_steps":
+		return setInt(name, v, &c.MaxSteps)
+	case "limits.max_memory":
+		return setInt(name, v, &c.MaxMemory)
+	case "limits.max_depth":
+		var depth int64
+		err := setInt(name, v, &depth)
+		c.MaxDepth = int(depth)
+		return err
+
+	case "sandbox.enabled":
+		var enabled bool
+		if err := setBool(name, v, &enabled); err != nil {
+			return err
+		}
+		if enabled {
+			c.Disabled |= evaluator.AllCapabilities
+		}
+		return nil
+	case "sandbox.disable":
+		names, ok := v.v.([]string)
+		if !ok {
+			return fmt.Errorf("%s must be an array of capabilities", name)
+		}
+		for _, capName := range names {
+			capability, ok := parseCapability(capName)
+			if !ok {
+				return fmt.Errorf("unknown capability %q, want filesystem, stdin, time, random or environment", capName)
+			}
+			c.Disabled |= capability
+		}
+		return nil
+
+	case "modules.path":
+		dirs, ok := v.v.([]string)
+		if !ok {
+			return fmt.Errorf("%s must be an array of directories", name)
+		}
+		for _, path := range dirs {
+			path = expandHome(path)
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			c.ModulePath = append(c.ModulePath, filepath.Clean(path))
+		}
+		return nil
+
+	case "repl.prompt":
+		return setString(name, v, &c.REPL.Prompt)
+	case "repl.color":
+		var color bool
+		if err := setBool(name, v, &color); err != nil {
+			return err
+		}
+		c.REPL.Color = &color
+		return nil
+	case "repl.page_height":
+		var height int64
+		err := setInt(name, v, &height)
+		c.REPL.PageHeight = int(height)
+		return err
+	case "repl.rc_file":
+		if err := setString(name, v, &c.REPL.RCFile); err != nil {
+			return err
+		}
+		c.REPL.RCFile = expandHome(c.REPL.RCFile)
+		return nil
+	case "repl.prelude":
+		var prelude bool
+		err := setBool(name, v, &prelude)
+		c.REPL.NoPrelude = !prelude
+		return err
+	}
+
+	if tableName != "" && !knownTables[tableName] {
+		return fmt.Errorf("unknown table [%s]", tableName)
+	}
+	return fmt.Errorf("unknown setting %s", name)
+}
+
+var knownTables = map[string]bool{"limits": true, "sandbox": true, "modules": true, "repl": true}
+
+func setInt(name string, v value, dst *int64) error {
+	n, ok := v.v.(int64)
+	if !ok || n < 0 {
+		return fmt.Errorf("%s must be a number of at least 0", name)
+	}
+	*dst = n
+	return nil
+}
+
+func setBool(name string, v value, dst *bool) error {
+	b, ok := v.v.(bool)
+	if !ok {
+		return fmt.Errorf("%s must be true or false", name)
+	}
+	*dst = b
+	return nil
+}
+
+func setString(name string, v value, dst *string) error {
+	s, ok := v.v.(string)
+	if !ok {
+		return fmt.Errorf("%s must be a string", name)
+	}
+	*dst = s
+	return nil
+}
+
+func parseCapability(name string) (evaluator.Capability, bool) {
+	for _, capability := range []evaluator.Capability{evaluator.Filesystem, evaluator.Stdin, evaluator.Time, evaluator.Random, evaluator.Environment} {
+		if capability.String() == name {
+			return capability, true
+		}
+	}
+	return 0, false
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// The limits, sandbox and module path in opts, everything else is kept
+// A nil Config leaves opts alone
+func (c *Config) Options(opts evaluator.Options) evaluator.Options {
+	if c == nil {
+		return opts
+	}
+	if c.MaxSteps > 0 {
+		opts.MaxSteps = c.MaxSteps
+	}
+	if c.MaxMemory > 0 {
+		opts.MaxMemory = c.MaxMemory
+	}
+	if c.MaxDepth > 0 {
+		opts.MaxDepth = c.MaxDepth
+	}
+	opts.Disabled |= c.Disabled
+	opts.ModulePath = append(append([]string{}, opts.ModulePath...), c.ModulePath...)
+	return opts
+}
+
+// Sets the preferences of the [repl] table on cfg, cfg.Options is left
+// to Options
+func (c *Config) ApplyREPL(cfg *repl.Config) {
+	if c == nil {
+		return
+	}
+	if c.REPL.Prompt != "" {
+		cfg.Prompt = c.REPL.Prompt
+	}
+	if c.REPL.Color != nil {
+		cfg.Color = *c.REPL.Color
+	}
+	if c.REPL.PageHeight != 0 {
+		cfg.PageHeight = c.REPL.PageHeight
+	}
+	if c.REPL.RCFile != "" {
+		cfg.RCFile = c.REPL.RCFile
+	}
+}
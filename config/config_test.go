@@ -0,0 +1,116 @@
+package config
+
+import (
+	"monkey/evaluator"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	src := `# the settings of the project
+[limits]
+max_steps = 1_000_000
+max_memory = 1024 # bytes
+max_depth = 100
+
+[sandbox]
+disable = ["time", "random",]
+
+[modules]
+path = ["lib", "/opt/monkey"]
+
+[repl]
+prompt = "# "
+color = false
+page_height = 20
+prelude = false
+`
+	cfg, err := Parse(src, "/project")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if cfg.MaxSteps != 1000000 || cfg.MaxMemory != 1024 || cfg.MaxDepth != 100 {
+		t.Errorf("wrong limits, got=%+v", cfg)
+	}
+	if cfg.Disabled != evaluator.Time|evaluator.Random {
+		t.Errorf("expected time and random to be disabled, got=%v", cfg.Disabled)
+	}
+	if strings.Join(cfg.ModulePath, " ") != "/project/lib /opt/monkey" {
+		t.Errorf("wrong module path, got=%v", cfg.ModulePath)
+	}
+	if cfg.REPL.Prompt != "# " || cfg.REPL.Color == nil || *cfg.REPL.Color || cfg.REPL.PageHeight != 20 || !cfg.REPL.NoPrelude {
+		t.Errorf("wrong repl settings, got=%+v", cfg.REPL)
+	}
+
+	opts := cfg.Options(evaluator.Options{Disabled: evaluator.Stdin, MaxSteps: 5})
+	if opts.MaxSteps != 1000000 || opts.Disabled != evaluator.Stdin|evaluator.Time|evaluator.Random || len(opts.ModulePath) != 2 {
+		t.Errorf("wrong options, got=%+v", opts)
+	}
+
+	cfg, err = Parse("[sandbox]\nenabled = true", "/")
+	if err != nil || cfg.Disabled != evaluator.AllCapabilities {
+		t.Errorf("expected the sandbox to disable everything, got=%v (%v)", cfg, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[limits\nmax_steps = 1", "1: missing ] after the table name"},
+		{"[limits]\nmax_step = 1", "2: unknown setting limits.max_step"},
+		{"[limit]\nmax_steps = 1", "2: unknown table [limit]"},
+		{"verbose = true", "1: unknown setting verbose"},
+		{"[limits]\nmax_steps = \"many\"", "2: limits.max_steps must be a number of at least 0"},
+		{"[limits]\nmax_depth = -1", "2: limits.max_depth must be a number of at least 0"},
+		{"[sandbox]\ndisable = [\"network\"]", `2: unknown capability "network", want filesystem, stdin, time, random or environment`},
+		{"[modules]\npath = [1]", "2: path: arrays can only hold strings, got 1"},
+		{"[repl]\nprompt", `2: expected key = value, got "prompt"`},
+		{"[repl]\ncolor = true\ncolor = false", "3: color is set twice"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input, "/")
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: expected error %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	root := t.TempDir()
+	nested := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, err := Find(nested); err != nil || path != "" {
+		t.Errorf("expected no configuration, got=%q (%v)", path, err)
+	}
+
+	for _, name := range []string{".monkeyconfig", "monkey.toml"} {
+		if err := os.WriteFile(filepath.Join(root, "a", name), []byte("[limits]\nmax_depth = 3\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path, err := Find(nested)
+	if err != nil || path != filepath.Join(root, "a", "monkey.toml") {
+		t.Fatalf("expected monkey.toml in a parent, got=%q (%v)", path, err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil || cfg.MaxDepth != 3 || cfg.Path != path {
+		t.Errorf("wrong configuration, got=%+v (%v)", cfg, err)
+	}
+
+	if err := os.WriteFile(path, []byte("[limits]\nmax_depth = deep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || err.Error() != path+":2: max_depth: invalid value deep" {
+		t.Errorf("expected the error to point into the file, got=%v", err)
+	}
+}
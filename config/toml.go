@@ -0,0 +1,141 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The part of TOML a configuration needs: [tables] with key = value, where
+// a value is a string, an integer, a boolean or an array of strings
+// # starts a comment outside of strings
+type table map[string]value
+
+type value struct {
+	line int
+	v    any
+}
+
+func parseTOML(src string) (map[string]table, error) {
+	tables := map[string]table{"": {}}
+	current := tables[""]
+
+	for i, line := range strings.Split(src, "\n") {
+		lineNo := i + 1
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("%d: missing ] after the table name", lineNo)
+			}
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if _, ok := tables[name]; ok {
+				return nil, fmt.Errorf("%d: table [%s] is defined twice", lineNo, name)
+			}
+			current = table{}
+			tables[name] = current
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%d: expected key = value, got %q", lineNo, line)
+		}
+		key = strings.TrimSpace(key)
+		if _, ok := current[key]; ok {
+			return nil, fmt.Errorf("%d: %s is set twice", lineNo, key)
+		}
+		v, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("%d: %s: %s", lineNo, key, err)
+		}
+		current[key] = value{line: lineNo, v: v}
+	}
+
+	return tables, nil
+}
+
+// Cuts off a # comment which isn't inside of a string
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+func parseValue(raw string) (any, error) {
+	switch {
+	case raw == "true" || raw == "false":
+		return raw == "true", nil
+	case strings.HasPrefix(raw, `"`):
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string %s", raw)
+		}
+		return s, nil
+	case strings.HasPrefix(raw, "["):
+		if !strings.HasSuffix(raw, "]") {
+			return nil, fmt.Errorf("missing ] after the array")
+		}
+		items := []string{}
+		for _, item := range splitArray(raw[1 : len(raw)-1]) {
+			s, err := strconv.Unquote(item)
+			if err != nil {
+				return nil, fmt.Errorf("arrays can only hold strings, got %s", item)
+			}
+			items = append(items, s)
+		}
+		return items, nil
+	default:
+		n, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %s", raw)
+		}
+		return n, nil
+	}
+}
+
+// The items between the brackets, commas in strings don't split them
+// A trailing comma is allowed
+func splitArray(s string) []string {
+	items := []string{}
+	inString := false
+	start := 0
+	add := func(end int) {
+		if item := strings.TrimSpace(s[start:end]); item != "" {
+			items = append(items, item)
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inString {
+				i++
+			}
+		case '"':
+			inString = !inString
+		case ',':
+			if !inString {
+				add(i)
+				start = i + 1
+			}
+		}
+	}
+	add(len(s))
+	return items
+}
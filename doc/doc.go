@@ -0,0 +1,141 @@
+// Collects the documentation of Monkey code: a function bound by a top
+// level let is documented by the // comments right above it, like Go
+//
+//	// Returns a new array with the result of f for every element
+//	let map = fn(arr, f) { ... };
+//
+// Names starting with _ are private and left out
+package doc
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// One documented function
+type Entry struct {
+	Name string
+	// e.g. map(arr, f), generators get fn* in front
+	Signature string
+	// The comment without the slashes, lines are separated by \n
+	// Empty when there is none
+	Doc string
+	// Where the let is, the zero value for builtins
+	Pos token.Position
+	// The capability a builtin needs, empty for everything else
+	Needs string
+}
+
+// The documentation of a file
+type File struct {
+	Path string
+	// The comment at the top, when a blank line separates it from the code
+	Doc     string
+	Entries []Entry
+}
+
+// Documents the functions of a program which was parsed with its comments
+// The entries are in the order of the source
+func Extract(path string, program *ast.Program) File {
+	file := File{Path: path, Doc: packageDoc(program)}
+
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || strings.HasPrefix(let.Name.Value, "_") {
+			continue
+		}
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+
+		params := make([]string, len(fn.Parameters))
+		for i, param := range fn.Parameters {
+			params[i] = param.Value
+		}
+		signature := let.Name.Value + "(" + strings.Join(params, ", ") + ")"
+		if fn.Generator {
+			signature = "fn* " + signature
+		}
+
+		file.Entries = append(file.Entries, Entry{
+			Name:      let.Name.Value,
+			Signature: signature,
+			Doc:       commentAbove(program.Comments, let.Pos()),
+			Pos:       let.Pos(),
+		})
+	}
+
+	return file
+}
+
+// The comment lines which end on the line above pos, in the column of pos
+// A trailing comment of the code above is in another column
+func commentAbove(comments []token.Token, pos token.Position) string {
+	lines := []string{}
+	line := pos.Line - 1
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		if c.Pos.Line >= pos.Line {
+			continue
+		}
+		if c.Pos.Line != line || c.Pos.Column != pos.Column {
+			break
+		}
+		lines = append([]string{commentText(c)}, lines...)
+		line--
+	}
+	return strings.Join(lines, "\n")
+}
+
+// The comment block the file starts with, at column 1 and with a blank line
+// behind it like commentAbove wants it. Without the blank line it documents
+// the first statement, e.g. let x = 1; // note on line 1 is no file doc
+func packageDoc(program *ast.Program) string {
+	lines := []string{}
+	line := 1
+	for _, c := range program.Comments {
+		if c.Pos.Line != line || c.Pos.Column != 1 {
+			break
+		}
+		lines = append(lines, commentText(c))
+		line++
+	}
+	if len(lines) == 0 || len(program.Statements) > 0 && program.Statements[0].Pos().Line <= line {
+		return ""
+	}
+	return strings.Join(lines, "\n")
+}
+
+func commentText(c token.Token) string {
+	text := strings.TrimPrefix(c.Literal, "//")
+	return strings.TrimPrefix(text, " ")
+}
+
+// The builtins of object.DefaultBuiltins and the ones which need a
+// capability, sorted by name
+func Builtins() []Entry {
+	entries := []Entry{}
+	for _, name := range object.DefaultBuiltins.Names() {
+		builtin, _ := object.DefaultBuiltins.Lookup(name)
+		entries = append(entries, builtinEntry(name, builtin.Usage, builtin.Doc, ""))
+	}
+	for _, name := range evaluator.SystemBuiltinNames() {
+		usage, doc, capability, _ := evaluator.SystemBuiltinDoc(name)
+		entries = append(entries, builtinEntry(name, usage, doc, capability.String()))
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+func builtinEntry(name, usage, doc, needs string) Entry {
+	if usage == "" {
+		usage = name + "(...)"
+	}
+	return Entry{Name: name, Signature: usage, Doc: doc, Needs: needs}
+}
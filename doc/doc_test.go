@@ -0,0 +1,103 @@
+package doc
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+const source = `// Helpers for lists
+// and more
+
+// Doubles x
+let double = fn(x) { x * 2 }; // not the doc of half
+
+// Halves x,
+// rounding down
+let half = fn(x) {
+  // not a doc either
+  let y = x / 2;
+  y
+};
+let noDoc = fn() {};
+
+// Not a function
+let limit = 10;
+
+// Private
+let _helper = fn() {};
+
+// Counts from 0
+let count = fn*(n) { for (i in 0..n) { yield i } };
+`
+
+func TestExtract(t *testing.T) {
+	program := parser.New(lexer.New(source)).ParseProgram()
+	file := Extract("lists.monkey", program)
+
+	if file.Doc != "Helpers for lists\nand more" {
+		t.Errorf("wrong file doc, got=%q", file.Doc)
+	}
+
+	expected := []struct {
+		signature string
+		doc       string
+		line      int
+	}{
+		{"double(x)", "Doubles x", 5},
+		{"half(x)", "Halves x,\nrounding down", 9},
+		{"noDoc()", "", 14},
+		{"fn* count(n)", "Counts from 0", 23},
+	}
+	if len(file.Entries) != len(expected) {
+		t.Fatalf("expected %d entries, got=%+v", len(expected), file.Entries)
+	}
+	for i, want := range expected {
+		entry := file.Entries[i]
+		if entry.Signature != want.signature || entry.Doc != want.doc || entry.Pos.Line != want.line {
+			t.Errorf("entry %d: expected %s %q on line %d, got=%+v", i, want.signature, want.doc, want.line, entry)
+		}
+	}
+
+	// a comment right above the first statement documents it, not the file
+	program = parser.New(lexer.New("// Doubles x\nlet double = fn(x) { x * 2 };")).ParseProgram()
+	if file := Extract("a.monkey", program); file.Doc != "" || file.Entries[0].Doc != "Doubles x" {
+		t.Errorf("expected the comment to document double, got=%+v", file)
+	}
+
+	// neither does a comment behind the code of line 1
+	program = parser.New(lexer.New("let double = fn(x) { x * 2 }; // note\n\nlet y = 1;")).ParseProgram()
+	if file := Extract("a.monkey", program); file.Doc != "" || file.Entries[0].Doc != "" {
+		t.Errorf("expected no docs for a trailing comment, got=%+v", file)
+	}
+}
+
+func TestRender(t *testing.T) {
+	program := parser.New(lexer.New(source)).ParseProgram()
+	page := Page{Title: "lists", Files: []File{Extract("lists.monkey", program)}, Builtins: Builtins()}
+
+	markdown := page.Markdown()
+	for _, want := range []string{
+		"# lists\n\n## lists.monkey\n\nHelpers for lists\nand more\n",
+		"\n### `half(x)`\n\nHalves x,\nrounding down\n",
+		"\n## Builtins\n",
+		"\n### `len(x)`\n\nThe number of characters of a string, elements of an array or pairs of a hash\n",
+		"\n### `readFile(path)`\n\nThe content of the file as a string\n\nNeeds filesystem access.\n",
+	} {
+		if !strings.Contains(markdown, want) {
+			t.Errorf("expected %q in the markdown, got=%q", want, markdown)
+		}
+	}
+
+	page = Page{Title: "<lists>", Files: page.Files}
+	html, err := page.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<h1>&lt;lists&gt;</h1>", `<h3 id="double"><code>double(x)</code></h3>`, `<p class="doc">Doubles x</p>`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected %q in the html, got=%q", want, html)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package doc
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// A page of documentation: the files and, if any, the builtins
+type Page struct {
+	Title    string
+	Files    []File
+	Builtins []Entry
+}
+
+func (p Page) Markdown() string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# %s\n", p.Title)
+
+	for _, file := range p.Files {
+		fmt.Fprintf(&out, "\n## %s\n", file.Path)
+		if file.Doc != "" {
+			fmt.Fprintf(&out, "\n%s\n", file.Doc)
+		}
+		for _, entry := range file.Entries {
+			writeMarkdownEntry(&out, entry)
+		}
+	}
+
+	if len(p.Builtins) > 0 {
+		out.WriteString("\n## Builtins\n")
+		for _, entry := range p.Builtins {
+			writeMarkdownEntry(&out, entry)
+		}
+	}
+
+	return out.String()
+}
+
+func writeMarkdownEntry(out *strings.Builder, entry Entry) {
+	fmt.Fprintf(out, "\n### `%s`\n", entry.Signature)
+	if entry.Doc != "" {
+		fmt.Fprintf(out, "\n%s\n", entry.Doc)
+	}
+	if entry.Needs != "" {
+		fmt.Fprintf(out, "\nNeeds %s access.\n", entry.Needs)
+	}
+}
+
+var htmlPage = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+code, pre { font-family: monospace; }
+.doc { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Files}}
+<h2 id="{{.Path}}">{{.Path}}</h2>
+{{if .Doc}}<p class="doc">{{.Doc}}</p>{{end}}
+{{range .Entries}}{{template "entry" .}}{{end}}
+{{end}}
+{{if .Builtins}}
+<h2 id="builtins">Builtins</h2>
+{{range .Builtins}}{{template "entry" .}}{{end}}
+{{end}}
+</body>
+</html>
+{{define "entry"}}<h3 id="{{.Name}}"><code>{{.Signature}}</code></h3>
+{{if .Doc}}<p class="doc">{{.Doc}}</p>{{end}}
+{{if .Needs}}<p>Needs {{.Needs}} access.</p>{{end}}
+{{end}}`))
+
+// A standalone page, everything from the source is escaped
+func (p Page) HTML() (string, error) {
+	var out strings.Builder
+	if err := htmlPage.Execute(&out, p); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,58 @@
+package evaluator
+
+import (
+	"context"
+	"io"
+	"monkey/object"
+)
+
+// A copy of builtins (nil means object.DefaultBuiltins) whose puts writes
+// to out instead of stdout, e.g. for a host which shows the output itself
+func BuiltinsWithOutput(builtins *object.Builtins, out io.Writer) *object.Builtins {
+	if builtins == nil {
+		builtins = object.DefaultBuiltins
+	}
+
+	puts := &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		for _, arg := range args {
+			io.WriteString(out, arg.Inspect()+"\n")
+		}
+		return NULL
+	}}
+	if original, ok := builtins.Lookup("puts"); ok {
+		puts.Usage, puts.Doc = original.Usage, original.Doc
+	}
+
+	builtins = builtins.Clone()
+	builtins.Add("puts", puts)
+	return builtins
+}
+
+// A copy of builtins (nil means object.DefaultBuiltins) with the builtins
+// which need a capability, for the compiler and the VM which have no
+// interpreter to look them up. They use the sandbox, rand and clock of
+// opts, a disabled one returns the error the evaluator gives for it
+func BuiltinsWithSystem(builtins *object.Builtins, opts Options) *object.Builtins {
+	if builtins == nil {
+		builtins = object.DefaultBuiltins
+	}
+
+	in := newInterpreter(context.Background(), opts)
+	builtins = builtins.Clone()
+	for name, system := range systemBuiltins {
+		if _, ok := builtins.Lookup(name); ok {
+			// the registry comes first like in the evaluator
+			continue
+		}
+
+		builtin := &object.Builtin{Fn: func(args ...object.Object) object.Object {
+			if in.opts.Disabled&system.capability != 0 {
+				return newError("builtin %s is disabled: no %s access", name, system.capability)
+			}
+			return system.fn(in, args...)
+		}}
+		builtin.Usage, builtin.Doc = system.usage, system.doc
+		builtins.Add(name, builtin)
+	}
+	return builtins
+}
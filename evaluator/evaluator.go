@@ -1,69 +1,676 @@
 package evaluator
 
 import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
 	"monkey/ast"
 	"monkey/object"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
 )
 
-func Eval(node ast.Node) object.Object {
+// Holds the state of one evaluation, it is shared by everything running
+// on behalf of it (imported modules, generators and spawned functions)
+type interpreter struct {
+	ctx  context.Context
+	done <-chan struct{}
+	opts Options
+
+	// Number of evaluated nodes, only counted when there is a step limit
+	// Atomic because generators and spawned functions run in other goroutines
+	steps atomic.Int64
+	// Approximate number of allocated bytes, only counted when there is a memory limit
+	allocated atomic.Int64
+	// Number of running function calls, only counted when there is a depth limit
+	depth atomic.Int64
+
+	// The error last passed to Options.Observer
+	lastError atomic.Pointer[object.Error]
+
+	// Options.Builtins or object.DefaultBuiltins
+	builtins *object.Builtins
+
+	// Options.Modules or the cache of this evaluation
+	modules *Modules
+
+	// Used by rand() and now(), see Options.Deterministic
+	rand  *lockedRand
+	clock func() time.Time
+}
+
+func newInterpreter(ctx context.Context, opts Options) *interpreter {
+	in := &interpreter{ctx: ctx, done: ctx.Done(), opts: opts, clock: opts.Clock}
+
+	in.builtins = opts.Builtins
+	if in.builtins == nil {
+		in.builtins = object.DefaultBuiltins
+	}
+	in.modules = opts.Modules
+	if in.modules == nil {
+		in.modules = NewModules()
+	}
+
+	if opts.Deterministic {
+		in.rand = newLockedRand(opts.Seed)
+		if in.clock == nil {
+			in.clock = func() time.Time { return time.Unix(0, 0) }
+		}
+	}
+	if in.clock == nil {
+		in.clock = time.Now
+	}
+
+	return in
+}
+
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return EvalContext(context.Background(), node, env)
+}
+
+// Like Eval but stops with an error once ctx is cancelled
+// The context is checked before every function call and loop iteration
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return EvalWithOptions(ctx, node, env, Options{})
+}
+
+// Returns an error if the evaluation was cancelled, nil otherwise
+func (in *interpreter) checkCancelled() *object.Error {
+	select {
+	case <-in.done:
+		return newError("evaluation cancelled: %s", in.ctx.Err())
+	default:
+		return nil
+	}
+}
+
+func (in *interpreter) eval(node ast.Node, env *object.Environment) (result object.Object) {
+	if in.opts.Observer != nil {
+		defer func() { in.observeError(result) }()
+	}
+	if in.opts.MaxSteps > 0 && in.steps.Add(1) > in.opts.MaxSteps {
+		return locate(newError("step budget exceeded: more than %d steps", in.opts.MaxSteps), node)
+	}
+	if in.opts.Profiler != nil {
+		defer in.opts.Profiler.recordNode(node, time.Now())
+	}
+	if in.opts.BeforeEval == nil && in.opts.AfterEval == nil {
+		return locate(in.evalNode(node, env), node)
+	}
+
+	if in.opts.BeforeEval != nil {
+		in.opts.BeforeEval(node, env)
+	}
+	result = locate(in.evalNode(node, env), node)
+	if in.opts.AfterEval != nil {
+		in.opts.AfterEval(node, env, result)
+	}
+
+	return result
+}
+
+func (in *interpreter) evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalStatements(node.Statements)
+		return in.evalProgram(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression)
+		return in.eval(node.Expression, env)
+
+	case *ast.BlockStatement:
+		return in.evalBlockStatement(node, env)
+
+	case *ast.ReturnStatement:
+		val := in.eval(node.ReturnValue, env)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+
+	case *ast.LetStatement:
+		val := in.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		// Shadowing a constant in an inner scope is fine, redefining it is not
+		if env.HasLocal(node.Name.Value) && env.IsConst(node.Name.Value) {
+			return newError("cannot reassign const %s", node.Name.Value)
+		}
+		if env.Frozen() {
+			return newError("cannot define %s in a frozen environment", node.Name.Value)
+		}
+		if err := in.observeDefine(node, val); err != nil {
+			return err
+		}
+		if node.Name.Resolved {
+			if node.Const {
+				env.SetConstSlot(node.Name.Index, val)
+			} else {
+				env.SetSlot(node.Name.Index, val)
+			}
+		} else if node.Const {
+			env.SetConst(node.Name.Value, val)
+		} else {
+			env.Set(node.Name.Value, val)
+		}
+
+	case *ast.ForStatement:
+		return in.evalForStatement(node, env)
+
+	case *ast.AssignExpression:
+		val := in.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		name := node.Name
+		if name.Resolved && env.IsConstSlot(name.Depth, name.Index) {
+			return newError("cannot reassign const %s", name.Value)
+		}
+		if name.Resolved && env.AssignSlot(name.Depth, name.Index, val) {
+			return val
+		}
+		if env.IsConst(node.Name.Value) {
+			return newError("cannot reassign const %s", node.Name.Value)
+		}
+		if env.IsFrozen(node.Name.Value) {
+			return newError("cannot reassign %s of a frozen environment", node.Name.Value)
+		}
+		if _, ok := env.Assign(node.Name.Value, val); !ok {
+			return newError("identifier not found: " + node.Name.Value)
+		}
+		return val
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return in.track(object.NewInteger(node.Value))
+
+	case *ast.StringLiteral:
+		return in.track(&object.String{Value: node.Value})
+
+	case *ast.TemplateLiteral:
+		return in.track(in.evalTemplateLiteral(node, env))
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right)
-		return evalPrefixExpression(node.Operator, right)
+		right := in.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return in.track(in.evalPrefixExpression(node.Operator, right))
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left)
-		right := Eval(node.Right)
-		return evalInfixExpression(node.Operator, left, right)
+		left := in.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		// The right side of ?? is only evaluated when it's needed
+		if node.Operator == "??" {
+			if left != NULL {
+				return left
+			}
+			return in.eval(node.Right, env)
+		}
+		right := in.eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		return in.track(in.evalInfixExpression(node.Operator, left, right))
+
+	case *ast.IfExpression:
+		return in.evalIfExpression(node, env)
+
+	case *ast.Identifier:
+		return in.evalIdentifier(node, env)
+
+	case *ast.FunctionLiteral:
+		return in.track(&object.Function{
+			Name:       node.Name,
+			Parameters: node.Parameters,
+			Body:       node.Body,
+			Locals:     node.Locals,
+			Env:        env,
+			Generator:  node.Generator,
+		})
+
+	case *ast.SpawnExpression:
+		fn := in.eval(node.Function, env)
+		if isError(fn) {
+			return fn
+		}
+		return in.evalSpawnExpression(fn)
+
+	case *ast.LazyExpression:
+		return in.track(object.NewThunk(func() object.Object {
+			return in.eval(node.Value, env)
+		}))
+
+	case *ast.YieldExpression:
+		val := in.eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return evalYieldExpression(val, env)
+
+	case *ast.CallExpression:
+		function := in.eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		if function == skipped {
+			return skip(node)
+		}
+		args := in.evalExpressions(node.Arguments, env)
+		if len(args) == 1 && isError(args[0]) {
+			return args[0]
+		}
+		if err := in.observeCall(node, function, args); err != nil {
+			return err
+		}
+		return in.applyFunction(function, args)
+
+	case *ast.ArrayLiteral:
+		elements := in.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return in.track(&object.Array{Elements: elements})
+
+	case *ast.HashLiteral:
+		return in.track(in.evalHashLiteral(node, env))
+
+	case *ast.IndexExpression:
+		left := in.eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		if left == skipped {
+			return skip(node)
+		}
+		index := in.eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.ImportExpression:
+		path := in.eval(node.Path, env)
+		if isError(path) {
+			return path
+		}
+		return in.evalImportExpression(path, env)
+
+	case *ast.MemberExpression:
+		obj := in.eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		if obj == skipped || (node.Optional && obj == NULL) {
+			return skip(node)
+		}
+		return evalMemberExpression(obj, node.Property.Value)
 	}
 
 	return nil
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+// What a ?. which found null gives the member, index or call expression
+// continuing the chain, they skip themselves as well. It's a null of its
+// own so it can't be mistaken for one the chain produced
+var skipped object.Object = &skippedChain{}
+
+type skippedChain struct {
+	object.Null
+	// a zero sized value could have the same address as NULL
+	_ byte
+}
+
+// The result of a skipped part of a chain, the end of the chain is null
+func skip(node ast.Expression) object.Object {
+	if ast.Chained(node) {
+		return skipped
+	}
+	return NULL
+}
+
+// Unwraps return values so a return statement stops the whole program
+func (in *interpreter) evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range program.Statements {
+		result = in.eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	return result
+}
+
+// Does NOT unwrap return values so nested blocks can bubble them up
+// to the function (or program) they belong to
+func (in *interpreter) evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	var result object.Object
+
+	for _, statement := range block.Statements {
+		result = in.eval(statement, env)
+
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	// an empty block or one of only lets still has a value
+	return orNull(result)
+}
+
+func (in *interpreter) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		evaluated := in.eval(e, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+
+	return result
+}
+
+func (in *interpreter) applyFunction(fn object.Object, args []object.Object) object.Object {
+	if err := in.checkCancelled(); err != nil {
+		return err
+	}
+
+	switch fn := fn.(type) {
+	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d",
+				len(fn.Parameters), len(args))
+		}
+
+		if err := in.trackEnvironment(len(args)); err != nil {
+			return err
+		}
+
+		if fn.Generator {
+			return in.newGenerator(fn, args)
+		}
+
+		if in.opts.MaxDepth > 0 {
+			if in.depth.Add(1) > int64(in.opts.MaxDepth) {
+				in.depth.Add(-1)
+				return newError("call depth exceeded: more than %d nested calls", in.opts.MaxDepth)
+			}
+			defer in.depth.Add(-1)
+		}
+		if in.opts.Profiler != nil {
+			defer in.opts.Profiler.recordFunction(fn, time.Now())
+		}
+
+		extendedEnv := extendFunctionEnv(fn, args)
+		evaluated := in.eval(fn.Body, extendedEnv)
+		return orNull(unwrapReturnValue(evaluated))
+
+	case *object.Builtin:
+		return in.track(fn.Fn(args...))
+
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+	env := object.NewSlotEnvironment(fn.Env, fn.Locals)
+	bindParameters(env, fn.Parameters, args)
+	return env
+}
+
+func bindParameters(env *object.Environment, params []*ast.Identifier, args []object.Object) {
+	for paramIdx, param := range params {
+		if param.Resolved {
+			env.SetSlot(param.Index, args[paramIdx])
+		} else {
+			env.Set(param.Value, args[paramIdx])
+		}
+	}
+}
+
+// A return only stops the function it is in, not the caller
+// The value of something which may have none, e.g. a function body
+// without statements, is null
+func orNull(obj object.Object) object.Object {
+	if obj == nil {
+		return NULL
+	}
+	return obj
+}
+
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
+// Bindings in the environment shadow builtins with the same name
+// Every iteration gets its own scope for the loop variables
+// With a single variable it's bound to the value, except for hashes where it's the key
+func (in *interpreter) evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := in.eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+	_, isHash := iterable.(*object.Hash)
+
+	iterator := it.Iterator()
+	if channel, ok := iterable.(*object.Channel); ok {
+		iterator = channel.IteratorUntil(in.done)
+	}
+	if stopper, ok := iterator.(object.Stopper); ok {
+		defer stopper.Stop()
+	}
+
+	for {
+		if err := in.checkCancelled(); err != nil {
+			return err
+		}
+
+		key, value, ok := iterator.Next()
+		if !ok {
+			// a channel stops waiting when the evaluation is cancelled
+			if err := in.checkCancelled(); err != nil {
+				return err
+			}
+			break
+		}
+		if isError(value) {
+			return value
+		}
+
+		if err := in.trackEnvironment(2); err != nil {
+			return err
+		}
+
+		loopEnv := object.NewSlotEnvironment(env, fs.Locals)
+		if fs.Key != nil {
+			bindLoopVariable(loopEnv, fs.Key, key)
+			bindLoopVariable(loopEnv, fs.Value, value)
+		} else if isHash {
+			bindLoopVariable(loopEnv, fs.Value, key)
+		} else {
+			bindLoopVariable(loopEnv, fs.Value, value)
+		}
+
+		result := in.eval(fs.Body, loopEnv)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+
+	return NULL
+}
+
+func bindLoopVariable(env *object.Environment, ident *ast.Identifier, val object.Object) {
+	if ident.Resolved {
+		env.SetSlot(ident.Index, val)
+	} else {
+		env.Set(ident.Value, val)
+	}
+}
+
+// Resolved names are found by their slot, the name is still needed for
+// slots which aren't set yet (e.g. using an outer x before let x)
+func (in *interpreter) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if node.Resolved {
+		if val, ok := env.GetSlot(node.Depth, node.Index); ok {
+			return val
+		}
+	}
+
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := in.builtins.Lookup(node.Value); ok {
+		return in.cancellable(node.Value, builtin)
+	}
+
+	if builtin, ok := in.systemBuiltin(node.Value); ok {
+		return builtin
+	}
+
+	return newError("identifier not found: " + node.Value)
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// Out of bounds access returns null instead of an error
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	max := int64(len(arrayObject.Elements) - 1)
+
+	if idx < 0 || idx > max {
+		return NULL
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+func (in *interpreter) evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
+	condition := in.eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+
+	if isTruthy(condition) {
+		return orNull(in.eval(ie.Consequence, env))
+	} else if ie.Alternative != nil {
+		return orNull(in.eval(ie.Alternative, env))
+	} else {
+		return NULL
+	}
+}
+
+// Everything except null and false is truthy
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
+func (in *interpreter) evalInfixExpression(operator string, left, right object.Object) object.Object {
+	_, leftBig := left.(*object.BigInteger)
+	_, rightBig := right.(*object.BigInteger)
+
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
+		return in.evalIntegerInfixExpression(operator, left, right)
+	case (leftBig || rightBig) && isInteger(left) && isInteger(right):
+		return evalBigIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(object.Equals(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!object.Equals(left, right))
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
 	default:
-		return NULL
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
 	}
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+func (in *interpreter) evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
+	var result int64
+	var overflow bool
+	var exact func() *big.Int
+
 	switch operator {
+	case "..":
+		return &object.Range{Start: leftVal, End: rightVal}
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		result, overflow = addInt(leftVal, rightVal)
+		exact = func() *big.Int { return new(big.Int).Add(big.NewInt(leftVal), big.NewInt(rightVal)) }
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		result, overflow = subInt(leftVal, rightVal)
+		exact = func() *big.Int { return new(big.Int).Sub(big.NewInt(leftVal), big.NewInt(rightVal)) }
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		result, overflow = mulInt(leftVal, rightVal)
+		exact = func() *big.Int { return new(big.Int).Mul(big.NewInt(leftVal), big.NewInt(rightVal)) }
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		result, overflow = divInt(leftVal, rightVal)
+		exact = func() *big.Int { return new(big.Int).Quo(big.NewInt(leftVal), big.NewInt(rightVal)) }
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -73,18 +680,33 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "!=":
 		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
-		return NULL
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+
+	if !overflow {
+		return object.NewInteger(result)
 	}
+	return in.overflow(result, exact, func() string {
+		return fmt.Sprintf("%d %s %d", leftVal, operator, rightVal)
+	})
 }
 
-func evalStatements(stmt []ast.Statement) object.Object {
-	var result object.Object
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
 
-	for _, statement := range stmt {
-		result = Eval(statement)
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
 	}
-
-	return result
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -95,24 +717,36 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func (in *interpreter) evalPrefixExpression(operator string, right object.Object) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return in.evalMinusPrefixOperatorExpression(right)
 	default:
-		return NULL
+		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+func (in *interpreter) evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if bigInt, ok := right.(*object.BigInteger); ok {
+		return object.NewBigInteger(new(big.Int).Neg(bigInt.Value))
+	}
 	if right.Type() != object.INTEGER_OBJ {
-		return NULL
+		return newError("unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	if value == math.MinInt64 {
+		return in.overflow(value, func() *big.Int { return new(big.Int).Neg(big.NewInt(value)) },
+			func() string { return fmt.Sprintf("-(%d)", value) })
+	}
+	return object.NewInteger(-value)
+}
+
+func isInteger(obj object.Object) bool {
+	_, ok := toBigInt(obj)
+	return ok
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
@@ -130,3 +764,97 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 		return FALSE
 	}
 }
+
+func (in *interpreter) evalTemplateLiteral(node *ast.TemplateLiteral, env *object.Environment) object.Object {
+	var out strings.Builder
+
+	for _, part := range node.Parts {
+		val := in.eval(part, env)
+		if isError(val) {
+			return val
+		}
+		out.WriteString(object.ToString(val))
+	}
+
+	return &object.String{Value: out.String()}
+}
+
+// The pairs are evaluated in the order they were written in, so the last
+// of two equal keys wins
+func (in *interpreter) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	hash := &object.Hash{}
+
+	for _, keyNode := range ast.SortedKeys(node) {
+		key := in.eval(keyNode, env)
+		if isError(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := in.eval(node.Pairs[keyNode], env)
+		if isError(value) {
+			return value
+		}
+
+		hash = hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+
+	return hash
+}
+
+// Missing keys result in null
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Get(key.HashKey())
+	if !ok {
+		return NULL
+	}
+
+	return pair.Value
+}
+
+// For hashes foo.bar is the same as foo["bar"]
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Hash:
+		return evalHashIndexExpression(obj, &object.String{Value: name})
+	case *object.Module:
+		val, ok := obj.Env.Get(name)
+		if !ok {
+			return newError("module %s has no member %s", obj.Name, name)
+		}
+		return val
+	default:
+		return newError("member access not supported: %s.%s", obj.Type(), name)
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// The innermost node an error comes out of is where it happened, the
+// nodes around it leave the position alone
+func locate(obj object.Object, node ast.Node) object.Object {
+	if err, ok := obj.(*object.Error); ok && !err.Pos.IsValid() {
+		err.Pos = node.Pos()
+	}
+	return obj
+}
+
+func isError(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ
+	}
+	return false
+}
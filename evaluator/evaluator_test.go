@@ -1,10 +1,19 @@
 package evaluator
 
 import (
+	"context"
+	"fmt"
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerExpression(t *testing.T) {
@@ -40,7 +49,9 @@ func testEval(input string) object.Object {
 	p := parser.New(l)
 	program := p.ParseProgram()
 
-	return Eval(program)
+	env := object.NewEnvironment()
+
+	return Eval(program, env)
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -82,6 +93,23 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"[1, 2] == [1, 2]", true},
+		{"[1, 2] != [1, 2]", false},
+		{"[1, 2] == [2, 1]", false},
+		{"[1, 2] == [1, 2, 3]", false},
+		{"[[1], [2, [3]]] == [[1], [2, [3]]]", true},
+		{"[] == []", true},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"b": 1}`, false},
+		{`{"a": 1} != {"a": 1, "b": 2}`, true},
+		{"1..3 == 1..3", true},
+		{"1..3 == 1..4", false},
+		{`[1] == {}`, false},
+		{`[1] == 1`, false},
+		{`{}["a"] == {}["b"]`, true},
+		{"let f = fn() { 1 }; f == f", true},
+		{"fn() { 1 } == fn() { 1 }", false},
 	}
 
 	for _, tt := range tests {
@@ -122,3 +150,1790 @@ func TestBangOperator(t *testing.T) {
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
+
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 > 2) { 10 }", nil},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func testNullObject(t *testing.T, obj object.Object) bool {
+	if obj != NULL {
+		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
+		return false
+	}
+	return true
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"return 10;", 10},
+		{"return 10; 9;", 10},
+		{"return 2 * 5; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return 10;
+  }
+
+  return 1;
+}
+`, 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"5; true + false; 5", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{`
+if (10 > 1) {
+  if (10 > 1) {
+    return true + false;
+  }
+
+  return 1;
+}
+`, "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{"10 / 0", "division by zero"},
+		{"let x = 5; x.y", "member access not supported: INTEGER.y"},
+		{"import(5)", "import path must be STRING, got INTEGER"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`let user = {}; user.address.city`, "member access not supported: NULL.city"},
+		{`5?.foo`, "member access not supported: INTEGER.foo"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; b;", 5},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v",
+			fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2)"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+let newAdder = fn(x) {
+  fn(y) { x + y };
+};
+
+let addTwo = newAdder(2);
+addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+// Writes the given files into a temporary directory and returns its path
+func writeModules(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("could not write module %s: %s", name, err)
+		}
+	}
+	return dir
+}
+
+func TestEmptyBodiesAreNull(t *testing.T) {
+	prefix := "let f = fn() { }; let g = fn() { let a = 1; }; "
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f()", "null"},
+		{"g()", "null"},
+		{"f() + 1", "ERROR: type mismatch: NULL + INTEGER"},
+		{"puts(f())", "null"},
+		{"len(f())", "ERROR: argument to `len` not supported, got NULL"},
+		{"str(f())", "null"},
+		{"[f(), g()]", "[null, null]"},
+		{`{"a": f()}`, "{a: null}"},
+		{`"${f()}!"`, "null!"},
+		{"f() ?? 1", "1"},
+		{"for (x in f()) {}", "ERROR: cannot iterate over NULL"},
+		{"let x = if (true) {}; puts(x); x", "null"},
+		{"if (false) { 1 } else { let y = 2; }", "null"},
+	}
+
+	for _, tt := range tests {
+		if got := testEval(prefix + tt.input); got == nil || got.Inspect() != tt.expected {
+			t.Errorf("%q: expected %s, got=%v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestImportExpression(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"math.monkey": `
+let square = fn(x) { x * x };
+let two = 2;
+`,
+		"lib.monkey": `
+let math = import("math");
+let squareTwo = fn() { math.square(math.two) };
+`,
+	})
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`import("` + filepath.Join(dir, "math.monkey") + `").square(3)`, 9},
+		{`let lib = import("` + filepath.Join(dir, "lib") + `"); lib.squareTwo()`, 4},
+		{`let lib = import("` + filepath.Join(dir, "lib") + `"); lib.math.two`, 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestImportIsCached(t *testing.T) {
+	dir := writeModules(t, map[string]string{"a.monkey": "let x = 1;"})
+	path := filepath.Join(dir, "a.monkey")
+
+	input := `import("` + path + `") == import("` + path + `")`
+	testBooleanObject(t, testEval(input), true)
+}
+
+func TestConcurrentImports(t *testing.T) {
+	// slow to load, so the imports run into each other while it's loading
+	dir := writeModules(t, map[string]string{"slow.monkey": "let n = 0; for (i in 0..20000) { n = n + i }; let id = fn() { n };"})
+	path := filepath.Join(dir, "slow.monkey")
+
+	// the spawned functions of one evaluation wait for the first load
+	input := `let tasks = [spawn fn() { import("` + path + `") }, spawn fn() { import("` + path + `") }];
+wait(tasks[0]) == wait(tasks[1])`
+	testBooleanObject(t, testEval(input), true)
+
+	// evaluations of their own don't share the module or its loading state
+	var wg sync.WaitGroup
+	results := make([]object.Object, 8)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = testEval(`import("` + path + `").id()`)
+		}()
+	}
+	wg.Wait()
+	for _, result := range results {
+		testIntegerObject(t, result, 199990000)
+	}
+
+	modules := NewModules()
+	eval := func(input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		return EvalWithOptions(context.Background(), program, object.NewEnvironment(), Options{Modules: modules})
+	}
+	first, second := eval(`import("`+path+`")`), eval(`import("`+path+`")`)
+	if first != second {
+		t.Errorf("evaluations sharing Options.Modules imported the module twice")
+	}
+	if loaded := modules.Loaded(); len(loaded) != 1 || loaded[0] != path {
+		t.Errorf("wrong loaded modules. want=%v, got=%v", []string{path}, loaded)
+	}
+	if testEval(`import("`+path+`")`) == first {
+		t.Errorf("an evaluation without Options.Modules got the shared module")
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"a.monkey":      `let b = import("b.monkey");`,
+		"b.monkey":      `let a = import("a.monkey");`,
+		"self.monkey":   `let me = import("self");`,
+		"broken.monkey": `let = 5;`,
+		"fails.monkey":  `let x = 1 + true;`,
+		"lib.monkey":    `let x = 1;`,
+	})
+
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`import("` + filepath.Join(dir, "a") + `")`, "import cycle detected: a.monkey -> b.monkey -> a.monkey"},
+		{`import("` + filepath.Join(dir, "self") + `")`, "import cycle detected: self.monkey -> self.monkey"},
+		{`import("` + filepath.Join(dir, "missing") + `")`, "no such file or directory"},
+		{`import("` + filepath.Join(dir, "broken") + `")`, "parser errors"},
+		{`import("` + filepath.Join(dir, "fails") + `")`, "type mismatch: INTEGER + BOOLEAN"},
+		{`import("` + filepath.Join(dir, "lib") + `").y`, "module " + filepath.Join(dir, "lib") + " has no member y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if !strings.Contains(errObj.Message, tt.expectedMessage) {
+			t.Errorf("wrong error message. expected to contain %q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`str(12)`, "12"},
+		{`str("12")`, "12"},
+		{`error("boom")`, "boom"},
+		{`error(1)`, "argument to `error` must be STRING, got INTEGER"},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`len({})`, 0},
+		{`keys({"a": 1})`, []string{"a"}},
+		{`keys({})`, []string{}},
+		{`keys([])`, "argument to `keys` must be HASH, got ARRAY"},
+		{`values({"a": 1})`, []int{1}},
+		{`values({})`, []int{}},
+		{`values(1)`, "argument to `values` must be HASH, got INTEGER"},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": 1}, [])`, "unusable as hash key: ARRAY"},
+		{`delete({"a": 1, "b": 2}, "a")["a"]`, nil},
+		{`delete({"a": 1, "b": 2}, "a")["b"]`, 2},
+		{`len(delete({"a": 1, "b": 2}, "c"))`, 2},
+		{`let h = {"a": 1}; delete(h, "a"); h["a"]`, 1},
+		{`delete("a", "a")`, "argument to `delete` must be HASH, got STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, obj.Message)
+				}
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong string. expected=%q, got=%q", expected, obj.Value)
+				}
+			default:
+				t.Errorf("object is not Error or String. got=%T (%+v)", evaluated, evaluated)
+			}
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				if array.Elements[i].Inspect() != expectedElem {
+					t.Errorf("wrong element. want=%q, got=%q",
+						expectedElem, array.Elements[i].Inspect())
+				}
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d",
+			len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Get(expectedKey)
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"foo": 5}.foo`, 5},
+		{`{"foo": 5}.bar`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestNullCoalescingAndOptionalChaining(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let h = {"a": 1}; h["a"] ?? 5`, 1},
+		{`let h = {"a": 1}; h["b"] ?? 5`, 5},
+		{`let h = {}; h.b ?? h.c ?? 7`, 7},
+		{`if (false) { 1 } ?? 2`, 2},
+		{`0 ?? 2`, 0},
+		{`let user = {"address": {"city": 3}}; user?.address?.city`, 3},
+		{`let user = {}; user?.address?.city`, nil},
+		{`let user = {}; user.address?.city ?? 9`, 9},
+		// the right side is not evaluated when it isn't needed
+		{`1 ?? error("not evaluated")`, 1},
+		// ?. on null skips the rest of the chain
+		{`let h = {}; h["x"]?.a.b`, nil},
+		{`let h = {}; h["x"]?.a["b"].c(error("not evaluated"))`, nil},
+		{`let h = {}; h.x?.a.b ?? 4`, 4},
+		{`let h = {}; [h.x?.a.b, 5][1]`, 5},
+		// but only when the object of ?. is null
+		{`let h = {"x": {}}; h.x?.a.b`, "member access not supported: NULL.b"},
+		{`let h = {}; h.x.a?.b`, "member access not supported: NULL.a"},
+		// parentheses end the chain
+		{`let h = {}; (h.x?.y).z`, "member access not supported: NULL.z"},
+		{`let h = {}; (h.x?.y)["z"]`, "index operator not supported: NULL"},
+		{`let h = {}; ((h.x?.y)) ?? 6`, 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let a = 1; a = 2; a", 2},
+		{"let a = 1; a = a + 1", 2},
+		{"let a = 1; let b = 1; a = b = 5; a + b", 10},
+		{"let a = 1; let set = fn() { a = 7 }; set(); a", 7},
+		{"let a = 1; let shadow = fn() { let a = 2; a = 3 }; shadow(); a", 1},
+		{"b = 1", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum = sum + x }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum = sum + i }; sum", 3},
+		{"let sum = 0; for (x in []) { sum = sum + x }; sum", 0},
+		{"let sum = 0; for (i in 0..5) { sum = sum + i }; sum", 10},
+		{"let sum = 0; for (i, x in 5..8) { sum = sum + i * x }; sum", 20},
+		{"let sum = 0; for (i in 5..1) { sum = sum + i }; sum", 0},
+		{`let sum = 0; for (k in {1: 10, 2: 20}) { sum = sum + k }; sum`, 3},
+		{`let sum = 0; for (k, v in {1: 10, 2: 20}) { sum = sum + v }; sum`, 30},
+		{`let s = ""; for (c in "abc") { s = c + s }; s`, "cba"},
+		{`let s = ""; for (i, c in "héj") { s = s + str(i) + c }; s`, "0h1é2j"},
+		{"for (x in [1]) { x }", nil},
+		{"let find = fn(xs, y) { for (x in xs) { if (x == y) { return true } }; false }; find([1, 2], 2)", true},
+		{"let find = fn(xs, y) { for (x in xs) { if (x == y) { return true } }; false }; find([1, 2], 3)", false},
+		{"let x = 5; for (x in [1, 2]) { x }; x", 5},
+		{"for (x in 5) { x }", "cannot iterate over INTEGER"},
+		{"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{`1.."a"`, "type mismatch: INTEGER .. STRING"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, obj.Message)
+				}
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong string. expected=%q, got=%q", expected, obj.Value)
+				}
+			default:
+				t.Errorf("object is not Error or String. got=%T (%+v)", evaluated, evaluated)
+			}
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let gen = fn*() { yield 1; yield 2; yield 3 };
+		  let sum = 0; for (x in gen()) { sum = sum + x }; sum`, 6},
+		{`let gen = fn*(n) { for (i in 0..n) { yield i * i } };
+		  let sum = 0; for (i, x in gen(4)) { sum = sum + i + x }; sum`, 20},
+		{`let gen = fn*() { yield 1; return 5; yield 2 };
+		  let sum = 0; for (x in gen()) { sum = sum + x }; sum`, 1},
+		{`let g = fn*() { yield 1; yield 2 }(); next(g) + next(g)`, 3},
+		{`let g = fn*() { yield 1 }(); next(g); next(g)`, nil},
+		{`let g = fn*() { yield 1 }(); for (x in g) { x }; next(g)`, nil},
+		// the body only runs once a value is requested
+		{`let g = fn*() { error("not run yet") }(); 1`, 1},
+		{`let g = fn*() { yield 1; error("boom") }(); let sum = 0; for (x in g) { sum = sum + x }`, "boom"},
+		{`let g = fn*() { yield 1 + true }(); next(g)`, "type mismatch: INTEGER + BOOLEAN"},
+		{`next([1])`, "argument to `next` must be GENERATOR, got ARRAY"},
+		{`let naturals = fn*() { let i = 0; for (x in 0..1000000000) { yield i; i = i + 1 } };
+		  let firstEven = fn() { for (x in naturals()) { if (x > 0) { if (x / 2 * 2 == x) { return x } } } };
+		  firstEven()`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+// Run with -race: a lazy value or generator must not evaluate against the
+// environment the spawning code keeps changing
+func TestSpawnLazyValuesAndGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 0; let l = lazy(x); let t = spawn fn() { force(l) }; for (i in 0..2000) { x = i }; wait(t)",
+			"can't force a lazy value of the spawning code, force it before the spawn"},
+		{"let x = 0; let g = fn*() { yield x }(); let t = spawn fn() { next(g) }; for (i in 0..2000) { x = i }; wait(t)",
+			"can't use a generator of the spawning code, send its values over a channel"},
+		{"let l = lazy(1 + 2); force(l); wait(spawn fn() { force(l) })", 3},
+		{"wait(spawn fn() { let l = lazy(5); force(l) })", 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("%q: expected error %q, got=%v", tt.input, expected, evaluated)
+			}
+		}
+	}
+}
+
+// A generator which is dropped while it's paused stops once its
+// evaluation is cancelled, its goroutine doesn't wait for next() forever
+func TestGeneratorsStopWithTheEvaluation(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		testIntegerObject(t, testEvalContext(ctx, `let g = fn*() { yield 1; yield 2 }(); next(g)`), 1)
+		cancel()
+	}
+
+	// the goroutines finish on their own after the cancellations
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before+5 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before+5 {
+		t.Errorf("expected the generators to stop, %d goroutines before and %d after", before, n)
+	}
+
+	// a generator the evaluation returned goes on until it's cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	g := testEvalContext(ctx, `let g = fn*() { yield 1; yield 2; yield 3 }(); next(g); g`)
+	if _, value, ok := g.(*object.Generator).Next(); !ok {
+		t.Errorf("expected the generator to go on after the evaluation")
+	} else {
+		testIntegerObject(t, value, 2)
+	}
+	cancel()
+	if _, value, ok := g.(*object.Generator).Next(); ok {
+		t.Errorf("expected a stopped generator, got=%v", value)
+	}
+
+	// or until Options.GeneratorsStop is closed, whatever the context does
+	stop := make(chan struct{})
+	ctx, cancel = context.WithCancel(context.Background())
+	program := parser.New(lexer.New(`let g = fn*() { yield 1; yield 2 }(); next(g); g`)).ParseProgram()
+	g = EvalWithOptions(ctx, program, object.NewEnvironment(), Options{GeneratorsStop: stop})
+	cancel()
+	if _, value, ok := g.(*object.Generator).Next(); !ok {
+		t.Errorf("expected the generator to outlive the context")
+	} else {
+		testIntegerObject(t, value, 2)
+	}
+	close(stop)
+	if _, value, ok := g.(*object.Generator).Next(); ok {
+		t.Errorf("expected a stopped generator, got=%v", value)
+	}
+}
+
+// Generators which are stopped at the same time each get their own error
+func TestConcurrentGenerators(t *testing.T) {
+	input := `let g = fn*() { for (x in 0..10) { yield x } };
+	  let first = fn() { for (x in g()) { if (x == 2) { return x } } }; first()`
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				evaluated := testEval(input)
+				if integer, ok := evaluated.(*object.Integer); !ok || integer.Value != 2 {
+					t.Errorf("expected 2, got=%v", evaluated)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSpawnAndChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let ch = channel(); spawn fn() { send(ch, 42) }; recv(ch)`, 42},
+		{`let task = spawn fn() { 1 + 2 }; wait(task)`, 3},
+		{`let task = spawn fn() { let x = 1 }; wait(task)`, nil},
+		{`let ch = channel(3); send(ch, 1); send(ch, 2); close(ch);
+		  let sum = 0; for (x in ch) { sum = sum + x }; sum`, 3},
+		{`let ch = channel(); close(ch); recv(ch)`, nil},
+		{`let results = channel();
+		  let worker = fn(n) { fn() { send(results, n * n) } };
+		  for (i in 1..4) { spawn worker(i) };
+		  recv(results) + recv(results) + recv(results)`, 14},
+		// spawned functions work on a snapshot of the environment
+		{`let x = 1; let task = spawn fn() { x = 2; x }; wait(task) * 10 + x`, 21},
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		  wait(spawn fn() { fib(10) })`, 55},
+		{`let task = spawn fn() { 1 + true }; wait(task)`, "type mismatch: INTEGER + BOOLEAN"},
+		{`spawn 5`, "spawn needs a FUNCTION, got INTEGER"},
+		{`spawn fn(x) { x }`, "spawned function must not take arguments, got 1 parameters"},
+		{`let ch = channel(1); close(ch); send(ch, 1)`, "send on closed channel"},
+		{`let ch = channel(1); close(ch); close(ch)`, "close of closed channel"},
+		{`channel(-1)`, "channel size must not be negative, got -1"},
+		{`recv(1)`, "argument to `recv` must be CHANNEL, got INTEGER"},
+		{`wait(1)`, "argument to `wait` must be TASK, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"const a = 5; a", 5},
+		{"const a = 5; a = 6", "cannot reassign const a"},
+		{"const a = 5; let a = 6", "cannot reassign const a"},
+		{"const a = 5; const a = 6", "cannot reassign const a"},
+		{"const a = 5; let f = fn() { a = 6 }; f()", "cannot reassign const a"},
+		{"const a = 5; for (x in [1]) { a = x }", "cannot reassign const a"},
+		// shadowing in an inner scope creates a new binding
+		{"const a = 5; let f = fn() { let a = 6; a = 7; a }; f() + a", 12},
+		{"const a = 5; let f = fn(a) { a = a + 1; a }; f(1) + a", 7},
+		{"const a = 5; let task = spawn fn() { a = 1 }; wait(task)", "cannot reassign const a"},
+		{"let a = 1; const b = a; a = 2; a + b", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let a = 1; let b = 2; "sum is ${a + b}"`, "sum is 3"},
+		{`let name = "Monkey"; "Hello ${name}!"`, "Hello Monkey!"},
+		{`"${[1, 2]} ${true} ${{"a": 1}["b"]}"`, "[1, 2] true null"},
+		{`"${"nested ${1 + 1}"}"`, "nested 2"},
+		{`"\${not evaluated}"`, "${not evaluated}"},
+		{`"${1}" == str(1)`, "true"},
+		{`"${1 + true}"`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: no result", tt.input)
+			continue
+		}
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func testEvalContext(ctx context.Context, input string) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return EvalContext(ctx, program, env)
+}
+
+func TestEvalContextCancellation(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelTimeout()
+
+	tests := []struct {
+		ctx      context.Context
+		input    string
+		expected string
+	}{
+		{cancelled, "let f = fn() { 1 }; f()", "evaluation cancelled: context canceled"},
+		{cancelled, "for (x in [1]) { x }", "evaluation cancelled: context canceled"},
+		{timeout, "let n = 0; for (x in 0..9223372036854775807) { n = n + 1 }",
+			"evaluation cancelled: context deadline exceeded"},
+		{timeout, `let gen = fn*() { for (x in 0..9223372036854775807) { yield x } };
+		  for (x in gen()) { x }`,
+			"evaluation cancelled: context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalContext(tt.ctx, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expected, errObj.Message)
+		}
+	}
+
+	// Without a cancelled context nothing changes
+	testIntegerObject(t, testEvalContext(context.Background(), "let f = fn() { 1 }; f()"), 1)
+}
+
+// recv, send, wait and looping over a channel only block until the
+// evaluation is cancelled
+func TestBlockingBuiltinsCancellation(t *testing.T) {
+	tests := []string{
+		"recv(channel())",
+		"send(channel(), 1)",
+		"wait(spawn fn() { recv(channel()) })",
+		"for (x in channel()) { x }",
+		"let ch = channel(); spawn fn() { send(ch, 1) }; recv(ch); recv(ch)",
+	}
+
+	for _, input := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		result := make(chan object.Object)
+		go func() { result <- testEvalContext(ctx, input) }()
+
+		select {
+		case evaluated := <-result:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != "evaluation cancelled: context deadline exceeded" {
+				t.Errorf("%q: expected the evaluation to be cancelled, got=%T(%+v)", input, evaluated, evaluated)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("%q: still blocked after the timeout", input)
+		}
+		cancel()
+	}
+
+	// a host's own builtin isn't replaced
+	builtins := object.DefaultBuiltins.Clone()
+	builtins.Register("recv", func(args ...object.Object) object.Object { return object.NewInteger(7) })
+	testIntegerObject(t, testEvalWithOptions("recv(channel())", Options{Builtins: builtins}), 7)
+}
+
+func testEvalWithOptions(input string, opts Options) object.Object {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	env := object.NewEnvironment()
+
+	return EvalWithOptions(context.Background(), program, env, opts)
+}
+
+func TestStepBudget(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxSteps int64
+		expected interface{}
+	}{
+		// program, expression statement and the literal
+		{"5", 3, 5},
+		{"5", 2, "step budget exceeded: more than 2 steps"},
+		{"1 + 2", 0, 3},
+		{"let n = 0; for (x in 0..9223372036854775807) { n = n + 1 }", 1000,
+			"step budget exceeded: more than 1000 steps"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10)", 1000, 0},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1000)", 1000,
+			"step budget exceeded: more than 1000 steps"},
+		{"let gen = fn*() { for (x in 0..9223372036854775807) { yield x } }; for (x in gen()) { x }", 1000,
+			"step budget exceeded: more than 1000 steps"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithOptions(tt.input, Options{MaxSteps: tt.maxSteps})
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		input     string
+		maxMemory int64
+		expected  interface{}
+	}{
+		{"let a = [1, 2, 3]; len(a)", 1024, 3},
+		{`let s = "a"; for (x in 0..100) { s = s + s }; len(s)`, 1 << 20,
+			"memory limit exceeded: more than 1048576 bytes allocated"},
+		{`let a = []; for (x in 0..100000) { a = push(a, x) }; len(a)`, 1 << 20,
+			"memory limit exceeded: more than 1048576 bytes allocated"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(100000)", 1 << 20,
+			"memory limit exceeded: more than 1048576 bytes allocated"},
+		{`let s = "a"; for (x in 0..10) { s = s + s }; len(s)`, 0, 1024},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithOptions(tt.input, Options{MaxMemory: tt.maxMemory})
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestSystemBuiltins(t *testing.T) {
+	dir := writeModules(t, map[string]string{"data.txt": "hello"})
+	path := filepath.Join(dir, "data.txt")
+	out := filepath.Join(dir, "out.txt")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len(readFile("` + path + `"))`, 5},
+		{`writeFile("` + out + `", "abc"); len(readFile("` + out + `"))`, 3},
+		{`now() > 0`, true},
+		{`rand(1)`, 0},
+		{`rand(10) < 10`, true},
+		{`sleep(1)`, nil},
+		{`rand(0)`, "argument to `rand` must be positive, got 0"},
+		{`let rand = fn(x) { x }; rand(5)`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDisabledCapabilities(t *testing.T) {
+	tests := []struct {
+		input    string
+		disabled Capability
+		expected interface{}
+	}{
+		{`readFile("x")`, Filesystem, "builtin readFile is disabled: no filesystem access"},
+		{`import("x")`, Filesystem, "import is disabled: no filesystem access"},
+		{`readLine()`, Stdin, "builtin readLine is disabled: no stdin access"},
+		{`now()`, Time, "builtin now is disabled: no time access"},
+		{`rand(10)`, Random, "builtin rand is disabled: no random access"},
+		{`getenv("HOME")`, Environment, "builtin getenv is disabled: no environment access"},
+		{`env()`, AllCapabilities, "builtin env is disabled: no environment access"},
+		{`let r = rand(10); r < 10`, Filesystem | Stdin | Time, true},
+		{`len(str(now()))`, AllCapabilities, "builtin now is disabled: no time access"},
+		{`len([1, 2, 3])`, AllCapabilities, 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithOptions(tt.input, Options{Disabled: tt.disabled})
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestDeterministicMode(t *testing.T) {
+	input := `let a = []; for (i in 0..20) { a = push(a, rand(1000)) }; a`
+	opts := Options{Deterministic: true, Seed: 42}
+
+	first := testEvalWithOptions(input, opts).Inspect()
+	second := testEvalWithOptions(input, opts).Inspect()
+	if first != second {
+		t.Errorf("same seed gave different results. first=%s, second=%s", first, second)
+	}
+
+	other := testEvalWithOptions(input, Options{Deterministic: true, Seed: 7}).Inspect()
+	if first == other {
+		t.Errorf("different seeds gave the same result %s", first)
+	}
+
+	// the pairs of a hash literal draw in the order they were written in
+	hash := `{"a": rand(1000), "b": rand(1000), "c": rand(1000), "d": rand(1000)}`
+	expected := testEvalWithOptions(hash, opts).Inspect()
+	for i := 0; i < 20; i++ {
+		if got := testEvalWithOptions(hash, opts).Inspect(); got != expected {
+			t.Fatalf("same seed gave different hashes. first=%s, then=%s", expected, got)
+		}
+	}
+
+	testIntegerObject(t, testEvalWithOptions("now()", opts), 0)
+
+	clock := func() time.Time { return time.UnixMilli(1234) }
+	testIntegerObject(t, testEvalWithOptions("now()", Options{Clock: clock}), 1234)
+	testIntegerObject(t, testEvalWithOptions("now()", Options{Deterministic: true, Clock: clock}), 1234)
+}
+
+func TestHashOrder(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"b": 2, "c": 3, "a": 1}`, `{a: 1, b: 2, c: 3}`},
+		{`keys({3: "c", 1: "a", 2: "b"})`, `[1, 2, 3]`},
+		{`values({true: 1, false: 0})`, `[0, 1]`},
+		{`let s = ""; for (k in {"z": 1, "x": 2, "y": 3}) { s = s + k }; s`, `xyz`},
+		// pairs are evaluated in the order they were written in
+		{`let seen = []; let k = fn(x) { seen = push(seen, x); x };
+		  {k("b"): k(1), k("a"): k(2), k("c"): k(3)}; seen`, `[b, 1, a, 2, c, 3]`},
+		{`{"a": 1, "b": 0, "a": 2}["a"]`, `2`},
+	}
+
+	// a random order would only show up every now and then
+	for i := 0; i < 20; i++ {
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			if evaluated.Inspect() != tt.expected {
+				t.Errorf("wrong order. expected=%s, got=%s", tt.expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestSharedObjects(t *testing.T) {
+	if testEval("1 + 1") != testEval("2") {
+		t.Errorf("small integers are not shared")
+	}
+	if testEval("-128") != object.NewInteger(-128) {
+		t.Errorf("-128 is not shared")
+	}
+	if testEval("100000") == testEval("100000") {
+		t.Errorf("large integers should not be cached")
+	}
+	if testEval("1 < 2") != object.TRUE || testEval("!true") != object.FALSE {
+		t.Errorf("booleans are not the shared singletons")
+	}
+	if testEval("if (false) { 1 }") != object.NULL {
+		t.Errorf("null is not the shared singleton")
+	}
+}
+
+func TestSlotScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; let f = fn() { let y = x; let x = 2; y + x }; f()", 3},
+		{"let x = 1; let f = fn(c) { if (c) { let x = 5; }; x }; f(false)", 1},
+		{"let x = 1; let f = fn(c) { if (c) { let x = 5; }; x }; f(true)", 5},
+		{"let f = fn() { let g = fn() { x }; let x = 2; g() }; let x = 1; f()", 2},
+		{"let f = fn(a) { fn(b) { a = a + b; a } }; let acc = f(10); acc(1); acc(2)", 13},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)", 3628800},
+		{"let fs = []; for (i in 0..3) { fs = push(fs, fn() { i }) }; fs[0]() + fs[2]()", 2},
+		{"let f = fn(a, a) { a }; f(1, 2)", 2},
+		{"let f = fn() { let s = 0; for (i in 1..4) { let sq = i * i; s = s + sq }; s }; f()", 14},
+		{"let f = fn(x) { let x = x + 1; x }; f(1)", 2},
+		{"let g = fn*(n) { for (i in 0..n) { yield i * n } }; let s = 0; for (v in g(3)) { s = s + v }; s", 9},
+		{"let n = 4; let f = fn() { n * 2 }; wait(spawn f)", 8},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	evaluated := testEval("let f = fn() { const c = 1; c = 2 }; f()")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "cannot reassign const c" {
+		t.Errorf("expected const error. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+func TestFrozenEnvironment(t *testing.T) {
+	globals := object.NewEnvironment()
+	if err := LoadPrelude(globals); err != nil {
+		t.Fatalf("could not load prelude: %s", err)
+	}
+	setup := "let square = fn(x) { x * x }; let counter = 0; let table = {\"a\": 1};"
+	Eval(parser.New(lexer.New(setup)).ParseProgram(), globals)
+	globals.Freeze()
+
+	input := "let total = sum(map([1, 2, 3], square)); total + table[\"a\"]"
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	results := make(chan object.Object)
+	for i := 0; i < 8; i++ {
+		go func() {
+			results <- Eval(program, object.NewEnclosedEnvironment(globals))
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		testIntegerObject(t, <-results, 15)
+	}
+
+	tests := []struct {
+		input    string
+		env      *object.Environment
+		expected string
+	}{
+		{"counter = 1", object.NewEnclosedEnvironment(globals),
+			"cannot reassign counter of a frozen environment"},
+		{"let f = fn() { counter = 1 }; f()", object.NewEnclosedEnvironment(globals),
+			"cannot reassign counter of a frozen environment"},
+		{"let x = 1", globals, "cannot define x in a frozen environment"},
+	}
+
+	for _, tt := range tests {
+		evaluated := Eval(parser.New(lexer.New(tt.input)).ParseProgram(), tt.env)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expected {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expected, errObj.Message)
+		}
+	}
+
+	// Shadowing a frozen name is fine
+	testIntegerObject(t, Eval(parser.New(lexer.New("let counter = 5; counter")).ParseProgram(),
+		object.NewEnclosedEnvironment(globals)), 5)
+}
+
+func TestLazyExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = lazy (1 + 2); force(x)", 3},
+		// lazy binds like a prefix operator
+		{"lazy 1 + 2", "type mismatch: THUNK + INTEGER"},
+		{"force(5)", 5},
+		{"let x = lazy y; let y = 10; force(x)", 10},
+		{"let x = lazy (1 / 0); 5", 5},
+		{"let x = lazy (1 / 0); force(x)", "division by zero"},
+		{"let n = 0; let x = lazy fn() { n = n + 1; n }(); force(x); force(x); n", 1},
+		{"let x = lazy 1; x", "lazy"},
+		// an endless stream of integers, only the needed part is computed
+		{`
+let from = fn(n) { [n, lazy from(n + 1)] };
+let nth = fn(stream, i) { if (i == 0) { stream[0] } else { nth(force(stream[1]), i - 1) } };
+nth(from(1), 100)
+`, 101},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+				}
+				continue
+			}
+			if evaluated.Inspect() != expected {
+				t.Errorf("wrong result. expected=%q, got=%q", expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestProfiler(t *testing.T) {
+	input := `
+let square = fn(x) { x * x };
+let sum = 0;
+for (i in 0..10) { sum = sum + square(i) };
+(fn() { sum })()
+`
+	profiler := NewProfiler()
+	testIntegerObject(t, testEvalWithOptions(input, Options{Profiler: profiler}), 285)
+
+	calls := map[string]int64{}
+	for _, entry := range profiler.Functions() {
+		calls[entry.Name] = entry.Count
+	}
+	if calls["square"] != 10 || calls["<anonymous>"] != 1 || len(calls) != 2 {
+		t.Errorf("wrong function calls. got=%v", calls)
+	}
+
+	nodes := map[string]int64{}
+	for _, entry := range profiler.Nodes() {
+		nodes[entry.Name] = entry.Count
+	}
+	if nodes["ForStatement"] != 1 || nodes["CallExpression"] != 11 || nodes["Program"] != 1 {
+		t.Errorf("wrong node counts. got=%v", nodes)
+	}
+
+	var out strings.Builder
+	profiler.Report(&out)
+	if !strings.Contains(out.String(), "square") || !strings.Contains(out.String(), "InfixExpression") {
+		t.Errorf("report is missing entries:\n%s", out.String())
+	}
+}
+
+func TestEvalHooks(t *testing.T) {
+	var events []string
+	opts := Options{
+		BeforeEval: func(node ast.Node, env *object.Environment) {
+			if _, ok := node.(*ast.InfixExpression); ok {
+				events = append(events, "before "+node.String())
+			}
+		},
+		AfterEval: func(node ast.Node, env *object.Environment, result object.Object) {
+			if _, ok := node.(*ast.InfixExpression); ok {
+				events = append(events, "after "+node.String()+" = "+result.Inspect())
+			}
+		},
+	}
+
+	testIntegerObject(t, testEvalWithOptions("let f = fn(x) { x * 2 }; f(1 + 2)", opts), 6)
+
+	expected := []string{
+		"before (1 + 2)",
+		"after (1 + 2) = 3",
+		"before (x * 2)",
+		"after (x * 2) = 6",
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events. expected=%q, got=%q", expected, events)
+	}
+}
+
+func TestBuiltinRegistry(t *testing.T) {
+	double := func(args ...object.Object) object.Object {
+		return object.NewInteger(args[0].(*object.Integer).Value * 2)
+	}
+
+	object.RegisterBuiltin("testDouble", double)
+	testIntegerObject(t, testEval("testDouble(21)"), 42)
+
+	registry := object.DefaultBuiltins.Clone()
+	registry.Register("triple", func(args ...object.Object) object.Object {
+		return object.NewInteger(args[0].(*object.Integer).Value * 3)
+	})
+	testIntegerObject(t, testEvalWithOptions("triple(len([1, 2]))", Options{Builtins: registry}), 6)
+
+	evaluated := testEval("triple(1)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: triple" {
+		t.Errorf("builtin leaked into the default registry. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	empty := object.NewBuiltins()
+	evaluated = testEvalWithOptions("len([1])", Options{Builtins: empty})
+	errObj, ok = evaluated.(*object.Error)
+	if !ok || errObj.Message != "identifier not found: len" {
+		t.Errorf("expected len to be missing. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+func TestSystemBuiltinsAreDocumented(t *testing.T) {
+	for _, name := range SystemBuiltinNames() {
+		usage, doc, _, ok := SystemBuiltinDoc(name)
+		if !ok || !strings.HasPrefix(usage, name+"(") || doc == "" {
+			t.Errorf("system builtin %s has no usage or doc. got=%q, %q", name, usage, doc)
+		}
+	}
+}
+
+type auditObserver struct {
+	NopObserver
+	events []string
+}
+
+func (o *auditObserver) OnDefine(name string, value object.Object, constant bool) error {
+	o.events = append(o.events, "define "+name+" = "+value.Inspect())
+	return nil
+}
+
+func (o *auditObserver) OnCall(name string, fn object.Object, args []object.Object) error {
+	if name == "puts" {
+		return fmt.Errorf("calling %s is not allowed", name)
+	}
+	o.events = append(o.events, fmt.Sprintf("call %s with %d args", name, len(args)))
+	return nil
+}
+
+func (o *auditObserver) OnError(err *object.Error) {
+	o.events = append(o.events, "error "+err.Message)
+}
+
+func TestObserver(t *testing.T) {
+	observer := &auditObserver{}
+	input := `const x = 2; let double = fn(n) { n * 2 }; double(x); len([1]); fn() { 1 }(); puts("hi")`
+	evaluated := testEvalWithOptions(input, Options{Observer: observer})
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "calling puts is not allowed" {
+		t.Fatalf("expected the policy error. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := []string{
+		"define x = 2",
+		"define double = fn(n) {\n(n * 2)\n}",
+		"call double with 1 args",
+		"call len with 1 args",
+		"call  with 0 args",
+		"error calling puts is not allowed",
+	}
+	if strings.Join(observer.events, "|") != strings.Join(expected, "|") {
+		t.Errorf("wrong events.\nwant=%q\ngot=%q", expected, observer.events)
+	}
+}
+
+func TestOverflowModes(t *testing.T) {
+	const max = "9223372036854775807"
+	const min = "(-9223372036854775807 - 1)"
+
+	tests := []struct {
+		input    string
+		mode     OverflowMode
+		expected string
+	}{
+		{max + " + 1", OverflowWrap, "-9223372036854775808"},
+		{min + " - 1", OverflowWrap, max},
+		{max + " * 2", OverflowWrap, "-2"},
+		{"-" + min, OverflowWrap, "-9223372036854775808"},
+		{min + " / -1", OverflowWrap, "-9223372036854775808"},
+
+		{max + " + 1", OverflowSaturate, max},
+		{min + " - 1", OverflowSaturate, "-9223372036854775808"},
+		{max + " * -2", OverflowSaturate, "-9223372036854775808"},
+		{"-" + min, OverflowSaturate, max},
+
+		{max + " + 1", OverflowError, "ERROR: integer overflow: 9223372036854775807 + 1"},
+		{max + " * 3", OverflowError, "ERROR: integer overflow: 9223372036854775807 * 3"},
+		{"-" + min, OverflowError, "ERROR: integer overflow: -(-9223372036854775808)"},
+		{"1 + 2", OverflowError, "3"},
+
+		{max + " + 1", OverflowPromote, "9223372036854775808"},
+		{max + " * " + max, OverflowPromote, "85070591730234615847396907784232501249"},
+		{"(" + max + " + 1) - 1", OverflowPromote, max},
+		{"(" + max + " + 1) == (" + max + " + 1)", OverflowPromote, "true"},
+		{"(" + max + " + 1) > " + max, OverflowPromote, "true"},
+		{"(" + max + " * 4) / (" + max + " * 2)", OverflowPromote, "2"},
+		{"-(" + max + " + 2)", OverflowPromote, "-9223372036854775809"},
+		{"let f = fn(n) { if (n == 0) { 1 } else { n * f(n - 1) } }; f(25)", OverflowPromote,
+			"15511210043330985984000000"},
+		{`let h = {}; let k = ` + max + ` + 1; h = {k: "big"}; h[` + max + ` + 1]`, OverflowPromote, "big"},
+		{"(" + max + " + 1) / 0", OverflowPromote, "ERROR: division by zero"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithOptions(tt.input, Options{Overflow: tt.mode})
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q (mode %d). expected=%q, got=%q",
+				tt.input, tt.mode, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	// Results which fit again are normal integers
+	evaluated := testEvalWithOptions("("+max+" + 1) - 2", Options{Overflow: OverflowPromote})
+	testIntegerObject(t, evaluated, 9223372036854775806)
+}
+
+func TestSetBuiltin(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`set({"a": 1}, "b", 2)`, `{a: 1, b: 2}`},
+		{`set({"a": 1}, "a", 2)`, `{a: 2}`},
+		{`let h = {"a": 1}; let g = set(h, "b", 2); h`, `{a: 1}`},
+		{`let h = {}; for (i in 0..1000) { h = set(h, i, i * i) }; [len(h), h[999]]`, `[1000, 998001]`},
+		{`set({}, fn(x) { x }, 1)`, "ERROR: unusable as hash key: FUNCTION"},
+		{`set([], 1, 2)`, "ERROR: argument to `set` must be HASH, got ARRAY"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		input string
+		code  int
+	}{
+		{"exit()", 0},
+		{"let f = fn() { exit(3); 1 }; f() + 1", 3},
+		{"for (i in 0..10) { if (i == 2) { exit(i) } }", 2},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok || !errObj.Exit || errObj.Code != tt.code {
+			t.Errorf("%q should exit with %d. got=%+v", tt.input, tt.code, errObj)
+		}
+	}
+
+	// codes the system can't keep are errors, not exits
+	for _, input := range []string{"exit(256)", "exit(300)", "exit(-1)"} {
+		errObj, ok := testEval(input).(*object.Error)
+		if !ok || errObj.Exit || !strings.HasPrefix(errObj.Message, "exit code must be between 0 and 255") {
+			t.Errorf("%q should be an error. got=%+v", input, errObj)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 + true;", "1:3"},
+		{"let x = 1;\n  foobar", "2:3"},
+		{"let f = fn(x) {\n  if (x) {\n    x - \"a\"\n  }\n};\nf(1)", "3:7"},
+		{"error(\"boom\")", "1:6"},
+	}
+
+	for _, tt := range tests {
+		errObj, ok := testEval(tt.input).(*object.Error)
+		if !ok {
+			t.Errorf("no error for %q", tt.input)
+			continue
+		}
+		if errObj.Pos.String() != tt.expected {
+			t.Errorf("wrong position for %q. expected=%s, got=%s", tt.input, tt.expected, errObj.Pos)
+		}
+	}
+}
+
+func TestTestBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // the error message, empty when it passes
+	}{
+		{"assert(1 < 2)", ""},
+		{"assert(0 > 1)", "assertion failed"},
+		{`assert(false, "order")`, "order: assertion failed"},
+		{"assertEq([1, 2], [1, 2])", ""},
+		{`assertEq(1, "1")`, `expected "1", got 1`},
+		{`assertEq(len("ab"), 3, "len")`, "len: expected 3, got 2"},
+		{"fail()", "failed"},
+		{`fail("not yet")`, "not yet"},
+		{`test(1, fn() {})`, "first argument to `test` must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		for name, builtin := range TestBuiltins(func(TestCase) {}) {
+			env.Set(name, builtin)
+		}
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		result := Eval(program, env)
+
+		errObj, isErr := result.(*object.Error)
+		switch {
+		case tt.expected == "" && isErr:
+			t.Errorf("%s: expected no error, got=%q", tt.input, errObj.Message)
+		case tt.expected != "" && (!isErr || errObj.Message != tt.expected):
+			t.Errorf("%s: expected error %q, got=%s", tt.input, tt.expected, result.Inspect())
+		}
+	}
+
+	registered := []TestCase{}
+	env := object.NewEnvironment()
+	for name, builtin := range TestBuiltins(func(tc TestCase) { registered = append(registered, tc) }) {
+		env.Set(name, builtin)
+	}
+	Eval(parser.New(lexer.New(`test("a", fn() { 1 }); test("b", fn() { 2 })`)).ParseProgram(), env)
+	if len(registered) != 2 || registered[0].Name != "a" || registered[1].Name != "b" {
+		t.Errorf("expected the tests a and b to be registered, got=%v", registered)
+	}
+}
+
+func TestCallDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		maxDepth int
+		expected interface{}
+	}{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(9)", 10, 0},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10)", 10,
+			"call depth exceeded: more than 10 nested calls"},
+		// calls one after another don't nest
+		{"let f = fn() { 1 }; for (i in 0..100) { f() }; f()", 1, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithOptions(tt.input, Options{MaxDepth: tt.maxDepth})
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok || errObj.Message != expected {
+				t.Errorf("expected error %q, got=%s", expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestModulePath(t *testing.T) {
+	project := writeModules(t, map[string]string{"a.monkey": `let name = "local a";`})
+	first := writeModules(t, map[string]string{"b.monkey": `let name = " first b";`, "a.monkey": `let name = "first a";`})
+	second := writeModules(t, map[string]string{"b.monkey": `let name = " second b";`})
+
+	module := &object.Module{Name: "main", Path: filepath.Join(project, "main.monkey")}
+	eval := func(input string) object.Object {
+		program := parser.New(lexer.New(input)).ParseProgram()
+		env := object.NewModuleEnvironment(module)
+		return EvalWithOptions(context.Background(), program, env, Options{ModulePath: []string{first, second}})
+	}
+
+	// next to the module wins, then the search path in order
+	result := eval(`let a = import("a"); let b = import("b"); a.name + b.name`)
+	if result.Inspect() != "local a first b" {
+		t.Errorf("wrong modules imported, got=%s", result.Inspect())
+	}
+
+	result = eval(`import("./b")`)
+	if errObj, ok := result.(*object.Error); !ok || !strings.Contains(errObj.Message, "no such file") {
+		t.Errorf("expected ./b not to use the search path, got=%s", result.Inspect())
+	}
+
+	result = eval(`import("c")`)
+	expected := `could not import "c": c.monkey not found in ` + project + ", " + first + ", " + second
+	if errObj, ok := result.(*object.Error); !ok || errObj.Message != expected {
+		t.Errorf("expected the searched directories in the error, got=%s", result.Inspect())
+	}
+}
+
+func TestEnvironmentBuiltins(t *testing.T) {
+	t.Setenv("MONKEY_TEST_VAR", "banana")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`getenv("MONKEY_TEST_VAR")`, "banana"},
+		{`getenv("MONKEY_TEST_UNSET")`, "null"},
+		{`env()["MONKEY_TEST_VAR"]`, "banana"},
+		{`setenv("MONKEY_TEST_VAR", "kiwi"); getenv("MONKEY_TEST_VAR")`, "kiwi"},
+		{`setenv("MONKEY_TEST_VAR", getenv("MONKEY_TEST_UNSET")); [getenv("MONKEY_TEST_VAR"), env()["MONKEY_TEST_VAR"]]`, "[null, null]"},
+		{`getenv(1)`, "ERROR: argument to `getenv` must be STRING, got INTEGER"},
+		{`setenv("MONKEY_TEST_VAR", 1)`, "ERROR: second argument to `setenv` must be STRING or NULL, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q. expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+// The body of a generator function only starts running once the first
+// value is requested. A generator which is paused stops once
+// Options.GeneratorsStop is closed, or without one once the context of
+// the evaluation is done, nothing could ask it for the next value then
+func (in *interpreter) newGenerator(fn *object.Function, args []object.Object) *object.Generator {
+	stop := in.opts.GeneratorsStop
+	if stop == nil {
+		stop = in.done
+	}
+
+	return object.NewGenerator(func(yield func(object.Object) bool) object.Object {
+		env := object.NewGeneratorEnvironment(fn.Env, fn.Locals, yield)
+		bindParameters(env, fn.Parameters, args)
+
+		return unwrapReturnValue(in.eval(fn.Body, env))
+	}, stop)
+}
+
+func evalYieldExpression(val object.Object, env *object.Environment) object.Object {
+	yield := env.Yield()
+	if yield == nil {
+		return newError("yield outside of generator function")
+	}
+
+	// a new error every time, the position is set on it
+	if !yield(val) {
+		return newError("generator stopped")
+	}
+
+	return NULL
+}
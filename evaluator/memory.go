@@ -0,0 +1,42 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+// Rough sizes in bytes of a scope, see object.ApproxSize for the values
+const (
+	environmentSize = 96
+	bindingSize     = 48
+)
+
+// Adds bytes to the allocated total, returns an error once the limit is exceeded
+func (in *interpreter) allocate(bytes int64) *object.Error {
+	if in.opts.MaxMemory <= 0 {
+		return nil
+	}
+
+	if in.allocated.Add(bytes) > in.opts.MaxMemory {
+		return newError("memory limit exceeded: more than %d bytes allocated", in.opts.MaxMemory)
+	}
+
+	return nil
+}
+
+// Accounts for a newly created object and passes it through
+func (in *interpreter) track(obj object.Object) object.Object {
+	if in.opts.MaxMemory <= 0 || obj == nil {
+		return obj
+	}
+
+	if err := in.allocate(object.ApproxSize(obj)); err != nil {
+		return err
+	}
+
+	return obj
+}
+
+// Accounts for a new scope with the given number of bindings
+func (in *interpreter) trackEnvironment(bindings int) *object.Error {
+	return in.allocate(environmentSize + int64(bindings)*bindingSize)
+}
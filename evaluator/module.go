@@ -0,0 +1,249 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Default file extension added to imports without one
+const ModuleExtension = ".monkey"
+
+// The environment variable with the directories imports are looked up in,
+// separated like PATH
+const ModulePathVariable = "MONKEY_PATH"
+
+type moduleEntry struct {
+	module *object.Module
+	// true while the module body is being evaluated, used to detect cycles
+	loading bool
+	// closed once the module is loaded or failed to, the error of a failed
+	// one is in err
+	loaded chan struct{}
+	err    object.Object
+	// absolute path of the module which imported this one first
+	importer string
+}
+
+// The modules imports are cached in, every module is only loaded once and
+// later imports get the cached module. Evaluations share one by setting
+// Options.Modules, e.g. the inputs of a REPL session
+type Modules struct {
+	mu      sync.Mutex
+	entries map[string]*moduleEntry
+}
+
+func NewModules() *Modules {
+	return &Modules{}
+}
+
+// The absolute paths of the modules which are loaded, sorted
+// e.g. to watch them for changes
+func (m *Modules) Loaded() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.entries))
+	for path, entry := range m.entries {
+		if !entry.loading {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// The directories of MONKEY_PATH for Options.ModulePath, relative ones
+// are made absolute so a chdir doesn't change what is imported
+func EnvModulePath() []string {
+	dirs := []string{}
+	for _, dir := range filepath.SplitList(os.Getenv(ModulePathVariable)) {
+		if dir == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+func (in *interpreter) evalImportExpression(path object.Object, env *object.Environment) object.Object {
+	name, ok := path.(*object.String)
+	if !ok {
+		return newError("import path must be STRING, got %s", path.Type())
+	}
+
+	if in.opts.Disabled&Filesystem != 0 {
+		return newError("import is disabled: no %s access", Filesystem)
+	}
+
+	importer := env.Module()
+	absPath, err := resolveModulePath(name.Value, importer, in.opts.ModulePath)
+	if err != nil {
+		return newError("could not import %q: %s", name.Value, err)
+	}
+
+	importerPath := ""
+	if importer != nil {
+		importerPath = importer.Path
+	}
+
+	m := in.modules
+	m.mu.Lock()
+	if m.entries == nil {
+		m.entries = map[string]*moduleEntry{}
+	}
+	if entry, ok := m.entries[absPath]; ok {
+		if entry.loading && m.importedBy(absPath, importerPath) {
+			cycle := importCycle(absPath, importerPath, m)
+			m.mu.Unlock()
+			return newError("import cycle detected: %s", cycle)
+		}
+		m.mu.Unlock()
+
+		// Another goroutine of the evaluation is loading it, e.g. a spawned
+		// function, so wait for it instead of loading the file twice
+		select {
+		case <-entry.loaded:
+		case <-in.done:
+			return in.checkCancelled()
+		}
+		if entry.err != nil {
+			return entry.err
+		}
+		return entry.module
+	}
+
+	module := &object.Module{Name: name.Value, Path: absPath}
+	module.Env = object.NewModuleEnvironment(module)
+	entry := &moduleEntry{module: module, loading: true, loaded: make(chan struct{}), importer: importerPath}
+	m.entries[absPath] = entry
+	m.mu.Unlock()
+
+	result := in.loadModule(module)
+	m.mu.Lock()
+	if isError(result) {
+		// Forget the module so a fixed version can be imported again
+		delete(m.entries, absPath)
+		entry.err = result
+	}
+	entry.loading = false
+	close(entry.loaded)
+	m.mu.Unlock()
+
+	if entry.err != nil {
+		return result
+	}
+	return module
+}
+
+// Reads, parses and evaluates the module file in the module environment
+func (in *interpreter) loadModule(module *object.Module) object.Object {
+	source, err := os.ReadFile(module.Path)
+	if err != nil {
+		return newError("could not import %q: %s", module.Name, err)
+	}
+
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("could not import %q: parser errors:\n\t%s",
+			module.Name, strings.Join(p.Errors(), "\n\t"))
+	}
+
+	result := in.eval(program, module.Env)
+	if errObj, ok := result.(*object.Error); ok && errObj.Exit {
+		return result
+	}
+	if isError(result) {
+		return newError("error in module %q: %s", module.Name, result.(*object.Error).Message)
+	}
+
+	return result
+}
+
+// Relative imports are resolved against the directory of the importing module,
+// or the working directory when the import doesn't come from a module
+// When there is no such file the directories of the search path are tried,
+// unless the import starts with ./ or ../
+func resolveModulePath(name string, importer *object.Module, searchPath []string) (string, error) {
+	path := name
+	if filepath.Ext(path) == "" {
+		path += ModuleExtension
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+
+	local := path
+	if importer != nil {
+		local = filepath.Join(filepath.Dir(importer.Path), path)
+	}
+	if explicitlyRelative(name) || len(searchPath) == 0 || fileExists(local) {
+		return filepath.Abs(local)
+	}
+
+	for _, dir := range searchPath {
+		if candidate := filepath.Join(dir, path); fileExists(candidate) {
+			return filepath.Abs(candidate)
+		}
+	}
+	where := filepath.Dir(local)
+	if abs, err := filepath.Abs(where); err == nil {
+		where = abs
+	}
+	return "", fmt.Errorf("%s not found in %s", path, strings.Join(append([]string{where}, searchPath...), ", "))
+}
+
+func explicitlyRelative(name string) bool {
+	name = filepath.ToSlash(name)
+	return strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../")
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// Reports whether the module at importer was imported by target, maybe
+// through other modules, while they all were loading. Then importing target
+// again closes a cycle, m is locked
+func (m *Modules) importedBy(target, importer string) bool {
+	for current := importer; current != ""; {
+		if current == target {
+			return true
+		}
+		entry, ok := m.entries[current]
+		if !ok || !entry.loading {
+			return false
+		}
+		current = entry.importer
+	}
+	return false
+}
+
+// Builds a readable chain like a.monkey -> b.monkey -> a.monkey
+// by following the importers back to the module which closed the cycle,
+// m is locked
+func importCycle(target, importer string, m *Modules) string {
+	chain := []string{filepath.Base(target)}
+	for current := importer; current != "" && current != target; {
+		chain = append([]string{filepath.Base(current)}, chain...)
+		entry, ok := m.entries[current]
+		if !ok {
+			break
+		}
+		current = entry.importer
+	}
+	chain = append([]string{filepath.Base(target)}, chain...)
+
+	return strings.Join(chain, " -> ")
+}
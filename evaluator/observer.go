@@ -0,0 +1,67 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// Gets told what a script does, e.g. for auditing or logging, pass it in
+// Options.Observer. OnDefine and OnCall can return an error to stop the
+// evaluation before the binding or call happens, which lets hosts enforce
+// their own policies. Generators and spawned functions notify from their
+// own goroutine
+type Observer interface {
+	// A let or const statement is about to bind name
+	OnDefine(name string, value object.Object, constant bool) error
+	// A function or builtin is about to be called, name is the name it was
+	// called by and empty when that's not known (e.g. fn(x) { x }(1))
+	OnCall(name string, fn object.Object, args []object.Object) error
+	// The evaluation produced an error, it's only reported once even
+	// though it passes through every enclosing node
+	OnError(err *object.Error)
+}
+
+// Does nothing, embed it to implement only some methods of Observer
+type NopObserver struct{}
+
+func (NopObserver) OnDefine(string, object.Object, bool) error          { return nil }
+func (NopObserver) OnCall(string, object.Object, []object.Object) error { return nil }
+func (NopObserver) OnError(*object.Error)                               {}
+
+func (in *interpreter) observeDefine(node *ast.LetStatement, val object.Object) *object.Error {
+	if in.opts.Observer == nil {
+		return nil
+	}
+	if err := in.opts.Observer.OnDefine(node.Name.Value, val, node.Const); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
+
+func (in *interpreter) observeCall(node *ast.CallExpression, fn object.Object, args []object.Object) *object.Error {
+	if in.opts.Observer == nil {
+		return nil
+	}
+
+	name := ""
+	if ident, ok := node.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	} else if function, ok := fn.(*object.Function); ok {
+		name = function.Name
+	}
+
+	if err := in.opts.Observer.OnCall(name, fn, args); err != nil {
+		return newError("%s", err)
+	}
+	return nil
+}
+
+// Errors bubble up as the same object, remembering the last one is
+// enough to report each of them once
+func (in *interpreter) observeError(result object.Object) {
+	err, ok := result.(*object.Error)
+	if !ok || err.Exit || in.lastError.Swap(err) == err {
+		return
+	}
+	in.opts.Observer.OnError(err)
+}
@@ -0,0 +1,93 @@
+package evaluator
+
+import (
+	"context"
+	"monkey/ast"
+	"monkey/object"
+	"time"
+)
+
+// Options change how a single evaluation runs, the zero value is
+// the same as calling Eval
+type Options struct {
+	// Abort with an error after this many evaluated AST nodes, 0 means no limit
+	// Useful to run untrusted code which could loop forever
+	MaxSteps int64
+
+	// Abort with an error once roughly this many bytes were allocated for
+	// values (strings, arrays, hashes, ...) and scopes, 0 means no limit
+	// It counts everything allocated during the evaluation, not only what
+	// is still in use, which protects hosts embedding the interpreter
+	MaxMemory int64
+
+	// Abort with an error once this many function calls are nested, 0 means
+	// no limit. Without one deep recursion runs until Go is out of stack
+	// The calls of generators and spawned functions are counted as well
+	MaxDepth int
+
+	// Builtins needing one of these capabilities return an error instead,
+	// AllCapabilities leaves only pure functions for untrusted code
+	// Filesystem also disables import
+	Disabled Capability
+
+	// The builtins available by name, nil means object.DefaultBuiltins
+	// Bindings in the environment still shadow them
+	Builtins *object.Builtins
+
+	// Makes runs reproducible: rand() draws from a source seeded with Seed
+	// and now() returns the time of Clock, or the unix epoch without one
+	// Hashes are walked and hash literals evaluated in a fixed order, only
+	// spawned functions which draw from rand() at the same time still
+	// depend on how their goroutines are scheduled
+	Deterministic bool
+	Seed          int64
+
+	// Returns the time used by now(), nil means the real time
+	// Hosts can use it to replay a run or fake the time in tests
+	Clock func() time.Time
+
+	// Counts and times every evaluated node and function call, see Profiler
+	// It slows the evaluation down, only set it to find out what's slow
+	Profiler *Profiler
+
+	// Called before and after every node is evaluated, e.g. to trace or
+	// debug a program. The result is nil for statements without a value
+	// Generators and spawned functions call them from their own goroutine
+	BeforeEval func(node ast.Node, env *object.Environment)
+	AfterEval  func(node ast.Node, env *object.Environment, result object.Object)
+
+	// What integer arithmetic does when the result doesn't fit into an
+	// int64, the zero value wraps around
+	Overflow OverflowMode
+
+	// Told about definitions, calls and errors, see Observer
+	Observer Observer
+
+	// Directories an import which isn't found next to the importing module
+	// is looked up in, in order. Imports starting with ./ or ../ only
+	// ever look next to the module
+	ModulePath []string
+
+	// The cache of imported modules, evaluations sharing it import every
+	// module only once. nil gives the evaluation a cache of its own
+	Modules *Modules
+
+	// Closing it stops the paused generators the evaluation made, e.g.
+	// once the REPL session which can still use them is over. nil stops
+	// them once the context is done. Either way a generator lives on
+	// after the evaluation returned it
+	GeneratorsStop <-chan struct{}
+}
+
+// Like EvalContext but with the limits and behaviour given by opts
+func EvalWithOptions(ctx context.Context, node ast.Node, env *object.Environment, opts Options) object.Object {
+	in := newInterpreter(ctx, opts)
+	return in.eval(node, env)
+}
+
+// Calls fn (a Monkey function or a builtin) with args and the limits and
+// behaviour given by opts, e.g. a callback a program handed to its host
+func ApplyWithOptions(ctx context.Context, fn object.Object, args []object.Object, opts Options) object.Object {
+	in := newInterpreter(ctx, opts)
+	return in.applyFunction(fn, args)
+}
@@ -0,0 +1,106 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+	"monkey/object"
+)
+
+// What happens when integer arithmetic doesn't fit into an int64
+type OverflowMode int
+
+const (
+	// Wrap around like Go does, e.g. the largest integer + 1 is the smallest
+	OverflowWrap OverflowMode = iota
+	// Stick to the largest or smallest integer
+	OverflowSaturate
+	// Stop with an "integer overflow" error
+	OverflowError
+	// Continue with arbitrary precision integers (BIG_INTEGER)
+	OverflowPromote
+)
+
+// Each returns the wrapped result and whether it overflowed
+
+func addInt(a, b int64) (int64, bool) {
+	r := a + b
+	return r, (a^r)&(b^r) < 0
+}
+
+func subInt(a, b int64) (int64, bool) {
+	r := a - b
+	return r, (a^b)&(a^r) < 0
+}
+
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, false
+	}
+	r := a * b
+	overflow := r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64)
+	return r, overflow
+}
+
+func divInt(a, b int64) (int64, bool) {
+	return a / b, a == math.MinInt64 && b == -1
+}
+
+// Decides the result of an overflowing operation, exact computes the real result
+func (in *interpreter) overflow(wrapped int64, exact func() *big.Int, describe func() string) object.Object {
+	switch in.opts.Overflow {
+	case OverflowSaturate:
+		if exact().Sign() < 0 {
+			return object.NewInteger(math.MinInt64)
+		}
+		return object.NewInteger(math.MaxInt64)
+	case OverflowError:
+		return newError("integer overflow: %s", describe())
+	case OverflowPromote:
+		return object.NewBigInteger(exact())
+	default:
+		return object.NewInteger(wrapped)
+	}
+}
+
+func toBigInt(obj object.Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value), true
+	case *object.BigInteger:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+// At least one side is a BIG_INTEGER, the other one may be an INTEGER
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal, _ := toBigInt(left)
+	rightVal, _ := toBigInt(right)
+
+	switch operator {
+	case "+":
+		return object.NewBigInteger(new(big.Int).Add(leftVal, rightVal))
+	case "-":
+		return object.NewBigInteger(new(big.Int).Sub(leftVal, rightVal))
+	case "*":
+		return object.NewBigInteger(new(big.Int).Mul(leftVal, rightVal))
+	case "/":
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		// Quo truncates like the integer division of int64
+		return object.NewBigInteger(new(big.Int).Quo(leftVal, rightVal))
+	case "<":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
@@ -0,0 +1,69 @@
+package evaluator
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"path"
+	"strings"
+)
+
+// The standard library written in Monkey itself
+//
+//go:embed prelude/*.monkey
+var preludeFS embed.FS
+
+// Evaluates the prelude files in alphabetical order into env
+// so their bindings are available to every program using env
+func LoadPrelude(env *object.Environment) error {
+	programs, err := PreludePrograms()
+	if err != nil {
+		return err
+	}
+
+	for _, prelude := range programs {
+		if result := Eval(prelude.Program, env); isError(result) {
+			return fmt.Errorf("%s: %s", prelude.File, result.(*object.Error).Message)
+		}
+	}
+
+	return nil
+}
+
+// A parsed file of the prelude
+type Prelude struct {
+	File    string
+	Program *ast.Program
+}
+
+// The parsed prelude files in alphabetical order, e.g. for the compiler
+// to put in front of a program
+func PreludePrograms() ([]Prelude, error) {
+	files, err := fs.Glob(preludeFS, "prelude/*.monkey")
+	if err != nil {
+		return nil, err
+	}
+
+	programs := []Prelude{}
+	for _, file := range files {
+		source, err := preludeFS.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// errors in the prelude point at its own file instead of the program's
+		p := parser.New(lexer.NewFile("<prelude>/"+path.Base(file), string(source)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return nil, fmt.Errorf("%s: parser errors:\n\t%s", file, strings.Join(p.Errors(), "\n\t"))
+		}
+
+		programs = append(programs, Prelude{File: file, Program: program})
+	}
+
+	return programs, nil
+}
@@ -0,0 +1,72 @@
+package evaluator
+
+import (
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+func testEvalWithPrelude(t *testing.T, input string) object.Object {
+	env := object.NewEnvironment()
+	if err := LoadPrelude(env); err != nil {
+		t.Fatalf("could not load prelude: %s", err)
+	}
+
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	return Eval(program, object.NewEnclosedEnvironment(env))
+}
+
+func TestPrelude(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{"map([], fn(x) { x * 2 })", "[]"},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", "[3, 4]"},
+		{"reduce([1, 2, 3], 10, fn(acc, x) { acc + x })", "16"},
+		{"sum([1, 2, 3, 4])", "10"},
+		{"contains([1, 2, 3], 2)", "true"},
+		{"contains([1, 2, 3], 5)", "false"},
+		{"reverse([1, 2, 3])", "[3, 2, 1]"},
+		{`join([1, 2, 3], ", ")`, "1, 2, 3"},
+		{`join([], ", ")`, ""},
+		{`repeat("ab", 3)`, "ababab"},
+		{`padLeft("7", 3, "0")`, "007"},
+		{`padRight("ab", 4, ".")`, "ab.."},
+		{`padLeft("7", 4, "ab")`, "abab7"},
+		{`padRight("long", 2, "-")`, "long"},
+		{`padLeft("a", 5, "")`, "ERROR: pad of `padLeft` must not be empty"},
+		{`padRight("a", 5, "")`, "ERROR: pad of `padRight` must not be empty"},
+		{`repeat("a", 0)`, ""},
+		{`len(repeat("a", 200000))`, "200000"},
+		{"reverse([])", "[]"},
+		{"let a = []; for (i in 0..5000) { a = push(a, i) }; [sum(a), len(filter(a, fn(x) { x > 10 })), reduce(a, 0, fn(n, x) { n + 1 })]",
+			"[12497500, 4989, 5000]"},
+		{`assert(1 < 2, "math works")`, "null"},
+		{`assert(1 > 2, "math is broken")`, "ERROR: assertion failed: math is broken"},
+		{`assertEqual(1 + 1, 3)`, "ERROR: assertion failed: expected 3, got 2"},
+		{"let map = 5; map", "5"},
+		{"contains([[1], [2]], [2])", "true"},
+		{"assertEqual(map([1, 2], fn(x) { x + 1 }), [2, 3])", "null"},
+		{"take([1, 2, 3], 2)", "[1, 2]"},
+		{"take(0..3, 5)", "[0, 1, 2]"},
+		{"take(fn*() { let i = 0; for (x in 0..1000000000) { i = i + 2; yield i } }(), 3)", "[2, 4, 6]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithPrelude(t, tt.input)
+		if evaluated == nil {
+			t.Errorf("%s: no result", tt.input)
+			continue
+		}
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
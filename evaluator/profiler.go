@@ -0,0 +1,116 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/object"
+	"reflect"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Collects how often each kind of AST node and each function was evaluated
+// and how long it took, pass it in Options.Profiler to enable it
+// Times include everything evaluated underneath, so a recursive function
+// is counted once per active call
+// One profiler can be shared by several runs, the numbers add up
+type Profiler struct {
+	mu        sync.Mutex
+	nodes     map[string]*ProfileEntry
+	functions map[string]*ProfileEntry
+}
+
+type ProfileEntry struct {
+	Name  string
+	Count int64
+	Total time.Duration
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		nodes:     map[string]*ProfileEntry{},
+		functions: map[string]*ProfileEntry{},
+	}
+}
+
+// Called deferred with the start time, e.g. defer p.recordNode(node, time.Now())
+func (p *Profiler) recordNode(node ast.Node, start time.Time) {
+	p.record(p.nodes, reflect.TypeOf(node).Elem().Name(), time.Since(start))
+}
+
+func (p *Profiler) recordFunction(fn *object.Function, start time.Time) {
+	name := fn.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+	p.record(p.functions, name, time.Since(start))
+}
+
+func (p *Profiler) record(entries map[string]*ProfileEntry, name string, elapsed time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := entries[name]
+	if !ok {
+		entry = &ProfileEntry{Name: name}
+		entries[name] = entry
+	}
+	entry.Count++
+	entry.Total += elapsed
+}
+
+// The node types sorted by their total time, slowest first
+func (p *Profiler) Nodes() []ProfileEntry {
+	return p.sorted(p.nodes)
+}
+
+// The functions sorted by their total time, slowest first
+// Functions are named after the let they are bound to
+func (p *Profiler) Functions() []ProfileEntry {
+	return p.sorted(p.functions)
+}
+
+func (p *Profiler) sorted(entries map[string]*ProfileEntry) []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result := make([]ProfileEntry, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// Writes both tables in a human readable form
+func (p *Profiler) Report(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "FUNCTION\tCALLS\tTOTAL\tAVERAGE")
+	for _, entry := range p.Functions() {
+		writeProfileEntry(w, entry)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "NODE\tCOUNT\tTOTAL\tAVERAGE")
+	for _, entry := range p.Nodes() {
+		writeProfileEntry(w, entry)
+	}
+
+	w.Flush()
+}
+
+func writeProfileEntry(w io.Writer, entry ProfileEntry) {
+	average := entry.Total / time.Duration(entry.Count)
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", entry.Name, entry.Count, entry.Total, average)
+}
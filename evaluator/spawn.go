@@ -0,0 +1,120 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+// The spawned function works on a snapshot of its environment so it can't
+// race with the spawning code, values have to be shared through channels.
+// Lazy values which aren't forced yet and generators can't be snapshotted,
+// see Environment.Snapshot
+func (in *interpreter) evalSpawnExpression(fn object.Object) object.Object {
+	function, ok := fn.(*object.Function)
+	if !ok {
+		return newError("spawn needs a FUNCTION, got %s", fn.Type())
+	}
+
+	if len(function.Parameters) != 0 {
+		return newError("spawned function must not take arguments, got %d parameters",
+			len(function.Parameters))
+	}
+
+	isolated := &object.Function{
+		Name:       function.Name,
+		Parameters: function.Parameters,
+		Body:       function.Body,
+		Locals:     function.Locals,
+		Env:        function.Env.Snapshot(),
+		Generator:  function.Generator,
+	}
+
+	return object.NewTask(func() object.Object {
+		return in.applyFunction(isolated, nil)
+	})
+}
+
+// recv, send and wait block until another goroutine is ready, so the
+// evaluator has its own versions which wake up when the evaluation is
+// cancelled like sleep does. They only replace object's builtins, a
+// host's own builtin of the same name is used as it is
+var blockingBuiltins = map[string]func(in *interpreter, args ...object.Object) object.Object{
+	"send": func(in *interpreter, args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newError("wrong number of arguments. got=%d, want=2", len(args))
+		}
+		channel, ok := args[0].(*object.Channel)
+		if !ok {
+			return newError("argument to `send` must be CHANNEL, got %s", args[0].Type())
+		}
+
+		if !channel.Send(args[1], in.done) {
+			if err := in.checkCancelled(); err != nil {
+				return err
+			}
+			return newError("send on closed channel")
+		}
+
+		return NULL
+	},
+	"recv": func(in *interpreter, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		channel, ok := args[0].(*object.Channel)
+		if !ok {
+			return newError("argument to `recv` must be CHANNEL, got %s", args[0].Type())
+		}
+
+		value, ok := channel.Receive(in.done)
+		if !ok {
+			if err := in.checkCancelled(); err != nil {
+				return err
+			}
+			return NULL
+		}
+
+		return value
+	},
+	"wait": func(in *interpreter, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		task, ok := args[0].(*object.Task)
+		if !ok {
+			return newError("argument to `wait` must be TASK, got %s", args[0].Type())
+		}
+
+		result, ok := task.Wait(in.done)
+		if !ok {
+			return in.checkCancelled()
+		}
+		if result == nil {
+			return NULL
+		}
+
+		return result
+	},
+}
+
+// object's versions of blockingBuiltins, looked up before a host can
+// replace them
+var objectBlockingBuiltins = func() map[string]*object.Builtin {
+	builtins := map[string]*object.Builtin{}
+	for name := range blockingBuiltins {
+		builtins[name], _ = object.DefaultBuiltins.Lookup(name)
+	}
+	return builtins
+}()
+
+// The version of builtin which stops waiting once the evaluation is
+// cancelled, if there is one
+func (in *interpreter) cancellable(name string, builtin *object.Builtin) *object.Builtin {
+	fn, ok := blockingBuiltins[name]
+	if !ok || objectBlockingBuiltins[name] != builtin {
+		return builtin
+	}
+
+	return &object.Builtin{Usage: builtin.Usage, Doc: builtin.Doc, Fn: func(args ...object.Object) object.Object {
+		return fn(in, args...)
+	}}
+}
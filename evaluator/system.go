@@ -0,0 +1,309 @@
+package evaluator
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"monkey/object"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Categories of builtins which reach outside of the interpreter
+// They can be combined, e.g. Filesystem | Stdin
+type Capability uint8
+
+const (
+	Filesystem Capability = 1 << iota
+	Stdin
+	Time
+	Random
+	// The environment variables of the process
+	Environment
+
+	// Everything above, disabling it leaves only the pure builtins
+	AllCapabilities = Filesystem | Stdin | Time | Random | Environment
+)
+
+func (c Capability) String() string {
+	switch c {
+	case Filesystem:
+		return "filesystem"
+	case Stdin:
+		return "stdin"
+	case Time:
+		return "time"
+	case Random:
+		return "random"
+	case Environment:
+		return "environment"
+	default:
+		return "unknown"
+	}
+}
+
+// A builtin which needs a capability, it gets the interpreter so it can
+// use per run state
+type systemBuiltin struct {
+	// Like object.Builtin.Usage and Doc
+	usage, doc string
+	capability Capability
+	fn         func(in *interpreter, args ...object.Object) object.Object
+}
+
+var (
+	stdinOnce   sync.Once
+	stdinReader *bufio.Reader
+)
+
+// Shared by every evaluation, a new reader per call would lose buffered input
+func readStdinLine() (string, error) {
+	stdinOnce.Do(func() { stdinReader = bufio.NewReader(os.Stdin) })
+	return stdinReader.ReadString('\n')
+}
+
+var systemBuiltins = map[string]systemBuiltin{
+	"readFile": {
+		usage:      "readFile(path)",
+		doc:        "The content of the file as a string",
+		capability: Filesystem,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ {
+				return newError("argument to `readFile` must be STRING, got %s", args[0].Type())
+			}
+
+			content, err := os.ReadFile(args[0].(*object.String).Value)
+			if err != nil {
+				return newError("could not read file: %s", err)
+			}
+
+			return &object.String{Value: string(content)}
+		},
+	},
+	"writeFile": {
+		usage:      "writeFile(path, content)",
+		doc:        "Writes the string to the file, replacing what was there",
+		capability: Filesystem,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ {
+				return newError("first argument to `writeFile` must be STRING, got %s", args[0].Type())
+			}
+			if args[1].Type() != object.STRING_OBJ {
+				return newError("second argument to `writeFile` must be STRING, got %s", args[1].Type())
+			}
+
+			path := args[0].(*object.String).Value
+			content := args[1].(*object.String).Value
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				return newError("could not write file: %s", err)
+			}
+
+			return NULL
+		},
+	},
+	"readLine": {
+		usage:      "readLine()",
+		doc:        "The next line of stdin without the newline, null at the end of the input",
+		capability: Stdin,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+
+			line, err := readStdinLine()
+			if err == io.EOF && line == "" {
+				return NULL
+			}
+			if err != nil && err != io.EOF {
+				return newError("could not read stdin: %s", err)
+			}
+
+			return &object.String{Value: strings.TrimRight(line, "\r\n")}
+		},
+	},
+	"now": {
+		usage:      "now()",
+		doc:        "Milliseconds since the unix epoch",
+		capability: Time,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+
+			return object.NewInteger(in.clock().UnixMilli())
+		},
+	},
+	"sleep": {
+		usage:      "sleep(ms)",
+		doc:        "Pauses for the given number of milliseconds, a cancelled evaluation wakes it up",
+		capability: Time,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != object.INTEGER_OBJ {
+				return newError("argument to `sleep` must be INTEGER, got %s", args[0].Type())
+			}
+
+			timer := time.NewTimer(time.Duration(args[0].(*object.Integer).Value) * time.Millisecond)
+			defer timer.Stop()
+
+			select {
+			case <-timer.C:
+				return NULL
+			case <-in.done:
+				return in.checkCancelled()
+			}
+		},
+	},
+	"rand": {
+		usage:      "rand(max)",
+		doc:        "A random integer n with 0 <= n < max",
+		capability: Random,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != object.INTEGER_OBJ {
+				return newError("argument to `rand` must be INTEGER, got %s", args[0].Type())
+			}
+
+			max := args[0].(*object.Integer).Value
+			if max <= 0 {
+				return newError("argument to `rand` must be positive, got %d", max)
+			}
+
+			return object.NewInteger(in.randInt(max))
+		},
+	},
+	"getenv": {
+		usage:      "getenv(name)",
+		doc:        "The value of the environment variable, null when it isn't set",
+		capability: Environment,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ {
+				return newError("argument to `getenv` must be STRING, got %s", args[0].Type())
+			}
+
+			value, ok := os.LookupEnv(args[0].(*object.String).Value)
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: value}
+		},
+	},
+	"setenv": {
+		usage:      "setenv(name, value)",
+		doc:        "Sets the environment variable for the rest of the process, null (e.g. from getenv) unsets it",
+		capability: Environment,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != object.STRING_OBJ {
+				return newError("first argument to `setenv` must be STRING, got %s", args[0].Type())
+			}
+
+			name := args[0].(*object.String).Value
+			var err error
+			switch value := args[1].(type) {
+			case *object.String:
+				err = os.Setenv(name, value.Value)
+			case *object.Null:
+				err = os.Unsetenv(name)
+			default:
+				return newError("second argument to `setenv` must be STRING or NULL, got %s", args[1].Type())
+			}
+			if err != nil {
+				return newError("could not set %s: %s", name, err)
+			}
+
+			return NULL
+		},
+	},
+	"env": {
+		usage:      "env()",
+		doc:        "A hash of every environment variable",
+		capability: Environment,
+		fn: func(in *interpreter, args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+
+			pairs := map[object.HashKey]object.HashPair{}
+			for _, entry := range os.Environ() {
+				name, value, _ := strings.Cut(entry, "=")
+				key := &object.String{Value: name}
+				pairs[key.HashKey()] = object.HashPair{Key: key, Value: &object.String{Value: value}}
+			}
+			return object.NewHash(pairs)
+		},
+	},
+}
+
+// The names of the builtins which need a capability in alphabetical order,
+// they aren't in object.DefaultBuiltins
+func SystemBuiltinNames() []string {
+	names := make([]string, 0, len(systemBuiltins))
+	for name := range systemBuiltins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// The usage and doc of a builtin which needs a capability, they are
+// documented like the ones in object.DefaultBuiltins
+func SystemBuiltinDoc(name string) (usage, doc string, capability Capability, ok bool) {
+	builtin, ok := systemBuiltins[name]
+	return builtin.usage, builtin.doc, builtin.capability, ok
+}
+
+// A seeded source for deterministic runs, generators and spawned
+// functions share it so it has to be locked
+type lockedRand struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (in *interpreter) randInt(max int64) int64 {
+	if in.rand == nil {
+		return rand.Int63n(max)
+	}
+
+	in.rand.mu.Lock()
+	defer in.rand.mu.Unlock()
+	return in.rand.rnd.Int63n(max)
+}
+
+// Looks up a builtin which needs a capability, sandboxed runs get an error instead
+func (in *interpreter) systemBuiltin(name string) (object.Object, bool) {
+	builtin, ok := systemBuiltins[name]
+	if !ok {
+		return nil, false
+	}
+
+	if in.opts.Disabled&builtin.capability != 0 {
+		return newError("builtin %s is disabled: no %s access", name, builtin.capability), true
+	}
+
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		return builtin.fn(in, args...)
+	}}, true
+}
@@ -0,0 +1,117 @@
+package evaluator
+
+import (
+	"fmt"
+	"monkey/object"
+	"strconv"
+)
+
+// A test a file registered with test(name, fn) or a benchmark of
+// bench(name, fn), fn takes no arguments
+type TestCase struct {
+	Name string
+	Fn   object.Object
+}
+
+// The helpers of monkey test: assert, assertEq, fail and test. They are
+// bound in the environment of a test file, so they hide the assert of the
+// prelude. test(name, fn) passes the test to register, it runs later
+func TestBuiltins(register func(TestCase)) map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"assert": {
+			Usage: "assert(cond, [message])",
+			Doc:   "Fails the test when cond isn't truthy",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 1 || len(args) > 2 {
+					return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+				}
+				if isTruthy(args[0]) {
+					return NULL
+				}
+				return testFailure("assertion failed", args[1:])
+			},
+		},
+		"assertEq": {
+			Usage: "assertEq(actual, expected, [message])",
+			Doc:   "Fails the test when actual isn't equal to expected",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) < 2 || len(args) > 3 {
+					return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+				}
+				if object.Equals(args[0], args[1]) {
+					return NULL
+				}
+				msg := fmt.Sprintf("expected %s, got %s", inspectQuoted(args[1]), inspectQuoted(args[0]))
+				return testFailure(msg, args[2:])
+			},
+		},
+		"fail": {
+			Usage: "fail([message])",
+			Doc:   "Fails the test right away",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) > 1 {
+					return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+				if len(args) == 0 {
+					return newError("failed")
+				}
+				if s, ok := args[0].(*object.String); ok {
+					return newError("%s", s.Value)
+				}
+				return newError("%s", args[0].Inspect())
+			},
+		},
+		"test": registerBuiltin("test", "Registers fn as the test name, monkey test calls it after the file ran", register),
+	}
+}
+
+// bench(name, fn) of monkey bench, like test it only registers fn
+func BenchBuiltins(register func(TestCase)) map[string]*object.Builtin {
+	return map[string]*object.Builtin{
+		"bench": registerBuiltin("bench", "Registers fn as the benchmark name, monkey bench calls it many times", register),
+	}
+}
+
+// test and bench, they take a name and a function without arguments
+func registerBuiltin(name, doc string, register func(TestCase)) *object.Builtin {
+	return &object.Builtin{
+		Usage: name + "(name, fn)",
+		Doc:   doc,
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			label, ok := args[0].(*object.String)
+			if !ok {
+				return newError("first argument to `%s` must be STRING, got %s", name, args[0].Type())
+			}
+			switch args[1].(type) {
+			case *object.Function, *object.Builtin:
+			default:
+				return newError("second argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+			}
+
+			register(TestCase{Name: label.Value, Fn: args[1]})
+			return NULL
+		},
+	}
+}
+
+// The message of the test goes in front of what went wrong
+func testFailure(msg string, message []object.Object) *object.Error {
+	if len(message) == 1 {
+		if s, ok := message[0].(*object.String); ok {
+			return newError("%s: %s", s.Value, msg)
+		}
+		return newError("%s: %s", message[0].Inspect(), msg)
+	}
+	return newError("%s", msg)
+}
+
+// Strings in quotes, so "1" and 1 look different
+func inspectQuoted(obj object.Object) string {
+	if s, ok := obj.(*object.String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,477 @@
+// Prints Monkey programs in the one canonical style, like gofmt does for Go
+//
+// Statements get a line each, blocks are indented by two spaces and
+// parentheses are only kept where the precedence needs them. Comments and
+// single blank lines between statements are kept where they were
+package format
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+const indentation = "  "
+
+// Operands of calls, indexes and members and everything which binds
+// even tighter (names, literals, ...)
+const primary = parser.INDEX + 1
+
+// Formats the source of a whole program, it has to parse
+func Source(src string) (string, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", &ParseError{Errors: p.Diagnostics()}
+	}
+	return Program(program, src), nil
+}
+
+type ParseError struct {
+	Errors []parser.Error
+}
+
+func (e *ParseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.String()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Prints a parsed program with its comments, src is the source it was parsed
+// from, it tells where the blank lines are
+func Program(program *ast.Program, src string) string {
+	pr := &printer{lines: strings.Split(src, "\n"), comments: program.Comments}
+
+	pr.first = true
+	pr.statements(program.Statements)
+	pr.commentsBefore(token.Position{Line: len(pr.lines) + 1})
+
+	out := pr.b.String()
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+type printer struct {
+	b      strings.Builder
+	indent int
+	lines  []string
+
+	comments []token.Token
+	// The last source line something was printed from, comments up to
+	// there go behind the current line
+	last int
+	// Nothing was printed yet in the current block
+	first bool
+}
+
+func (p *printer) write(s string) {
+	p.b.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.write("\n" + strings.Repeat(indentation, p.indent))
+}
+
+// Starts the line of a statement or comment at line in the source, one
+// blank line in front of it is kept
+func (p *printer) startLine(line int) {
+	if p.b.Len() == 0 {
+		p.first = false
+		return
+	}
+	if !p.first && line >= 2 && line-2 < len(p.lines) && strings.TrimSpace(p.lines[line-2]) == "" {
+		p.write("\n")
+	}
+	p.first = false
+	p.newline()
+}
+
+func (p *printer) seen(pos token.Position) {
+	if pos.Line > p.last {
+		p.last = pos.Line
+	}
+}
+
+// Comments which come before pos get their own lines
+func (p *printer) commentsBefore(pos token.Position) {
+	for len(p.comments) > 0 && before(p.comments[0].Pos, pos) {
+		p.startLine(p.comments[0].Pos.Line)
+		p.write(p.comments[0].Literal)
+		p.comments = p.comments[1:]
+	}
+}
+
+// Comments on the lines printed so far go to the end of the current line,
+// e.g. let x = 1; // the answer
+func (p *printer) trailingComments() {
+	for i := 0; len(p.comments) > 0 && p.comments[0].Pos.Line <= p.last; i++ {
+		if i == 0 && p.afterCode(p.comments[0].Pos) {
+			p.write(" ")
+		} else {
+			p.newline()
+		}
+		p.write(p.comments[0].Literal)
+		p.comments = p.comments[1:]
+	}
+}
+
+// Reports whether there is code in front of pos on its line in the source
+func (p *printer) afterCode(pos token.Position) bool {
+	if pos.Line-1 >= len(p.lines) {
+		return false
+	}
+	line := p.lines[pos.Line-1]
+	return strings.TrimSpace(line[:min(pos.Column-1, len(line))]) != ""
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+func (p *printer) statements(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		p.commentsBefore(stmt.Pos())
+		p.startLine(stmt.Pos().Line)
+		p.statementText(stmt, !endsWithBrace(stmt) || i+1 < len(stmts) && p.continues(stmts[i+1]))
+		p.trailingComments()
+	}
+}
+
+// if (...) { ... } ends with a brace like a for loop and needs no semicolon
+func endsWithBrace(stmt ast.Statement) bool {
+	if stmt, ok := stmt.(*ast.ExpressionStatement); ok {
+		_, ok := stmt.Expression.(*ast.IfExpression)
+		return ok
+	}
+	return false
+}
+
+// Reports whether stmt would continue an expression statement in front of it
+// which isn't ended with a semicolon, e.g. -1 and [1, 2] do
+func (p *printer) continues(stmt ast.Statement) bool {
+	exp, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	scratch := &printer{lines: p.lines}
+	scratch.expression(exp.Expression, parser.LOWEST)
+	first := lexer.New(scratch.b.String()).NextToken()
+	return parser.Precedence(first.Type) > parser.LOWEST
+}
+
+// Without semicolon the statement is the only one of a block on one line,
+// or an if which the next statement doesn't continue
+func (p *printer) statementText(stmt ast.Statement, semicolon bool) {
+	p.seen(stmt.Pos())
+
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write(stmt.Token.Literal + " " + stmt.Name.Value + " = ")
+		p.expression(stmt.Value, parser.LOWEST)
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.ReturnValue, parser.LOWEST)
+	case *ast.ForStatement:
+		p.write("for (")
+		if stmt.Key != nil {
+			p.write(stmt.Key.Value + ", ")
+		}
+		p.write(stmt.Value.Value + " in ")
+		p.expression(stmt.Iterable, parser.LOWEST)
+		p.write(") ")
+		p.block(stmt.Body)
+		return
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+	}
+
+	if semicolon {
+		p.write(";")
+	}
+}
+
+// A block with one statement which was written on one line stays that way,
+// e.g. fn(x) { x * 2 }
+func (p *printer) block(block *ast.BlockStatement) {
+	p.seen(block.Pos())
+	p.write("{")
+
+	if len(block.Statements) == 0 && !p.commentBefore(block.Rbrace) {
+		p.write("}")
+		p.seen(block.Rbrace)
+		return
+	}
+	if len(block.Statements) == 1 && block.Pos().Line == block.Rbrace.Line {
+		p.write(" ")
+		p.statementText(block.Statements[0], false)
+		p.write(" }")
+		p.seen(block.Rbrace)
+		return
+	}
+
+	p.trailingComments()
+	p.indent++
+	p.first = true
+	p.statements(block.Statements)
+	p.commentsBefore(block.Rbrace)
+	p.indent--
+	p.first = false
+
+	p.newline()
+	p.write("}")
+	p.seen(block.Rbrace)
+}
+
+func (p *printer) commentBefore(pos token.Position) bool {
+	return len(p.comments) > 0 && before(p.comments[0].Pos, pos)
+}
+
+// Prints exp, in parentheses if it binds less tightly than precedence
+func (p *printer) expression(exp ast.Expression, precedence int) {
+	p.seen(exp.Pos())
+
+	if precedenceOf(exp) < precedence {
+		p.write("(")
+		p.expression(exp, parser.LOWEST)
+		p.write(")")
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(exp.Token.Literal)
+	case *ast.Boolean:
+		p.write(exp.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(quote(exp.Value))
+	case *ast.TemplateLiteral:
+		// the embedded expressions are kept as they were written
+		p.write(`"` + exp.Token.Literal + `"`)
+	case *ast.PrefixExpression:
+		p.write(exp.Operator)
+		p.expression(exp.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		// a - b - c is (a - b) - c, the right side needs parentheses
+		// when it has the same precedence
+		op := parser.Precedence(exp.Token.Type)
+		p.expression(exp.Left, op)
+		if exp.Token.Type == token.RANGE {
+			p.write(exp.Operator)
+		} else {
+			p.write(" " + exp.Operator + " ")
+		}
+		p.expression(exp.Right, op+1)
+	case *ast.AssignExpression:
+		p.write(exp.Name.Value + " = ")
+		p.expression(exp.Value, parser.LOWEST)
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn")
+		if exp.Generator {
+			p.write("*")
+		}
+		p.write("(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+		}
+		p.write(") ")
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.operand(exp.Function)
+		p.list("(", exp.Arguments, ")", exp.Pos())
+	case *ast.IndexExpression:
+		p.operand(exp.Left)
+		p.write("[")
+		p.expression(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.MemberExpression:
+		p.operand(exp.Object)
+		p.write(exp.Token.Literal + exp.Property.Value)
+	case *ast.ArrayLiteral:
+		p.list("[", exp.Elements, "]", exp.Pos())
+	case *ast.HashLiteral:
+		p.hash(exp)
+	case *ast.ImportExpression:
+		p.write("import(")
+		p.expression(exp.Path, parser.LOWEST)
+		p.write(")")
+	case *ast.YieldExpression:
+		p.write("yield ")
+		p.expression(exp.Value, parser.LOWEST)
+	case *ast.LazyExpression:
+		p.write("lazy ")
+		p.expression(exp.Value, parser.PREFIX)
+	case *ast.SpawnExpression:
+		p.write("spawn ")
+		p.expression(exp.Function, parser.CALL)
+	}
+}
+
+// How tightly exp holds together, its operands can go next to an operator
+// of a lower precedence without parentheses
+func precedenceOf(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(exp.Token.Type)
+	case *ast.AssignExpression:
+		return parser.ASSIGN
+	case *ast.PrefixExpression, *ast.SpawnExpression, *ast.LazyExpression:
+		return parser.PREFIX
+	case *ast.CallExpression:
+		return parser.CALL
+	case *ast.IndexExpression, *ast.MemberExpression:
+		return parser.INDEX
+	case *ast.YieldExpression:
+		// everything after them belongs to them
+		return parser.LOWEST
+	default:
+		return primary
+	}
+}
+
+// The function, left side or object of a call, index or member. A chain
+// with a ?. which ends there was in parentheses, e.g. (a?.b).c
+func (p *printer) operand(exp ast.Expression) {
+	if !ast.Chained(exp) && optional(exp) {
+		p.seen(exp.Pos())
+		p.write("(")
+		p.expression(exp, parser.LOWEST)
+		p.write(")")
+		return
+	}
+	p.expression(exp, parser.CALL)
+}
+
+// Reports whether a ?. is part of the chain which ends with exp
+func optional(exp ast.Expression) bool {
+	for {
+		switch e := exp.(type) {
+		case *ast.MemberExpression:
+			if e.Optional {
+				return true
+			}
+			exp = e.Object
+		case *ast.IndexExpression:
+			exp = e.Left
+		case *ast.CallExpression:
+			exp = e.Function
+		default:
+			return false
+		}
+		if !ast.Chained(exp) {
+			return false
+		}
+	}
+}
+
+// Elements written on lines of their own keep a line each
+func (p *printer) list(open string, elements []ast.Expression, close string, pos token.Position) {
+	p.write(open)
+	if !multiline(pos, elements) {
+		for i, el := range elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(el, parser.LOWEST)
+		}
+		p.write(close)
+		return
+	}
+
+	p.indent++
+	for i, el := range elements {
+		p.commentsBefore(el.Pos())
+		p.newline()
+		p.expression(el, parser.LOWEST)
+		// arrays and calls don't allow a comma after the last element
+		if i < len(elements)-1 {
+			p.write(",")
+		}
+		p.trailingComments()
+	}
+	p.indent--
+	p.newline()
+	p.write(close)
+}
+
+func multiline(pos token.Position, elements []ast.Expression) bool {
+	return len(elements) > 0 && elements[0].Pos().Line > pos.Line
+}
+
+// The pairs are kept in the order they were written in
+func (p *printer) hash(hash *ast.HashLiteral) {
+	keys := ast.SortedKeys(hash)
+
+	p.write("{")
+	if !multiline(hash.Pos(), keys) {
+		for i, key := range keys {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pair(key, hash.Pairs[key])
+		}
+		p.write("}")
+		return
+	}
+
+	p.indent++
+	for _, key := range keys {
+		p.commentsBefore(key.Pos())
+		p.newline()
+		p.pair(key, hash.Pairs[key])
+		p.write(",")
+		p.trailingComments()
+	}
+	p.indent--
+	p.newline()
+	p.write("}")
+}
+
+func (p *printer) pair(key, value ast.Expression) {
+	p.expression(key, parser.LOWEST)
+	p.write(": ")
+	p.expression(value, parser.LOWEST)
+}
+
+// The string literal the lexer reads back as s
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '"' || ch == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case ch == '\n':
+			b.WriteString(`\n`)
+		case ch == '\t':
+			b.WriteString(`\t`)
+		case ch == '$' && i+1 < len(s) && s[i+1] == '{':
+			// otherwise it would be a template
+			b.WriteString(`\$`)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
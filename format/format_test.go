@@ -0,0 +1,136 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x   =   5", "let x = 5;\n"},
+		{"const  y=x", "const y = x;\n"},
+		{"return 1", "return 1;\n"},
+		{"", ""},
+		// parentheses only where the precedence needs them
+		{"(1 + 2) * 3", "(1 + 2) * 3;\n"},
+		{"1 + (2 * 3)", "1 + 2 * 3;\n"},
+		{"a - (b - c)", "a - (b - c);\n"},
+		{"(a - b) - c", "a - b - c;\n"},
+		{"-(a + b)", "-(a + b);\n"},
+		{"!(-a)", "!-a;\n"},
+		{"(a + b)(c)", "(a + b)(c);\n"},
+		{"(f(x)).y", "f(x).y;\n"},
+		{"(a = 1) + 2", "(a = 1) + 2;\n"},
+		{"x = (y = 1)", "x = y = 1;\n"},
+		{"(lazy a) + b", "lazy a + b;\n"},
+		{"lazy (a + b)", "lazy (a + b);\n"},
+		{"(lazy f)(x)", "(lazy f)(x);\n"},
+		{"1 .. 10", "1..10;\n"},
+		{"a?.b ?? c", "a?.b ?? c;\n"},
+		{"(a?.b).c", "(a?.b).c;\n"},
+		{"(a?.b.c)(1)[0]", "(a?.b.c)(1)[0];\n"},
+		{"((a?.b).c).d", "(a?.b).c.d;\n"},
+		{`"a\"b\n\t\\ \${x}"`, `"a\"b\n\t\\ \${x}";` + "\n"},
+		{`"sum: ${ a+b }"`, `"sum: ${ a+b }";` + "\n"},
+		{"[1,2,  3][0]", "[1, 2, 3][0];\n"},
+		{`{"b":1,"a":2}`, `{"b": 1, "a": 2};` + "\n"},
+		{"import( \"lib\" )", "import(\"lib\");\n"},
+		{"spawn fn() { 1 }", "spawn fn() { 1 };\n"},
+		// blocks
+		{"fn(x){x*2}", "fn(x) { x * 2 };\n"},
+		{"fn*(){ yield 1; yield 2 }", "fn*() {\n  yield 1;\n  yield 2;\n};\n"},
+		{"if (x) {\n1} else {2}", "if (x) {\n  1;\n} else { 2 }\n"},
+		{"if(x){}", "if (x) {}\n"},
+		{"if (x) { 1 }; -1", "if (x) { 1 };\n-1;\n"},
+		{"if (x) { 1 }; [1, 2]", "if (x) { 1 };\n[1, 2];\n"},
+		{"if (x) { 1 }; (a = 1) + 2", "if (x) { 1 };\n(a = 1) + 2;\n"},
+		{"if (x) { 1 }; f(1)", "if (x) { 1 }\nf(1);\n"},
+		{"for (k,v in h) { puts(k) }", "for (k, v in h) { puts(k) }\n"},
+		{"let f = fn(a) {\nlet b = a\n\n\n\nb\n}", "let f = fn(a) {\n  let b = a;\n\n  b;\n};\n"},
+		// elements on their own lines keep them
+		{"let a = [\n1, 2]", "let a = [\n  1,\n  2\n];\n"},
+		{"let h = {\n\"a\": 1, \"b\": 2}", "let h = {\n  \"a\": 1,\n  \"b\": 2,\n};\n"},
+		// comments
+		{"// one\n\n// two\nlet x = 1 // three", "// one\n\n// two\nlet x = 1; // three\n"},
+		{"let f = fn() { // open\n  1\n  // close\n}\n// end\n", "let f = fn() { // open\n  1;\n  // close\n};\n// end\n"},
+		{"if (x) {\n // nothing\n}", "if (x) {\n  // nothing\n}\n"},
+		{"let a = [\n  1, // one\n  2 // two\n]", "let a = [\n  1, // one\n  2 // two\n];\n"},
+		{"f(1, // one\n2)", "f(1, 2); // one\n"},
+	}
+
+	for _, tt := range tests {
+		formatted, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("Source(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if formatted != tt.expected {
+			t.Errorf("Source(%q) wrong.\nexpected=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+		if again, _ := Source(formatted); again != formatted {
+			t.Errorf("formatting %q again changed it.\nexpected=%q\ngot=%q", formatted, formatted, again)
+		}
+	}
+}
+
+// Formatting keeps the meaning, the result parses to the same program and
+// formatting it again changes nothing
+func TestSourceRoundTrip(t *testing.T) {
+	inputs := []string{
+		"if (x) { 1 };\n-1",
+		"if (x) { 1 } else { 2 };\n[1, 2, 3]",
+		"let f = fn() { if (x) { 1 }; -1 }",
+		"if (x) { 1 };\n// note\n(a + b) * c",
+		"if (x) { 1 }\nif (y) { 2 }\nlet z = 3",
+	}
+
+	for _, input := range inputs {
+		once, err := Source(input)
+		if err != nil {
+			t.Fatalf("Source(%q) failed: %s", input, err)
+		}
+		program := parser.New(lexer.New(once)).ParseProgram()
+		original := parser.New(lexer.New(input)).ParseProgram()
+		if program.String() != original.String() {
+			t.Errorf("formatting %q changed the program.\nexpected=%q\ngot=%q", input, original.String(), program.String())
+		}
+		if twice, _ := Source(once); twice != once {
+			t.Errorf("formatting %q is not stable.\nonce=%q\ntwice=%q", input, once, twice)
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source("let = 5")
+	if _, ok := err.(*ParseError); !ok {
+		t.Fatalf("expected a *ParseError, got=%T (%v)", err, err)
+	}
+}
+
+// The prelude is real code, formatting it twice has to give the same result
+func TestPreludeIsStable(t *testing.T) {
+	paths, _ := filepath.Glob("../evaluator/prelude/*.monkey")
+	if len(paths) == 0 {
+		t.Fatal("no prelude files found")
+	}
+
+	for _, path := range paths {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		once, err := Source(string(source))
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		if twice, _ := Source(once); twice != once {
+			t.Errorf("%s: formatting is not stable.\nonce=%q\ntwice=%q", path, once, twice)
+		}
+	}
+}
@@ -0,0 +1,544 @@
+// Translates a compiled program into the source of a Go program, an
+// experimental backend for scripts which run long enough that the VM's
+// dispatch shows. Every function becomes a Go function in which the slots
+// of the operand stack and the locals are Go variables and the jumps are
+// gotos, so go build turns it into machine code. The values are the ones
+// of the object package, the Go program is built inside this module
+package gogen
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The operations the translated instructions call, see support.go
+//
+//go:embed support/support.go
+var supportSource string
+
+// How to translate, the zero value works
+type Options struct {
+	// The path errors start with, like monkey run prints them. "script"
+	// when empty
+	Name string
+}
+
+// The operation of the support file for the arithmetic and comparison
+// opcodes, the fused ones use the one code.FusedOperation gives
+var operations = map[code.Opcode]string{
+	code.OpAdd:         "add",
+	code.OpSub:         "sub",
+	code.OpMul:         "mul",
+	code.OpDiv:         "div",
+	code.OpEqual:       "equal",
+	code.OpNotEqual:    "notEqual",
+	code.OpGreaterThan: "greater",
+	code.OpLessThan:    "less",
+	code.OpRange:       "span",
+}
+
+// Writes a Go program with a main which runs b like monkey run runs it
+// on the VM: the same output, the same errors and exit codes. What it
+// doesn't have are the VM's limits, a program runs until it's done. b has
+// to pass compiler.Verify, its builtins are the ones of
+// object.DefaultBuiltins
+func Translate(b *compiler.Bytecode, opts Options) ([]byte, error) {
+	if err := compiler.Verify(b); err != nil {
+		return nil, err
+	}
+	name := opts.Name
+	if name == "" {
+		name = "script"
+	}
+
+	t := &translator{bytecode: b, numGlobals: len(b.Globals)}
+	main := &object.CompiledFunction{Instructions: b.Instructions, NumLocals: b.NumLocals, Lines: b.Lines}
+	if err := t.function(main, -1); err != nil {
+		return nil, err
+	}
+	for i, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			if err := t.function(fn, i); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	imports, support, err := splitSupport()
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by monkey translate from %s. DO NOT EDIT.\n\n", name)
+	out.WriteString("package main\n\nimport (\n")
+	for _, path := range imports {
+		fmt.Fprintf(&out, "%s\n", path)
+	}
+	out.WriteString(")\n\n")
+
+	out.WriteString("func main() {\n")
+	for i, global := range b.Globals {
+		if global == "ARGV" {
+			out.WriteString("argv := []object.Object{}\n")
+			out.WriteString("for _, arg := range os.Args[1:] {\nargv = append(argv, &object.String{Value: arg})\n}\n")
+			fmt.Fprintf(&out, "globals[%d] = &object.Array{Elements: argv}\n", i)
+		}
+	}
+	out.WriteString("if _, err := program(nil, nil); err != nil {\n")
+	fmt.Fprintf(&out, "os.Exit(report(%s, err))\n}\n}\n\n", strconv.Quote(name))
+
+	fmt.Fprintf(&out, "var globals [%d]object.Object\n\n", t.numGlobals)
+	if err := t.constants(&out); err != nil {
+		return nil, err
+	}
+	if len(b.Builtins) > 0 {
+		out.WriteString("var (\n")
+		for i, builtin := range b.Builtins {
+			fmt.Fprintf(&out, "b%d = builtin(%s)\n", i, strconv.Quote(builtin))
+		}
+		out.WriteString(")\n\n")
+	}
+	if t.numCaches > 0 {
+		out.WriteString("var (\n")
+		for i := 0; i < t.numCaches; i++ {
+			fmt.Fprintf(&out, "icache%d inlineCache\n", i)
+		}
+		out.WriteString(")\n\n")
+	}
+
+	out.Write(t.functions.Bytes())
+	out.WriteString(support)
+
+	source, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("the translation isn't valid Go: %s", err)
+	}
+	return source, nil
+}
+
+// The import specs of the support file with os added, and what comes
+// after them
+func splitSupport() ([]string, string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "support.go", supportSource, parser.ImportsOnly)
+	if err != nil {
+		return nil, "", err
+	}
+
+	imports := []string{`"os"`}
+	for _, spec := range file.Imports {
+		if spec.Path.Value != `"os"` {
+			imports = append(imports, spec.Path.Value)
+		}
+	}
+	sort.Strings(imports)
+
+	end := fset.Position(file.Decls[len(file.Decls)-1].End()).Offset
+	return imports, supportSource[end:], nil
+}
+
+type translator struct {
+	bytecode *compiler.Bytecode
+	// The size of the array of globals, the names of the bytecode and the
+	// ones just the instructions know about
+	numGlobals int
+	numCaches  int
+	functions  bytes.Buffer
+}
+
+// The constants are c followed by their index, the functions f for what
+// a closure of them is reported as and fn for their code
+func (t *translator) constants(out *bytes.Buffer) error {
+	if len(t.bytecode.Constants) == 0 {
+		return nil
+	}
+	out.WriteString("var (\n")
+	for i, c := range t.bytecode.Constants {
+		switch c := c.(type) {
+		case *object.Integer:
+			fmt.Fprintf(out, "c%d = object.NewInteger(%d)\n", i, c.Value)
+		case *object.String:
+			fmt.Fprintf(out, "c%d = &object.String{Value: %s}\n", i, strconv.Quote(c.Value))
+		case *object.CompiledFunction:
+			fmt.Fprintf(out, "f%d = &object.CompiledFunction{Name: %s, NumParameters: %d}\n",
+				i, strconv.Quote(c.Name), c.NumParameters)
+		default:
+			return fmt.Errorf("can't translate constant %d, a %s", i, c.Type())
+		}
+	}
+	out.WriteString(")\n\n")
+	return nil
+}
+
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	pos      int
+	next     int
+}
+
+// The translation of one function, the main program has index -1
+type function struct {
+	t     *translator
+	fn    *object.CompiledFunction
+	index int
+	// What the trace of an error calls it, like the VM's
+	name string
+
+	list   []*instruction
+	depths map[int]int
+	// The instructions a reachable one jumps to
+	targets map[int]bool
+	// The locals a closure captures, they're kept in cells
+	captured map[int]bool
+	maxDepth int
+
+	body bytes.Buffer
+	// Whether the body needs err and done
+	usesErr  bool
+	usesDone bool
+}
+
+func (t *translator) function(fn *object.CompiledFunction, index int) error {
+	f := &function{t: t, fn: fn, index: index, name: "<main>", captured: map[int]bool{}, targets: map[int]bool{}}
+	if index >= 0 {
+		f.name = "<anonymous>"
+		if fn.Name != "" {
+			f.name = fn.Name
+		}
+	}
+
+	f.decode()
+	f.computeDepths()
+
+	terminated := false
+	for _, in := range f.list {
+		if _, reachable := f.depths[in.pos]; !reachable {
+			continue
+		}
+		if f.targets[in.pos] {
+			fmt.Fprintf(&f.body, "L%d:\n", in.pos)
+		}
+		if err := f.instruction(in); err != nil {
+			return err
+		}
+		terminated = in.op == code.OpJump || in.op == code.OpReturnValue || in.op == code.OpReturn
+	}
+	if f.targets[len(fn.Instructions)] {
+		fmt.Fprintf(&f.body, "L%d:\n", len(fn.Instructions))
+		terminated = false
+	}
+	// the verifier makes sure only the main program gets here
+	if !terminated {
+		f.body.WriteString("return object.NULL, nil\n")
+	}
+
+	f.write(&t.functions)
+	return nil
+}
+
+// The Go function of fn, program for the main program
+func goName(index int) string {
+	if index < 0 {
+		return "program"
+	}
+	return fmt.Sprintf("fn%d", index)
+}
+
+func (f *function) write(out *bytes.Buffer) {
+	fmt.Fprintf(out, "func %s(cl *closure, args []object.Object) (object.Object, error) {\n", goName(f.index))
+
+	vars := []string{}
+	for i := 0; i < f.fn.NumLocals; i++ {
+		vars = append(vars, local(i))
+	}
+	for i := 0; i < f.maxDepth; i++ {
+		vars = append(vars, slot(i))
+	}
+	if len(vars) > 0 {
+		fmt.Fprintf(out, "var %s object.Object\n", strings.Join(vars, ", "))
+		// a value which is only ever popped is still used
+		fmt.Fprintf(out, "%s = %s\n", strings.Repeat("_, ", len(vars)-1)+"_", strings.Join(vars, ", "))
+	}
+	if f.usesErr {
+		out.WriteString("var err error\n")
+	}
+	if f.usesDone {
+		out.WriteString("var done bool\n")
+	}
+	for i := 0; i < f.fn.NumParameters; i++ {
+		fmt.Fprintf(out, "%s = args[%d]\n", local(i), i)
+	}
+
+	out.Write(f.body.Bytes())
+	out.WriteString("}\n\n")
+}
+
+func local(i int) string { return fmt.Sprintf("l%d", i) }
+func slot(i int) string  { return fmt.Sprintf("s%d", i) }
+
+func (f *function) decode() {
+	ins := f.fn.Instructions
+	for i := 0; i < len(ins); {
+		// Verify decoded the instructions already
+		_, operands, width, _ := code.ReadInstruction(ins, i)
+		op := code.Opcode(ins[i])
+		if op == code.OpCaptureLocal {
+			f.captured[operands[0]] = true
+		}
+		f.list = append(f.list, &instruction{op: op, operands: operands, pos: i, next: i + width})
+		i += width
+	}
+}
+
+// How many values are on the stack before every reachable instruction,
+// Verify made sure it's the same on every path
+func (f *function) computeDepths() {
+	byPos := map[int]*instruction{}
+	for _, in := range f.list {
+		byPos[in.pos] = in
+	}
+
+	f.depths = map[int]int{}
+	if len(f.list) == 0 {
+		return
+	}
+	work := []int{0}
+	f.depths[0] = 0
+
+	visit := func(pos, depth int) {
+		if _, known := f.depths[pos]; known || pos == len(f.fn.Instructions) {
+			return
+		}
+		f.depths[pos] = depth
+		work = append(work, pos)
+	}
+
+	for len(work) > 0 {
+		in := byPos[work[len(work)-1]]
+		work = work[:len(work)-1]
+		depth := f.depths[in.pos]
+
+		pops, pushes := code.StackEffect(in.op, in.operands)
+		after := depth - pops + pushes
+		f.maxDepth = max(f.maxDepth, after)
+		// a label only jumped to from code no path reaches would be unused
+		for j, kind := range code.OperandKinds(in.op) {
+			if kind == code.JumpOperand {
+				f.targets[in.operands[j]] = true
+			}
+		}
+
+		switch in.op {
+		case code.OpJump:
+			visit(in.operands[0], after)
+		case code.OpJumpNotTruthy, code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+			code.OpGreaterThanJumpNotTruthy, code.OpLessThanJumpNotTruthy:
+			visit(in.operands[0], after)
+			visit(in.next, after)
+		case code.OpJumpNotNull:
+			// the value stays when it jumps
+			visit(in.operands[0], depth)
+			visit(in.next, after)
+		case code.OpIterNext:
+			// the iterator is popped when it's done
+			visit(in.operands[1], depth-1)
+			visit(in.next, after)
+		case code.OpReturnValue, code.OpReturn:
+		default:
+			visit(in.next, after)
+		}
+	}
+}
+
+func (f *function) printf(format string, a ...interface{}) {
+	fmt.Fprintf(&f.body, format, a...)
+	f.body.WriteByte('\n')
+}
+
+// Returns the error of the instruction at pos, if there is one
+func (f *function) check(pos int) {
+	f.usesErr = true
+	f.failIf("err != nil", "err", pos)
+}
+
+func (f *function) failIf(condition, err string, pos int) {
+	p := f.fn.Lines.Position(pos)
+	f.printf("if %s {\nreturn nil, fail(%s, %s, %d, %d)\n}", condition, err, strconv.Quote(f.name), p.Line, p.Column)
+}
+
+func (f *function) getLocal(i int) string {
+	if f.captured[i] {
+		return fmt.Sprintf("getCell(%s)", local(i))
+	}
+	return fmt.Sprintf("orNull(%s)", local(i))
+}
+
+// The slots from start to the top of the stack, for the arguments of a
+// call or the elements of an array
+func slots(start, end int) string {
+	names := []string{}
+	for i := start; i < end; i++ {
+		names = append(names, slot(i))
+	}
+	return strings.Join(names, ", ")
+}
+
+func (f *function) cache() string {
+	f.t.numCaches++
+	return fmt.Sprintf("&icache%d", f.t.numCaches-1)
+}
+
+func (f *function) instruction(in *instruction) error {
+	d := f.depths[in.pos]
+	top := slot(d - 1)
+	operands := in.operands
+
+	switch in.op {
+	case code.OpConstant:
+		f.printf("%s = c%d", slot(d), operands[0])
+
+	case code.OpPop:
+		// the value is left in its slot
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpRange:
+		f.printf("%s, err = %s(%s, %s)", slot(d-2), operations[in.op], slot(d-2), slot(d-1))
+		f.check(in.pos)
+
+	case code.OpTrue:
+		f.printf("%s = object.TRUE", slot(d))
+	case code.OpFalse:
+		f.printf("%s = object.FALSE", slot(d))
+	case code.OpNull:
+		f.printf("%s = object.NULL", slot(d))
+
+	case code.OpMinus:
+		f.printf("%s, err = minus(%s)", top, top)
+		f.check(in.pos)
+	case code.OpBang:
+		f.printf("%s = bang(%s)", top, top)
+
+	case code.OpGetGlobal:
+		f.t.numGlobals = max(f.t.numGlobals, operands[0]+1)
+		f.printf("%s = globals[%d]", slot(d), operands[0])
+		f.failIf(slot(d)+" == nil", fmt.Sprintf("undefined(%s)", strconv.Quote(f.globalName(operands[0]))), in.pos)
+	case code.OpSetGlobal:
+		f.t.numGlobals = max(f.t.numGlobals, operands[0]+1)
+		f.printf("globals[%d] = %s", operands[0], top)
+
+	case code.OpJump:
+		f.printf("goto L%d", operands[0])
+	case code.OpJumpNotTruthy:
+		f.printf("if !truthy(%s) {\ngoto L%d\n}", top, operands[0])
+	case code.OpJumpNotNull:
+		f.printf("if %s != object.NULL {\ngoto L%d\n}", top, operands[0])
+
+	case code.OpGetLocal:
+		f.printf("%s = %s", slot(d), f.getLocal(operands[0]))
+	case code.OpSetLocal:
+		if f.captured[operands[0]] {
+			f.printf("setCell(&%s, %s)", local(operands[0]), top)
+		} else {
+			f.printf("%s = %s", local(operands[0]), top)
+		}
+	case code.OpClearLocals:
+		for i := operands[0]; i < operands[0]+operands[1]; i++ {
+			f.printf("%s = nil", local(i))
+		}
+
+	case code.OpIter:
+		f.printf("%s, err = iterate(%s)", top, top)
+		f.check(in.pos)
+	case code.OpIterNext:
+		key := "_"
+		value := slot(d)
+		if operands[0] == 2 {
+			key, value = slot(d), slot(d+1)
+		}
+		f.usesDone = true
+		f.printf("%s, %s, done, err = next(%s, %d)", key, value, top, operands[0])
+		f.check(in.pos)
+		f.printf("if done {\ngoto L%d\n}", operands[1])
+
+	case code.OpCall:
+		callee := d - 1 - operands[0]
+		f.printf("%s, err = call(%s)", slot(callee), slots(callee, d))
+		f.check(in.pos)
+	case code.OpReturnValue:
+		f.printf("return %s, nil", top)
+	case code.OpReturn:
+		f.printf("return object.NULL, nil")
+
+	case code.OpClosure:
+		start := d - operands[1]
+		f.printf("%s = &closure{Closure: &object.Closure{Fn: f%d, Free: []object.Object{%s}}, run: %s}",
+			slot(start), operands[0], slots(start, d), goName(operands[0]))
+	case code.OpGetFree:
+		f.printf("%s = getFree(cl, %d)", slot(d), operands[0])
+	case code.OpSetFree:
+		f.printf("setFree(cl, %d, %s)", operands[0], top)
+	case code.OpCaptureLocal:
+		f.printf("%s = capture(&%s)", slot(d), local(operands[0]))
+	case code.OpCaptureFree:
+		f.printf("%s = cl.Free[%d]", slot(d), operands[0])
+
+	case code.OpGetBuiltin:
+		f.printf("%s = b%d", slot(d), operands[0])
+		f.failIf(slot(d)+" == nil", fmt.Sprintf("undefined(%s)", strconv.Quote(f.t.bytecode.Builtins[operands[0]])), in.pos)
+
+	case code.OpArray:
+		start := d - operands[0]
+		f.printf("%s = &object.Array{Elements: []object.Object{%s}}", slot(start), slots(start, d))
+	case code.OpHash:
+		start := d - operands[0]
+		f.printf("%s, err = hash(%s)", slot(start), slots(start, d))
+		f.check(in.pos)
+	case code.OpTemplate:
+		start := d - operands[0]
+		f.printf("%s = template(%s)", slot(start), slots(start, d))
+	case code.OpIndex:
+		f.printf("%s, err = index(%s, %s, %s)", slot(d-2), slot(d-2), slot(d-1), f.cache())
+		f.check(in.pos)
+	case code.OpMember:
+		f.printf("%s, err = member(%s, c%d, %t, %s)", top, top, operands[0], operands[1] == 1, f.cache())
+		f.check(in.pos)
+
+	case code.OpGetLocalConstantAdd, code.OpGetLocalConstantSub:
+		operation, _ := code.FusedOperation(in.op)
+		f.printf("%s, err = %s(%s, c%d)", slot(d), operations[operation], f.getLocal(operands[0]), operands[1])
+		f.check(in.pos)
+	case code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+		code.OpGreaterThanJumpNotTruthy, code.OpLessThanJumpNotTruthy:
+		operation, _ := code.FusedOperation(in.op)
+		f.printf("%s, err = %s(%s, %s)", slot(d-2), operations[operation], slot(d-2), slot(d-1))
+		f.check(in.pos)
+		f.printf("if %s != object.TRUE {\ngoto L%d\n}", slot(d-2), operands[0])
+
+	default:
+		def, err := code.Lookup(byte(in.op))
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("can't translate %s yet", def.Name)
+	}
+	return nil
+}
+
+func (f *function) globalName(index int) string {
+	if index < len(f.t.bytecode.Globals) {
+		return f.t.bytecode.Globals[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
@@ -0,0 +1,197 @@
+package gogen
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/lexer"
+	monkeyparser "monkey/parser"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, input string, optimize bool) *compiler.Bytecode {
+	t.Helper()
+	p := monkeyparser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	comp := compiler.NewWithOptions(compiler.Options{Optimize: optimize, Globals: []string{"ARGV"}})
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		input    string
+		optimize bool
+		expected []string
+	}{
+		{
+			"let a = 1; puts(a + 2)",
+			false,
+			[]string{
+				"// Code generated by monkey translate from test.monkey. DO NOT EDIT.",
+				"var globals [1]object.Object",
+				"b0 = builtin(\"puts\")",
+				"s1, err = add(s1, s2)",
+				`return nil, fail(err, "<main>", 1, 19)`,
+			},
+		},
+		{
+			"let f = fn(n) { if (n > 1) { n } else { 0 } }; f(2)",
+			true,
+			[]string{
+				`f2 = &object.CompiledFunction{Name: "f", NumParameters: 1}`,
+				"func fn2(cl *closure, args []object.Object) (object.Object, error) {",
+				"l0 = args[0]",
+				"s0, err = greater(s0, s1)",
+				"if s0 != object.TRUE {",
+			},
+		},
+		{
+			"let g = fn() { let x = 0; fn() { x = x + 1 } }",
+			false,
+			[]string{"s0 = capture(&l0)", "setFree(cl, 0, s0)", "Free: []object.Object{s0}}, run: fn"},
+		},
+		{
+			`let h = {"a": 1}; for (k, v in h) { puts(k, h.a) }`,
+			false,
+			[]string{"s1, s2, done, err = next(s0, 2)", "c0, false, &icache0)", "goto L"},
+		},
+		{
+			"puts(ARGV)",
+			false,
+			[]string{"os.Args[1:]", "globals[0] = &object.Array{Elements: argv}"},
+		},
+	}
+
+	for _, tt := range tests {
+		source, err := Translate(compile(t, tt.input, tt.optimize), Options{Name: "test.monkey"})
+		if err != nil {
+			t.Fatalf("%q: Translate returned an error: %s", tt.input, err)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), "main.go", source, 0); err != nil {
+			t.Errorf("%q: the translation doesn't parse: %s", tt.input, err)
+		}
+		for _, expected := range tt.expected {
+			if !strings.Contains(string(source), expected) {
+				t.Errorf("%q: expected the translation to contain %q, got:\n%s", tt.input, expected, source)
+			}
+		}
+	}
+}
+
+func TestTranslateInvalid(t *testing.T) {
+	bytecode := &compiler.Bytecode{Instructions: code.Make(code.OpPop)}
+	if _, err := Translate(bytecode, Options{}); err == nil || !strings.Contains(err.Error(), "invalid bytecode") {
+		t.Errorf("expected bytecode which doesn't verify to be refused, got=%v", err)
+	}
+}
+
+// Builds the translations with the Go toolchain and runs them, which takes
+// a few seconds
+func TestTranslatedPrograms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("needs the go command")
+	}
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input  string
+		args   []string
+		stdout string
+		stderr string
+		code   int
+	}{
+		{`puts(1 + 2 * 3, "a" + "b", 7 / 2, -(1 - 3), !true, 1 < 2, "x" == "x", [1] == [1])`, nil,
+			"7\nab\n3\n2\nfalse\ntrue\ntrue\ntrue\n", "", 0},
+		{"let fib = fn(n) { if (n < 2) { return n } fib(n - 1) + fib(n - 2) }; puts(fib(20))", nil, "6765\n", "", 0},
+		{"let counter = fn() { let n = 0; fn() { n = n + 1; n } }; let c = counter(); c(); puts(c())", nil, "2\n", "", 0},
+		{"let fs = []; for (i in 0..3) { fs = push(fs, fn() { i }) }; for (f in fs) { puts(f()) }", nil, "0\n1\n2\n", "", 0},
+		{`let h = {"b": 2, "a": {"c": 1}}; for (k, v in h) { puts("${k}=${v}") }; for (k in h) { puts(k) }`, nil,
+			"a={c: 1}\nb=2\na\nb\n", "", 0},
+		{`let h = {"a": {"c": 1}}; puts(h.a.c, h["b"], h.b?.c, h.b ?? 5, [1, 2][5], "${[1]}!")`, nil,
+			"1\nnull\nnull\n5\nnull\n[1]!\n", "", 0},
+		{"let s = 0; for (i in 0..100) { if (i > 90) { s = s + i } }; puts(s)", nil, "855\n", "", 0},
+		{"puts(ARGV, len(ARGV))", []string{"a", "b"}, "[a, b]\n2\n", "", 0},
+		{"puts(1); exit(3); puts(2)", nil, "1\n", "", 3},
+		{"let f = fn(x) { x + true };\nlet g = fn() { f(1) };\ng()", nil, "",
+			"test.monkey:1:19: type mismatch: INTEGER + BOOLEAN\n" +
+				"  at f (test.monkey:1:19)\n" +
+				"  at g (test.monkey:2:17)\n" +
+				"  at <main> (test.monkey:3:2)\n", 1},
+		{`puts(len(1))`, nil, "", "test.monkey:1:9: argument to `len` not supported, got INTEGER\n", 1},
+		{"fn(x) { x }(1, 2)", nil, "", "test.monkey:1:12: wrong number of arguments: want=1, got=2\n", 1},
+		// the trace has every call like the VM's
+		{"let f = fn(n) { f(n + 1) }; f(0)", nil, "", "test.monkey:1:18: call depth exceeded: more than 1023 nested calls\n  at f", 1},
+		{`for (x in 5) { x }`, nil, "", "test.monkey:1:1: cannot iterate over INTEGER\n", 1},
+	}
+
+	dir := t.TempDir()
+	mod := fmt.Sprintf("module translated\n\ngo 1.23\n\nrequire monkey v0.0.0\n\nreplace monkey => %s\n", root)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		for _, optimize := range []bool{false, true} {
+			source, err := Translate(compile(t, tt.input, optimize), Options{Name: "test.monkey"})
+			if err != nil {
+				t.Fatalf("%q: Translate returned an error: %s", tt.input, err)
+			}
+			pkg := filepath.Join(dir, fmt.Sprintf("p%d_%t", i, optimize))
+			if err := os.Mkdir(pkg, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(pkg, "main.go"), source, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// one go build for all of them
+	build := exec.Command(goTool, "build", "-o", filepath.Join(dir, "bin")+string(filepath.Separator), "./...")
+	build.Dir = dir
+	build.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=-mod=mod")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("go build failed: %s\n%s", err, out)
+	}
+
+	for i, tt := range tests {
+		for _, optimize := range []bool{false, true} {
+			var stdout, stderr strings.Builder
+			run := exec.Command(filepath.Join(dir, "bin", fmt.Sprintf("p%d_%t", i, optimize)), tt.args...)
+			run.Stdout = &stdout
+			run.Stderr = &stderr
+			code := 0
+			if err := run.Run(); err != nil {
+				exit, ok := err.(*exec.ExitError)
+				if !ok {
+					t.Fatal(err)
+				}
+				code = exit.ExitCode()
+			}
+
+			if stdout.String() != tt.stdout || !strings.HasPrefix(stderr.String(), tt.stderr) ||
+				(tt.stderr == "" && stderr.Len() > 0) || code != tt.code {
+				t.Errorf("%q (optimized %t): expected %q, %q and exit %d, got=%q, %q and %d",
+					tt.input, optimize, tt.stdout, tt.stderr, tt.code, stdout.String(), stderr.String(), code)
+			}
+		}
+	}
+}
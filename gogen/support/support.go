@@ -0,0 +1,447 @@
+// What every Go program gogen.Translate writes starts with: the
+// operations of the instructions, with the same results and errors as
+// the VM's. Translate copies the file into the program after its own
+// package clause and imports, so the imports are the program's and the
+// generated names can't be used here: main, program, globals and c, f,
+// b, fn or icache followed by a number
+package support
+
+import (
+	"fmt"
+	"monkey/object"
+	"monkey/token"
+	"os"
+	"strings"
+)
+
+// Like vm.MaxFrames, the main program is the first frame
+const maxCalls = 1023
+
+// How many calls of the program's functions are running
+var depth int
+
+// A function of the program with the cells of the variables it captures,
+// run is the Go function Translate wrote for it
+type closure struct {
+	*object.Closure
+	run func(cl *closure, args []object.Object) (object.Object, error)
+}
+
+func call(fn object.Object, args ...object.Object) (object.Object, error) {
+	switch fn := fn.(type) {
+	case *closure:
+		if len(args) != fn.Fn.NumParameters {
+			return nil, fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.Fn.NumParameters, len(args))
+		}
+		if depth >= maxCalls {
+			return nil, fmt.Errorf("call depth exceeded: more than %d nested calls", maxCalls)
+		}
+		depth++
+		result, err := fn.run(fn, args)
+		depth--
+		return result, err
+	case *object.Builtin:
+		result := fn.Fn(args...)
+		if err, ok := result.(*object.Error); ok {
+			return nil, err
+		}
+		return orNull(result), nil
+	default:
+		return nil, fmt.Errorf("not a function: %s", fn.Type())
+	}
+}
+
+// The builtin of the name, nil when there is none so using it is an error
+// like in the VM
+func builtin(name string) object.Object {
+	if b, ok := object.DefaultBuiltins.Lookup(name); ok {
+		return b
+	}
+	return nil
+}
+
+func undefined(name string) error {
+	return fmt.Errorf("identifier not found: %s", name)
+}
+
+// The error of the instruction at line:column of function. Every function
+// the error returns through adds itself to the trace, like the VM's frames
+// do, and the position of a builtin's error is the one of its call
+func fail(err error, function string, line, column int) error {
+	e, ok := err.(*object.Error)
+	if !ok {
+		e = &object.Error{Message: err.Error()}
+	}
+	if e.Exit {
+		return e
+	}
+
+	pos := token.Position{Line: line, Column: column}
+	e.Trace = append(e.Trace, object.TraceEntry{Function: function, Pos: pos})
+	if !e.Pos.IsValid() {
+		e.Pos = pos
+	}
+	return e
+}
+
+// Prints the error like monkey run does and gives the exit code
+func report(path string, err error) int {
+	e, ok := err.(*object.Error)
+	if !ok {
+		e = &object.Error{Message: err.Error()}
+	}
+	if e.Exit {
+		return e.Code
+	}
+
+	if e.Pos.IsValid() {
+		fmt.Fprintf(os.Stderr, "%s:%s: %s\n", path, e.Pos, e.Message)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, e.Message)
+	}
+	for i := 0; len(e.Trace) >= 2 && i < len(e.Trace); {
+		call := e.Trace[i]
+		fmt.Fprintf(os.Stderr, "  at %s (%s:%s)\n", call.Function, path, call.Pos)
+
+		repeats := 0
+		for i++; i < len(e.Trace) && e.Trace[i] == call; i++ {
+			repeats++
+		}
+		if repeats > 0 {
+			fmt.Fprintf(os.Stderr, "  ... %d more\n", repeats)
+		}
+	}
+	return 1
+}
+
+// The value of a variable which is read before it's set is null
+func orNull(obj object.Object) object.Object {
+	if obj == nil {
+		return object.NULL
+	}
+	return obj
+}
+
+// A local a closure captured is kept in a cell
+func getCell(slot object.Object) object.Object {
+	if cell, ok := slot.(*object.Cell); ok {
+		return orNull(cell.Value)
+	}
+	return orNull(slot)
+}
+
+func setCell(slot *object.Object, value object.Object) {
+	if cell, ok := (*slot).(*object.Cell); ok {
+		cell.Value = value
+	} else {
+		*slot = value
+	}
+}
+
+// The cell of a local for a closure, the first closure which captures it
+// makes one
+func capture(slot *object.Object) object.Object {
+	cell, ok := (*slot).(*object.Cell)
+	if !ok {
+		cell = &object.Cell{Value: *slot}
+		*slot = cell
+	}
+	return cell
+}
+
+func getFree(cl *closure, index int) object.Object {
+	return orNull(cl.Free[index].(*object.Cell).Value)
+}
+
+func setFree(cl *closure, index int, value object.Object) {
+	cl.Free[index].(*object.Cell).Value = value
+}
+
+func boolean(value bool) object.Object {
+	if value {
+		return object.TRUE
+	}
+	return object.FALSE
+}
+
+// Only false and null are falsy
+func truthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func bang(obj object.Object) object.Object {
+	return boolean(!truthy(obj))
+}
+
+func minus(obj object.Object) (object.Object, error) {
+	integer, ok := obj.(*object.Integer)
+	if !ok {
+		return nil, fmt.Errorf("unknown operator: -%s", obj.Type())
+	}
+	return object.NewInteger(-integer.Value), nil
+}
+
+// The operators on two integers are checked first, everything else goes
+// through binary
+
+func add(left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return object.NewInteger(l.Value + r.Value), nil
+		}
+	}
+	return binary("+", left, right)
+}
+
+func sub(left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return object.NewInteger(l.Value - r.Value), nil
+		}
+	}
+	return binary("-", left, right)
+}
+
+func mul(left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return object.NewInteger(l.Value * r.Value), nil
+		}
+	}
+	return binary("*", left, right)
+}
+
+// binary checks for the division by zero
+func div(left, right object.Object) (object.Object, error) {
+	return binary("/", left, right)
+}
+
+func equal(left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return boolean(l.Value == r.Value), nil
+		}
+	}
+	return binary("==", left, right)
+}
+
+func notEqual(left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return boolean(l.Value != r.Value), nil
+		}
+	}
+	return binary("!=", left, right)
+}
+
+func greater(left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return boolean(l.Value > r.Value), nil
+		}
+	}
+	return binary(">", left, right)
+}
+
+func less(left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return boolean(l.Value < r.Value), nil
+		}
+	}
+	return binary("<", left, right)
+}
+
+func span(left, right object.Object) (object.Object, error) {
+	return binary("..", left, right)
+}
+
+// Checks the types in the same order as the VM's binaryOperation
+func binary(operator string, left, right object.Object) (object.Object, error) {
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return integerOperation(operator, left.(*object.Integer).Value, right.(*object.Integer).Value)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		l, r := left.(*object.String).Value, right.(*object.String).Value
+		switch operator {
+		case "+":
+			return &object.String{Value: l + r}, nil
+		case "==":
+			return boolean(l == r), nil
+		case "!=":
+			return boolean(l != r), nil
+		}
+		return nil, fmt.Errorf("unknown operator: %s %s %s", leftType, operator, rightType)
+	case operator == "==":
+		return boolean(object.Equals(left, right)), nil
+	case operator == "!=":
+		return boolean(!object.Equals(left, right)), nil
+	case leftType != rightType:
+		return nil, fmt.Errorf("type mismatch: %s %s %s", leftType, operator, rightType)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", leftType, operator, rightType)
+	}
+}
+
+// Overflowing wraps around like in the VM
+func integerOperation(operator string, l, r int64) (object.Object, error) {
+	switch operator {
+	case "+":
+		return object.NewInteger(l + r), nil
+	case "-":
+		return object.NewInteger(l - r), nil
+	case "*":
+		return object.NewInteger(l * r), nil
+	case "/":
+		if r == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return object.NewInteger(l / r), nil
+	case "==":
+		return boolean(l == r), nil
+	case "!=":
+		return boolean(l != r), nil
+	case ">":
+		return boolean(l > r), nil
+	case "<":
+		return boolean(l < r), nil
+	case "..":
+		return &object.Range{Start: l, End: r}, nil
+	default:
+		return nil, fmt.Errorf("unknown integer operator: %s", operator)
+	}
+}
+
+// The keys and values in turns
+func hash(elements ...object.Object) (object.Object, error) {
+	h := &object.Hash{}
+	for i := 0; i < len(elements); i += 2 {
+		hashable, ok := elements[i].(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", elements[i].Type())
+		}
+		h = h.Set(hashable.HashKey(), object.HashPair{Key: elements[i], Value: elements[i+1]})
+	}
+	return h, nil
+}
+
+// The parts converted like str() does
+func template(parts ...object.Object) object.Object {
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(object.ToString(part))
+	}
+	return &object.String{Value: out.String()}
+}
+
+// Remembers the last key an index or member expression looked up and its
+// value in the last hash, like the VM's inline caches. Every one of them
+// in the program has its own
+type inlineCache struct {
+	key    object.Object
+	hashed object.HashedKey
+	hash   *object.Hash
+	value  object.Object
+}
+
+func (c *inlineCache) lookup(h *object.Hash, key object.Object) (object.Object, error) {
+	if key != c.key {
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		c.key = key
+		c.hashed = object.NewHashedKey(hashable.HashKey())
+		c.hash = nil
+	} else if h == c.hash {
+		return c.value, nil
+	}
+
+	pair, ok := h.GetHashed(c.hashed)
+	if !ok {
+		pair.Value = object.NULL
+	}
+	c.hash = h
+	c.value = pair.Value
+	return c.value, nil
+}
+
+// Out of bounds access and missing keys give null
+func index(left, index object.Object, cache *inlineCache) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			break
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return object.NULL, nil
+		}
+		return left.Elements[i.Value], nil
+	case *object.Hash:
+		return cache.lookup(left, index)
+	}
+	return nil, fmt.Errorf("index operator not supported: %s", left.Type())
+}
+
+// foo.bar of a hash is foo["bar"], foo?.bar is null when foo is
+func member(obj object.Object, name *object.String, optional bool, cache *inlineCache) (object.Object, error) {
+	if optional && obj == object.NULL {
+		return object.NULL, nil
+	}
+	h, ok := obj.(*object.Hash)
+	if !ok {
+		return nil, fmt.Errorf("member access not supported: %s.%s", obj.Type(), name.Value)
+	}
+	return cache.lookup(h, name)
+}
+
+// What a loop goes through, it's on the stack while the loop runs
+type iterator struct {
+	object.Iterator
+	// Looping over a hash with one variable gives its keys
+	hash bool
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func iterate(iterable object.Object) (object.Object, error) {
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return nil, fmt.Errorf("cannot iterate over %s", iterable.Type())
+	}
+	_, isHash := iterable.(*object.Hash)
+	return &iterator{Iterator: it.Iterator(), hash: isHash}, nil
+}
+
+// The next element, value is the loop's only variable when there's one
+// and the key the first one of two. done once there are no more
+func next(obj object.Object, variables int) (key, value object.Object, done bool, err error) {
+	it := obj.(*iterator)
+	key, value, ok := it.Next()
+	if !ok {
+		if stopper, ok := it.Iterator.(object.Stopper); ok {
+			stopper.Stop()
+		}
+		return nil, nil, true, nil
+	}
+	if err, ok := value.(*object.Error); ok {
+		return nil, nil, false, err
+	}
+
+	if variables != 2 && it.hash {
+		return nil, key, false, nil
+	}
+	return key, value, false, nil
+}
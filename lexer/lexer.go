@@ -1,22 +1,43 @@
 package lexer
 
-import "monkey/token"
+import (
+	"monkey/token"
+	"strings"
+)
 
 type Lexer struct {
 	input        string
 	position     int  // current position in input (Points EXACTLY to current char)
 	readPosition int  // to look one char ahead of current position
 	ch           byte // current char (where position points to)
+	start        int  // where the last token returned by NextToken begins
+	line         int  // line of the current char, starting at 1
+	lineStart    int  // position of the first char of that line
+	file         string
+
+	comments []token.Token
 }
 
 // Returns the Lexer (pointer) and calls readChar to initialize the correct positions
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
 
+// A Lexer whose positions are in file, see token.Position
+func NewFile(file, input string) *Lexer {
+	l := New(input)
+	l.file = file
+	return l
+}
+
 func (l *Lexer) readChar() {
+	// The char after a newline starts the next line
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPosition
+	}
 	// Check if we reached the end of input
 	// If yes ch is set to 0 which is the ASCII value for NUL
 	// That means we either didnt read anything yet or reach the end of the file
@@ -33,9 +54,18 @@ func (l *Lexer) readChar() {
 }
 
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
 	l.skipWhitespace()
+	l.start = l.position
+
+	pos := token.Position{Line: l.line, Column: l.position - l.lineStart + 1, File: l.file}
+	tok := l.readToken()
+	tok.Pos = pos
+	return tok
+}
+
+// Reads the token starting at the current char
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -55,6 +85,34 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.RANGE, Literal: ".."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
+	case '?':
+		switch l.peekChar() {
+		case '?':
+			l.readChar()
+			tok = token.Token{Type: token.NULLISH, Literal: "??"}
+		case '.':
+			l.readChar()
+			tok = token.Token{Type: token.OPTIONAL_DOT, Literal: "?."}
+		default:
+			tok = newToken(token.ILLEGAL, l.ch)
+		}
+	case '"':
+		literal, template := l.readString()
+		tok.Literal = literal
+		if template {
+			tok.Type = token.TEMPLATE
+		} else {
+			tok.Type = token.STRING
+		}
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
@@ -81,6 +139,10 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -95,6 +157,12 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
 			return tok
+		} else if l.ch == '$' && isDigit(l.peekChar()) {
+			// $1, $2, ... are the names the REPL binds its results to
+			l.readChar()
+			tok.Type = token.IDENT
+			tok.Literal = "$" + l.readNumber()
+			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
@@ -104,9 +172,36 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// Where the last token returned by NextToken begins and ends in the input,
+// e.g. for tools which show the source with colors
+func (l *Lexer) Span() (start, end int) {
+	return min(l.start, len(l.input)), min(l.position, len(l.input))
+}
+
+// The comments skipped so far in the order of the input, the Literal
+// includes the //
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
+}
+
+// Comments (// until the end of the line) are skipped like whitespace,
+// they are only remembered for Comments
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		l.readChar()
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			start := l.position
+			pos := token.Position{Line: l.line, Column: l.position - l.lineStart + 1, File: l.file}
+			for l.ch != '\n' && l.ch != 0 {
+				l.readChar()
+			}
+			literal := strings.TrimRight(l.input[start:min(l.position, len(l.input))], "\r")
+			l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: literal, Pos: pos})
+		default:
+			return
+		}
 	}
 }
 
@@ -125,6 +220,93 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
+// Reads everything between the opening and the closing " into the literal
+// Supports the escape sequences \n, \t, \", \$ and \\
+// An unterminated string simply ends at the end of the input
+// When the string contains ${...} the raw source is returned instead and
+// template is true, the parser takes care of the embedded expressions
+func (l *Lexer) readString() (literal string, template bool) {
+	start := l.position + 1
+
+	for {
+		l.readChar()
+		if l.ch == '"' || l.ch == 0 {
+			break
+		}
+
+		if l.ch == '\\' {
+			l.readChar()
+			if l.ch == 0 {
+				break
+			}
+			continue
+		}
+
+		if l.ch == '$' && l.peekChar() == '{' {
+			template = true
+			l.readChar()
+			l.skipInterpolation()
+		}
+	}
+
+	// position can be behind the input when the string is unterminated
+	end := min(l.position, len(l.input))
+	raw := l.input[min(start, end):end]
+	if template {
+		return raw, true
+	}
+
+	return Unescape(raw), false
+}
+
+// Moves from the { of ${ to the matching }, strings inside of the
+// embedded expression can contain braces and quotes themselves
+func (l *Lexer) skipInterpolation() {
+	depth := 1
+
+	for depth > 0 {
+		l.readChar()
+		switch l.ch {
+		case 0:
+			return
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '"':
+			l.readString()
+			if l.ch == 0 {
+				return
+			}
+		}
+	}
+}
+
+// Replaces the escape sequences inside of a raw string literal
+func Unescape(raw string) string {
+	var out []byte
+
+	for i := 0; i < len(raw); i++ {
+		ch := raw[i]
+		if ch != '\\' || i+1 == len(raw) {
+			out = append(out, ch)
+			continue
+		}
+
+		i++
+		switch raw[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 't':
+			out = append(out, '\t')
+		default:
+			out = append(out, raw[i])
+		}
+	}
+
+	return string(out)
+}
+
 func (l *Lexer) readNumber() string {
 	position := l.position
 
@@ -152,3 +334,45 @@ func (l *Lexer) peekChar() byte {
 		return l.input[l.readPosition]
 	}
 }
+
+// A piece of a template string, either text or the source of an embedded expression
+type TemplatePart struct {
+	Literal    string
+	Expression bool
+}
+
+// Splits the raw literal of a TEMPLATE token into text and expression parts
+// Escape sequences in the text parts are already replaced
+// ok is false if an embedded expression isn't closed with }
+func SplitTemplate(raw string) (parts []TemplatePart, ok bool) {
+	l := New(raw)
+	textStart := 0
+
+	for l.position < len(raw) {
+		switch {
+		case l.ch == '\\':
+			l.readChar()
+		case l.ch == '$' && l.peekChar() == '{':
+			if l.position > textStart {
+				parts = append(parts, TemplatePart{Literal: Unescape(raw[textStart:l.position])})
+			}
+
+			l.readChar()
+			expressionStart := l.position + 1
+			l.skipInterpolation()
+			if l.position >= len(raw) {
+				return parts, false
+			}
+
+			parts = append(parts, TemplatePart{Literal: raw[expressionStart:l.position], Expression: true})
+			textStart = l.position + 1
+		}
+		l.readChar()
+	}
+
+	if textStart < len(raw) {
+		parts = append(parts, TemplatePart{Literal: Unescape(raw[textStart:])})
+	}
+
+	return parts, true
+}
@@ -25,6 +25,17 @@ func TestNextToken(t *testing.T) {
 
     10 == 10;
     10 != 9;
+    "foobar"
+    "foo bar"
+    "say \"hi\"\n"
+    import("lib.monkey").add;
+    // a comment until the end of the line
+    [1, 2]; // another one
+    {"foo": "bar"}
+    a?.b ?? c;
+    for (x in 1..10) {}
+    "sum is ${a + b}"
+    "nested ${f("}")} \${no}"
     `
 
 	tests := []struct {
@@ -104,6 +115,45 @@ func TestNextToken(t *testing.T) {
 		{token.NOT_EQ, "!="},
 		{token.INT, "9"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.STRING, "say \"hi\"\n"},
+		{token.IMPORT, "import"},
+		{token.LPAREN, "("},
+		{token.STRING, "lib.monkey"},
+		{token.RPAREN, ")"},
+		{token.DOT, "."},
+		{token.IDENT, "add"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
+		{token.IDENT, "a"},
+		{token.OPTIONAL_DOT, "?."},
+		{token.IDENT, "b"},
+		{token.NULLISH, "??"},
+		{token.IDENT, "c"},
+		{token.SEMICOLON, ";"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.IN, "in"},
+		{token.INT, "1"},
+		{token.RANGE, ".."},
+		{token.INT, "10"},
+		{token.RPAREN, ")"},
+		{token.LBRACE, "{"},
+		{token.RBRACE, "}"},
+		{token.TEMPLATE, "sum is ${a + b}"},
+		{token.TEMPLATE, `nested ${f("}")} \${no}`},
 		{token.EOF, ""},
 	}
 
@@ -123,3 +173,114 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestSplitTemplate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []TemplatePart
+		ok       bool
+	}{
+		{"sum is ${a + b}", []TemplatePart{{"sum is ", false}, {"a + b", true}}, true},
+		{"${a}${b}", []TemplatePart{{"a", true}, {"b", true}}, true},
+		{`${h["}"]}!\n`, []TemplatePart{{`h["}"]`, true}, {"!\n", false}}, true},
+		{`\${a} ${ {1: 2}[1] }`, []TemplatePart{{"${a} ", false}, {" {1: 2}[1] ", true}}, true},
+		{"open ${a", []TemplatePart{{"open ", false}}, false},
+	}
+
+	for i, tt := range tests {
+		parts, ok := SplitTemplate(tt.input)
+		if ok != tt.ok {
+			t.Errorf("tests[%d] - ok wrong. expected=%t, got=%t", i, tt.ok, ok)
+		}
+
+		if len(parts) != len(tt.expected) {
+			t.Fatalf("tests[%d] - wrong number of parts. expected=%d, got=%d (%+v)",
+				i, len(tt.expected), len(parts), parts)
+		}
+
+		for j, part := range parts {
+			if part != tt.expected[j] {
+				t.Errorf("tests[%d] - part %d wrong. expected=%+v, got=%+v",
+					i, j, tt.expected[j], part)
+			}
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	input := `let x = "a\"b" // done
+x == 10;`
+	expected := []string{"let", "x", "=", `"a\"b"`, "x", "==", "10", ";", ""}
+
+	l := New(input)
+	for i, want := range expected {
+		l.NextToken()
+		start, end := l.Span()
+		if got := input[start:end]; got != want {
+			t.Errorf("tests[%d] - span wrong. expected=%q, got=%q", i, want, got)
+		}
+	}
+}
+
+func TestResultIdentifiers(t *testing.T) {
+	input := `$1 + $12; $x`
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "$1"},
+		{token.PLUS, "+"},
+		{token.IDENT, "$12"},
+		{token.SEMICOLON, ";"},
+		{token.ILLEGAL, "$"},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Errorf("tests[%d] - wrong token. expected=%q %q, got=%q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"a\nb\" // done\n}"
+	expected := []token.Position{
+		{Line: 1, Column: 1}, {Line: 1, Column: 5}, {Line: 1, Column: 7}, {Line: 1, Column: 9}, {Line: 1, Column: 10},
+		{Line: 2, Column: 3}, {Line: 2, Column: 5}, {Line: 2, Column: 7},
+		{Line: 4, Column: 1}, {Line: 4, Column: 2},
+	}
+
+	l := New(input)
+	for i, want := range expected {
+		if tok := l.NextToken(); tok.Pos != want {
+			t.Errorf("tests[%d] - position of %q wrong. expected=%s, got=%s", i, tok.Literal, want, tok.Pos)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := "// first\nlet x = 5; // second\r\n//\n"
+	expected := []token.Token{
+		{Type: token.COMMENT, Literal: "// first", Pos: token.Position{Line: 1, Column: 1}},
+		{Type: token.COMMENT, Literal: "// second", Pos: token.Position{Line: 2, Column: 12}},
+		{Type: token.COMMENT, Literal: "//", Pos: token.Position{Line: 3, Column: 1}},
+	}
+
+	l := New(input)
+	for l.NextToken().Type != token.EOF {
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expected), len(comments))
+	}
+	for i, want := range expected {
+		if comments[i] != want {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, want, comments[i])
+		}
+	}
+}
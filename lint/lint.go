@@ -0,0 +1,267 @@
+// Finds code which runs but most likely doesn't do what was meant, e.g. a
+// variable which is never used or an assignment where a comparison belongs
+//
+// The scopes are the ones of the resolver: every function and loop body
+// has its own, so an identifier it resolved (Depth, Index) tells which
+// binding it uses
+package lint
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// The checks, a Diagnostic says which one found it
+const (
+	UNUSED              = "unused"
+	SHADOW              = "shadow"
+	UNREACHABLE         = "unreachable"
+	ASSIGN_IN_CONDITION = "assign-in-condition"
+	COMPARE_COMPOSITE   = "compare-composite"
+	// Only found by Undefined
+	UNDEFINED = "undefined"
+)
+
+type Diagnostic struct {
+	Pos     token.Position
+	Rule    string
+	Message string
+}
+
+// 3:5: unused: x is declared but never used
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Pos, d.Rule, d.Message)
+}
+
+// Checks a program the parser resolved, the diagnostics are sorted by position
+func Check(program *ast.Program) []Diagnostic {
+	l := &linter{globals: map[string]*ast.Identifier{}, declarations: map[*ast.Identifier]bool{}}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			if _, ok := l.globals[let.Name.Value]; !ok {
+				l.globals[let.Name.Value] = let.Name
+			}
+		}
+	}
+
+	ast.Walk(l, program)
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i].Pos, l.diagnostics[j].Pos
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return l.diagnostics
+}
+
+type linter struct {
+	scopes []*scope
+	// The top level lets, they are never resolved
+	globals map[string]*ast.Identifier
+	// Identifiers which bind or assign a name, they don't use it
+	declarations map[*ast.Identifier]bool
+
+	diagnostics []Diagnostic
+}
+
+// One function or loop body, the slots are the Locals of the resolver
+type scope struct {
+	names []string
+	// Where the slot is bound first, nil if it's not known
+	declared []*ast.Identifier
+	// Parameters and loop variables don't need to be used, lets do
+	let  []bool
+	used []bool
+}
+
+func (l *linter) report(pos token.Position, rule, format string, args ...any) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Pos: pos, Rule: rule, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.Program:
+		l.unreachable(node.Statements)
+	case *ast.BlockStatement:
+		l.unreachable(node.Statements)
+	case *ast.FunctionLiteral:
+		l.enter(node.Locals, node.Parameters, node.Body)
+		ast.Walk(l, node.Body)
+		l.leave()
+		return nil
+	case *ast.ForStatement:
+		// the iterable is evaluated outside of the loop scope
+		ast.Walk(l, node.Iterable)
+		vars := []*ast.Identifier{node.Value}
+		if node.Key != nil {
+			vars = []*ast.Identifier{node.Key, node.Value}
+		}
+		l.enter(node.Locals, vars, node.Body)
+		ast.Walk(l, node.Body)
+		l.leave()
+		return nil
+	case *ast.LetStatement:
+		l.declarations[node.Name] = true
+	case *ast.AssignExpression:
+		l.declarations[node.Name] = true
+	case *ast.MemberExpression:
+		// the property is a name of the object, not a variable
+		ast.Walk(l, node.Object)
+		return nil
+	case *ast.Identifier:
+		if node.Resolved && !l.declarations[node] && node.Depth < len(l.scopes) {
+			s := l.scopes[len(l.scopes)-1-node.Depth]
+			if node.Index < len(s.used) {
+				s.used[node.Index] = true
+			}
+		}
+	case *ast.IfExpression:
+		if assign, ok := node.Condition.(*ast.AssignExpression); ok {
+			l.report(assign.Name.Pos(), ASSIGN_IN_CONDITION, "assignment to %s in a condition, did you mean ==?", assign.Name.Value)
+		}
+	case *ast.InfixExpression:
+		l.compareComposite(node)
+	}
+	return l
+}
+
+// Declares the variables and the lets of a new function or loop body
+func (l *linter) enter(locals []string, vars []*ast.Identifier, body *ast.BlockStatement) {
+	s := &scope{
+		names:    locals,
+		declared: make([]*ast.Identifier, len(locals)),
+		let:      make([]bool, len(locals)),
+		used:     make([]bool, len(locals)),
+	}
+	slots := map[string]int{}
+	for i, name := range locals {
+		slots[name] = i
+	}
+
+	declare := func(ident *ast.Identifier, let bool) {
+		index, ok := slots[ident.Value]
+		if !ok || s.declared[index] != nil {
+			return
+		}
+		s.declared[index] = ident
+		s.let[index] = let
+		l.shadow(ident)
+	}
+	for _, ident := range vars {
+		declare(ident, false)
+	}
+	for _, ident := range lets(body) {
+		declare(ident, true)
+	}
+
+	l.scopes = append(l.scopes, s)
+}
+
+func (l *linter) leave() {
+	s := l.scopes[len(l.scopes)-1]
+	l.scopes = l.scopes[:len(l.scopes)-1]
+
+	for i, name := range s.names {
+		if s.let[i] && !s.used[i] && !strings.HasPrefix(name, "_") {
+			l.report(s.declared[i].Pos(), UNUSED, "%s is declared but never used", name)
+		}
+	}
+}
+
+// The lets which bind in the scope of body, like the resolver hoists them
+func lets(body ast.Node) []*ast.Identifier {
+	idents := []*ast.Identifier{}
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral, *ast.ForStatement:
+			return false
+		case *ast.LetStatement:
+			idents = append(idents, node.Name)
+		}
+		return true
+	})
+	return idents
+}
+
+func (l *linter) shadow(ident *ast.Identifier) {
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		s := l.scopes[i]
+		for slot, name := range s.names {
+			if name == ident.Value && s.declared[slot] != nil {
+				l.report(ident.Pos(), SHADOW, "%s shadows the %s declared at %s", ident.Value, name, s.declared[slot].Pos())
+				return
+			}
+		}
+	}
+	if global, ok := l.globals[ident.Value]; ok {
+		l.report(ident.Pos(), SHADOW, "%s shadows the %s declared at %s", ident.Value, ident.Value, global.Pos())
+	}
+}
+
+// Only the first statement after a return is reported
+func (l *linter) unreachable(statements []ast.Statement) {
+	for i, stmt := range statements {
+		if _, ok := stmt.(*ast.ReturnStatement); ok && i+1 < len(statements) {
+			l.report(statements[i+1].Pos(), UNREACHABLE, "unreachable code after return")
+			return
+		}
+	}
+}
+
+// Functions are only equal to themselves and an empty literal is better
+// written as a check of the length
+func (l *linter) compareComposite(exp *ast.InfixExpression) {
+	if exp.Operator != "==" && exp.Operator != "!=" {
+		return
+	}
+
+	for _, operand := range []ast.Expression{exp.Left, exp.Right} {
+		switch operand := operand.(type) {
+		case *ast.FunctionLiteral:
+			l.report(exp.Pos(), COMPARE_COMPOSITE, "a new function is never equal to another value, %s is always %t", exp.Operator, exp.Operator == "!=")
+			return
+		case *ast.ArrayLiteral:
+			if len(operand.Elements) == 0 {
+				l.report(exp.Pos(), COMPARE_COMPOSITE, "comparison with [] builds a new array, use len(...) %s 0", exp.Operator)
+				return
+			}
+		case *ast.HashLiteral:
+			if len(operand.Pairs) == 0 {
+				l.report(exp.Pos(), COMPARE_COMPOSITE, "comparison with {} builds a new hash, use len(...) %s 0", exp.Operator)
+				return
+			}
+		}
+	}
+}
+
+// Reports the names which are bound nowhere, neither in the program nor
+// by defined (e.g. for the builtins and the prelude). The evaluator would
+// stop with "identifier not found" there
+func Undefined(program *ast.Program, defined func(name string) bool) []Diagnostic {
+	globals := map[string]bool{}
+	declarations := map[*ast.Identifier]bool{}
+	for _, ident := range lets(program) {
+		globals[ident.Value] = true
+		declarations[ident] = true
+	}
+
+	diagnostics := []Diagnostic{}
+	var inspect func(node ast.Node) bool
+	inspect = func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.MemberExpression:
+			ast.Inspect(node.Object, inspect)
+			return false
+		case *ast.Identifier:
+			if !node.Resolved && !declarations[node] && !globals[node.Value] && !defined(node.Value) {
+				diagnostics = append(diagnostics, Diagnostic{Pos: node.Pos(), Rule: UNDEFINED, Message: "undefined: " + node.Value})
+			}
+		}
+		return true
+	}
+	ast.Inspect(program, inspect)
+
+	return diagnostics
+}
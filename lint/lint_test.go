@@ -0,0 +1,91 @@
+package lint
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; puts(x)", nil},
+		// top level bindings can be used by importers and the REPL
+		{"let unused = 1", nil},
+		{"let f = fn() { let a = 1; let b = 2; b }", []string{"1:20: unused: a is declared but never used"}},
+		{"let f = fn() { let _a = 1; 2 }", nil},
+		{"let f = fn(a, b) { 1 }", nil},
+		{"let f = fn() { let a = 1; fn() { a } }", nil},
+		{"let f = fn() { let g = fn() { a }; let a = 1; g }", nil},
+		{"let f = fn() { let a = 1; a = 2 }", []string{"1:20: unused: a is declared but never used"}},
+		{"for (x in [1]) { let y = 2 }", []string{"1:22: unused: y is declared but never used"}},
+		{"let f = fn(x) { fn(x) { x } }", []string{"1:20: shadow: x shadows the x declared at 1:12"}},
+		{"let x = 1; let f = fn() { let x = 2; x }", []string{"1:31: shadow: x shadows the x declared at 1:5"}},
+		{"let f = fn(xs) { for (x in xs) { x } }", nil},
+		{"let f = fn() { return 1; puts(2); 3 }", []string{"1:26: unreachable: unreachable code after return"}},
+		{"if (x) { return 1 } else { 2 }", nil},
+		{"if (x = 1) { 2 }", []string{"1:5: assign-in-condition: assignment to x in a condition, did you mean ==?"}},
+		{"let f = fn() { 1 }; f != fn() { 1 }", []string{"1:23: compare-composite: a new function is never equal to another value, != is always true"}},
+		{"xs == []", []string{"1:4: compare-composite: comparison with [] builds a new array, use len(...) == 0"}},
+		{"h != {}", []string{"1:3: compare-composite: comparison with {} builds a new hash, use len(...) != 0"}},
+		{"xs == [1]", nil},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q: parser errors: %v", tt.input, p.Errors())
+		}
+
+		diagnostics := Check(program)
+		got := []string{}
+		for _, d := range diagnostics {
+			got = append(got, d.String())
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestUndefined(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1; puts(x)", nil},
+		{"let f = fn(a) { a + b }", []string{"1:21: undefined: b"}},
+		// top level lets count everywhere, even when they come later
+		{"let f = fn() { g() }; let g = fn() { 1 }", nil},
+		{"if (true) { let x = 1 }; x", nil},
+		{"lib.helper", []string{"1:1: undefined: lib"}},
+		{"y = 1", []string{"1:1: undefined: y"}},
+	}
+
+	defined := func(name string) bool { return name == "puts" }
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q: parser errors: %v", tt.input, p.Errors())
+		}
+
+		got := []string{}
+		for _, d := range Undefined(program, defined) {
+			got = append(got, d.Pos.String()+": "+d.Message)
+		}
+		if len(got) != len(tt.expected) || (len(got) > 0 && got[0] != tt.expected[0]) {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package object
+
+import "fmt"
+
+// The builtins every engine has, the evaluator and the VM look them up in
+// DefaultBuiltins
+func init() {
+	for name, builtin := range builtins {
+		DefaultBuiltins.Add(name, builtin)
+	}
+}
+
+var builtins = map[string]*Builtin{
+	"len": {
+		Usage: "len(x)",
+		Doc:   "The number of characters of a string, elements of an array or pairs of a hash",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				return NewInteger(int64(len(arg.Value)))
+			case *Array:
+				return NewInteger(int64(len(arg.Elements)))
+			case *Hash:
+				return NewInteger(int64(arg.Len()))
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"first": {
+		Usage: "first(array)",
+		Doc:   "The first element of the array, null when it's empty",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `first` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+
+			return NULL
+		},
+	},
+	"last": {
+		Usage: "last(array)",
+		Doc:   "The last element of the array, null when it's empty",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `last` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+
+			return NULL
+		},
+	},
+	"rest": {
+		Usage: "rest(array)",
+		Doc:   "A new array with everything but the first element, null when it's empty",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `rest` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &Array{Elements: newElements}
+			}
+
+			return NULL
+		},
+	},
+	"push": {
+		Usage: "push(array, value)",
+		Doc:   "A new array with value added to the end, the array itself stays as it is",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &Array{Elements: newElements}
+		},
+	},
+	"puts": {
+		Usage: "puts(values...)",
+		Doc:   "Prints every value on its own line and returns null",
+		Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+
+			return NULL
+		},
+	},
+	"keys": {
+		Usage: "keys(hash)",
+		Doc:   "The keys of the hash as an array",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+			}
+
+			hash := args[0].(*Hash)
+			keys := make([]Object, 0, hash.Len())
+			for _, pair := range hash.SortedPairs() {
+				keys = append(keys, pair.Key)
+			}
+
+			return &Array{Elements: keys}
+		},
+	},
+	"values": {
+		Usage: "values(hash)",
+		Doc:   "The values of the hash as an array",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `values` must be HASH, got %s", args[0].Type())
+			}
+
+			hash := args[0].(*Hash)
+			values := make([]Object, 0, hash.Len())
+			for _, pair := range hash.SortedPairs() {
+				values = append(values, pair.Value)
+			}
+
+			return &Array{Elements: values}
+		},
+	},
+	"has": {
+		Usage: "has(hash, key)",
+		Doc:   "Whether the hash contains the key",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `has` must be HASH, got %s", args[0].Type())
+			}
+
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			if _, ok := args[0].(*Hash).Get(key.HashKey()); ok {
+				return TRUE
+			}
+			return FALSE
+		},
+	},
+	"delete": {
+		Usage: "delete(hash, key)",
+		Doc:   "A new hash without the key, hashes are immutable like arrays",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+			}
+
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			return args[0].(*Hash).Delete(key.HashKey())
+		},
+	},
+	"set": {
+		Usage: "set(hash, key, value)",
+		Doc:   "A new hash with the key set to the value, it shares most of its memory with the old one so this is cheap",
+		Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `set` must be HASH, got %s", args[0].Type())
+			}
+
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			pair := HashPair{Key: args[1], Value: args[2]}
+			return args[0].(*Hash).Set(key.HashKey(), pair)
+		},
+	},
+	"next": {
+		Usage: "next(generator)",
+		Doc:   "The next value of a generator, null once it is exhausted",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != GENERATOR_OBJ {
+				return newError("argument to `next` must be GENERATOR, got %s", args[0].Type())
+			}
+
+			_, value, ok := args[0].(*Generator).Next()
+			if !ok {
+				return NULL
+			}
+
+			return value
+		},
+	},
+	"channel": {
+		Usage: "channel([size])",
+		Doc:   "A new channel, channel() is unbuffered and channel(n) buffers up to n values",
+		Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			if len(args) == 0 {
+				return NewChannel(0)
+			}
+
+			size, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `channel` must be INTEGER, got %s", args[0].Type())
+			}
+			if size.Value < 0 {
+				return newError("channel size must not be negative, got %d", size.Value)
+			}
+
+			return NewChannel(int(size.Value))
+		},
+	},
+	"send": {
+		Usage: "send(channel, value)",
+		Doc:   "Sends the value, blocks until it's received or there is room in the buffer",
+		Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != CHANNEL_OBJ {
+				return newError("argument to `send` must be CHANNEL, got %s", args[0].Type())
+			}
+
+			if !args[0].(*Channel).Send(args[1], nil) {
+				return newError("send on closed channel")
+			}
+
+			return NULL
+		},
+	},
+	"recv": {
+		Usage: "recv(channel)",
+		Doc:   "Receives the next value, null once the channel is closed and all values are received",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != CHANNEL_OBJ {
+				return newError("argument to `recv` must be CHANNEL, got %s", args[0].Type())
+			}
+
+			value, ok := args[0].(*Channel).Receive(nil)
+			if !ok {
+				return NULL
+			}
+
+			return value
+		},
+	},
+	"close": {
+		Usage: "close(channel)",
+		Doc:   "Closes the channel, receivers get null after the last value",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != CHANNEL_OBJ {
+				return newError("argument to `close` must be CHANNEL, got %s", args[0].Type())
+			}
+
+			if !args[0].(*Channel).Close() {
+				return newError("close of closed channel")
+			}
+
+			return NULL
+		},
+	},
+	"wait": {
+		Usage: "wait(task)",
+		Doc:   "Blocks until a spawned function is done and returns its result",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != TASK_OBJ {
+				return newError("argument to `wait` must be TASK, got %s", args[0].Type())
+			}
+
+			result, _ := args[0].(*Task).Wait(nil)
+			if result == nil {
+				return NULL
+			}
+
+			return result
+		},
+	},
+	"force": {
+		Usage: "force(value)",
+		Doc:   "Runs a lazy value (once) and returns its result, other values are returned as they are",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			thunk, ok := args[0].(*Thunk)
+			if !ok {
+				return args[0]
+			}
+
+			return thunk.Force()
+		},
+	},
+	"str": {
+		Usage: "str(value)",
+		Doc:   "Converts any value into its string representation",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			if str, ok := args[0].(*String); ok {
+				return str
+			}
+
+			return &String{Value: ToString(args[0])}
+		},
+	},
+	"exit": {
+		Usage: "exit([code])",
+		Doc:   "Stops the program, the command line tool exits with code (0 by default, at most 255)",
+		Fn: func(args ...Object) Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			code := int64(0)
+			if len(args) == 1 {
+				integer, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+				}
+				code = integer.Value
+			}
+			// the system only keeps the lowest byte, exit(256) would succeed
+			if code < 0 || code > 255 {
+				return newError("exit code must be between 0 and 255, got %d", code)
+			}
+
+			return &Error{Message: fmt.Sprintf("exit(%d)", code), Exit: true, Code: int(code)}
+		},
+	},
+	"error": {
+		Usage: "error(message)",
+		Doc:   "Stops the evaluation with the message, e.g. for failed assertions",
+		Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `error` must be STRING, got %s", args[0].Type())
+			}
+
+			return newError("%s", args[0].(*String).Value)
+		},
+	},
+}
+
+// The conversion rules of str(), strings are used as they are
+// and everything else is converted by its Inspect method
+func ToString(obj Object) string {
+	if str, ok := obj.(*String); ok {
+		return str.Value
+	}
+
+	return obj.Inspect()
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,77 @@
+package object
+
+import (
+	"sort"
+	"sync"
+)
+
+// A set of builtin functions by name, the evaluator looks names up in it
+// after the environment and the compiler after the symbol table. Hosts
+// can add their own functions to DefaultBuiltins or pass a separate
+// registry per evaluation
+type Builtins struct {
+	mu  sync.RWMutex
+	fns map[string]*Builtin
+}
+
+func NewBuiltins() *Builtins {
+	return &Builtins{fns: map[string]*Builtin{}}
+}
+
+// Used when no other registry is given, starts out with the builtins of
+// builtin_functions.go
+var DefaultBuiltins = NewBuiltins()
+
+// Adds fn to DefaultBuiltins, replacing any builtin with the same name
+func RegisterBuiltin(name string, fn BuiltinFunction) {
+	DefaultBuiltins.Register(name, fn)
+}
+
+// Adds fn under name, replacing any builtin with the same name
+func (b *Builtins) Register(name string, fn BuiltinFunction) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fns[name] = &Builtin{Fn: fn}
+}
+
+// Like Register but keeps the usage and doc of builtin
+func (b *Builtins) Add(name string, builtin *Builtin) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fns[name] = builtin
+}
+
+func (b *Builtins) Lookup(name string) (*Builtin, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	builtin, ok := b.fns[name]
+	return builtin, ok
+}
+
+// The registered names in alphabetical order
+func (b *Builtins) Names() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	names := make([]string, 0, len(b.fns))
+	for name := range b.fns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// A copy which can be changed without affecting the original,
+// e.g. DefaultBuiltins.Clone() plus a few extras for one host
+func (b *Builtins) Clone() *Builtins {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	clone := NewBuiltins()
+	for name, builtin := range b.fns {
+		clone.fns[name] = builtin
+	}
+
+	return clone
+}
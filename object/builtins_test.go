@@ -0,0 +1,36 @@
+package object
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltinsAreDocumented(t *testing.T) {
+	for name, builtin := range builtins {
+		if !strings.HasPrefix(builtin.Usage, name+"(") || builtin.Doc == "" {
+			t.Errorf("builtin %s has no usage or doc. got=%q, %q", name, builtin.Usage, builtin.Doc)
+		}
+		registered, ok := DefaultBuiltins.Lookup(name)
+		if !ok || registered.Doc != builtin.Doc {
+			t.Errorf("builtin %s was registered without its doc", name)
+		}
+	}
+}
+
+func TestToString(t *testing.T) {
+	tests := []struct {
+		input    Object
+		expected string
+	}{
+		{&String{Value: "hi"}, "hi"},
+		{NewInteger(5), "5"},
+		{TRUE, "true"},
+		{&Array{Elements: []Object{&String{Value: "a"}}}, "[a]"},
+	}
+
+	for _, tt := range tests {
+		if got := ToString(tt.input); got != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package object
+
+import (
+	"fmt"
+	"monkey/code"
+)
+
+// A function literal compiled to bytecode, a constant of the compiled
+// program which the VM calls in a frame of its own
+type CompiledFunction struct {
+	Instructions code.Instructions
+	// The slots of a call: the parameters, the lets and the loops' locals
+	NumLocals     int
+	NumParameters int
+	// See ast.FunctionLiteral.Name
+	Name string
+	// Where the instructions come from, for the VM's errors
+	Lines code.LineTable
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	if cf.Name != "" {
+		return fmt.Sprintf("CompiledFunction[%s]", cf.Name)
+	}
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// What the VM calls: a compiled function together with the variables of
+// the enclosing functions it captures
+type Closure struct {
+	Fn *CompiledFunction
+	// One Cell for every free variable, in the order of the compiler's
+	// FreeSymbols
+	Free []Object
+}
+
+// Reported as a FUNCTION like the evaluator's functions, so type checks
+// and error messages don't depend on how the program is run
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	if c.Fn.Name != "" {
+		return fmt.Sprintf("Closure[%s]", c.Fn.Name)
+	}
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Holds a local once a closure captures it, the function defining it and
+// every closure share the cell so they all see assignments to it
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string {
+	if c.Value == nil {
+		return "cell"
+	}
+	return "cell(" + c.Value.Inspect() + ")"
+}
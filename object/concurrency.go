@@ -0,0 +1,132 @@
+package object
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A Go channel which can be shared between spawned functions
+type Channel struct {
+	ch chan Object
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func NewChannel(size int) *Channel {
+	return &Channel{ch: make(chan Object, size)}
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("channel(%d)", cap(c.ch)) }
+
+// Blocks until the value is received (or buffered) or done is closed, a
+// nil done blocks for as long as it takes
+// Returns false if the channel is closed or done was closed first
+func (c *Channel) Send(value Object, done <-chan struct{}) (ok bool) {
+	defer func() {
+		// Closed while we were blocked
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return false
+	}
+
+	select {
+	case c.ch <- value:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// Blocks until a value is sent or done is closed, ok is false once the
+// channel is closed and drained or done was closed first
+func (c *Channel) Receive(done <-chan struct{}) (Object, bool) {
+	select {
+	case value, ok := <-c.ch:
+		return value, ok
+	case <-done:
+		return nil, false
+	}
+}
+
+// Returns false if the channel was already closed
+func (c *Channel) Close() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	c.closed = true
+	close(c.ch)
+	return true
+}
+
+type channelIterator struct {
+	channel *Channel
+	done    <-chan struct{}
+	index   int64
+}
+
+// Loops until the channel is closed
+func (c *Channel) Iterator() Iterator {
+	return &channelIterator{channel: c}
+}
+
+// Like Iterator but also stops once done is closed
+func (c *Channel) IteratorUntil(done <-chan struct{}) Iterator {
+	return &channelIterator{channel: c, done: done}
+}
+
+func (it *channelIterator) Next() (Object, Object, bool) {
+	value, ok := it.channel.Receive(it.done)
+	if !ok {
+		return nil, nil, false
+	}
+
+	key := NewInteger(it.index)
+	it.index++
+
+	return key, value, true
+}
+
+// The handle of a spawned function, used to wait for its result
+type Task struct {
+	done   chan struct{}
+	result Object
+}
+
+// Runs fn in a new goroutine
+func NewTask(fn func() Object) *Task {
+	t := &Task{done: make(chan struct{})}
+
+	go func() {
+		defer close(t.done)
+		t.result = fn()
+	}()
+
+	return t
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return "task" }
+
+// Blocks until the spawned function returned or done is closed, ok is
+// false if done was closed first
+func (t *Task) Wait(done <-chan struct{}) (result Object, ok bool) {
+	select {
+	case <-t.done:
+		return t.result, true
+	case <-done:
+		return nil, false
+	}
+}
@@ -0,0 +1,474 @@
+package object
+
+import (
+	"maps"
+	"slices"
+	"sort"
+)
+
+// The environment keeps track of the values bound to names
+type Environment struct {
+	store map[string]Object
+	// Bindings the resolver gave a fixed index, names[i] is the name of slots[i]
+	// An unset slot is nil and behaves as if the name wasn't bound here
+	slots []Object
+	names []string
+	// Names in store or slots which were bound with const
+	consts map[string]bool
+	outer  *Environment
+	// The module the environment belongs to, nil for the REPL or other
+	// code that wasn't loaded from a file
+	module *Module
+	// Set for the scope of a generator function call, used by yield
+	yield func(Object) bool
+	// A frozen environment is never changed again, see Freeze
+	frozen bool
+}
+
+func NewEnvironment() *Environment {
+	s := make(map[string]Object)
+	return &Environment{store: s, consts: make(map[string]bool), outer: nil}
+}
+
+// Used for function calls so the function body gets its own scope
+// but can still access the bindings of the outer scope
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// The scope of a function call or loop iteration with the slots the
+// resolver found for it, names that aren't in there still work through
+// the map
+func NewSlotEnvironment(outer *Environment, names []string) *Environment {
+	env := &Environment{outer: outer, names: names}
+	if len(names) > 0 {
+		env.slots = make([]Object, len(names))
+	}
+	return env
+}
+
+// The root environment of a module
+func NewModuleEnvironment(m *Module) *Environment {
+	env := NewEnvironment()
+	env.module = m
+	return env
+}
+
+// The scope of a generator function call
+func NewGeneratorEnvironment(outer *Environment, names []string, yield func(Object) bool) *Environment {
+	env := NewSlotEnvironment(outer, names)
+	env.yield = yield
+	return env
+}
+
+// Returns the index of the slot for name, -1 if there is none
+func (e *Environment) slot(name string) int {
+	for i, n := range e.names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Looks up a binding of this environment by name, ignoring the outer ones
+func (e *Environment) local(name string) (Object, bool) {
+	if i := e.slot(name); i >= 0 && e.slots[i] != nil {
+		return e.slots[i], true
+	}
+	obj, ok := e.store[name]
+	return obj, ok
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if obj, ok := env.local(name); ok {
+			return obj, true
+		}
+	}
+	return nil, false
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	if i := e.slot(name); i >= 0 {
+		e.slots[i] = val
+	} else {
+		e.setStore(name, val)
+	}
+	delete(e.consts, name)
+	return val
+}
+
+func (e *Environment) setStore(name string, val Object) {
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
+	e.store[name] = val
+}
+
+// Binds a value which can't be reassigned afterwards
+func (e *Environment) SetConst(name string, val Object) Object {
+	if i := e.slot(name); i >= 0 {
+		e.slots[i] = val
+	} else {
+		e.setStore(name, val)
+	}
+	e.markConst(name)
+	return val
+}
+
+func (e *Environment) markConst(name string) {
+	if e.consts == nil {
+		e.consts = make(map[string]bool)
+	}
+	e.consts[name] = true
+}
+
+// Removes the binding of this environment, the outer ones are left alone
+// Returns false if the name isn't bound here or the environment is frozen
+func (e *Environment) Delete(name string) bool {
+	if e.frozen || !e.HasLocal(name) {
+		return false
+	}
+	if i := e.slot(name); i >= 0 {
+		e.slots[i] = nil
+	}
+	delete(e.store, name)
+	delete(e.consts, name)
+	return true
+}
+
+// Reports whether the name is bound in this environment, ignoring the outer ones
+func (e *Environment) HasLocal(name string) bool {
+	_, ok := e.local(name)
+	return ok
+}
+
+// Reports whether the binding the name resolves to is a constant
+func (e *Environment) IsConst(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.local(name); ok {
+			return env.consts[name]
+		}
+	}
+	return false
+}
+
+// Changes the value of an existing binding in the environment where it was defined
+// Returns false if the name isn't bound at all
+func (e *Environment) Assign(name string, val Object) (Object, bool) {
+	for env := e; env != nil; env = env.outer {
+		if i := env.slot(name); i >= 0 && env.slots[i] != nil {
+			env.slots[i] = val
+			return val, true
+		}
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return val, true
+		}
+	}
+	return nil, false
+}
+
+// The slot versions of Get, Set and friends, depth is the number of
+// outer environments to skip and index comes from the resolver
+// The getters report false for unset slots, callers fall back to the name then
+
+func (e *Environment) up(depth int) *Environment {
+	env := e
+	for ; depth > 0 && env != nil; depth-- {
+		env = env.outer
+	}
+	return env
+}
+
+func (e *Environment) GetSlot(depth, index int) (Object, bool) {
+	env := e.up(depth)
+	if env == nil || index >= len(env.slots) || env.slots[index] == nil {
+		return nil, false
+	}
+	return env.slots[index], true
+}
+
+func (e *Environment) SetSlot(index int, val Object) Object {
+	e.slots[index] = val
+	if e.consts != nil {
+		delete(e.consts, e.names[index])
+	}
+	return val
+}
+
+func (e *Environment) SetConstSlot(index int, val Object) Object {
+	e.slots[index] = val
+	e.markConst(e.names[index])
+	return val
+}
+
+// Reports whether the slot is bound to a constant
+func (e *Environment) IsConstSlot(depth, index int) bool {
+	env := e.up(depth)
+	return env != nil && env.consts != nil && env.consts[env.names[index]]
+}
+
+// Frozen environments are left alone, Assign and IsFrozen report on them
+func (e *Environment) AssignSlot(depth, index int, val Object) bool {
+	env := e.up(depth)
+	if env == nil || env.frozen || index >= len(env.slots) || env.slots[index] == nil {
+		return false
+	}
+	env.slots[index] = val
+	return true
+}
+
+// Makes the environment and its outer environments read only, so they can
+// be shared by evaluations running in different goroutines without locking
+// Every evaluation needs its own NewEnclosedEnvironment(frozen) for its bindings
+// Freeze before sharing, the environment must not be in use while freezing it
+func (e *Environment) Freeze() {
+	for env := e; env != nil; env = env.outer {
+		env.frozen = true
+	}
+}
+
+func (e *Environment) Frozen() bool {
+	return e.frozen
+}
+
+// Reports whether the binding the name resolves to is in a frozen environment
+func (e *Environment) IsFrozen(name string) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.local(name); ok {
+			return env.frozen
+		}
+	}
+	return false
+}
+
+// The names bound in this environment itself in alphabetical order
+func (e *Environment) LocalNames() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	for i, name := range e.names {
+		if e.slots[i] != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// All names which can be looked up from here (including the outer
+// environments) in alphabetical order
+func (e *Environment) Names() []string {
+	seen := map[string]bool{}
+	for env := e; env != nil; env = env.outer {
+		for name := range env.store {
+			seen[name] = true
+		}
+		for i, name := range env.names {
+			if env.slots[i] != nil {
+				seen[name] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// The bindings of one environment at some point, see Checkpoint
+type Checkpoint struct {
+	store  map[string]Object
+	slots  []Object
+	consts map[string]bool
+}
+
+// Remembers the bindings of this environment (not of the outer ones) so
+// Rollback can undo everything bound or assigned here in the meantime
+func (e *Environment) Checkpoint() *Checkpoint {
+	return &Checkpoint{
+		store:  maps.Clone(e.store),
+		slots:  slices.Clone(e.slots),
+		consts: maps.Clone(e.consts),
+	}
+}
+
+// The checkpoint stays as it is, it can be rolled back to again
+func (e *Environment) Rollback(c *Checkpoint) {
+	e.store = maps.Clone(c.store)
+	e.consts = maps.Clone(c.consts)
+	copy(e.slots, c.slots)
+}
+
+// The names of this environment which were bound, assigned or removed
+// since the checkpoint, in alphabetical order
+func (e *Environment) Changed(c *Checkpoint) []string {
+	var names []string
+	changed := func(name string, before, after Object) {
+		if before != after || c.consts[name] != e.consts[name] {
+			names = append(names, name)
+		}
+	}
+
+	for i, name := range e.names {
+		changed(name, c.slots[i], e.slots[i])
+	}
+	for name, after := range e.store {
+		changed(name, c.store[name], after)
+	}
+	for name, before := range c.store {
+		if _, ok := e.store[name]; !ok {
+			changed(name, before, nil)
+		}
+	}
+	sort.Strings(names)
+
+	return slices.Compact(names)
+}
+
+// Puts the names back the way they were at the checkpoint, everything
+// else stays as it is. Names which weren't bound then are removed
+func (e *Environment) Restore(c *Checkpoint, names ...string) {
+	for _, name := range names {
+		if i := e.slot(name); i >= 0 {
+			e.slots[i] = c.slots[i]
+		} else if before, ok := c.store[name]; ok {
+			e.setStore(name, before)
+		} else {
+			delete(e.store, name)
+		}
+
+		if c.consts[name] {
+			e.markConst(name)
+		} else {
+			delete(e.consts, name)
+		}
+	}
+}
+
+// Returns the module the environment (or one of its outer environments) belongs to
+func (e *Environment) Module() *Module {
+	for env := e; env != nil; env = env.outer {
+		if env.module != nil {
+			return env.module
+		}
+	}
+	return nil
+}
+
+// Returns the yield function of the generator the environment belongs to
+func (e *Environment) Yield() func(Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if env.yield != nil {
+			return env.yield
+		}
+	}
+	return nil
+}
+
+// Copies the environment together with everything reachable from it (outer
+// environments, closures, modules) so the copy can be used by another goroutine
+// without sharing a single binding with the original
+// Channels and tasks are still shared, they are safe to use concurrently. A
+// lazy value which isn't forced yet and a generator would run against the
+// original environment, the copy gets ones which only give an error then
+func (e *Environment) Snapshot() *Environment {
+	s := &snapshot{envs: map[*Environment]*Environment{}}
+	return s.env(e)
+}
+
+type snapshot struct {
+	// Already copied environments, needed for recursive functions
+	envs map[*Environment]*Environment
+}
+
+func (s *snapshot) env(e *Environment) *Environment {
+	if e == nil {
+		return nil
+	}
+	if copied, ok := s.envs[e]; ok {
+		return copied
+	}
+
+	copied := &Environment{
+		store:  make(map[string]Object, len(e.store)),
+		consts: make(map[string]bool, len(e.consts)),
+		names:  e.names,
+	}
+	if e.slots != nil {
+		copied.slots = make([]Object, len(e.slots))
+	}
+	s.envs[e] = copied
+
+	copied.outer = s.env(e.outer)
+	if e.module != nil {
+		copied.module = &Module{Name: e.module.Name, Path: e.module.Path, Env: copied}
+	}
+	for name, val := range e.store {
+		copied.store[name] = s.object(val)
+	}
+	for i, val := range e.slots {
+		if val != nil {
+			copied.slots[i] = s.object(val)
+		}
+	}
+	for name := range e.consts {
+		copied.consts[name] = true
+	}
+
+	return copied
+}
+
+func (s *snapshot) object(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Function:
+		return &Function{
+			Name:       obj.Name,
+			Parameters: obj.Parameters,
+			Body:       obj.Body,
+			Locals:     obj.Locals,
+			Env:        s.env(obj.Env),
+			Generator:  obj.Generator,
+		}
+	case *Module:
+		return s.env(obj.Env).module
+	case *Array:
+		elements := make([]Object, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = s.object(el)
+		}
+		return &Array{Elements: elements}
+	case *Hash:
+		copied := &Hash{}
+		obj.Each(func(key HashKey, pair HashPair) {
+			copied = copied.Set(key, HashPair{Key: pair.Key, Value: s.object(pair.Value)})
+		})
+		return copied
+	case *Thunk:
+		if result, ok := obj.Forced(); ok {
+			copied := &Thunk{result: s.object(result)}
+			copied.once.Do(func() {})
+			copied.forced.Store(true)
+			return copied
+		}
+		return NewThunk(func() Object {
+			return &Error{Message: "can't force a lazy value of the spawning code, force it before the spawn"}
+		})
+	case *Generator:
+		return NewGenerator(func(yield func(Object) bool) Object {
+			return &Error{Message: "can't use a generator of the spawning code, send its values over a channel"}
+		}, nil)
+	default:
+		return obj
+	}
+}
@@ -0,0 +1,103 @@
+package object
+
+import "testing"
+
+func TestCheckpointRollback(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("shared", NewInteger(1))
+	env := NewEnclosedEnvironment(outer)
+	env.Set("a", NewInteger(1))
+	env.SetConst("c", NewInteger(2))
+
+	checkpoint := env.Checkpoint()
+	env.Set("a", NewInteger(10))
+	env.Set("b", NewInteger(20))
+	env.Set("c", NewInteger(30))
+	env.Rollback(checkpoint)
+
+	if val, _ := env.Get("a"); val.(*Integer).Value != 1 {
+		t.Errorf("a was not rolled back. got=%s", val.Inspect())
+	}
+	if env.HasLocal("b") {
+		t.Errorf("b should be gone after the rollback")
+	}
+	if !env.IsConst("c") {
+		t.Errorf("c should be a constant again")
+	}
+
+	// the checkpoint keeps working after a rollback
+	env.Set("d", NewInteger(4))
+	env.Rollback(checkpoint)
+	if env.HasLocal("d") {
+		t.Errorf("d should be gone after the second rollback")
+	}
+}
+
+func TestSlotCheckpoint(t *testing.T) {
+	env := NewSlotEnvironment(nil, []string{"x"})
+	env.SetSlot(0, NewInteger(1))
+
+	checkpoint := env.Checkpoint()
+	env.SetSlot(0, NewInteger(2))
+	env.Rollback(checkpoint)
+
+	if val, _ := env.GetSlot(0, 0); val.(*Integer).Value != 1 {
+		t.Errorf("slot was not rolled back. got=%s", val.Inspect())
+	}
+}
+
+func TestChangedAndRestore(t *testing.T) {
+	env := NewEnvironment()
+	one := NewInteger(1)
+	env.Set("kept", one)
+	env.Set("a", one)
+	env.Set("gone", one)
+
+	checkpoint := env.Checkpoint()
+	env.Set("kept", one)
+	env.Set("a", NewInteger(2))
+	env.Set("b", NewInteger(3))
+	env.Delete("gone")
+
+	changed := env.Changed(checkpoint)
+	expected := []string{"a", "b", "gone"}
+	if len(changed) != len(expected) {
+		t.Fatalf("wrong changed names. expected=%q, got=%q", expected, changed)
+	}
+	for i, name := range expected {
+		if changed[i] != name {
+			t.Errorf("changed[%d] wrong. expected=%q, got=%q", i, name, changed[i])
+		}
+	}
+
+	env.Set("later", one)
+	env.Restore(checkpoint, changed...)
+	if val, _ := env.Get("a"); val != one {
+		t.Errorf("a was not restored. got=%s", val.Inspect())
+	}
+	if env.HasLocal("b") || !env.HasLocal("gone") || !env.HasLocal("later") {
+		t.Errorf("only the changed names should be restored. got=%q", env.LocalNames())
+	}
+}
+
+func TestDelete(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", NewInteger(1))
+	env := NewEnclosedEnvironment(outer)
+	env.SetConst("x", NewInteger(2))
+
+	if !env.Delete("x") {
+		t.Fatalf("Delete(x) should remove the local binding")
+	}
+	if val, _ := env.Get("x"); val.(*Integer).Value != 1 || env.IsConst("x") {
+		t.Errorf("the outer x should be visible again. got=%s", val.Inspect())
+	}
+	if env.Delete("x") {
+		t.Errorf("Delete should leave the outer environments alone")
+	}
+
+	outer.Freeze()
+	if outer.Delete("x") {
+		t.Errorf("Delete should leave frozen environments alone")
+	}
+}
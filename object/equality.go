@@ -0,0 +1,56 @@
+package object
+
+// Reports whether two objects are equal. Arrays, hashes and ranges are compared
+// by their contents, functions and other reference types by identity
+func Equals(a, b Object) bool {
+	if a == b {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *BigInteger:
+		b, ok := b.(*BigInteger)
+		return ok && a.Value.Cmp(b.Value) == 0
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *Null:
+		_, ok := b.(*Null)
+		return ok
+	case *Range:
+		b, ok := b.(*Range)
+		return ok && a.Start == b.Start && a.End == b.End
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equals(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || a.Len() != b.Len() {
+			return false
+		}
+		equal := true
+		a.Each(func(key HashKey, pair HashPair) {
+			other, ok := b.Get(key)
+			if !ok || !Equals(pair.Value, other.Value) {
+				equal = false
+			}
+		})
+		return equal
+	default:
+		return false
+	}
+}
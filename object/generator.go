@@ -0,0 +1,112 @@
+package object
+
+import "sync"
+
+// A generator produces its values lazily. The producing function runs in its
+// own goroutine and is paused after every value until the next one is requested
+type Generator struct {
+	run func(yield func(Object) bool) Object
+	// Stops a paused generator like Stop does once it's closed
+	stop <-chan struct{}
+
+	mu      sync.Mutex
+	resume  chan struct{}
+	values  chan Object
+	started bool
+	done    bool
+	index   int64
+}
+
+// run is called once the first value is requested. It has to stop as soon as
+// yield returns false, which happens when the generator was stopped or stop
+// was closed, e.g. because the evaluation which made it is over. A nil stop
+// never is, only Stop ends a paused generator then
+func NewGenerator(run func(yield func(Object) bool) Object, stop <-chan struct{}) *Generator {
+	return &Generator{run: run, stop: stop}
+}
+
+func (g *Generator) Type() ObjectType { return GENERATOR_OBJ }
+func (g *Generator) Inspect() string  { return "generator" }
+
+// A generator can only be consumed once, so it is its own iterator
+func (g *Generator) Iterator() Iterator { return g }
+
+// An error returned by the producing function is handed out as the last value
+func (g *Generator) Next() (Object, Object, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.done {
+		return nil, nil, false
+	}
+
+	if !g.started {
+		g.started = true
+		g.resume = make(chan struct{})
+		g.values = make(chan Object)
+		go g.produce()
+	} else {
+		select {
+		case g.resume <- struct{}{}:
+		case <-g.values:
+			// produce only gives up without being resumed when stop is closed
+			g.done = true
+			return nil, nil, false
+		}
+	}
+
+	value, ok := <-g.values
+	if !ok {
+		g.done = true
+		return nil, nil, false
+	}
+	// Nothing comes after an error
+	if value.Type() == ERROR_OBJ {
+		g.done = true
+	}
+
+	key := NewInteger(g.index)
+	g.index++
+
+	return key, value, true
+}
+
+// Stops a paused generator so its goroutine can finish
+func (g *Generator) Stop() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.done {
+		return
+	}
+
+	g.done = true
+	if g.started {
+		close(g.resume)
+	}
+}
+
+func (g *Generator) produce() {
+	defer close(g.values)
+
+	stopped := false
+	yield := func(value Object) bool {
+		g.values <- value
+		select {
+		case _, ok := <-g.resume:
+			if !ok {
+				stopped = true
+				return false
+			}
+			return true
+		case <-g.stop:
+			stopped = true
+			return false
+		}
+	}
+
+	result := g.run(yield)
+	if !stopped && result != nil && result.Type() == ERROR_OBJ {
+		g.values <- result
+	}
+}
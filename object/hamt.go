@@ -0,0 +1,209 @@
+package object
+
+import (
+	"math/bits"
+)
+
+// The pairs of a Hash live in a hash array mapped trie (HAMT). Every node
+// uses 5 bits of the hashed key to pick one of 32 children, and only stores
+// the children which exist. Changing a hash copies the nodes on the way to
+// the pair (a handful) and shares everything else with the old hash, so
+// "returns a new hash" operations don't have to copy all pairs
+const (
+	hamtBits  = 5
+	hamtWidth = 1 << hamtBits
+	hamtMask  = hamtWidth - 1
+)
+
+type hamtNode struct {
+	// Bit i is set when there is a child for the 5 bit chunk i
+	bitmap   uint32
+	children []hamtChild
+	// Only used below the last level, for keys whose hashes are identical
+	collisions []hamtEntry
+}
+
+// Exactly one of the fields is set
+type hamtChild struct {
+	entry *hamtEntry
+	node  *hamtNode
+}
+
+// A pair together with its key, stored in the leaves of the trie
+type hamtEntry struct {
+	hash uint64 // hashOf(key), kept so splitting a leaf doesn't hash again
+	key  HashKey
+	pair HashPair
+}
+
+// Spreads the bits of a key over all 64 bits, integer keys are
+// sequential and would otherwise all end up in the same few branches
+func hashOf(key HashKey) uint64 {
+	h := key.Value
+	for i := 0; i < len(key.Type); i++ {
+		h = (h ^ uint64(key.Type[i])) * 0x100000001b3
+	}
+	// the finalizer of splitmix64
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+func (n *hamtNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) get(h uint64, key HashKey, shift uint) (HashPair, bool) {
+	for {
+		if shift >= 64 {
+			for _, entry := range n.collisions {
+				if entry.key == key {
+					return entry.pair, true
+				}
+			}
+			return HashPair{}, false
+		}
+
+		bit := uint32(1) << ((h >> shift) & hamtMask)
+		if n.bitmap&bit == 0 {
+			return HashPair{}, false
+		}
+
+		child := n.children[n.index(bit)]
+		if child.entry != nil {
+			if child.entry.key == key {
+				return child.entry.pair, true
+			}
+			return HashPair{}, false
+		}
+
+		n = child.node
+		shift += hamtBits
+	}
+}
+
+// Returns a new node with the entry added or replaced, and whether it was added
+func (n *hamtNode) set(h uint64, entry *hamtEntry, shift uint) (*hamtNode, bool) {
+	if shift >= 64 {
+		copied := &hamtNode{collisions: make([]hamtEntry, len(n.collisions), len(n.collisions)+1)}
+		copy(copied.collisions, n.collisions)
+		for i := range copied.collisions {
+			if copied.collisions[i].key == entry.key {
+				copied.collisions[i] = *entry
+				return copied, false
+			}
+		}
+		copied.collisions = append(copied.collisions, *entry)
+		return copied, true
+	}
+
+	bit := uint32(1) << ((h >> shift) & hamtMask)
+	idx := n.index(bit)
+
+	if n.bitmap&bit == 0 {
+		copied := &hamtNode{bitmap: n.bitmap | bit, children: make([]hamtChild, len(n.children)+1)}
+		copy(copied.children, n.children[:idx])
+		copied.children[idx] = hamtChild{entry: entry}
+		copy(copied.children[idx+1:], n.children[idx:])
+		return copied, true
+	}
+
+	child := n.children[idx]
+	var replacement hamtChild
+	added := false
+
+	switch {
+	case child.node != nil:
+		var node *hamtNode
+		node, added = child.node.set(h, entry, shift+hamtBits)
+		replacement = hamtChild{node: node}
+	case child.entry.key == entry.key:
+		replacement = hamtChild{entry: entry}
+	default:
+		// Two keys share this chunk, push both one level down
+		node, _ := (&hamtNode{}).set(child.entry.hash, child.entry, shift+hamtBits)
+		node, _ = node.set(h, entry, shift+hamtBits)
+		replacement = hamtChild{node: node}
+		added = true
+	}
+
+	copied := &hamtNode{bitmap: n.bitmap, children: make([]hamtChild, len(n.children))}
+	copy(copied.children, n.children)
+	copied.children[idx] = replacement
+	return copied, added
+}
+
+// Returns a new node without the key (nil when it's empty), and whether
+// the key was there at all
+func (n *hamtNode) delete(h uint64, key HashKey, shift uint) (*hamtNode, bool) {
+	if shift >= 64 {
+		for i, entry := range n.collisions {
+			if entry.key == key {
+				copied := &hamtNode{collisions: make([]hamtEntry, 0, len(n.collisions)-1)}
+				copied.collisions = append(copied.collisions, n.collisions[:i]...)
+				copied.collisions = append(copied.collisions, n.collisions[i+1:]...)
+				if len(copied.collisions) == 0 {
+					return nil, true
+				}
+				return copied, true
+			}
+		}
+		return n, false
+	}
+
+	bit := uint32(1) << ((h >> shift) & hamtMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	idx := n.index(bit)
+	child := n.children[idx]
+
+	var replacement *hamtChild
+	if child.node != nil {
+		node, removed := child.node.delete(h, key, shift+hamtBits)
+		if !removed {
+			return n, false
+		}
+		if node != nil {
+			replacement = &hamtChild{node: node}
+			// A node with a single entry left can be replaced by the entry
+			if len(node.children) == 1 && node.children[0].entry != nil {
+				replacement = &hamtChild{entry: node.children[0].entry}
+			}
+		}
+	} else if child.entry.key != key {
+		return n, false
+	}
+
+	if replacement != nil {
+		copied := &hamtNode{bitmap: n.bitmap, children: make([]hamtChild, len(n.children))}
+		copy(copied.children, n.children)
+		copied.children[idx] = *replacement
+		return copied, true
+	}
+
+	if len(n.children) == 1 {
+		return nil, true
+	}
+	copied := &hamtNode{bitmap: n.bitmap &^ bit, children: make([]hamtChild, 0, len(n.children)-1)}
+	copied.children = append(copied.children, n.children[:idx]...)
+	copied.children = append(copied.children, n.children[idx+1:]...)
+	return copied, true
+}
+
+func (n *hamtNode) each(fn func(entry *hamtEntry)) {
+	for i := range n.collisions {
+		fn(&n.collisions[i])
+	}
+	for _, child := range n.children {
+		if child.entry != nil {
+			fn(child.entry)
+		} else {
+			child.node.each(fn)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package object
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func intKey(i int64) HashKey {
+	return (&Integer{Value: i}).HashKey()
+}
+
+func intPair(i int64) HashPair {
+	return HashPair{Key: &Integer{Value: i}, Value: &Integer{Value: i * 10}}
+}
+
+func TestHashAgainstMap(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	expected := map[HashKey]int64{}
+	h := &Hash{}
+
+	for i := 0; i < 20000; i++ {
+		n := rnd.Int63n(2000)
+		key := intKey(n)
+		if rnd.Intn(3) == 0 {
+			h = h.Delete(key)
+			delete(expected, key)
+		} else {
+			h = h.Set(key, intPair(n))
+			expected[key] = n * 10
+		}
+	}
+
+	if h.Len() != len(expected) {
+		t.Fatalf("wrong length. want=%d, got=%d", len(expected), h.Len())
+	}
+	for key, value := range expected {
+		pair, ok := h.Get(key)
+		if !ok || pair.Value.(*Integer).Value != value {
+			t.Fatalf("wrong value for %v. want=%d, got=%v", key, value, pair.Value)
+		}
+	}
+
+	count := 0
+	h.Each(func(key HashKey, pair HashPair) {
+		count++
+		if _, ok := expected[key]; !ok {
+			t.Errorf("unexpected key %v", key)
+		}
+	})
+	if count != len(expected) {
+		t.Errorf("Each visited %d pairs, want %d", count, len(expected))
+	}
+}
+
+func TestHashIsPersistent(t *testing.T) {
+	h1 := NewHash(map[HashKey]HashPair{intKey(1): intPair(1), intKey(2): intPair(2)})
+	h2 := h1.Set(intKey(3), intPair(3))
+	h3 := h2.Delete(intKey(1))
+	h4 := h3.Set(intKey(2), HashPair{Key: &Integer{Value: 2}, Value: &String{Value: "two"}})
+
+	if h1.Len() != 2 || h2.Len() != 3 || h3.Len() != 2 || h4.Len() != 2 {
+		t.Fatalf("wrong lengths: %d %d %d %d", h1.Len(), h2.Len(), h3.Len(), h4.Len())
+	}
+	if _, ok := h1.Get(intKey(3)); ok {
+		t.Errorf("setting changed the old hash")
+	}
+	if _, ok := h2.Get(intKey(1)); !ok {
+		t.Errorf("deleting changed the old hash")
+	}
+	if pair, _ := h3.Get(intKey(2)); pair.Value.Inspect() != "20" {
+		t.Errorf("replacing changed the old hash, got %s", pair.Value.Inspect())
+	}
+	if h1.Delete(intKey(99)) != h1 {
+		t.Errorf("deleting a missing key should return the same hash")
+	}
+}
+
+// Keys with the same hash end up in a collision node below the last level
+func TestHashCollisions(t *testing.T) {
+	const h = 0xdeadbeef
+	root := &hamtNode{}
+	for i := int64(0); i < 3; i++ {
+		root, _ = root.set(h, &hamtEntry{hash: h, key: intKey(i), pair: intPair(i)}, 0)
+	}
+
+	for i := int64(0); i < 3; i++ {
+		if pair, ok := root.get(h, intKey(i), 0); !ok || pair.Value.Inspect() != intPair(i).Value.Inspect() {
+			t.Errorf("key %d not found", i)
+		}
+	}
+
+	root, removed := root.delete(h, intKey(1), 0)
+	if !removed {
+		t.Fatalf("key 1 not removed")
+	}
+	if _, ok := root.get(h, intKey(1), 0); ok {
+		t.Errorf("key 1 still there")
+	}
+	if _, ok := root.get(h, intKey(2), 0); !ok {
+		t.Errorf("key 2 got lost")
+	}
+}
+
+// Strings only hash to a number, two with the same one are still
+// different keys
+func TestHashStringCollisions(t *testing.T) {
+	a := HashKey{Type: STRING_OBJ, Value: 1, text: "a"}
+	b := HashKey{Type: STRING_OBJ, Value: 1, text: "b"}
+
+	h := (&Hash{}).Set(a, HashPair{Key: &String{Value: "a"}, Value: &Integer{Value: 1}})
+	h = h.Set(b, HashPair{Key: &String{Value: "b"}, Value: &Integer{Value: 2}})
+	if h.Len() != 2 {
+		t.Fatalf("expected 2 keys, got=%d", h.Len())
+	}
+	if pair, ok := h.Get(a); !ok || pair.Value.Inspect() != "1" {
+		t.Errorf("expected a to be 1, got=%v and %t", pair.Value, ok)
+	}
+	if pair, ok := h.Get(b); !ok || pair.Value.Inspect() != "2" {
+		t.Errorf("expected b to be 2, got=%v and %t", pair.Value, ok)
+	}
+	if h = h.Delete(a); h.Len() != 1 {
+		t.Errorf("expected 1 key after deleting a, got=%d", h.Len())
+	}
+	if _, ok := h.Get(b); !ok {
+		t.Errorf("b got lost deleting a")
+	}
+}
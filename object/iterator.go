@@ -0,0 +1,109 @@
+package object
+
+import "unicode/utf8"
+
+// Objects which can be looped over with for-in
+type Iterable interface {
+	Iterator() Iterator
+}
+
+// Next returns the key (the index for everything except hashes) and value
+// of the next element, ok is false once all elements are consumed
+type Iterator interface {
+	Next() (key Object, value Object, ok bool)
+}
+
+// Implemented by iterators holding on to resources (like a paused generator)
+// so loops which end early can release them
+type Stopper interface {
+	Stop()
+}
+
+type arrayIterator struct {
+	elements []Object
+	index    int
+}
+
+func (ao *Array) Iterator() Iterator {
+	return &arrayIterator{elements: ao.Elements}
+}
+
+func (it *arrayIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.elements) {
+		return nil, nil, false
+	}
+
+	key := NewInteger(int64(it.index))
+	value := it.elements[it.index]
+	it.index++
+
+	return key, value, true
+}
+
+// Iterates over the characters (not the bytes) of a string
+type stringIterator struct {
+	value    string
+	position int
+	index    int
+}
+
+func (s *String) Iterator() Iterator {
+	return &stringIterator{value: s.Value}
+}
+
+func (it *stringIterator) Next() (Object, Object, bool) {
+	if it.position >= len(it.value) {
+		return nil, nil, false
+	}
+
+	r, size := utf8.DecodeRuneInString(it.value[it.position:])
+	key := NewInteger(int64(it.index))
+	it.position += size
+	it.index++
+
+	return key, &String{Value: string(r)}, true
+}
+
+type hashIterator struct {
+	pairs []HashPair
+	index int
+}
+
+// The pairs are copied so the loop body can't affect the iteration
+func (h *Hash) Iterator() Iterator {
+	return &hashIterator{pairs: h.SortedPairs()}
+}
+
+func (it *hashIterator) Next() (Object, Object, bool) {
+	if it.index >= len(it.pairs) {
+		return nil, nil, false
+	}
+
+	pair := it.pairs[it.index]
+	it.index++
+
+	return pair.Key, pair.Value, true
+}
+
+type rangeIterator struct {
+	current int64
+	end     int64
+	index   int64
+}
+
+func (r *Range) Iterator() Iterator {
+	return &rangeIterator{current: r.Start, end: r.End}
+}
+
+func (it *rangeIterator) Next() (Object, Object, bool) {
+	if it.current >= it.end {
+		return nil, nil, false
+	}
+
+	key := NewInteger(it.index)
+	value := NewInteger(it.current)
+	it.current++
+	it.index++
+
+	return key, value, true
+}
@@ -1,13 +1,38 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"monkey/ast"
+	"monkey/token"
+	"sort"
+	"strings"
+)
 
 type ObjectType string
 
 const (
-	INTEGER_OBJ = "INTEGER"
-	BOOLEAN_OBJ = "BOOLEAN"
-	NULL_OBJ    = "NULL"
+	INTEGER_OBJ      = "INTEGER"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	STRING_OBJ       = "STRING"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	MODULE_OBJ       = "MODULE"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	RANGE_OBJ        = "RANGE"
+	BIG_INTEGER_OBJ  = "BIG_INTEGER"
+	GENERATOR_OBJ    = "GENERATOR"
+	CHANNEL_OBJ      = "CHANNEL"
+	TASK_OBJ         = "TASK"
+	THUNK_OBJ        = "THUNK"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
 )
 
 type Object interface {
@@ -22,6 +47,47 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+// Integers in this range are allocated once and shared, loop counters,
+// indexes and lengths are almost always small
+const (
+	SmallIntMin = -128
+	SmallIntMax = 1024
+)
+
+var smallIntegers = func() []Integer {
+	ints := make([]Integer, SmallIntMax-SmallIntMin+1)
+	for i := range ints {
+		ints[i].Value = int64(i + SmallIntMin)
+	}
+	return ints
+}()
+
+// Integers are never changed after they are created, so they can be shared
+func NewInteger(value int64) *Integer {
+	if value >= SmallIntMin && value <= SmallIntMax {
+		return &smallIntegers[value-SmallIntMin]
+	}
+	return &Integer{Value: value}
+}
+
+// An integer which doesn't fit into an int64, only created when the
+// evaluator promotes overflowing arithmetic. Results which fit again
+// become a normal Integer, so a BigInteger is never equal to an Integer
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+func (b *BigInteger) Type() ObjectType { return BIG_INTEGER_OBJ }
+
+// Returns an Integer when value fits into one, a BigInteger otherwise
+func NewBigInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return NewInteger(value.Int64())
+	}
+	return &BigInteger{Value: value}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -33,3 +99,332 @@ type Null struct{}
 
 func (n *Null) Inspect() string  { return "null" }
 func (n *Null) Type() ObjectType { return NULL_OBJ }
+
+// There is only ever one null, true and false so they can be compared by pointer
+var (
+	NULL  = &Null{}
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+)
+
+type String struct {
+	Value string
+}
+
+func (s *String) Inspect() string  { return s.Value }
+func (s *String) Type() ObjectType { return STRING_OBJ }
+
+// Wraps the value of a return statement so the evaluator knows
+// it has to stop evaluating the remaining statements
+type ReturnValue struct {
+	Value Object
+}
+
+func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
+func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+
+type Error struct {
+	Message string
+	// Where the error happened, filled in by the evaluator and the VM
+	Pos token.Position
+	// The calls the VM was in, innermost first. The first one is where
+	// the error happened
+	Trace []TraceEntry
+	// Set by exit(), the program stops on purpose and the host should
+	// end with Code instead of reporting an error
+	Exit bool
+	Code int
+}
+
+// A function on the VM's stack and where it was when the error happened
+type TraceEntry struct {
+	Function string
+	Pos      token.Position
+}
+
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+
+// An error is also a Go error, the VM returns the ones of builtins from
+// Run so the host still sees Exit and Code
+func (e *Error) Error() string { return e.Message }
+
+// A function carries its own environment so closures are possible
+// Calling a generator function returns a Generator instead of running the body
+type Function struct {
+	// See ast.FunctionLiteral.Name
+	Name       string
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	// The slots of a call, see ast.FunctionLiteral
+	Locals    []string
+	Env       *Environment
+	Generator bool
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn")
+	if f.Generator {
+		out.WriteString("*")
+	}
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+// Functions implemented in Go which are available in every Monkey program
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+	// How it's called, e.g. "push(array, value)", and what it does
+	// Shown by the REPL's :doc, both are empty for undocumented builtins
+	Usage string
+	Doc   string
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+type Array struct {
+	Elements []Object
+}
+
+func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
+func (ao *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range ao.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// The integers from Start up to (but not including) End, e.g. 1..5
+// The values are produced lazily while iterating
+type Range struct {
+	Start int64
+	End   int64
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string  { return fmt.Sprintf("%d..%d", r.Start, r.End) }
+
+// Used as the key of the Go map inside a Hash
+// Two objects with the same type and value result in the same HashKey
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	// The value itself for keys whose Value is only a hash of it (strings
+	// and big integers), so keys with the same hash are still different
+	text string
+}
+
+// Only objects implementing Hashable can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	} else {
+		value = 0
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Value: fnv(s.Value), text: s.Value}
+}
+
+func (b *BigInteger) HashKey() HashKey {
+	text := b.Value.String()
+	return HashKey{Type: b.Type(), Value: fnv(text), text: text}
+}
+
+// FNV-1a, without hash/fnv's allocations
+func fnv(s string) uint64 {
+	h := uint64(0xcbf29ce484222325)
+	for i := 0; i < len(s); i++ {
+		h = (h ^ uint64(s[i])) * 0x100000001b3
+	}
+	return h
+}
+
+// Keeps the original key next to the value so we can print the Hash
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hashes never change, Set and Delete return a new hash which shares
+// most of its pairs with the old one (see hamt.go)
+// The zero value is an empty hash
+type Hash struct {
+	root *hamtNode
+	size int
+}
+
+// Builds a hash from the given pairs
+func NewHash(pairs map[HashKey]HashPair) *Hash {
+	h := &Hash{}
+	for key, pair := range pairs {
+		h = h.Set(key, pair)
+	}
+	return h
+}
+
+func (h *Hash) Len() int { return h.size }
+
+func (h *Hash) Get(key HashKey) (HashPair, bool) {
+	return h.GetHashed(NewHashedKey(key))
+}
+
+// A HashKey together with where it goes in a hash, for a key which is
+// looked up again and again, like the name of a member in a loop
+type HashedKey struct {
+	key  HashKey
+	hash uint64
+}
+
+func NewHashedKey(key HashKey) HashedKey {
+	return HashedKey{key: key, hash: hashOf(key)}
+}
+
+// Get without hashing the key again
+func (h *Hash) GetHashed(key HashedKey) (HashPair, bool) {
+	if h.root == nil {
+		return HashPair{}, false
+	}
+	return h.root.get(key.hash, key.key, 0)
+}
+
+// Returns a new hash with the pair added or replaced
+func (h *Hash) Set(key HashKey, pair HashPair) *Hash {
+	root := h.root
+	if root == nil {
+		root = &hamtNode{}
+	}
+
+	hashed := hashOf(key)
+	root, added := root.set(hashed, &hamtEntry{hash: hashed, key: key, pair: pair}, 0)
+	size := h.size
+	if added {
+		size++
+	}
+
+	return &Hash{root: root, size: size}
+}
+
+// Returns a new hash without key, or the hash itself when key isn't in it
+func (h *Hash) Delete(key HashKey) *Hash {
+	if h.root == nil {
+		return h
+	}
+
+	root, removed := h.root.delete(hashOf(key), key, 0)
+	if !removed {
+		return h
+	}
+
+	return &Hash{root: root, size: h.size - 1}
+}
+
+// Calls fn for every pair in no particular order, see SortedPairs
+func (h *Hash) Each(fn func(key HashKey, pair HashPair)) {
+	if h.root == nil {
+		return
+	}
+	h.root.each(func(entry *hamtEntry) {
+		fn(entry.key, entry.pair)
+	})
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.SortedPairs() {
+		pairs = append(pairs, fmt.Sprintf("%s: %s",
+			pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// The order of the trie depends on the hashed keys, so everything which
+// shows or walks the pairs of a hash uses this order instead. Keys are grouped
+// by type, integers and strings are sorted by their value and false comes
+// before true
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, h.size)
+	h.Each(func(_ HashKey, pair HashPair) {
+		pairs = append(pairs, pair)
+	})
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return lessKey(pairs[i].Key, pairs[j].Key)
+	})
+
+	return pairs
+}
+
+func lessKey(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return a.Type() < b.Type()
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value < b.(*Integer).Value
+	case *BigInteger:
+		return a.Value.Cmp(b.(*BigInteger).Value) < 0
+	case *String:
+		return a.Value < b.(*String).Value
+	case *Boolean:
+		return !a.Value && b.(*Boolean).Value
+	default:
+		return false
+	}
+}
+
+// A loaded source file. Its top level bindings live in Env
+type Module struct {
+	Name string // the path as written in the import expression
+	Path string // the absolute path of the file
+	Env  *Environment
+}
+
+func (m *Module) Inspect() string  { return fmt.Sprintf("<module %s>", m.Name) }
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
@@ -0,0 +1,37 @@
+package object
+
+// Rough sizes in bytes, they only need to be good enough to stop
+// scripts which allocate way too much
+const (
+	ObjectHeaderSize = 16
+	PointerSize      = 8
+	HashPairSize     = 64
+)
+
+// About how many bytes a newly created object takes, for the memory
+// limits of the evaluator and the VM. Only the object itself is counted,
+// the elements of arrays and hashes were already counted when they were
+// created
+func ApproxSize(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *Boolean, *Null, *Error:
+		// shared singletons and errors which end the evaluation anyway
+		return 0
+	case *Integer:
+		if obj.Value >= SmallIntMin && obj.Value <= SmallIntMax {
+			// comes from the shared cache
+			return 0
+		}
+		return ObjectHeaderSize
+	case *BigInteger:
+		return ObjectHeaderSize + int64(len(obj.Value.Bits()))*PointerSize
+	case *String:
+		return ObjectHeaderSize + int64(len(obj.Value))
+	case *Array:
+		return ObjectHeaderSize + int64(len(obj.Elements))*PointerSize
+	case *Hash:
+		return ObjectHeaderSize + int64(obj.Len())*HashPairSize
+	default:
+		return ObjectHeaderSize
+	}
+}
@@ -0,0 +1,41 @@
+package object
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// A deferred computation which runs at most once, the first Force runs it
+// and every later one returns the same result
+type Thunk struct {
+	once   sync.Once
+	run    func() Object
+	result Object
+	// Set once result is, so Forced can read it without waiting
+	forced atomic.Bool
+}
+
+func NewThunk(run func() Object) *Thunk {
+	return &Thunk{run: run}
+}
+
+func (t *Thunk) Type() ObjectType { return THUNK_OBJ }
+func (t *Thunk) Inspect() string  { return "lazy" }
+
+// Safe to call from several goroutines, they all wait for the same run
+func (t *Thunk) Force() Object {
+	t.once.Do(func() {
+		t.result = t.run()
+		t.run = nil
+		t.forced.Store(true)
+	})
+	return t.result
+}
+
+// The result of a thunk which was forced already, false otherwise
+func (t *Thunk) Forced() (Object, bool) {
+	if !t.forced.Load() {
+		return nil, false
+	}
+	return t.result, true
+}
@@ -14,36 +14,61 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN  // x = y
+	NULLISH // a ?? b
 	EQUALS
 	LESSGREATER
+	RANGE // 1..10
 	SUM
 	PRODUCT
 	PREFIX
 	CALL
+	INDEX // array[index], foo.bar
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
+	token.ASSIGN:       ASSIGN,
+	token.NULLISH:      NULLISH,
+	token.EQ:           EQUALS,
+	token.NOT_EQ:       EQUALS,
+	token.LT:           LESSGREATER,
+	token.GT:           LESSGREATER,
+	token.RANGE:        RANGE,
+	token.PLUS:         SUM,
+	token.MINUS:        SUM,
+	token.SLASH:        PRODUCT,
+	token.ASTERISK:     PRODUCT,
+	token.LPAREN:       CALL,
+	token.DOT:          INDEX,
+	token.LBRACKET:     INDEX,
+	token.OPTIONAL_DOT: INDEX,
 }
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors []Error
 
 	curToken  token.Token
 	peekToken token.Token
 
+	// One entry per function literal we are in, true for generator functions
+	// Used to only allow yield directly inside of generators
+	functions []bool
+
 	// Hash map to check if a token has a associated parsing function
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// Where the nodes come from, nil allocates every node on its own
+	arena *ast.Arena
+
+	// Every distinct name and string literal of the parse, so repeated ones
+	// share their memory. It goes away with the parser
+	interned map[string]string
+
+	// What the last parentheses enclosed, a chain ends at them, e.g. the
+	// ?. of (h.x?.y).z doesn't skip the .z
+	grouped ast.Expression
 }
 
 // Define types for the Expression parsing
@@ -67,8 +92,9 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 func New(l *lexer.Lexer) *Parser {
 	// Init the lexer in our Parser with the parameter lexer (pointer so the address of the Lexer object)
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:        l,
+		errors:   []Error{},
+		interned: map[string]string{},
 	}
 
 	// Use make to initialize a Hash Table to register different expression parsing functions
@@ -83,6 +109,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.YIELD, p.parseYieldExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
+	p.registerPrefix(token.LAZY, p.parseLazyExpression)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -94,6 +128,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+	p.registerInfix(token.OPTIONAL_DOT, p.parseMemberExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
+	p.registerInfix(token.RANGE, p.parseInfixExpression)
+	p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 
 	// Read two tokens so curToken AND peekToken are set
 	p.nextToken()
@@ -102,39 +142,224 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Like New but takes the nodes from the arena, the same arena can be used
+// for several parsers whose programs are released together
+func NewWithArena(l *lexer.Lexer, arena *ast.Arena) *Parser {
+	p := New(l)
+	p.arena = arena
+	return p
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	lit := p.arena.StringLiteral()
+	lit.Token = p.curToken
+	lit.Value = p.curToken.Literal
+	return lit
+}
+
+// Every embedded expression is parsed by its own parser
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	template := &ast.TemplateLiteral{Token: p.curToken}
+
+	parts, ok := lexer.SplitTemplate(p.curToken.Literal)
+	if !ok {
+		p.error(p.curToken.Pos, "unterminated ${ in string")
+		return nil
+	}
+
+	for _, part := range parts {
+		if !part.Expression {
+			literal := p.intern(part.Literal)
+			text := &ast.StringLiteral{
+				Token: token.Token{Type: token.STRING, Literal: literal},
+				Value: literal,
+			}
+			template.Parts = append(template.Parts, text)
+			continue
+		}
+
+		sub := NewWithArena(lexer.New(part.Literal), p.arena)
+		sub.functions = p.functions
+		sub.interned = p.interned
+		exp := sub.parseExpression(LOWEST)
+
+		if len(sub.Errors()) == 0 && !sub.peekTokenIs(token.EOF) {
+			sub.error(sub.peekToken.Pos, fmt.Sprintf("unexpected %s after expression", sub.peekToken.Type))
+		}
+		// the positions of the sub parser are inside of the ${...}
+		for _, msg := range sub.Errors() {
+			p.error(template.Token.Pos, fmt.Sprintf("in ${%s}: %s", part.Literal, msg))
+		}
+
+		template.Parts = append(template.Parts, exp)
+	}
+
+	return template
+}
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Path = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	return exp
+}
+
+// The member name after the . is always an identifier (e.g. lib.add)
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	p.chain(object)
+	exp := &ast.MemberExpression{
+		Token:    p.curToken,
+		Object:   object,
+		Optional: p.curTokenIs(token.OPTIONAL_DOT),
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Property = p.newIdentifier()
+
+	return exp
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+// Only identifiers can be assigned to
+// The right side is parsed with a lower precedence so a = b = 5 is a = (b = 5)
+func (p *Parser) parseAssignExpression(left ast.Expression) ast.Expression {
+	name, ok := left.(*ast.Identifier)
+	if !ok {
+		msg := fmt.Sprintf("invalid assignment target %s", left.String())
+		p.error(left.Pos(), msg)
+		return nil
+	}
+
+	exp := &ast.AssignExpression{Token: p.curToken, Name: name}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs[key] = value
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	p.chain(left)
+	exp := p.arena.IndexExpression()
+	exp.Token = p.curToken
+	exp.Left = left
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
-	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseCallArguments()
+	p.chain(function)
+	exp := p.arena.CallExpression()
+	exp.Token = p.curToken
+	exp.Function = function
+	exp.Arguments = p.parseExpressionList(token.RPAREN)
 	return exp
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+// Marks a member, index or call expression which another one continues,
+// see ast.Chained. One in parentheses ends its chain
+func (p *Parser) chain(exp ast.Expression) {
+	if exp == p.grouped {
+		return
+	}
+	switch exp := exp.(type) {
+	case *ast.MemberExpression:
+		exp.Chained = true
+	case *ast.IndexExpression:
+		exp.Chained = true
+	case *ast.CallExpression:
+		exp.Chained = true
+	}
+}
 
-	if p.peekTokenIs(token.RPAREN) {
+// Parses comma separated expressions until the end token
+// Used for call arguments and array elements
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		return args
+		return list
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
-	return args
+	return list
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
 	lit := &ast.FunctionLiteral{Token: p.curToken}
 
+	if p.peekTokenIs(token.ASTERISK) {
+		p.nextToken()
+		lit.Generator = true
+	}
+
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
@@ -145,11 +370,47 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
+	p.functions = append(p.functions, lit.Generator)
 	lit.Body = p.parseBlockStatement()
+	p.functions = p.functions[:len(p.functions)-1]
 
 	return lit
 }
 
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	exp := &ast.SpawnExpression{Token: p.curToken}
+
+	p.nextToken()
+	exp.Function = p.parseExpression(PREFIX)
+
+	return exp
+}
+
+// lazy binds like a prefix operator, lazy f(x) defers the call but lazy a + b
+// only defers a, the sum needs lazy (a + b)
+func (p *Parser) parseLazyExpression() ast.Expression {
+	exp := &ast.LazyExpression{Token: p.curToken}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(PREFIX)
+
+	return exp
+}
+
+func (p *Parser) parseYieldExpression() ast.Expression {
+	exp := &ast.YieldExpression{Token: p.curToken}
+
+	if len(p.functions) == 0 || !p.functions[len(p.functions)-1] {
+		p.error(p.curToken.Pos, "yield outside of generator function")
+		return nil
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	identifiers := []*ast.Identifier{}
 
@@ -160,13 +421,13 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident := p.newIdentifier()
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident := p.newIdentifier()
 		identifiers = append(identifiers, ident)
 	}
 
@@ -211,7 +472,8 @@ func (p *Parser) parseIfExpression() ast.Expression {
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
-	block := &ast.BlockStatement{Token: p.curToken}
+	block := p.arena.BlockStatement()
+	block.Token = p.curToken
 	block.Statements = []ast.Statement{}
 
 	p.nextToken()
@@ -223,6 +485,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken.Pos
 
 	return block
 }
@@ -236,22 +499,22 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 		return nil
 	}
 
+	p.grouped = exp
 	return exp
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{
-		Token: p.curToken,
-		Value: p.curTokenIs(token.TRUE),
-	}
+	boolean := p.arena.Boolean()
+	boolean.Token = p.curToken
+	boolean.Value = p.curTokenIs(token.TRUE)
+	return boolean
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
-	expression := &ast.InfixExpression{
-		Token:    p.curToken,
-		Operator: p.curToken.Literal,
-		Left:     left,
-	}
+	expression := p.arena.InfixExpression()
+	expression.Token = p.curToken
+	expression.Operator = p.curToken.Literal
+	expression.Left = left
 
 	precedence := p.curPrecedence()
 	p.nextToken()
@@ -261,10 +524,9 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
-	expression := &ast.PrefixExpression{
-		Token:    p.curToken,
-		Operator: p.curToken.Literal,
-	}
+	expression := p.arena.PrefixExpression()
+	expression.Token = p.curToken
+	expression.Operator = p.curToken.Literal
 
 	// Advance token from the prefix (e.g. -5, from the - to 5)
 	p.nextToken()
@@ -275,14 +537,52 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return expression
 }
 
+// An error of the parser and where in the input it is
+type Error struct {
+	Pos     token.Position
+	Message string
+}
+
+// 3:7: expected next token to be ), got ; instead
+func (e Error) String() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+func (p *Parser) error(pos token.Position, msg string) {
+	p.errors = append(p.errors, Error{Pos: pos, Message: msg})
+}
+
+// The messages of the errors, see Diagnostics for where they are
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Message
+	}
+	return msgs
+}
+
+// The errors with their positions, in the order they were found
+func (p *Parser) Diagnostics() []Error {
 	return p.errors
 }
 
 // Helper function to set the current and next token (similar to position and readPosition in our Lexer)
+// Names and strings are interned so repeated ones share their memory
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	if p.peekToken.Type == token.IDENT || p.peekToken.Type == token.STRING {
+		p.peekToken.Literal = p.intern(p.peekToken.Literal)
+	}
+}
+
+// Returns the copy of s the parse already has
+func (p *Parser) intern(s string) string {
+	if canonical, ok := p.interned[s]; ok {
+		return canonical
+	}
+	p.interned[s] = s
+	return s
 }
 
 // Entry point of our parser, init our AST and set the statements to an empty slice
@@ -301,26 +601,37 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	program.Comments = p.l.Comments()
+
+	// A program with errors may have holes in it, it's not evaluated anyway
+	if len(p.errors) == 0 {
+		resolve(program)
+	}
+
 	return program
 }
 
 // Parse each statement and return it
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.FOR:
+		return p.parseForStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-// Parse a Let Statement (e.g. let x = 5)
+// Parse a Let Statement (e.g. let x = 5) or a Const Statement (e.g. const x = 5)
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	// Creates a new Statement pointer to our LetStatement struct from the AST
-	// Init the Token field (LET token)
-	stmt := &ast.LetStatement{Token: p.curToken}
+	// Init the Token field (LET or CONST token)
+	stmt := p.arena.LetStatement()
+	stmt.Token = p.curToken
+	stmt.Const = p.curTokenIs(token.CONST)
 
 	// Check if next statement is an identifier (e.g. x or foo), if not its not a valid let statement
 	// expectPeek moves to the next token
@@ -330,7 +641,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	// The name which is an Identifier now points to a AST Identifier struct with all fields initialized
 	// Literal would be x or foo etc.
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.newIdentifier()
 
 	// Next Token should be an assign token
 	if !p.expectPeek(token.ASSIGN) {
@@ -341,6 +652,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
+	// Gives functions a name for profiles and error messages
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fl.Name = stmt.Name.Value
+	}
+
 	for p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -350,7 +666,8 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 // Parse return statements
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
-	stmt := &ast.ReturnStatement{Token: p.curToken}
+	stmt := p.arena.ReturnStatement()
+	stmt.Token = p.curToken
 
 	// Advance token to be on the expression after the =
 	p.nextToken()
@@ -364,9 +681,56 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// Parse for-in loops (e.g. for (x in xs) { ... } or for (k, v in hash) { ... })
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = p.newIdentifier()
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = p.newIdentifier()
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	stmt.Body = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 // Parse expression statement
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
-	stmt := &ast.ExpressionStatement{Token: p.curToken}
+	stmt := p.arena.ExpressionStatement()
+	stmt.Token = p.curToken
 
 	stmt.Expression = p.parseExpression(LOWEST)
 
@@ -379,7 +743,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.error(p.curToken.Pos, msg)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -410,16 +774,24 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 // Returns a AST Identifier with the token and its Value
 // DOESNT advance the token
 func (p *Parser) parseIdentifier() ast.Expression {
-	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return p.newIdentifier()
+}
+
+func (p *Parser) newIdentifier() *ast.Identifier {
+	ident := p.arena.Identifier()
+	ident.Token = p.curToken
+	ident.Value = p.curToken.Literal
+	return ident
 }
 
 func (p *Parser) parseIntegerLiteral() ast.Expression {
-	lit := &ast.IntegerLiteral{Token: p.curToken}
+	lit := p.arena.IntegerLiteral()
+	lit.Token = p.curToken
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.error(p.curToken.Pos, msg)
 		return nil
 	}
 	lit.Value = value
@@ -451,7 +823,17 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 // Append an error to our Parser slice
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.error(p.peekToken.Pos, msg)
+}
+
+// The precedence of an infix operator (e.g. SUM for +), LOWEST for all
+// other tokens. Tools which print an AST use it to put back parentheses
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+
+	return LOWEST
 }
 
 // Helper functions for precedences evaluation
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/lexer"
+	"strings"
 	"testing"
+	"unsafe"
 )
 
 func TestReturnStatements(t *testing.T) {
@@ -345,6 +347,78 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"-lib.value * 2",
+			"((-(lib.value)) * 2)",
+		},
+		{
+			"lib.add(1, 2 * 3)",
+			"(lib.add)(1, (2 * 3))",
+		},
+		{
+			"a.b.c + 1",
+			"(((a.b).c) + 1)",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"lib.list[0]",
+			"((lib.list)[0])",
+		},
+		{
+			"a ?? b == c",
+			"(a ?? (b == c))",
+		},
+		{
+			"a ?? b ?? c",
+			"((a ?? b) ?? c)",
+		},
+		{
+			"0..n - 1",
+			"(0 .. (n - 1))",
+		},
+		{
+			"a = b = 1 + 2",
+			"a = b = (1 + 2)",
+		},
+		{
+			"x = y ?? 5",
+			"x = (y ?? 5)",
+		},
+		{
+			"spawn fn() { x }",
+			"spawn fn()x",
+		},
+		{
+			"spawn worker == task",
+			"(spawn worker == task)",
+		},
+		{
+			"lazy a + b * c",
+			"(lazy a + (b * c))",
+		},
+		{
+			"lazy (a + b) * c",
+			"(lazy (a + b) * c)",
+		},
+		{
+			"lazy f(x)[0]",
+			"lazy (f(x)[0])",
+		},
+		{
+			"[1, lazy f(x)]",
+			"[1, lazy f(x)]",
+		},
+		{
+			"user?.address?.city ?? \"unknown\"",
+			"(((user?.address)?.city) ?? unknown)",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -770,3 +844,606 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestImportExpressionParsing(t *testing.T) {
+	input := `import("lib.monkey");`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.ImportExpression. got=%T",
+			stmt.Expression)
+	}
+
+	path, ok := exp.Path.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp.Path is not ast.StringLiteral. got=%T", exp.Path)
+	}
+
+	if path.Value != "lib.monkey" {
+		t.Errorf("path.Value not %q. got=%q", "lib.monkey", path.Value)
+	}
+}
+
+func TestMemberExpressionParsing(t *testing.T) {
+	input := "lib.add"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MemberExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MemberExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Object, "lib") {
+		return
+	}
+
+	if !testIdentifier(t, exp.Property, "add") {
+		return
+	}
+}
+
+func TestParsingArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+// The chain of (a?.b).c ends at the parentheses, the ?. doesn't skip .c
+func TestParenthesesEndTheChain(t *testing.T) {
+	tests := []struct {
+		input   string
+		chained bool
+	}{
+		{"a?.b.c", true},
+		{"(a?.b).c", false},
+		{"(a?.b)[0]", false},
+		{"(a?.b)(1)", false},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		var inner ast.Expression
+		switch exp := program.Statements[0].(*ast.ExpressionStatement).Expression.(type) {
+		case *ast.MemberExpression:
+			inner = exp.Object
+		case *ast.IndexExpression:
+			inner = exp.Left
+		case *ast.CallExpression:
+			inner = exp.Function
+		}
+		if ast.Chained(inner) != tt.chained {
+			t.Errorf("%q: expected chained=%t for %s", tt.input, tt.chained, inner)
+		}
+	}
+}
+
+func TestParsingOptionalMemberExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		optional bool
+	}{
+		{"user.name", false},
+		{"user?.name", true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		exp, ok := stmt.Expression.(*ast.MemberExpression)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.MemberExpression. got=%T",
+				stmt.Expression)
+		}
+
+		if exp.Optional != tt.optional {
+			t.Errorf("exp.Optional not %t. got=%t", tt.optional, exp.Optional)
+		}
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	expected := map[string]int64{
+		"one":   1,
+		"two":   2,
+		"three": 3,
+	}
+
+	for key, value := range hash.Pairs {
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+		}
+
+		expectedValue := expected[literal.String()]
+
+		testIntegerLiteral(t, value, expectedValue)
+	}
+}
+
+func TestParsingEmptyHashLiteral(t *testing.T) {
+	input := "{}"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	tests := map[string]func(ast.Expression){
+		"one": func(e ast.Expression) {
+			testInfixExpression(t, e, 0, "+", 1)
+		},
+		"two": func(e ast.Expression) {
+			testInfixExpression(t, e, 10, "-", 8)
+		},
+		"three": func(e ast.Expression) {
+			testInfixExpression(t, e, 15, "/", 5)
+		},
+	}
+
+	for key, value := range hash.Pairs {
+		literal, ok := key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", key)
+			continue
+		}
+
+		testFunc, ok := tests[literal.String()]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.String())
+			continue
+		}
+
+		testFunc(value)
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedKey      string
+		expectedValue    string
+		expectedIterable string
+	}{
+		{"for (x in xs) { x }", "", "x", "xs"},
+		{"for (k, v in hash) { v };", "k", "v", "hash"},
+		{"for (i in 0..10) { i }", "", "i", "(0 .. 10)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+				len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt not *ast.ForStatement. got=%T", program.Statements[0])
+		}
+
+		if tt.expectedKey == "" {
+			if stmt.Key != nil {
+				t.Errorf("stmt.Key is not nil. got=%q", stmt.Key.String())
+			}
+		} else if !testIdentifier(t, stmt.Key, tt.expectedKey) {
+			return
+		}
+
+		if !testIdentifier(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+
+		if stmt.Iterable.String() != tt.expectedIterable {
+			t.Errorf("stmt.Iterable wrong. want=%q, got=%q",
+				tt.expectedIterable, stmt.Iterable.String())
+		}
+
+		if len(stmt.Body.Statements) != 1 {
+			t.Errorf("stmt.Body.Statements has not 1 statements. got=%d",
+				len(stmt.Body.Statements))
+		}
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	input := "x = 5 + 1;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.AssignExpression. got=%T",
+			stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Name, "x") {
+		return
+	}
+
+	testInfixExpression(t, exp.Value, 5, "+", 1)
+}
+
+func TestInvalidAssignTarget(t *testing.T) {
+	l := lexer.New("1 + 2 = 3")
+	p := New(l)
+	p.ParseProgram()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	if errors[0] != "invalid assignment target (1 + 2)" {
+		t.Errorf("wrong error. got=%q", errors[0])
+	}
+}
+
+func TestGeneratorFunctionParsing(t *testing.T) {
+	input := `fn*(n) { yield n; yield n + 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if !function.Generator {
+		t.Fatalf("function.Generator is not true")
+	}
+
+	if len(function.Body.Statements) != 2 {
+		t.Fatalf("function.Body.Statements has not 2 statements. got=%d",
+			len(function.Body.Statements))
+	}
+
+	bodyStmt := function.Body.Statements[1].(*ast.ExpressionStatement)
+	yield, ok := bodyStmt.Expression.(*ast.YieldExpression)
+	if !ok {
+		t.Fatalf("body stmt is not ast.YieldExpression. got=%T", bodyStmt.Expression)
+	}
+
+	testInfixExpression(t, yield.Value, "n", "+", 1)
+}
+
+func TestYieldOutsideOfGenerator(t *testing.T) {
+	tests := []string{
+		"yield 1",
+		"fn() { yield 1 }",
+		"fn*() { fn() { yield 1 } }",
+	}
+
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != "yield outside of generator function" {
+			t.Errorf("%s: expected yield error. got=%q", input, errors)
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	l := lexer.New("const answer = 42;")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("stmt not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	if !stmt.Const {
+		t.Errorf("stmt.Const is not true")
+	}
+
+	if stmt.TokenLiteral() != "const" {
+		t.Errorf("stmt.TokenLiteral not 'const'. got=%q", stmt.TokenLiteral())
+	}
+
+	if !testIdentifier(t, stmt.Name, "answer") {
+		return
+	}
+
+	testLiteralExpression(t, stmt.Value, 42)
+
+	if stmt.String() != "const answer = 42;" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestTemplateLiteralParsing(t *testing.T) {
+	input := `"sum of ${a} and ${b} is ${a + b}!"`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	template, ok := stmt.Expression.(*ast.TemplateLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.TemplateLiteral. got=%T", stmt.Expression)
+	}
+
+	expected := []string{"sum of ", "a", " and ", "b", " is ", "(a + b)", "!"}
+	if len(template.Parts) != len(expected) {
+		t.Fatalf("wrong number of parts. expected=%d, got=%d",
+			len(expected), len(template.Parts))
+	}
+
+	for i, part := range template.Parts {
+		if part.String() != expected[i] {
+			t.Errorf("part %d wrong. expected=%q, got=%q", i, expected[i], part.String())
+		}
+	}
+
+	testIdentifier(t, template.Parts[1], "a")
+	testInfixExpression(t, template.Parts[5], "a", "+", "b")
+}
+
+func TestTemplateLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"${}"`, "in ${}: no prefix parse function for EOF found"},
+		{`"${a b}"`, "in ${a b}: unexpected IDENT after expression"},
+		{`"${a"`, "unterminated ${ in string"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("%s: wrong errors. expected=%q, got=%q", tt.input, tt.expected, errors)
+		}
+	}
+}
+
+func TestFunctionLiteralName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.LetStatement)
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Errorf("function literal name wrong. want 'myFunction', got=%q", function.Name)
+	}
+}
+
+func TestParseWithArena(t *testing.T) {
+	input := strings.Repeat("let add = fn(a, b) { return a + b * 2; }; add(1, -2)[0];\n", 50)
+
+	plain := New(lexer.New(input)).ParseProgram()
+
+	p := NewWithArena(lexer.New(input), ast.NewArena())
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if program.String() != plain.String() {
+		t.Fatalf("arena program differs.\nwant=%q\ngot=%q", plain.String(), program.String())
+	}
+
+	withoutArena := testing.AllocsPerRun(5, func() {
+		New(lexer.New(input)).ParseProgram()
+	})
+	withArena := testing.AllocsPerRun(5, func() {
+		NewWithArena(lexer.New(input), ast.NewArena()).ParseProgram()
+	})
+	if withArena >= withoutArena {
+		t.Errorf("arena doesn't save allocations. with=%.0f, without=%.0f", withArena, withoutArena)
+	}
+}
+
+// Repeated names and strings of one parse share their memory, another
+// parse has its own copies which go away with it
+func TestInterning(t *testing.T) {
+	input := `let key = "key"; key; "key"`
+	program := New(lexer.New(input)).ParseProgram()
+
+	name := program.Statements[0].(*ast.LetStatement).Name.Value
+	str := program.Statements[0].(*ast.LetStatement).Value.(*ast.StringLiteral).Value
+	use := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.Identifier).Value
+	again := program.Statements[2].(*ast.ExpressionStatement).Expression.(*ast.StringLiteral).Value
+
+	if unsafe.StringData(name) != unsafe.StringData(use) {
+		t.Errorf("the names of one parse don't share memory")
+	}
+	if unsafe.StringData(str) != unsafe.StringData(again) {
+		t.Errorf("the strings of one parse don't share memory")
+	}
+
+	other := New(lexer.New(strings.Clone(input))).ParseProgram()
+	if unsafe.StringData(other.Statements[0].(*ast.LetStatement).Name.Value) == unsafe.StringData(name) {
+		t.Errorf("two parses share their names")
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let = 5;", "1:5: expected next token to be IDENT, got = instead"},
+		{"let x = 1;\nlet y = ;", "2:9: no prefix parse function for ; found"},
+		{"1 + 2 = 3", "1:3: invalid assignment target (1 + 2)"},
+		{"fn() { yield 1 }", "1:8: yield outside of generator function"},
+		{"let s = \"a ${1 1}\";", "1:9: in ${1 1}: unexpected INT after expression"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := diagnostics[0].String(); got != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package parser
+
+import (
+	"monkey/ast"
+)
+
+// The resolver gives every name bound inside a function or loop body a
+// fixed slot, so the evaluator can find it by index instead of looking
+// up the name in a map. Top level names stay unresolved because the REPL
+// and imported modules keep adding to them while the program runs
+type resolver struct {
+	scopes []*scope
+	// Only collecting the lets of the current scope, see hoist
+	hoisting bool
+}
+
+// The bindings of one function call or loop iteration
+type scope struct {
+	names []string
+	slots map[string]int
+}
+
+func resolve(program *ast.Program) {
+	r := &resolver{}
+	for _, stmt := range program.Statements {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolver) push(names []string) *scope {
+	s := &scope{slots: map[string]int{}}
+	for _, name := range names {
+		s.declare(name)
+	}
+	r.scopes = append(r.scopes, s)
+	return s
+}
+
+func (r *resolver) pop() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (s *scope) declare(name string) {
+	if _, ok := s.slots[name]; !ok {
+		s.slots[name] = len(s.names)
+		s.names = append(s.names, name)
+	}
+}
+
+// All lets of a body are declared before anything in it is resolved,
+// otherwise a closure defined above a let would skip over it
+// Lets can hide anywhere in the body (e.g. in an if block) so this walks
+// all of it, except for nested functions and loops which get their own scope
+func (r *resolver) hoist(block *ast.BlockStatement) {
+	r.hoisting = true
+	r.block(block)
+	r.hoisting = false
+}
+
+func (r *resolver) identifier(ident *ast.Identifier) {
+	if r.hoisting {
+		return
+	}
+
+	ident.Resolved = false
+	for depth := 0; depth < len(r.scopes); depth++ {
+		s := r.scopes[len(r.scopes)-1-depth]
+		if index, ok := s.slots[ident.Value]; ok {
+			ident.Resolved = true
+			ident.Depth = depth
+			ident.Index = index
+			return
+		}
+	}
+}
+
+func (r *resolver) block(block *ast.BlockStatement) {
+	if block == nil {
+		return
+	}
+	for _, stmt := range block.Statements {
+		r.statement(stmt)
+	}
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if r.hoisting && len(r.scopes) > 0 {
+			r.scopes[len(r.scopes)-1].declare(stmt.Name.Value)
+		}
+		r.expression(stmt.Value)
+		r.identifier(stmt.Name)
+	case *ast.ReturnStatement:
+		r.expression(stmt.ReturnValue)
+	case *ast.ExpressionStatement:
+		r.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		r.block(stmt)
+	case *ast.ForStatement:
+		// The iterable is evaluated before the loop scope exists
+		r.expression(stmt.Iterable)
+		if r.hoisting {
+			return
+		}
+
+		names := []string{}
+		if stmt.Key != nil {
+			names = append(names, stmt.Key.Value)
+		}
+		names = append(names, stmt.Value.Value)
+
+		s := r.push(names)
+		r.hoist(stmt.Body)
+		if stmt.Key != nil {
+			r.identifier(stmt.Key)
+		}
+		r.identifier(stmt.Value)
+		r.block(stmt.Body)
+		r.pop()
+		stmt.Locals = s.names
+	}
+}
+
+func (r *resolver) expression(exp ast.Expression) {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		r.identifier(exp)
+	case *ast.PrefixExpression:
+		r.expression(exp.Right)
+	case *ast.InfixExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Right)
+	case *ast.IfExpression:
+		r.expression(exp.Condition)
+		r.block(exp.Consequence)
+		r.block(exp.Alternative)
+	case *ast.FunctionLiteral:
+		if r.hoisting {
+			return
+		}
+
+		names := make([]string, len(exp.Parameters))
+		for i, param := range exp.Parameters {
+			names[i] = param.Value
+		}
+
+		s := r.push(names)
+		r.hoist(exp.Body)
+		for _, param := range exp.Parameters {
+			r.identifier(param)
+		}
+		r.block(exp.Body)
+		r.pop()
+		exp.Locals = s.names
+	case *ast.YieldExpression:
+		r.expression(exp.Value)
+	case *ast.SpawnExpression:
+		r.expression(exp.Function)
+	case *ast.LazyExpression:
+		r.expression(exp.Value)
+	case *ast.CallExpression:
+		r.expression(exp.Function)
+		for _, arg := range exp.Arguments {
+			r.expression(arg)
+		}
+	case *ast.TemplateLiteral:
+		for _, part := range exp.Parts {
+			r.expression(part)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range exp.Elements {
+			r.expression(el)
+		}
+	case *ast.IndexExpression:
+		r.expression(exp.Left)
+		r.expression(exp.Index)
+	case *ast.AssignExpression:
+		r.expression(exp.Value)
+		r.identifier(exp.Name)
+	case *ast.HashLiteral:
+		for key, value := range exp.Pairs {
+			r.expression(key)
+			r.expression(value)
+		}
+	case *ast.ImportExpression:
+		r.expression(exp.Path)
+	case *ast.MemberExpression:
+		// the property is a name of the object, not a variable
+		r.expression(exp.Object)
+	}
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"testing"
+)
+
+func TestResolver(t *testing.T) {
+	input := `
+let g = 1;
+let f = fn(a, b) {
+	let c = a;
+	fn(d) { [a, c, d, g] }
+};
+for (i in [1]) { let j = i; j }
+`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	outer := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if got := outer.Locals; len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("wrong locals for outer function. got=%v", got)
+	}
+
+	inner := outer.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	elements := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.ArrayLiteral).Elements
+
+	tests := []struct {
+		resolved bool
+		depth    int
+		index    int
+	}{
+		{true, 1, 0},  // a
+		{true, 1, 2},  // c
+		{true, 0, 0},  // d
+		{false, 0, 0}, // g is a global
+	}
+
+	for i, tt := range tests {
+		ident := elements[i].(*ast.Identifier)
+		if ident.Resolved != tt.resolved || ident.Depth != tt.depth || ident.Index != tt.index {
+			t.Errorf("wrong resolution for %s. want=(%t, %d, %d), got=(%t, %d, %d)",
+				ident.Value, tt.resolved, tt.depth, tt.index,
+				ident.Resolved, ident.Depth, ident.Index)
+		}
+	}
+
+	loop := program.Statements[2].(*ast.ForStatement)
+	if got := loop.Locals; len(got) != 2 || got[0] != "i" || got[1] != "j" {
+		t.Fatalf("wrong locals for loop. got=%v", got)
+	}
+}
+
+// A let further down in the body must still be found by closures above it
+func TestResolverHoisting(t *testing.T) {
+	input := `fn() { let g = fn() { x }; if (true) { let x = 2; } }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if got := fn.Locals; len(got) != 2 || got[0] != "g" || got[1] != "x" {
+		t.Fatalf("wrong locals. got=%v", got)
+	}
+
+	g := fn.Body.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	x := g.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Identifier)
+	if !x.Resolved || x.Depth != 1 || x.Index != 1 {
+		t.Errorf("x not resolved to the outer function. got=(%t, %d, %d)",
+			x.Resolved, x.Depth, x.Index)
+	}
+}
@@ -0,0 +1,477 @@
+package repl
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// A REPL command like :help, they start with a colon so they can't be
+// confused with Monkey code
+type command struct {
+	// e.g. ":load <file>"
+	usage string
+	help  string
+	run   func(r *REPL, args string)
+}
+
+// Filled in init, :help needs to read the map itself
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"help": {
+			usage: ":help",
+			help:  "show this list",
+			run:   (*REPL).help,
+		},
+		"quit": {
+			usage: ":quit",
+			help:  "leave the REPL",
+			run:   func(r *REPL, args string) { r.quit = true },
+		},
+		"reset": {
+			usage: ":reset",
+			help:  "forget everything defined in this session",
+			run: func(r *REPL, args string) {
+				r.reset()
+				fmt.Fprintln(r.out, "session reset")
+			},
+		},
+		"load": {
+			usage: ":load <file>",
+			help:  "run a file in this session, its definitions stay around",
+			run:   (*REPL).load,
+		},
+		"save": {
+			usage: ":save <file>",
+			help:  "write the inputs of this session which worked to a file",
+			run:   (*REPL).save,
+		},
+		"type": {
+			usage: ":type <expr>",
+			help:  "evaluate expr and show the type of the result",
+			run:   (*REPL).showType,
+		},
+		"ast": {
+			usage: ":ast [code]",
+			help:  "show the syntax tree of code or of the last input",
+			run:   (*REPL).showAST,
+		},
+		"bytecode": {
+			usage: ":bytecode [code]",
+			help:  "show the bytecode the compiler makes of code or of the last input",
+			run:   (*REPL).showBytecode,
+		},
+		"engine": {
+			usage: ":engine [evaluator|vm]",
+			help:  "show or switch what runs the inputs, the vm compiles them and has globals of its own",
+			run:   (*REPL).engine,
+		},
+		"tokens": {
+			usage: ":tokens [code]",
+			help:  "show the tokens the lexer makes of code or of the last input",
+			run:   (*REPL).showTokens,
+		},
+		"time": {
+			usage: ":time [expr]",
+			help:  "time expr, or every evaluation until :time is used again",
+			run:   (*REPL).time,
+		},
+		"more": {
+			usage: ":more",
+			help:  "show the next page of a long result",
+			run: func(r *REPL, args string) {
+				if len(r.more) == 0 {
+					r.printError("nothing more to show")
+					return
+				}
+				r.page()
+			},
+		},
+		"doc": {
+			usage: ":doc <name>",
+			help:  "show how a builtin is called and what it does",
+			run:   (*REPL).showDoc,
+		},
+		"undef": {
+			usage: ":undef <name>",
+			help:  "remove a binding of this session",
+			run:   (*REPL).undefine,
+		},
+		"undo": {
+			usage: ":undo",
+			help:  "take back the last input which defined something",
+			run:   (*REPL).undo,
+		},
+		"results": {
+			usage: ":results",
+			help:  "list the results so far, $1 is the first one",
+			run:   (*REPL).listResults,
+		},
+		"env": {
+			usage: ":env",
+			help:  "list the bindings of this session",
+			run:   (*REPL).listBindings,
+		},
+	}
+}
+
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), ":")
+}
+
+// Splits ":load file.monkey" into the command and its arguments and runs it
+func (r *REPL) command(input string) {
+	name, args, _ := strings.Cut(strings.TrimSpace(input)[1:], " ")
+
+	cmd, ok := commands[name]
+	if !ok {
+		r.printError(fmt.Sprintf("unknown command :%s, see :help", name))
+		return
+	}
+
+	cmd.run(r, strings.TrimSpace(args))
+}
+
+func (r *REPL) printError(msg string) {
+	if r.color {
+		msg = colorError + msg + colorReset
+	}
+	fmt.Fprintln(r.errOut, msg)
+}
+
+func (r *REPL) help(args string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s\n", commands[name].usage, commands[name].help)
+	}
+	w.Flush()
+}
+
+// Runs a file as if it was typed in, so its definitions can be tried out
+func (r *REPL) load(path string) {
+	if path == "" {
+		r.printError("usage: :load <file>")
+		return
+	}
+	if r.cfg.Options.Disabled&evaluator.Filesystem != 0 {
+		r.printError(":load is disabled, there is no filesystem access")
+		return
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		r.printError(fmt.Sprintf("could not load %s: %s", path, err))
+		return
+	}
+
+	ctx, stop := r.context()
+	defer stop()
+
+	// The content becomes an input, so :save doesn't depend on the file
+	r.session.CountNodes = false
+	if _, err := r.session.EvalLineContext(ctx, strings.TrimRight(string(source), "\n")); err != nil {
+		r.report(Result{}, err)
+		return
+	}
+
+	fmt.Fprintf(r.out, "loaded %s\n", path)
+}
+
+func (r *REPL) save(path string) {
+	if path == "" {
+		r.printError("usage: :save <file>")
+		return
+	}
+	if r.cfg.Options.Disabled&evaluator.Filesystem != 0 {
+		r.printError(":save is disabled, there is no filesystem access")
+		return
+	}
+
+	content, err := r.session.Script()
+	if err != nil {
+		r.printError(fmt.Sprintf("can't save the session: %s", err))
+		return
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		r.printError(fmt.Sprintf("could not save %s: %s", path, err))
+		return
+	}
+
+	fmt.Fprintf(r.out, "saved %d inputs to %s\n", len(r.session.Inputs()), path)
+}
+
+func (r *REPL) showType(source string) {
+	if source == "" {
+		r.printError("usage: :type <expr>")
+		return
+	}
+
+	result, err := r.evaluate(source)
+	if err != nil {
+		r.report(result, err)
+		return
+	}
+	if result.Value == nil {
+		fmt.Fprintln(r.out, "no value, only expressions have a type")
+		return
+	}
+
+	fmt.Fprintln(r.out, describeType(result.Value))
+}
+
+// The type together with what's most interesting about it, e.g. the
+// parameters of a function or the length of an array
+func describeType(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Function:
+		params := make([]string, len(obj.Parameters))
+		for i, param := range obj.Parameters {
+			params[i] = param.Value
+		}
+		fn := "fn"
+		if obj.Generator {
+			fn = "fn*"
+		}
+		return fmt.Sprintf("%s(%s(%s))", obj.Type(), fn, strings.Join(params, ", "))
+	case *object.Array:
+		return fmt.Sprintf("%s[%d]", obj.Type(), len(obj.Elements))
+	case *object.Hash:
+		return fmt.Sprintf("%s{%d}", obj.Type(), obj.Len())
+	case *object.String:
+		return fmt.Sprintf("%s(%d)", obj.Type(), len(obj.Value))
+	default:
+		return string(obj.Type())
+	}
+}
+
+// Bindings come first, they shadow the builtins of the same name
+func (r *REPL) showDoc(name string) {
+	if name == "" {
+		r.printError("usage: :doc <name>")
+		return
+	}
+
+	if obj, ok := r.session.Env().Get(name); ok {
+		fn, ok := obj.(*object.Function)
+		if !ok {
+			r.printError(fmt.Sprintf("%s is a %s, not a function", name, obj.Type()))
+			return
+		}
+		params := make([]string, len(fn.Parameters))
+		for i, param := range fn.Parameters {
+			params[i] = param.Value
+		}
+		fmt.Fprintf(r.out, "%s(%s)\n  defined in Monkey, there is no documentation\n", name, strings.Join(params, ", "))
+		return
+	}
+
+	builtins := r.cfg.Options.Builtins
+	if builtins == nil {
+		builtins = object.DefaultBuiltins
+	}
+	if builtin, ok := builtins.Lookup(name); ok {
+		if builtin.Usage == "" {
+			fmt.Fprintf(r.out, "%s\n  a builtin without documentation\n", name)
+			return
+		}
+		fmt.Fprintf(r.out, "%s\n  %s\n", builtin.Usage, builtin.Doc)
+		return
+	}
+
+	if usage, doc, capability, ok := evaluator.SystemBuiltinDoc(name); ok {
+		fmt.Fprintf(r.out, "%s\n  %s\n  needs %s access\n", usage, doc, capability)
+		return
+	}
+
+	r.printError(fmt.Sprintf("%s is neither a builtin nor bound in this session", name))
+}
+
+// Only parses, nothing is evaluated
+func (r *REPL) showAST(source string) {
+	if source == "" {
+		source = r.last
+	}
+	if source == "" {
+		r.printError("nothing entered yet, use :ast <code>")
+		return
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		r.printParserErrors(p.Errors())
+		return
+	}
+
+	fmt.Fprintln(r.out, ast.Sexp(program))
+}
+
+// Compiles without running it, names of earlier inputs show up as
+// globals
+func (r *REPL) showBytecode(source string) {
+	if source == "" {
+		source = r.last
+	}
+	if source == "" {
+		r.printError("nothing entered yet, use :bytecode <code>")
+		return
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		r.printParserErrors(p.Errors())
+		return
+	}
+
+	// the names of the session are globals the snippet can use
+	comp := compiler.NewWithOptions(compiler.Options{
+		Globals:  r.session.Env().Names(),
+		Builtins: evaluator.BuiltinsWithSystem(r.session.Options.Builtins, r.session.Options),
+	})
+	if err := comp.Compile(program); err != nil {
+		r.printError(err.Error())
+		return
+	}
+	compiler.Disassemble(r.out, comp.Bytecode())
+}
+
+// One token per line with its line:column, type and literal
+func (r *REPL) showTokens(source string) {
+	if source == "" {
+		source = r.last
+	}
+	if source == "" {
+		r.printError("nothing entered yet, use :tokens <code>")
+		return
+	}
+
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	l := lexer.New(source)
+	for {
+		tok := l.NextToken()
+		start, _ := l.Span()
+		line, column := position(source, start)
+		fmt.Fprintf(w, "%d:%d\t%s\t%q\n", line, column, tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	w.Flush()
+}
+
+// The 1-based line and column of offset in source
+func position(source string, offset int) (line, column int) {
+	before := source[:offset]
+	line = strings.Count(before, "\n") + 1
+	column = offset - strings.LastIndex(before, "\n")
+	return line, column
+}
+
+func (r *REPL) engine(name string) {
+	if name == "" {
+		fmt.Fprintf(r.out, "inputs run on the %s\n", r.session.Engine)
+		return
+	}
+	engine, ok := ParseEngine(name)
+	if !ok {
+		r.printError(fmt.Sprintf("unknown engine %s, use evaluator or vm", name))
+		return
+	}
+	r.session.Engine = engine
+	fmt.Fprintf(r.out, "inputs run on the %s\n", engine)
+}
+
+func (r *REPL) time(source string) {
+	if source != "" {
+		timing := r.timing
+		r.timing = true
+		r.eval(source)
+		r.timing = timing
+		return
+	}
+
+	r.timing = !r.timing
+	if r.timing {
+		fmt.Fprintln(r.out, "timing on")
+	} else {
+		fmt.Fprintln(r.out, "timing off")
+	}
+}
+
+// Values are put on one line and cut off, a function body can be long
+func (r *REPL) listBindings(args string) {
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	scope := r.session.Env()
+	for _, name := range scope.LocalNames() {
+		// :results lists those
+		if strings.HasPrefix(name, "$") {
+			continue
+		}
+		value, _ := scope.Get(name)
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, value.Type(), summarize(value.Inspect(), 60))
+	}
+	w.Flush()
+}
+
+func (r *REPL) undefine(name string) {
+	if name == "" {
+		r.printError("usage: :undef <name>")
+		return
+	}
+	if !r.session.Undefine(name) {
+		r.printError(fmt.Sprintf("%s isn't defined in this session", name))
+		return
+	}
+	fmt.Fprintf(r.out, "removed %s\n", name)
+}
+
+func (r *REPL) undo(args string) {
+	input, ok := r.session.Undo()
+	if !ok {
+		r.printError("nothing to undo")
+		return
+	}
+	fmt.Fprintf(r.out, "undid %s\n", summarize(input, 60))
+}
+
+func (r *REPL) listResults(args string) {
+	results := r.session.Results()
+	if len(results) == 0 {
+		fmt.Fprintln(r.out, "no results yet")
+		return
+	}
+
+	w := tabwriter.NewWriter(r.out, 0, 0, 2, ' ', 0)
+	for i, value := range results {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", resultName(i+1), value.Type(), summarize(value.Inspect(), 60))
+	}
+	w.Flush()
+}
+
+// Collapses the whitespace of text and shortens it to at most max characters
+func summarize(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max-3]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,329 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		contains []string
+		missing  []string
+	}{
+		{":help\n", []string{":env", ":help", ":quit", ":reset"}, nil},
+		{":quit\n1 + 1\n", nil, []string{"2"}},
+		{"let x = 1;\n:reset\nx\n", []string{"session reset", "identifier not found: x"}, nil},
+		{"let x = 1;\nlet s = \"hi\";\n:env\n", []string{"s  STRING   hi", "x  INTEGER  1"}, nil},
+		{":nope\n", []string{"unknown command :nope, see :help"}, nil},
+		{"1 + 1\n\"hi\"\n:results\n", []string{"$1  INTEGER  2\n$2  STRING   hi\n"}, nil},
+		{":results\n", []string{"no results yet"}, nil},
+		{"let x = 1;\n:undef x\nx\n", []string{"removed x", "identifier not found: x"}, nil},
+		{":undef len\n", []string{"len isn't defined in this session"}, nil},
+		{"let x = 1;\nlet x = 2;\n:undo\nx\n", []string{"undid let x = 2;\n>> 1\n"}, nil},
+		{":undo\n", []string{"nothing to undo"}, nil},
+		{"1 + 1\n:env\n", []string{"_  INTEGER  2"}, []string{"$1"}},
+		{"  :env  \n", nil, []string{"parser errors"}},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		for _, want := range tt.contains {
+			if !strings.Contains(got, want) {
+				t.Errorf("output of %q misses %q. got=%q", tt.input, want, got)
+			}
+		}
+		for _, unwanted := range tt.missing {
+			if strings.Contains(got, unwanted) {
+				t.Errorf("output of %q should not contain %q. got=%q", tt.input, unwanted, got)
+			}
+		}
+	}
+}
+
+func TestDocCommand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":doc len\n", "len(x)\n  The number of characters of a string, elements of an array or pairs of a hash\n"},
+		{":doc readFile\n", "readFile(path)\n  The content of the file as a string\n  needs filesystem access\n"},
+		{"let add = fn(a, b) { a + b };\n:doc add\n", "add(a, b)\n  defined in Monkey, there is no documentation\n"},
+		{"let x = 1;\n:doc x\n", "x is a INTEGER, not a function\n"},
+		{":doc nope\n", "nope is neither a builtin nor bound in this session\n"},
+		{":doc\n", "usage: :doc <name>\n"},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		if !strings.Contains(got, tt.expected) {
+			t.Errorf("output of %q misses %q. got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		input    string
+		max      int
+		expected string
+	}{
+		{"short", 10, "short"},
+		{"fn(x) {\n  x\n}", 20, "fn(x) { x }"},
+		{"a very long value", 10, "a very ..."},
+	}
+
+	for _, tt := range tests {
+		if got := summarize(tt.input, tt.max); got != tt.expected {
+			t.Errorf("summarize(%q, %d) wrong. expected=%q, got=%q", tt.input, tt.max, tt.expected, got)
+		}
+	}
+}
+
+func TestLoadCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lib.monkey")
+	source := "let square = fn(x) { x * x };\nlet answer = square(7);\n"
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(t.TempDir(), "broken.monkey")
+	if err := os.WriteFile(broken, []byte("let x = 1;\nx + true;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		contains []string
+	}{
+		{":load " + path + "\nanswer + square(2)\n", []string{"loaded " + path, "53"}},
+		{":load " + broken + "\nx\n", []string{"ERROR: type mismatch: INTEGER + BOOLEAN", "identifier not found: x"}},
+		{":load missing.monkey\n", []string{"could not load missing.monkey"}},
+		{":load\n", []string{"usage: :load <file>"}},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		for _, want := range tt.contains {
+			if !strings.Contains(got, want) {
+				t.Errorf("output of %q misses %q. got=%q", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestSaveCommand(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.monkey")
+	if err := os.WriteFile(lib, []byte("let double = fn(x) { x * 2 };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "session.monkey")
+
+	input := "let a = 1;\nlet = 2\n:load " + lib + "\na + true\nlet f = fn(x) {\n  double(x) + a\n};\n:save " + path + "\n"
+	got := runRepl(input)
+	if !strings.Contains(got, "saved 3 inputs to "+path) {
+		t.Fatalf("save not confirmed. got=%q", got)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "let a = 1;\nlet double = fn(x) { x * 2 };\nlet f = fn(x) {\n  double(x) + a\n};\n"
+	if string(content) != expected {
+		t.Errorf("wrong saved session. expected=%q, got=%q", expected, string(content))
+	}
+
+	// the saved script runs on its own
+	got = runRepl(":load " + path + "\nf(5)\n")
+	if !strings.Contains(got, "11\n") {
+		t.Errorf("saved session does not run. got=%q", got)
+	}
+}
+
+func TestSaveCommandKeepsTheInputsApart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.monkey")
+
+	// every input ends up a statement of its own, a removed let is gone
+	input := "1+1\n[1,2,3]\nlet a = 1\nlet b = 2 // two\n:undef a\n:save " + path + "\n"
+	got := runRepl(input)
+	if !strings.Contains(got, "saved 3 inputs to "+path) {
+		t.Fatalf("save not confirmed. got=%q", got)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "1+1;\n[1,2,3];\nlet b = 2 // two\n;\n"
+	if string(content) != expected {
+		t.Errorf("wrong saved session. expected=%q, got=%q", expected, string(content))
+	}
+	got = runRepl(":load " + path + "\nb + 1\n")
+	if !strings.Contains(got, "loaded "+path) || !strings.Contains(got, "3\n") {
+		t.Errorf("saved session does not load. got=%q", got)
+	}
+
+	// inputs which would mean something else in the file aren't saved
+	refused := []struct {
+		input    string
+		expected string
+	}{
+		{"1\n$1 + 1\n", `"$1 + 1" uses $1, the value of an earlier input`},
+		{"1\n_ * 2\n", `"_ * 2" uses _, the value of an earlier input`},
+		{"let a = 1; let b = 2;\n:undef a\n", `uses a, which was removed`},
+	}
+	for _, tt := range refused {
+		os.Remove(path)
+		got := runRepl(tt.input + ":save " + path + "\n")
+		if !strings.Contains(got, "can't save the session: ") || !strings.Contains(got, tt.expected) {
+			t.Errorf("save of %q not refused with %q. got=%q", tt.input, tt.expected, got)
+		}
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("save of %q wrote the file anyway", tt.input)
+		}
+	}
+}
+
+func TestTypeCommand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":type 1 + 2\n", "INTEGER\n"},
+		{":type fn(x, y) { x + y }\n", "FUNCTION(fn(x, y))\n"},
+		{":type [1, 2, 3]\n", "ARRAY[3]\n"},
+		{`:type {"a": 1}` + "\n", "HASH{1}\n"},
+		{`:type "monkey"` + "\n", "STRING(6)\n"},
+		{":type len\n", "BUILTIN\n"},
+		{":type 1..3\n", "RANGE\n"},
+		{":type let x = 1;\n", "no value, only expressions have a type\n"},
+		{":type y\n", "ERROR: identifier not found: y\n"},
+		{":type\n", "usage: :type <expr>\n"},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		if !strings.Contains(got, tt.expected) {
+			t.Errorf("output of %q wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestASTCommand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":ast 1 + 2 * 3\n", "(program (+ 1 (* 2 3)))\n"},
+		{":ast let x = -a[0];\n", "(program (let x (- (index a 0))))\n"},
+		{"let y = 5;\n:ast\n", "(program (let y 5))\n"},
+		{"let add = fn(a,\nb) { a + b };\n:ast\n", "(program (let add (fn (a b) (block (+ a b)))))\n"},
+		{":ast\n", "nothing entered yet, use :ast <code>\n"},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		if !strings.Contains(got, tt.expected) {
+			t.Errorf("output of %q wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// :ast doesn't evaluate anything
+	got := runRepl(":ast let z = 1;\nz\n")
+	if !strings.Contains(got, "identifier not found: z") {
+		t.Errorf(":ast should not evaluate. got=%q", got)
+	}
+}
+
+func TestBytecodeCommand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":bytecode 1 + 2\n", "  0000 OpConstant 0           ; 1\n  0003 OpConstant 1           ; 2\n  0006 OpAdd\n  0007 OpPop\n"},
+		{"let y = 5;\n:bytecode\n", "  0003 OpSetGlobal 0          ; y\n"},
+		// a name of the session isn't undefined
+		{"let y = 5;\n:bytecode y\n", "  0000 OpGetGlobal 0          ; y\n"},
+		{":bytecode nope\n", "undefined variable nope"},
+		{":bytecode import(\"x\")\n", "compiling ImportExpression is not supported yet"},
+		{":bytecode\n", "nothing entered yet, use :bytecode <code>\n"},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		if !strings.Contains(got, tt.expected) {
+			t.Errorf("output of %q wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// :bytecode doesn't evaluate anything
+	got := runRepl(":bytecode let z = 1;\nz\n")
+	if !strings.Contains(got, "identifier not found: z") {
+		t.Errorf(":bytecode should not evaluate. got=%q", got)
+	}
+}
+
+func TestTokensCommand(t *testing.T) {
+	got := runRepl(":tokens let x = \"hi\";\n")
+	expected := `1:1   LET     "let"
+1:5   IDENT   "x"
+1:7   =       "="
+1:9   STRING  "hi"
+1:13  ;       ";"
+1:14  EOF     ""
+`
+	if !strings.Contains(got, expected) {
+		t.Errorf("wrong tokens. expected=%q, got=%q", expected, got)
+	}
+
+	got = runRepl("[1,\n  2]\n:tokens\n")
+	if !strings.Contains(got, "2:3  INT  \"2\"") {
+		t.Errorf("tokens of the last input have wrong positions. got=%q", got)
+	}
+}
+
+func TestTimeCommand(t *testing.T) {
+	took := regexp.MustCompile(`took [0-9.]+[µnm]?s, (\d+) nodes\n`)
+
+	got := runRepl(":time 1 + 2\n1 + 2\n")
+	if matches := took.FindAllStringSubmatch(got, -1); len(matches) != 1 || matches[0][1] != "5" {
+		t.Errorf(":time expr should time exactly one evaluation of 5 nodes. got=%q", got)
+	}
+	if !strings.Contains(got, "3\ntook") {
+		t.Errorf("the result should come before the time. got=%q", got)
+	}
+
+	got = runRepl(":time\n1\n2\n:time\n3\n")
+	if !strings.Contains(got, "timing on") || !strings.Contains(got, "timing off") {
+		t.Errorf("toggling not confirmed. got=%q", got)
+	}
+	if matches := took.FindAllString(got, -1); len(matches) != 2 {
+		t.Errorf("expected 2 timed evaluations, got %d. output=%q", len(matches), got)
+	}
+}
+
+func TestEngineCommand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{":engine\n", []string{"inputs run on the evaluator\n"}},
+		{":engine vm\nlet a = 2;\na * 3\n", []string{"inputs run on the vm\n", "6\n"}},
+		{":engine rust\n", []string{"unknown engine rust, use evaluator or vm\n"}},
+		{"let a = 1;\n:engine vm\na\n", []string{"undefined variable a"}},
+		{":engine vm\n:time 1 + 2\n", []string{"3\ntook "}},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		for _, expected := range tt.expected {
+			if !strings.Contains(got, expected) {
+				t.Errorf("%q: expected output to contain %q. got=%q", tt.input, expected, got)
+			}
+		}
+	}
+}
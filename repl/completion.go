@@ -0,0 +1,83 @@
+package repl
+
+import (
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// Finds the words the word in front of the cursor could be completed to
+// It only works on the text, so any frontend (a terminal, an editor
+// plugin, the tests) can use it
+type Completer interface {
+	// pos is the cursor position in line, returns the whole candidate
+	// words and where the word they replace starts
+	Complete(line []rune, pos int) (candidates []string, start int)
+}
+
+// Completes keywords, builtins and everything bound in env, env is read
+// on every completion so new lets show up right away
+func NewCompleter(env *object.Environment) Completer {
+	return &envCompleter{env: env}
+}
+
+type envCompleter struct {
+	env *object.Environment
+}
+
+func (c *envCompleter) Complete(line []rune, pos int) ([]string, int) {
+	start := pos
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+
+	// The property of a member expression is a name of the module, not of env
+	if start > 0 && line[start-1] == '.' {
+		return nil, start
+	}
+
+	prefix := string(line[start:pos])
+	if prefix == "" {
+		return nil, start
+	}
+
+	seen := map[string]bool{}
+	candidates := []string{}
+	add := func(names []string) {
+		for _, name := range names {
+			if strings.HasPrefix(name, prefix) && !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	add(token.Keywords())
+	add(object.DefaultBuiltins.Names())
+	add(evaluator.SystemBuiltinNames())
+	add(c.env.Names())
+	sort.Strings(candidates)
+
+	return candidates, start
+}
+
+// Identifiers are made of ASCII letters and underscores, see the lexer
+func isWordRune(r rune) bool {
+	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r == '_'
+}
+
+// The longest prefix all candidates share
+func commonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
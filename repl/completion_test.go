@@ -0,0 +1,69 @@
+package repl
+
+import (
+	"io"
+	"monkey/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompleter(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("counter", object.NewInteger(1))
+	env.Set("count_all", object.NewInteger(2))
+	completer := NewCompleter(object.NewEnclosedEnvironment(env))
+
+	tests := []struct {
+		line       string
+		expected   []string
+		startIndex int
+	}{
+		{"le", []string{"len", "let"}, 0},
+		{"let x = cou", []string{"count_all", "counter"}, 8},
+		{"pu", []string{"push", "puts"}, 0},
+		{"readF", []string{"readFile"}, 0},
+		{"1 + ", nil, 4},
+		{"math.le", nil, 5},
+		{"xyz", []string{}, 0},
+	}
+
+	for _, tt := range tests {
+		line := []rune(tt.line)
+		candidates, start := completer.Complete(line, len(line))
+		if !reflect.DeepEqual(candidates, tt.expected) {
+			t.Errorf("Complete(%q) wrong candidates. expected=%v, got=%v", tt.line, tt.expected, candidates)
+		}
+		if start != tt.startIndex {
+			t.Errorf("Complete(%q) wrong start. expected=%d, got=%d", tt.line, tt.startIndex, start)
+		}
+	}
+}
+
+func TestLineEditorCompletion(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("counter", object.NewInteger(1))
+	env.Set("count_all", object.NewInteger(2))
+
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"cou\te\t\r", "counter"},
+		{"pus\t(x)\r", "push(x)"},
+		{"\tx\r", "\tx"},
+		{"(le)\x1b[D\tn\r", "(len)"},
+	}
+
+	for _, tt := range tests {
+		e := NewLineEditor(strings.NewReader(tt.keys), io.Discard)
+		e.SetCompleter(NewCompleter(env))
+		got, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) returned error: %s", tt.keys, err)
+		}
+		if got != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. expected=%q, got=%q", tt.keys, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package repl
+
+import (
+	"monkey/lexer"
+	"monkey/token"
+	"strings"
+)
+
+// One level of indentation for every bracket which is still open
+const INDENT = "  "
+
+// Reports whether the input has more opening than closing parens, braces
+// or brackets, the user is then still typing e.g. a function body
+func isIncomplete(input string) bool {
+	return openBrackets(input) > 0
+}
+
+// The number of parens, braces and brackets which aren't closed yet
+// Brackets inside of strings are part of the STRING token, so they don't count
+func openBrackets(input string) int {
+	l := lexer.New(input)
+	depth := 0
+
+	for {
+		tok := l.NextToken()
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		case token.EOF:
+			return depth
+		}
+	}
+}
+
+// The indentation the next line of an unfinished input starts with, so
+// a function body is indented while it's typed
+func indentation(input string) string {
+	depth := openBrackets(input)
+	if depth <= 0 {
+		return ""
+	}
+	return strings.Repeat(INDENT, depth)
+}
@@ -0,0 +1,101 @@
+package repl
+
+import (
+	"io"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/token"
+	"os"
+	"strings"
+)
+
+// ANSI escape codes for the colors of the REPL
+const (
+	colorReset   = "\x1b[0m"
+	colorKeyword = "\x1b[35m"
+	colorNumber  = "\x1b[36m"
+	colorString  = "\x1b[32m"
+	colorComment = "\x1b[90m"
+	colorError   = "\x1b[31m"
+)
+
+// Reports whether out is a terminal which should get colors, a file or
+// pipe gets plain text and so does everything when NO_COLOR is set
+func ColorTerminal(out io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := out.(*os.File)
+	return ok && isTerminal(int(f.Fd()))
+}
+
+// Reports whether in is a terminal someone types into, a pipe or a file
+// (e.g. echo 'puts(1 + 2)' | monkey) is run as a program instead
+func Interactive(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	return ok && isTerminal(int(f.Fd()))
+}
+
+// Colors keywords, numbers, strings and comments of the source, everything
+// else (and the whitespace in between) is kept as it is
+func Highlight(input string) string {
+	var b strings.Builder
+	l := lexer.New(input)
+	last := 0
+
+	for {
+		tok := l.NextToken()
+		start, end := l.Span()
+		highlightGap(&b, input[last:start])
+		if tok.Type == token.EOF {
+			break
+		}
+
+		text := input[start:end]
+		switch {
+		case tok.Type == token.INT:
+			b.WriteString(colorNumber + text + colorReset)
+		case tok.Type == token.STRING || tok.Type == token.TEMPLATE:
+			b.WriteString(colorString + text + colorReset)
+		case tok.Type != token.IDENT && token.LookupIdent(tok.Literal) == tok.Type:
+			b.WriteString(colorKeyword + text + colorReset)
+		default:
+			b.WriteString(text)
+		}
+		last = end
+	}
+
+	return b.String()
+}
+
+// Between two tokens there is only whitespace and comments
+func highlightGap(b *strings.Builder, gap string) {
+	for {
+		i := strings.Index(gap, "//")
+		if i < 0 {
+			b.WriteString(gap)
+			return
+		}
+
+		end := strings.IndexByte(gap[i:], '\n')
+		if end < 0 {
+			end = len(gap) - i
+		}
+		b.WriteString(gap[:i])
+		b.WriteString(colorComment + gap[i:i+end] + colorReset)
+		gap = gap[i+end:]
+	}
+}
+
+// Errors are red, strings are shown as they are and everything else
+// looks like the literal it was written as
+func highlightResult(obj object.Object, p PrettyPrinter) string {
+	switch obj := obj.(type) {
+	case *object.Error:
+		return colorError + obj.Inspect() + colorReset
+	case *object.String:
+		return colorString + obj.Inspect() + colorReset
+	default:
+		return Highlight(p.Format(obj))
+	}
+}
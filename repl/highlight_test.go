@@ -0,0 +1,49 @@
+package repl
+
+import (
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5;", colorKeyword + "let" + colorReset + " x = " + colorNumber + "5" + colorReset + ";"},
+		{`puts("hi")`, "puts(" + colorString + `"hi"` + colorReset + ")"},
+		{"fn(a) { true }", colorKeyword + "fn" + colorReset + "(a) { " + colorKeyword + "true" + colorReset + " }"},
+		{"x // note\ny", "x " + colorComment + "// note" + colorReset + "\ny"},
+		{`"open`, colorString + `"open` + colorReset},
+	}
+
+	for _, tt := range tests {
+		if got := Highlight(tt.input); got != tt.expected {
+			t.Errorf("Highlight(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHighlightResult(t *testing.T) {
+	tests := []struct {
+		obj      object.Object
+		expected string
+	}{
+		{object.NewInteger(5), colorNumber + "5" + colorReset},
+		{&object.String{Value: "let"}, colorString + "let" + colorReset},
+		{&object.Error{Message: "boom"}, colorError + "ERROR: boom" + colorReset},
+	}
+
+	for _, tt := range tests {
+		if got := highlightResult(tt.obj, DefaultPrettyPrinter); got != tt.expected {
+			t.Errorf("highlightResult(%s) wrong. expected=%q, got=%q", tt.obj.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestInteractive(t *testing.T) {
+	if Interactive(strings.NewReader("puts(1)")) {
+		t.Errorf("a strings.Reader is not interactive")
+	}
+}
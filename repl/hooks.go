@@ -0,0 +1,136 @@
+package repl
+
+import (
+	"fmt"
+	"monkey/object"
+	"sort"
+	"strings"
+)
+
+// The functions the rc file registered through the repl module, e.g.
+//
+//	repl.prompt(fn() { str(len(keys(counts))) + "> " })
+//	repl.format(fn(value) { "=> " + str(value) })
+//	repl.complete(fn(prefix) { ["banana", "bandana"] })
+//
+// A hook which fails is removed again, the REPL falls back to its default
+type hooks struct {
+	// Returns the prompt
+	prompt object.Object
+	// Gets a result and returns the text to print for it
+	format object.Object
+	// Gets the word in front of the cursor and returns more candidates
+	complete object.Object
+}
+
+// The repl module every session can use, :reset forgets the hooks since
+// the rc file registers them again
+func (r *REPL) api() *object.Module {
+	env := object.NewEnvironment()
+	register := func(name string, hook *object.Object) {
+		env.SetConst(name, &object.Builtin{
+			Usage: "repl." + name + "(fn)",
+			Fn: func(args ...object.Object) object.Object {
+				if len(args) != 1 {
+					return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want=1", len(args))}
+				}
+				switch args[0].Type() {
+				case object.FUNCTION_OBJ, object.BUILTIN_OBJ:
+					*hook = args[0]
+				case object.NULL_OBJ:
+					*hook = nil
+				default:
+					return &object.Error{Message: fmt.Sprintf("argument to `repl.%s` must be FUNCTION, got %s", name, args[0].Type())}
+				}
+				return object.NULL
+			},
+		})
+	}
+	register("prompt", &r.hooks.prompt)
+	register("format", &r.hooks.format)
+	register("complete", &r.hooks.complete)
+
+	return &object.Module{Name: "repl", Env: env}
+}
+
+// Calls a hook and expects a value of the type want back, a failing hook
+// is reported and removed
+func (r *REPL) callHook(name string, hook *object.Object, want object.ObjectType, args ...object.Object) (object.Object, bool) {
+	ctx, stop := r.context()
+	defer stop()
+
+	result, err := r.session.Call(ctx, *hook, args...)
+	if err == nil && result.Type() != want {
+		err = fmt.Errorf("it returned %s instead of %s", result.Type(), want)
+	}
+	if err != nil {
+		*hook = nil
+		r.printError(fmt.Sprintf("the %s hook failed and is removed: %s", name, err))
+		return nil, false
+	}
+	return result, true
+}
+
+func (r *REPL) prompt() string {
+	if r.hooks.prompt == nil {
+		return r.cfg.Prompt
+	}
+	if result, ok := r.callHook("prompt", &r.hooks.prompt, object.STRING_OBJ); ok {
+		return result.(*object.String).Value
+	}
+	return r.cfg.Prompt
+}
+
+// The text of a result, false when the REPL should format it itself
+func (r *REPL) format(obj object.Object) (string, bool) {
+	if r.hooks.format == nil || obj.Type() == object.ERROR_OBJ {
+		return "", false
+	}
+	if result, ok := r.callHook("format", &r.hooks.format, object.STRING_OBJ, obj); ok {
+		return result.(*object.String).Value, true
+	}
+	return "", false
+}
+
+// Adds the candidates of the complete hook to the usual ones
+type hookCompleter struct {
+	Completer
+	r *REPL
+}
+
+func (c *hookCompleter) Complete(line []rune, pos int) ([]string, int) {
+	candidates, start := c.Completer.Complete(line, pos)
+	prefix := string(line[start:pos])
+	if c.r.hooks.complete == nil || prefix == "" {
+		return candidates, start
+	}
+
+	// Errors can't be printed in the middle of the line, the hook just
+	// doesn't add anything then
+	ctx, stop := c.r.context()
+	defer stop()
+	result, err := c.r.session.Call(ctx, c.r.hooks.complete, &object.String{Value: prefix})
+	arr, ok := result.(*object.Array)
+	if err != nil || !ok {
+		return candidates, start
+	}
+
+	for _, el := range arr.Elements {
+		str, ok := el.(*object.String)
+		if ok && strings.HasPrefix(str.Value, prefix) && !contains(candidates, str.Value) {
+			candidates = append(candidates, str.Value)
+		}
+	}
+	sort.Strings(candidates)
+
+	return candidates, start
+}
+
+func contains(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
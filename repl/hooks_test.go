@@ -0,0 +1,77 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newHookREPL(t *testing.T, rc, input string, out *strings.Builder) *REPL {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "monkeyrc")
+	if err := os.WriteFile(path, []byte(rc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return New(Config{Reader: strings.NewReader(input), Writer: out, RCFile: path})
+}
+
+func TestHooks(t *testing.T) {
+	tests := []struct {
+		rc       string
+		input    string
+		expected string
+	}{
+		{
+			`let n = 0; repl.prompt(fn() { n = n + 1; str(n) + "> " });`,
+			"1\n2\n",
+			"1> 1\n2> 2\n3> ",
+		},
+		{
+			`repl.format(fn(value) { "=> " + str(value) });`,
+			"[1, 2]\nlet x = 1;\nnope\n",
+			">> => [1, 2]\n>> >> ERROR: identifier not found: nope\n>> ",
+		},
+		{
+			`repl.prompt(fn() { 1 });`,
+			"1\n",
+			"the prompt hook failed and is removed: it returned INTEGER instead of STRING\n>> 1\n>> ",
+		},
+		{
+			`repl.format(fn() { "no parameter" });`,
+			"1\n2\n",
+			">> the format hook failed and is removed: wrong number of arguments: want=0, got=1\n1\n>> 2\n>> ",
+		},
+		{
+			`repl.prompt(fn() { "$ " });`,
+			"1\n:reset\n2\n",
+			"$ 1\n$ session reset\n$ 2\n$ ",
+		},
+		{
+			`repl.format(5);`,
+			"1\n",
+			"error in ",
+		},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		newHookREPL(t, tt.rc, tt.input, &out).Run()
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("rc %q with %q: expected %q, got=%q", tt.rc, tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestCompleteHook(t *testing.T) {
+	var out strings.Builder
+	r := newHookREPL(t, `repl.complete(fn(prefix) { ["banana", "bandana", "cherry"] });`, "", &out)
+	r.Run()
+
+	completer := &hookCompleter{Completer: NewCompleter(r.session.Env()), r: r}
+	candidates, start := completer.Complete([]rune("puts(ban"), 8)
+	if start != 5 || !reflect.DeepEqual(candidates, []string{"banana", "bandana"}) {
+		t.Errorf("wrong candidates. got=%q at %d", candidates, start)
+	}
+}
@@ -0,0 +1,504 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Returned by ReadLine when the user pressed Ctrl+C, the line is thrown away
+var ErrInterrupted = errors.New("interrupted")
+
+// How many entries of the history file are loaded at the start
+const maxHistory = 1000
+
+// Reads one line of input, the REPL doesn't care whether it comes from a
+// terminal or a pipe
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// Used when the input isn't a terminal (e.g. a piped file or the tests),
+// there is nothing to edit then
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	io.WriteString(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// A small readline: the line can be edited with the arrow keys, Home/End,
+// Backspace/Delete and the emacs shortcuts Ctrl+A, Ctrl+E, Ctrl+W, Ctrl+U
+// and Ctrl+K, Up and Down walk through the history
+type LineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// Switched into raw mode while a line is read, -1 when there is no terminal
+	fd      int
+	history []string
+	// Every entered line is appended to it, empty keeps the history in memory
+	historyFile string
+	// Used for Tab, without one Tab is inserted as it is
+	completer Completer
+	// Colors the line while it's edited, see Highlight
+	highlight func(string) string
+	// Already typed when the next line starts, see Prefill
+	prefill string
+}
+
+// in is only switched into raw mode when it's a terminal, otherwise the
+// keys are expected to arrive as they are typed (which the tests rely on)
+func NewLineEditor(in io.Reader, out io.Writer) *LineEditor {
+	e := &LineEditor{in: bufio.NewReader(in), out: out, fd: -1}
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		e.fd = int(f.Fd())
+	}
+	return e
+}
+
+func (e *LineEditor) SetCompleter(c Completer) {
+	e.completer = c
+}
+
+func (e *LineEditor) SetHighlighter(highlight func(string) string) {
+	e.highlight = highlight
+}
+
+// The next ReadLine starts with text as if it was typed already, the
+// REPL puts the indentation of an unfinished block there
+func (e *LineEditor) Prefill(text string) {
+	e.prefill = text
+}
+
+// The terminal gets a LineEditor with the history of earlier sessions,
+// everything else is read line by line
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	if f, ok := in.(*os.File); ok && isTerminal(int(f.Fd())) {
+		e := NewLineEditor(in, out)
+		if path, err := defaultHistoryFile(); err == nil {
+			e.LoadHistory(path)
+		}
+		return e
+	}
+
+	return &plainReader{scanner: bufio.NewScanner(in), out: out}
+}
+
+// ~/.monkey_history
+func defaultHistoryFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".monkey_history"), nil
+}
+
+// Reads the entries of an earlier session and appends new lines to the
+// file from now on, a missing file just starts an empty history
+func (e *LineEditor) LoadHistory(path string) error {
+	e.historyFile = path
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	for _, line := range lines {
+		if line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	return nil
+}
+
+// Empty lines and repeats of the last entry aren't worth remembering
+// Pasted blocks of several lines are left out too, the history file
+// has one entry per line
+func (e *LineEditor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || strings.Contains(line, "\n") {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+func (e *LineEditor) History() []string {
+	return e.history
+}
+
+// Keys which don't insert themselves
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// The state of the line which is edited right now
+type editLine struct {
+	prompt string
+	buf    []rune
+	pos    int
+	// Position in the history while walking through it, len(history) is the new line
+	historyIndex int
+	// What was typed before walking into the history
+	draft []rune
+}
+
+// Reads a line and adds it to the history, io.EOF when Ctrl+D is pressed
+// on an empty line or the input ends
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		if restore, err := makeRaw(e.fd); err == nil {
+			defer restore()
+			// Bracketed paste: the terminal wraps pasted text in ESC [ 200 ~ and ESC [ 201 ~
+			io.WriteString(e.out, "\x1b[?2004h")
+			defer io.WriteString(e.out, "\x1b[?2004l")
+		}
+	}
+
+	line := &editLine{prompt: prompt, historyIndex: len(e.history)}
+	line.buf = []rune(e.prefill)
+	line.pos = len(line.buf)
+	e.prefill = ""
+	io.WriteString(e.out, prompt+string(line.buf))
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(line.buf) > 0 {
+				break
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyLineFeed:
+			io.WriteString(e.out, "\r\n")
+			e.AddHistory(string(line.buf))
+			return string(line.buf), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(line.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			line.deleteForward()
+		case keyCtrlA:
+			line.pos = 0
+		case keyCtrlE:
+			line.pos = len(line.buf)
+		case keyCtrlB:
+			line.left()
+		case keyCtrlF:
+			line.right()
+		case keyCtrlP:
+			e.previous(line)
+		case keyCtrlN:
+			e.next(line)
+		case keyBackspace, keyCtrlH:
+			line.deleteBackward()
+		case keyCtrlW:
+			line.deleteWord()
+		case keyCtrlU:
+			line.buf = line.buf[line.pos:]
+			line.pos = 0
+		case keyCtrlK:
+			line.buf = line.buf[:line.pos]
+		case keyEscape:
+			if e.escape(line) {
+				// A pasted block with several lines is entered as it is
+				io.WriteString(e.out, "\r\n")
+				e.AddHistory(string(line.buf))
+				return string(line.buf), nil
+			}
+		case keyTab:
+			e.complete(line)
+		default:
+			if unicode.IsPrint(r) {
+				line.insert(r)
+				line.dedent(r)
+			}
+		}
+
+		e.refresh(line)
+	}
+
+	io.WriteString(e.out, "\r\n")
+	e.AddHistory(string(line.buf))
+	return string(line.buf), nil
+}
+
+// Handles the sequences the arrow keys and friends send, e.g. ESC [ A for Up
+// Returns true when a paste of several lines has to be entered right away
+func (e *LineEditor) escape(line *editLine) bool {
+	next, _, err := e.in.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return false
+	}
+
+	code, _, err := e.in.ReadRune()
+	if err != nil {
+		return false
+	}
+
+	// ESC [ 3 ~ and the like, the digits say which key it was
+	if code >= '0' && code <= '9' {
+		digits := string(code)
+		for {
+			r, _, err := e.in.ReadRune()
+			if err != nil || r == '~' {
+				break
+			}
+			digits += string(r)
+		}
+
+		switch digits {
+		case "1", "7":
+			line.pos = 0
+		case "4", "8":
+			line.pos = len(line.buf)
+		case "3":
+			line.deleteForward()
+		case "200":
+			return e.paste(line)
+		}
+		return false
+	}
+
+	switch code {
+	case 'A':
+		e.previous(line)
+	case 'B':
+		e.next(line)
+	case 'C':
+		line.right()
+	case 'D':
+		line.left()
+	case 'H':
+		line.pos = 0
+	case 'F':
+		line.pos = len(line.buf)
+	}
+	return false
+}
+
+// Inserts everything up to the end of the paste without looking at it, so
+// a pasted function isn't evaluated line by line (or completed on a Tab)
+// With a newline in it the whole block has to be entered, the editor
+// can only redraw a single line
+func (e *LineEditor) paste(line *editLine) bool {
+	const end = "\x1b[201~"
+	var pasted strings.Builder
+
+	for !strings.HasSuffix(pasted.String(), end) {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			break
+		}
+		pasted.WriteRune(r)
+	}
+
+	text := strings.TrimSuffix(pasted.String(), end)
+	// terminals send \r for the newlines of a paste
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if !strings.Contains(text, "\n") {
+		for _, r := range text {
+			line.insert(r)
+		}
+		return false
+	}
+
+	for _, r := range strings.TrimRight(text, "\n") {
+		line.insert(r)
+	}
+	// the block isn't shown yet, drawn from the start of the line
+	io.WriteString(e.out, "\r"+line.prompt+strings.ReplaceAll(string(line.buf), "\n", "\r\n")+"\x1b[K")
+	return true
+}
+
+func (e *LineEditor) previous(line *editLine) {
+	if line.historyIndex == 0 {
+		return
+	}
+	if line.historyIndex == len(e.history) {
+		line.draft = line.buf
+	}
+	line.historyIndex--
+	line.set([]rune(e.history[line.historyIndex]))
+}
+
+func (e *LineEditor) next(line *editLine) {
+	if line.historyIndex >= len(e.history) {
+		return
+	}
+	line.historyIndex++
+	if line.historyIndex == len(e.history) {
+		line.set(line.draft)
+		return
+	}
+	line.set([]rune(e.history[line.historyIndex]))
+}
+
+// One candidate replaces the word, several are completed as far as they
+// agree and listed below the line when that doesn't add anything
+// Without a word in front of the cursor Tab indents
+func (e *LineEditor) complete(line *editLine) {
+	if e.completer == nil {
+		line.insert('\t')
+		return
+	}
+
+	candidates, start := e.completer.Complete(line.buf, line.pos)
+	if start == line.pos && len(candidates) == 0 {
+		line.insert('\t')
+		return
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	prefix := commonPrefix(candidates)
+	if len(candidates) == 1 || len([]rune(prefix)) > line.pos-start {
+		rest := append([]rune(prefix), line.buf[line.pos:]...)
+		line.buf = append(line.buf[:start], rest...)
+		line.pos = start + len([]rune(prefix))
+		return
+	}
+
+	io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+}
+
+// Redraws the whole line and puts the cursor back where it belongs
+func (e *LineEditor) refresh(line *editLine) {
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(line.prompt)
+	if e.highlight != nil {
+		b.WriteString(e.highlight(string(line.buf)))
+	} else {
+		b.WriteString(string(line.buf))
+	}
+	// clears whatever was left over from a longer line
+	b.WriteString("\x1b[K")
+	if back := len(line.buf) - line.pos; back > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", back)
+	}
+	io.WriteString(e.out, b.String())
+}
+
+func (l *editLine) set(buf []rune) {
+	l.buf = append([]rune{}, buf...)
+	l.pos = len(l.buf)
+}
+
+func (l *editLine) insert(r rune) {
+	l.buf = append(l.buf, 0)
+	copy(l.buf[l.pos+1:], l.buf[l.pos:])
+	l.buf[l.pos] = r
+	l.pos++
+}
+
+// A closing bracket typed into the indentation goes back one level,
+// so the } of a block lines up with the line that opened it
+func (l *editLine) dedent(r rune) {
+	if r != '}' && r != ')' && r != ']' {
+		return
+	}
+	before := string(l.buf[:l.pos-1])
+	if strings.TrimLeft(before, " ") != "" || len(before) < len(INDENT) {
+		return
+	}
+	l.buf = append(l.buf[:l.pos-1-len(INDENT)], l.buf[l.pos-1:]...)
+	l.pos -= len(INDENT)
+}
+
+func (l *editLine) left() {
+	if l.pos > 0 {
+		l.pos--
+	}
+}
+
+func (l *editLine) right() {
+	if l.pos < len(l.buf) {
+		l.pos++
+	}
+}
+
+func (l *editLine) deleteBackward() {
+	if l.pos == 0 {
+		return
+	}
+	l.buf = append(l.buf[:l.pos-1], l.buf[l.pos:]...)
+	l.pos--
+}
+
+func (l *editLine) deleteForward() {
+	if l.pos == len(l.buf) {
+		return
+	}
+	l.buf = append(l.buf[:l.pos], l.buf[l.pos+1:]...)
+}
+
+// Ctrl+W removes the word before the cursor and the spaces behind it
+func (l *editLine) deleteWord() {
+	start := l.pos
+	for start > 0 && unicode.IsSpace(l.buf[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(l.buf[start-1]) {
+		start--
+	}
+	l.buf = append(l.buf[:start], l.buf[l.pos:]...)
+	l.pos = start
+}
@@ -0,0 +1,151 @@
+package repl
+
+import (
+	"io"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineEditorEditing(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"abc\r", "abc"},
+		{"abc\x1b[D\x1b[DX\r", "aXbc"},
+		{"abc\x01X\x05Y\r", "XabcY"},
+		{"let foo = bar\x17\x17baz\r", "let foo baz"},
+		{"abcd\x7f\x7f\r", "ab"},
+		{"abcd\x1b[H\x1b[3~\r", "bcd"},
+		{"abcd\x02\x02\x0b\r", "ab"},
+		{"abcd\x02\x02\x15\r", "cd"},
+		{"héllo\x1b[D\x1b[D\x1b[D\x1b[D\x7f\r", "éllo"},
+		{"last line without enter", "last line without enter"},
+	}
+
+	for _, tt := range tests {
+		e := NewLineEditor(strings.NewReader(tt.keys), io.Discard)
+		got, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) returned error: %s", tt.keys, err)
+		}
+		if got != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. expected=%q, got=%q", tt.keys, tt.expected, got)
+		}
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	keys := "first\rsecond\r\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[A\x1b[Bedit\r"
+	e := NewLineEditor(strings.NewReader(keys), io.Discard)
+
+	expected := []string{"first", "second", "first", "secondedit"}
+	for _, want := range expected {
+		got, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine returned error: %s", err)
+		}
+		if got != want {
+			t.Errorf("wrong line. expected=%q, got=%q", want, got)
+		}
+	}
+
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the input, got=%v", err)
+	}
+}
+
+func TestLineEditorControlKeys(t *testing.T) {
+	e := NewLineEditor(strings.NewReader("abc\x03\x04"), io.Discard)
+
+	if _, err := e.ReadLine(PROMPT); err != ErrInterrupted {
+		t.Errorf("Ctrl+C should interrupt, got=%v", err)
+	}
+	if _, err := e.ReadLine(PROMPT); err != io.EOF {
+		t.Errorf("Ctrl+D on an empty line should end the input, got=%v", err)
+	}
+}
+
+func TestLineEditorHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	if err := os.WriteFile(path, []byte("let a = 1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewLineEditor(strings.NewReader("a * 2\r\r\x1b[A\x1b[A\r"), io.Discard)
+	if err := e.LoadHistory(path); err != nil {
+		t.Fatalf("LoadHistory returned error: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		e.ReadLine(PROMPT)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the empty line is left out, the recalled line is appended again
+	expected := "let a = 1\na * 2\nlet a = 1\n"
+	if string(content) != expected {
+		t.Errorf("wrong history file. expected=%q, got=%q", expected, string(content))
+	}
+}
+
+func TestLineEditorBracketedPaste(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		// a single line is inserted and can still be edited
+		{"let x = \x1b[200~add(1, 2)\x1b[201~;\r", []string{"let x = add(1, 2);"}},
+		// several lines are one input, Tab and Enter inside don't do anything special
+		{"\x1b[200~let f = fn(x) {\r\tx\r};\rf(2)\r\x1b[201~", []string{"let f = fn(x) {\n\tx\n};\nf(2)"}},
+		{"\x1b[200~1\r\n2\x1b[201~3\r", []string{"1\n2", "3"}},
+	}
+
+	for _, tt := range tests {
+		e := NewLineEditor(strings.NewReader(tt.keys), io.Discard)
+		e.SetCompleter(NewCompleter(object.NewEnvironment()))
+		for _, want := range tt.expected {
+			got, err := e.ReadLine(PROMPT)
+			if err != nil {
+				t.Fatalf("ReadLine(%q) returned error: %s", tt.keys, err)
+			}
+			if got != want {
+				t.Errorf("ReadLine(%q) wrong. expected=%q, got=%q", tt.keys, want, got)
+			}
+		}
+		if len(e.History()) > 1 {
+			t.Errorf("pasted blocks should not be in the history. got=%q", e.History())
+		}
+	}
+}
+
+func TestLineEditorPrefill(t *testing.T) {
+	tests := []struct {
+		prefill  string
+		keys     string
+		expected string
+	}{
+		{"  ", "x * 2\r", "  x * 2"},
+		{"    ", "}\r", "  }"},
+		{"  ", "}\r", "}"},
+		{"  ", "\x7f\x7fx\r", "x"},
+		{"", "a}\r", "a}"},
+	}
+
+	for _, tt := range tests {
+		e := NewLineEditor(strings.NewReader(tt.keys), io.Discard)
+		e.Prefill(tt.prefill)
+		got, err := e.ReadLine(CONTINUATION_PROMPT)
+		if err != nil {
+			t.Fatalf("ReadLine(%q) returned error: %s", tt.keys, err)
+		}
+		if got != tt.expected {
+			t.Errorf("ReadLine(%q) after Prefill(%q) wrong. expected=%q, got=%q", tt.keys, tt.prefill, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package repl
+
+import (
+	"fmt"
+	"monkey/object"
+	"strings"
+)
+
+// Limits for printing results, a value which fits into Width stays on one
+// line, otherwise its elements get a line each
+type PrettyPrinter struct {
+	// Columns a line may take up, 0 puts every element on its own line
+	Width int
+	// Arrays and hashes nested deeper than this are shown as [...] and {...}
+	// 0 means no limit
+	MaxDepth int
+	// Only the first MaxItems elements are shown, then "... 990 more"
+	// 0 means no limit
+	MaxItems int
+}
+
+var DefaultPrettyPrinter = PrettyPrinter{Width: 80, MaxDepth: 8, MaxItems: 100}
+
+// Either a piece of text or a collection with its elements
+type pretty struct {
+	text        string
+	open, close string
+	items       []*pretty
+}
+
+// Short values look exactly like obj.Inspect()
+func (p PrettyPrinter) Format(obj object.Object) string {
+	var b strings.Builder
+	p.build(obj, 0).write(&b, 0, p.Width)
+	return b.String()
+}
+
+func (p PrettyPrinter) build(obj object.Object, depth int) *pretty {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if p.MaxDepth > 0 && depth >= p.MaxDepth && len(obj.Elements) > 0 {
+			return &pretty{text: "[...]"}
+		}
+		doc := &pretty{open: "[", close: "]"}
+		for i, el := range obj.Elements {
+			if p.MaxItems > 0 && i == p.MaxItems {
+				doc.items = append(doc.items, more(len(obj.Elements)-i))
+				break
+			}
+			doc.items = append(doc.items, p.build(el, depth+1))
+		}
+		return doc
+	case *object.Hash:
+		if p.MaxDepth > 0 && depth >= p.MaxDepth && obj.Len() > 0 {
+			return &pretty{text: "{...}"}
+		}
+		doc := &pretty{open: "{", close: "}"}
+		for i, pair := range obj.SortedPairs() {
+			if p.MaxItems > 0 && i == p.MaxItems {
+				doc.items = append(doc.items, more(obj.Len()-i))
+				break
+			}
+			value := p.build(pair.Value, depth+1)
+			// the key stays in front of the value, even when the value is split up
+			if value.text != "" || value.open == "" {
+				value.text = pair.Key.Inspect() + ": " + value.text
+			} else {
+				value.open = pair.Key.Inspect() + ": " + value.open
+			}
+			doc.items = append(doc.items, value)
+		}
+		return doc
+	default:
+		return &pretty{text: obj.Inspect()}
+	}
+}
+
+func more(n int) *pretty {
+	return &pretty{text: fmt.Sprintf("... %d more", n)}
+}
+
+func (d *pretty) flat() string {
+	if d.open == "" {
+		return d.text
+	}
+
+	items := make([]string, len(d.items))
+	for i, item := range d.items {
+		items[i] = item.flat()
+	}
+	return d.open + strings.Join(items, ", ") + d.close
+}
+
+func (d *pretty) write(b *strings.Builder, indent, width int) {
+	flat := d.flat()
+	if d.open == "" || len(d.items) == 0 || (indent+len(flat) <= width && !strings.Contains(flat, "\n")) {
+		b.WriteString(flat)
+		return
+	}
+
+	b.WriteString(d.open)
+	for i, item := range d.items {
+		b.WriteString("\n")
+		b.WriteString(strings.Repeat(" ", indent+2))
+		item.write(b, indent+2, width)
+		if i < len(d.items)-1 {
+			b.WriteString(",")
+		}
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.Repeat(" ", indent))
+	b.WriteString(d.close)
+}
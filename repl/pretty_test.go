@@ -0,0 +1,44 @@
+package repl
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+func integers(n int) *object.Array {
+	arr := &object.Array{}
+	for i := 0; i < n; i++ {
+		arr.Elements = append(arr.Elements, object.NewInteger(int64(i)))
+	}
+	return arr
+}
+
+func TestPrettyPrinter(t *testing.T) {
+	name := &object.String{Value: "name"}
+	scores := &object.String{Value: "scores"}
+	nested := object.NewHash(map[object.HashKey]object.HashPair{
+		name.HashKey():   {Key: name, Value: &object.String{Value: "monkey"}},
+		scores.HashKey(): {Key: scores, Value: integers(3)},
+	})
+
+	tests := []struct {
+		printer  PrettyPrinter
+		obj      object.Object
+		expected string
+	}{
+		{DefaultPrettyPrinter, integers(3), "[0, 1, 2]"},
+		{DefaultPrettyPrinter, nested, "{name: monkey, scores: [0, 1, 2]}"},
+		{PrettyPrinter{Width: 8}, integers(3), "[\n  0,\n  1,\n  2\n]"},
+		{PrettyPrinter{Width: 80, MaxItems: 2}, integers(1000), "[0, 1, ... 998 more]"},
+		{PrettyPrinter{Width: 20, MaxDepth: 8}, nested, "{\n  name: monkey,\n  scores: [0, 1, 2]\n}"},
+		{PrettyPrinter{Width: 12, MaxDepth: 8}, nested, "{\n  name: monkey,\n  scores: [\n    0,\n    1,\n    2\n  ]\n}"},
+		{PrettyPrinter{Width: 80, MaxDepth: 1}, &object.Array{Elements: []object.Object{integers(2), &object.Array{}}}, "[[...], []]"},
+		{DefaultPrettyPrinter, object.NewInteger(5), "5"},
+	}
+
+	for i, tt := range tests {
+		if got := tt.printer.Format(tt.obj); got != tt.expected {
+			t.Errorf("tests[%d] - wrong format. expected=%q, got=%q", i, tt.expected, got)
+		}
+	}
+}
@@ -1,50 +1,439 @@
 package repl
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"monkey/ast"
 	"monkey/evaluator"
-	"monkey/lexer"
-	"monkey/parser"
+	"monkey/object"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 const PROMPT = ">> "
 
+// Shown while an unfinished input (e.g. an open brace) is continued
+const CONTINUATION_PROMPT = ".. "
+
+// Bound to the result of the last evaluation which had one (and wasn't an
+// error), so it can be used in the next input without typing it again
+const LAST_RESULT = "_"
+
+// Everything about the REPL an embedder can change, zero values pick the
+// defaults noted on the fields
+type Config struct {
+	// Where the input comes from, os.Stdin by default
+	// A terminal gets the line editor, anything else is read line by line
+	Reader io.Reader
+	// Results and the output of commands, os.Stdout by default
+	Writer io.Writer
+	// Parser errors, error results and failed commands, Writer by default
+	ErrorWriter io.Writer
+
+	// PROMPT and CONTINUATION_PROMPT by default
+	Prompt             string
+	ContinuationPrompt string
+	// Printed once at the start, nothing by default
+	Banner string
+	// Printed above parser errors, set NoParserErrorFace to leave it out
+	ParserErrorFace   string
+	NoParserErrorFace bool
+
+	// Highlights input and results, see ColorTerminal for a good default
+	Color bool
+	// DefaultPrettyPrinter when it's the zero value
+	Pretty PrettyPrinter
+	// Results longer than this many lines are cut off, :more shows the rest
+	// 0 uses the height of the terminal (no limit for anything else),
+	// a negative number never cuts anything off
+	PageHeight int
+
+	// The bindings every line can use (e.g. the prelude), a new empty
+	// environment by default
+	Env *object.Environment
+	// Evaluated in the session scope at the start and after :reset, so
+	// personal helpers are always around, see DefaultRCFile
+	// Nothing is loaded when it's empty or the file doesn't exist
+	RCFile string
+
+	// The limits and sandbox of every evaluation, disabling the
+	// Filesystem capability also disables :load and :save
+	Options evaluator.Options
+	// What runs the inputs, the evaluator by default, see :engine
+	Engine Engine
+	// Compiled before the first input on the VM, e.g. the prelude which
+	// is in Env for the evaluator
+	VMPrelude []*ast.Program
+	// Makes the context of every evaluation, nil means one which Ctrl+C
+	// cancels. Serve uses it to put a time limit on the inputs
+	Context func() (context.Context, context.CancelFunc)
+	// An input or command which panics only gets an internal error and
+	// the REPL goes on, e.g. so one client can't stop Serve. Bindings the
+	// input made before it panicked may be left behind
+	RecoverPanics bool
+
+	// Gets every input and output of the session with a timestamp, e.g. a
+	// log for a class or a bug report. puts writes to Writer then, so its
+	// output ends up in there as well
+	Transcript io.Writer
+}
+
+// A running REPL, the state is shared by the input loop and the commands
+type REPL struct {
+	cfg    Config
+	out    io.Writer
+	errOut io.Writer
+	reader lineReader
+	// Evaluates the inputs, the REPL reads and prints around it
+	session *Session
+	color   bool
+	// How results are formatted
+	pretty PrettyPrinter
+	// The last complete input, used by :ast without code
+	last string
+	// The lines of the last result which didn't fit on the screen, see :more
+	more []string
+	// Turned on by :time, every evaluation reports how long it took
+	timing bool
+	// Set by :quit
+	quit bool
+	// nil without Config.Transcript
+	transcript *transcript
+	// Registered by the rc file through the repl module
+	hooks hooks
+}
+
+func New(cfg Config) *REPL {
+	if cfg.Reader == nil {
+		cfg.Reader = os.Stdin
+	}
+	if cfg.Writer == nil {
+		cfg.Writer = os.Stdout
+	}
+	if cfg.ErrorWriter == nil {
+		cfg.ErrorWriter = cfg.Writer
+	}
+	if cfg.Prompt == "" {
+		cfg.Prompt = PROMPT
+	}
+	if cfg.ContinuationPrompt == "" {
+		cfg.ContinuationPrompt = CONTINUATION_PROMPT
+	}
+	if cfg.ParserErrorFace == "" && !cfg.NoParserErrorFace {
+		cfg.ParserErrorFace = MONKEY_FACE
+	}
+	if cfg.Pretty == (PrettyPrinter{}) {
+		cfg.Pretty = DefaultPrettyPrinter
+	}
+	if cfg.Env == nil {
+		cfg.Env = object.NewEnvironment()
+	}
+
+	r := &REPL{
+		cfg:    cfg,
+		out:    cfg.Writer,
+		errOut: cfg.ErrorWriter,
+		color:  cfg.Color,
+		pretty: cfg.Pretty,
+	}
+	// Between env and the session, so :env and :undef leave the module alone
+	startup := object.NewEnclosedEnvironment(cfg.Env)
+	startup.SetConst("repl", r.api())
+	r.session = NewSession(startup)
+	r.session.Options = cfg.Options
+	r.session.Engine = cfg.Engine
+	r.session.VMPrelude = cfg.VMPrelude
+
+	if cfg.Transcript != nil {
+		r.transcript = newTranscript(cfg.Transcript)
+		r.out = io.MultiWriter(r.out, r.transcript)
+		r.errOut = io.MultiWriter(r.errOut, r.transcript)
+		r.session.Options.Builtins = evaluator.BuiltinsWithOutput(r.session.Options.Builtins, r.out)
+	}
+
+	// Line editor for a terminal, plain lines for everything else
+	r.reader = newLineReader(cfg.Reader, cfg.Writer)
+	if editor, ok := r.reader.(*LineEditor); ok && r.color {
+		editor.SetHighlighter(Highlight)
+	}
+	r.updateCompleter()
+
+	return r
+}
+
 // io Reader = User Input from the Console
 // io Writer = Output to the console
-func Start(in io.Reader, out io.Writer) {
-	// Scanner for reading User Input
-	scanner := bufio.NewScanner(in)
+// env holds the bindings every line can use (e.g. the prelude)
+func Start(in io.Reader, out io.Writer, env *object.Environment) {
+	New(Config{Reader: in, Writer: out, Env: env, Color: ColorTerminal(out)}).Run()
+}
+
+// Starts over with an empty session scope, env is kept
+func (r *REPL) reset() {
+	r.session.Reset()
+	r.hooks = hooks{}
+	r.updateCompleter()
+	r.loadRC()
+}
+
+// The completer has to know the current session scope
+func (r *REPL) updateCompleter() {
+	if editor, ok := r.reader.(*LineEditor); ok {
+		editor.SetCompleter(&hookCompleter{Completer: NewCompleter(r.session.Env()), r: r})
+	}
+}
+
+// $MONKEY_RC or ~/.monkeyrc
+func DefaultRCFile() string {
+	if path := os.Getenv("MONKEY_RC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkeyrc")
+}
+
+// The rc file isn't part of the session, :save leaves it out. The
+// evaluator runs it whatever the engine is, the hooks it registers are
+// called by the evaluator
+func (r *REPL) loadRC() {
+	if r.cfg.RCFile == "" {
+		return
+	}
+
+	source, err := os.ReadFile(r.cfg.RCFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		r.printError(fmt.Sprintf("could not load %s: %s", r.cfg.RCFile, err))
+		return
+	}
+
+	ctx, stop := r.context()
+	defer stop()
+	program, err := parse(string(source))
+	if err == nil {
+		_, err = r.session.evaluateTree(ctx, program)
+	}
+	var runtimeErr *RuntimeError
+	switch {
+	case errors.As(err, &runtimeErr):
+		r.printError(fmt.Sprintf("error in %s: %s", r.cfg.RCFile, runtimeErr.Err.Message))
+	case err != nil:
+		r.report(Result{}, err)
+	}
+}
+
+// Reads and evaluates inputs until the input ends or :quit is used
+func (r *REPL) Run() {
+	if r.cfg.Banner != "" {
+		io.WriteString(r.out, r.cfg.Banner)
+	}
+	r.loadRC()
+	defer r.session.Close()
+
+	// Lines of an input which isn't complete yet
+	var pending []string
 
 	// Endless loop
-	for {
-		// Writes PROMPT into the out (io.Writer) so to the console
-		fmt.Fprintf(out, PROMPT)
-		// Scans the user Input, when nothing is there (user pressed cmd+c) exit loop and REPL
-		scanned := scanner.Scan()
-		if !scanned {
+	for !r.quit {
+		var prompt string
+		if len(pending) == 0 {
+			prompt = r.prompt()
+		} else {
+			prompt = r.cfg.ContinuationPrompt
+			// Only typed lines are indented, piped ones bring their own
+			if editor, ok := r.reader.(*LineEditor); ok {
+				editor.Prefill(indentation(strings.Join(pending, "\n")))
+			}
+		}
+
+		// Reads the user Input, when nothing is there (user pressed ctrl+d) exit loop and REPL
+		input, err := r.reader.ReadLine(prompt)
+		if err == ErrInterrupted {
+			// Ctrl+C throws away the input typed so far
+			pending = nil
+			continue
+		}
+		if err != nil {
 			return
 		}
+		if r.transcript != nil {
+			r.transcript.input(prompt, input)
+		}
 
-		// Get the user Input as a string
-		line := scanner.Text()
-		// Init the Lexer
-		l := lexer.New(line)
-		p := parser.New(l)
+		// Commands are handled before anything is parsed
+		if len(pending) == 0 && isCommand(input) {
+			r.guard(func() { r.command(input) })
+			continue
+		}
 
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		// Keep reading while brackets are still open
+		pending = append(pending, input)
+		line := strings.Join(pending, "\n")
+		if isIncomplete(line) {
 			continue
 		}
+		pending = nil
+
+		r.last = line
+		r.guard(func() { r.eval(line) })
+	}
+}
+
+// Runs one input, with Config.RecoverPanics its panic is printed as an
+// internal error instead of ending the process
+func (r *REPL) guard(run func()) {
+	if r.cfg.RecoverPanics {
+		defer func() {
+			if v := recover(); v != nil {
+				r.printError(fmt.Sprintf("internal error: %v", v))
+			}
+		}()
+	}
+	run()
+}
+
+// Evaluates one complete input in the session and prints the result
+func (r *REPL) eval(line string) {
+	ctx, stop := r.context()
+	defer stop()
+
+	r.session.CountNodes = r.timing
+	result, err := r.session.EvalLineContext(ctx, line)
+	r.report(result, err)
+}
+
+// Evaluates source in the session without making it an input, e.g.
+// for the rc file
+func (r *REPL) evaluate(source string) (Result, error) {
+	ctx, stop := r.context()
+	defer stop()
+
+	r.session.CountNodes = false
+	return r.session.evaluate(ctx, source)
+}
+
+// Prints the value or the error of an evaluation, and how long it took
+// while :time is on
+func (r *REPL) report(result Result, err error) {
+	var parseErr *ParseError
+	var runtimeErr *RuntimeError
+
+	switch {
+	case errors.As(err, &parseErr):
+		r.printParserErrors(parseErr.Errors)
+		return
+	case errors.As(err, &runtimeErr) && runtimeErr.Err.Exit:
+		// exit() leaves the REPL like :quit
+		r.quit = true
+		return
+	case errors.As(err, &runtimeErr):
+		r.print(runtimeErr.Err)
+	case err != nil:
+		r.printError(err.Error())
+	case result.Value != nil:
+		r.print(result.Value)
+	}
+
+	switch {
+	case r.timing && r.session.Engine == VMEngine:
+		fmt.Fprintf(r.out, "took %s\n", roundDuration(result.Duration))
+	case r.timing:
+		fmt.Fprintf(r.out, "took %s, %d nodes\n", roundDuration(result.Duration), result.Nodes)
+	}
+}
 
-		evaluated := evaluator.Eval(program)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+// Cancels the returned context on Ctrl+C (SIGINT), the tests replace it
+func (r *REPL) context() (context.Context, context.CancelFunc) {
+	if r.cfg.Context != nil {
+		return r.cfg.Context()
+	}
+	return notifyInterrupt(context.Background())
+}
+
+var notifyInterrupt = func(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, os.Interrupt)
+}
+
+// Enough digits to compare two runs, 1.234567ms is noise after the 3rd
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(time.Microsecond)
+	default:
+		return d
+	}
+}
+
+// Error results go to the ErrorWriter, values are cut off after a page
+func (r *REPL) print(obj object.Object) {
+	text, ok := r.format(obj)
+	if !ok && r.color {
+		text = highlightResult(obj, r.pretty)
+	} else if !ok {
+		text = r.pretty.Format(obj)
+	}
+
+	if obj.Type() == object.ERROR_OBJ {
+		io.WriteString(r.errOut, text+"\n")
+		return
+	}
+
+	r.more = strings.Split(text, "\n")
+	r.page()
+}
+
+// Writes the next page of r.more, with a hint if there is still more
+func (r *REPL) page() {
+	height := r.pageHeight()
+	lines := r.more
+	if height <= 0 || len(lines) <= height {
+		r.more = nil
+	} else {
+		// one line for the hint and one for the next prompt
+		keep := max(height-2, 1)
+		lines, r.more = lines[:keep], lines[keep:]
+	}
+
+	for _, line := range lines {
+		io.WriteString(r.out, line+"\n")
+	}
+	if len(r.more) > 0 {
+		hint := fmt.Sprintf("... %d more lines, :more shows them", len(r.more))
+		if r.color {
+			// a cut off string or array would color the hint otherwise
+			hint = colorReset + colorComment + hint + colorReset
 		}
+		io.WriteString(r.out, hint+"\n")
+	}
+}
+
+// Checked every time, the terminal may have been resized
+func (r *REPL) pageHeight() int {
+	if r.cfg.PageHeight != 0 {
+		return r.cfg.PageHeight
+	}
+
+	f, ok := r.out.(*os.File)
+	if !ok {
+		return 0
+	}
+	_, height, err := terminalSize(int(f.Fd()))
+	if err != nil || height < 3 {
+		return 0
 	}
+	return height
 }
 
 const MONKEY_FACE = `            __,__
@@ -60,11 +449,15 @@ const MONKEY_FACE = `            __,__
            '-----'
 `
 
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, MONKEY_FACE)
+func (r *REPL) printParserErrors(errors []string) {
+	out := r.errOut
+	io.WriteString(out, r.cfg.ParserErrorFace)
 	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
 	io.WriteString(out, " parser errors:\n")
 	for _, msg := range errors {
+		if r.color {
+			msg = colorError + msg + colorReset
+		}
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
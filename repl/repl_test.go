@@ -0,0 +1,294 @@
+package repl
+
+import (
+	"context"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runRepl(input string) string {
+	var out strings.Builder
+	Start(strings.NewReader(input), &out, object.NewEnvironment())
+	return out.String()
+}
+
+func TestReplEvaluates(t *testing.T) {
+	got := runRepl("1 + 2\n")
+	expected := PROMPT + "3\n" + PROMPT
+	if got != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestReplParserErrors(t *testing.T) {
+	got := runRepl("let = 5\n")
+	if !strings.Contains(got, MONKEY_FACE) || !strings.Contains(got, "parser errors:") {
+		t.Errorf("parser errors not printed. got=%q", got)
+	}
+}
+
+func TestReplKeepsBindings(t *testing.T) {
+	got := runRepl("let x = 5;\nlet double = fn(n) { n * 2 };\ndouble(x)\n")
+	if !strings.Contains(got, "10\n") {
+		t.Errorf("bindings did not survive between lines. got=%q", got)
+	}
+}
+
+func TestReplContinuesOpenBrackets(t *testing.T) {
+	got := runRepl("let add = fn(a, b) {\n  a + b\n};\nadd(1,\n2)\n")
+	expected := PROMPT + CONTINUATION_PROMPT + CONTINUATION_PROMPT + PROMPT + CONTINUATION_PROMPT + "3\n" + PROMPT
+	if got != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, got)
+	}
+}
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 + 2", false},
+		{"fn(x) {", true},
+		{"[1, 2,", true},
+		{"add(1, [2, {", true},
+		{"if (x) { 1 } else { 2 }", false},
+		{`"{"`, false},
+		{"}", false},
+	}
+
+	for _, tt := range tests {
+		if got := isIncomplete(tt.input); got != tt.expected {
+			t.Errorf("isIncomplete(%q) wrong. expected=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestIndentation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let f = fn(x) {", "  "},
+		{"let f = fn(x) {\n  if (x) {", "    "},
+		{"let f = fn(x) {\n  if (x) { 1 }", "  "},
+		{"puts(\"{\"", "  "},
+		{"1 + 2", ""},
+		{"}", ""},
+	}
+
+	for _, tt := range tests {
+		if got := indentation(tt.input); got != tt.expected {
+			t.Errorf("indentation(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestReplPrettyPrintsResults(t *testing.T) {
+	got := runRepl("let xs = [];\nfor (x in 0..1000) { xs = push(xs, x) };\nxs\n")
+	if !strings.Contains(got, "... 900 more\n]") {
+		t.Errorf("long arrays should be cut off. got=%q", got)
+	}
+}
+
+func TestReplInterruptCancelsEvaluation(t *testing.T) {
+	notify := notifyInterrupt
+	defer func() { notifyInterrupt = notify }()
+	// stands in for Ctrl+C, pressed shortly after the evaluation started
+	notifyInterrupt = func(ctx context.Context) (context.Context, context.CancelFunc) {
+		return context.WithTimeout(ctx, 20*time.Millisecond)
+	}
+
+	got := runRepl("let x = 42;\nfor (i in 0..1000000000000) { i }\nx\n")
+	if !strings.Contains(got, "ERROR: evaluation cancelled") {
+		t.Errorf("the loop was not cancelled. got=%q", got)
+	}
+	if !strings.HasSuffix(got, "42\n"+PROMPT) {
+		t.Errorf("the session did not survive the interrupt. got=%q", got)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	var out, log strings.Builder
+	New(Config{
+		Reader:     strings.NewReader("let x = 2;\nputs(x * 3)\nlet f = fn() {\nx }\nnope\n"),
+		Writer:     &out,
+		Color:      true,
+		Transcript: &log,
+	}).Run()
+
+	stamp := `\d{4}-\d\d-\d\d \d\d:\d\d:\d\d `
+	expected := regexp.MustCompile("^" + stamp + "# session started\n" +
+		stamp + ">> let x = 2;\n" +
+		stamp + ">> puts\\(x \\* 3\\)\n" +
+		stamp + "6\n" +
+		stamp + "null\n" +
+		stamp + ">> let f = fn\\(\\) \\{\n" +
+		stamp + "\\.\\. x \\}\n" +
+		stamp + ">> nope\n" +
+		stamp + "ERROR: identifier not found: nope\n$")
+	if !expected.MatchString(log.String()) {
+		t.Errorf("wrong transcript. got=%q", log.String())
+	}
+	if !strings.Contains(out.String(), "6\n") {
+		t.Errorf("puts should still write to the output. got=%q", out.String())
+	}
+}
+
+func TestReplExit(t *testing.T) {
+	got := runRepl("let x = 1;\nexit(1)\nx\n")
+	if strings.Contains(got, "ERROR") || strings.HasSuffix(got, "1\n"+PROMPT) {
+		t.Errorf("exit() should leave the REPL quietly. got=%q", got)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	var out, errOut strings.Builder
+	env := object.NewEnvironment()
+	env.Set("answer", object.NewInteger(42))
+
+	New(Config{
+		Reader:             strings.NewReader("answer\nlet f = fn(x) {\nx }\nlet = 1\nnope\n"),
+		Writer:             &out,
+		ErrorWriter:        &errOut,
+		Prompt:             "monkey> ",
+		ContinuationPrompt: "...... ",
+		Banner:             "welcome\n",
+		NoParserErrorFace:  true,
+		Env:                env,
+	}).Run()
+
+	expected := "welcome\nmonkey> 42\nmonkey> ...... monkey> monkey> monkey> "
+	if out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+	if strings.Contains(errOut.String(), MONKEY_FACE) {
+		t.Errorf("the face should be left out. got=%q", errOut.String())
+	}
+	if !strings.Contains(errOut.String(), "parser errors:") || !strings.Contains(errOut.String(), "ERROR: identifier not found: nope") {
+		t.Errorf("errors should go to the ErrorWriter. got=%q", errOut.String())
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	var out strings.Builder
+	New(Config{Reader: strings.NewReader("let = 1\n"), Writer: &out}).Run()
+
+	if !strings.HasPrefix(out.String(), PROMPT+MONKEY_FACE) {
+		t.Errorf("defaults not used. got=%q", out.String())
+	}
+}
+
+func TestRCFile(t *testing.T) {
+	dir := t.TempDir()
+	rc := filepath.Join(dir, "monkeyrc")
+	if err := os.WriteFile(rc, []byte("let inc = fn(x) { x + 1 };\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(dir, "broken")
+	if err := os.WriteFile(broken, []byte("let a = 1;\nmissing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		rcFile   string
+		input    string
+		contains string
+	}{
+		{rc, "inc(1)\n", "2\n"},
+		{rc, "let inc = 5;\n:reset\ninc(1)\n", "2\n"},
+		{broken, "a\n", "error in " + broken + ": identifier not found: missing\n"},
+		{filepath.Join(dir, "nothing"), "1\n", PROMPT + "1\n"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		New(Config{Reader: strings.NewReader(tt.input), Writer: &out, RCFile: tt.rcFile}).Run()
+		if !strings.Contains(out.String(), tt.contains) {
+			t.Errorf("rc file %s with %q: expected %q in output, got=%q", tt.rcFile, tt.input, tt.contains, out.String())
+		}
+	}
+
+	// the rc file isn't saved with the session
+	saved := filepath.Join(dir, "saved.monkey")
+	New(Config{Reader: strings.NewReader("1\n:save " + saved + "\n"), Writer: &strings.Builder{}, RCFile: rc}).Run()
+	if content, _ := os.ReadFile(saved); string(content) != "1;\n" {
+		t.Errorf("rc file ended up in :save. got=%q", content)
+	}
+
+	t.Setenv("MONKEY_RC", rc)
+	if got := DefaultRCFile(); got != rc {
+		t.Errorf("MONKEY_RC not used. got=%q", got)
+	}
+}
+
+func TestReplLastResult(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2\n_ * 10\n", "30\n"},
+		{"[1, 2]\nlet x = 5;\nlen(_)\n", "2\n"},
+		{"7\nnope\n_\n", "7\n"},
+		{"_\n", "ERROR: identifier not found: _\n"},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		if !strings.HasSuffix(got, PROMPT+tt.expected+PROMPT) {
+			t.Errorf("output of %q wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestReplRollsBackFailedInputs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = 1; let b = nope;\na\n", "ERROR: identifier not found: a\n"},
+		{"let x = 1;\nx = 2; nope;\nx\n", "1\n"},
+		{"let n = 0;\nlet inc = fn() { n = n + 1; missing };\ninc()\nn\n", "0\n"},
+		{"let y = 1;\ny = 2;\ny\n", "2\n"},
+	}
+
+	for _, tt := range tests {
+		got := runRepl(tt.input)
+		if !strings.HasSuffix(got, PROMPT+tt.expected+PROMPT) {
+			t.Errorf("output of %q wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestReplPagesLongResults(t *testing.T) {
+	var out strings.Builder
+	input := "let xs = [];\nfor (x in 0..30) { xs = push(xs, x) };\nxs\n:more\n:more\n:more\n"
+	New(Config{
+		Reader:     strings.NewReader(input),
+		Writer:     &out,
+		Pretty:     PrettyPrinter{Width: 1},
+		PageHeight: 12,
+	}).Run()
+	got := out.String()
+
+	// 32 lines: the brackets and 30 elements
+	pages := []string{
+		"[\n  0,\n  1,\n  2,\n  3,\n  4,\n  5,\n  6,\n  7,\n  8,\n... 22 more lines, :more shows them\n",
+		"  9,\n  10,\n  11,\n  12,\n  13,\n  14,\n  15,\n  16,\n  17,\n  18,\n... 12 more lines, :more shows them\n",
+		"  29\n]\n" + PROMPT + "nothing more to show\n",
+	}
+	for _, page := range pages {
+		if !strings.Contains(got, page) {
+			t.Errorf("page missing. expected=%q, got=%q", page, got)
+		}
+	}
+
+	got = runRepl("[1, 2]\n")
+	if strings.Contains(got, ":more") {
+		t.Errorf("output which isn't a terminal should not be paged. got=%q", got)
+	}
+}
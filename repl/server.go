@@ -0,0 +1,97 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"net"
+	"time"
+)
+
+// How Serve runs the REPL for every connection
+type ServerConfig struct {
+	// The bindings every connection can use (e.g. the prelude), Serve
+	// freezes it so the connections can share it. Everything a
+	// connection defines stays in its own session
+	Env *object.Environment
+	// The limits and sandbox of every input, e.g. MaxSteps and
+	// Disabled: evaluator.AllCapabilities for a public server
+	// Stdin is always disabled, the server's input isn't the client's
+	// MaxDepth, MaxMemory and MaxSteps left at 0 get the Default limits
+	Options evaluator.Options
+	// Every input is cancelled after this long, 0 means no limit
+	Timeout time.Duration
+	// Greets every connection
+	Banner string
+}
+
+// The limits of every input when ServerConfig.Options has none. Without a
+// depth limit one connection's endless recursion runs the whole server out
+// of stack before the Timeout stops it
+const (
+	DefaultServerMaxDepth  = 1000
+	DefaultServerMaxMemory = 64 << 20
+	DefaultServerMaxSteps  = 10_000_000
+)
+
+// Accepts connections on l and runs a REPL for each until it quits or
+// the connection closes, e.g. for a teaching server or as the backend of
+// a playground. puts writes to the connection instead of stdout
+// Returns the error which stopped l from accepting connections
+func Serve(l net.Listener, cfg ServerConfig) error {
+	if cfg.Env == nil {
+		cfg.Env = object.NewEnvironment()
+	}
+	cfg.Env.Freeze()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn, cfg)
+	}
+}
+
+func serveConn(conn net.Conn, cfg ServerConfig) {
+	defer conn.Close()
+
+	opts := cfg.Options
+	opts.Disabled |= evaluator.Stdin
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = DefaultServerMaxDepth
+	}
+	if opts.MaxMemory <= 0 {
+		opts.MaxMemory = DefaultServerMaxMemory
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = DefaultServerMaxSteps
+	}
+
+	// Every connection gets its own puts, the other builtins are shared
+	opts.Builtins = evaluator.BuiltinsWithOutput(opts.Builtins, conn)
+
+	// a panic of an input only reaches its own connection, this
+	// catches the ones outside of an input like the banner or the rc file
+	defer func() {
+		if v := recover(); v != nil {
+			fmt.Fprintf(conn, "internal error: %v\n", v)
+		}
+	}()
+
+	New(Config{
+		Reader:        conn,
+		Writer:        conn,
+		Banner:        cfg.Banner,
+		Env:           cfg.Env,
+		Options:       opts,
+		RecoverPanics: true,
+		Context: func() (context.Context, context.CancelFunc) {
+			if cfg.Timeout > 0 {
+				return context.WithTimeout(context.Background(), cfg.Timeout)
+			}
+			return context.WithCancel(context.Background())
+		},
+	}).Run()
+}
@@ -0,0 +1,133 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"monkey/evaluator"
+	"monkey/object"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sends the input over a new connection and returns everything the
+// server wrote until it closed the connection
+func serveInput(t *testing.T, addr, input string) string {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, input+":quit\n")
+	out, err := io.ReadAll(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatalf("could not read: %s", err)
+	}
+	return string(out)
+}
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen: %s", err)
+	}
+	defer l.Close()
+
+	env := object.NewEnvironment()
+	env.Set("answer", object.NewInteger(42))
+	go Serve(l, ServerConfig{
+		Env: env,
+		// the loop below is stopped by the timeout, not the default limits
+		Options: evaluator.Options{Disabled: evaluator.AllCapabilities, MaxMemory: 1 << 40, MaxSteps: 1 << 40},
+		Timeout: 50 * time.Millisecond,
+		Banner:  "welcome\n",
+	})
+	addr := l.Addr().String()
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"let x = answer;\nputs(x + 1)\n", []string{"welcome\n", "43\nnull\n"}},
+		// every connection has its own session
+		{"x\n", []string{"ERROR: identifier not found: x"}},
+		{"for (i in 0..1000000000000) { i }\nanswer\n", []string{"ERROR: evaluation cancelled", "42\n"}},
+		{":load /etc/passwd\n", []string{":load is disabled"}},
+		{"readFile(\"/etc/passwd\")\n", []string{"ERROR:"}},
+	}
+
+	for _, tt := range tests {
+		got := serveInput(t, addr, tt.input)
+		for _, want := range tt.want {
+			if !strings.Contains(got, want) {
+				t.Errorf("input %q: missing %q. got=%q", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestServeLimits(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen: %s", err)
+	}
+	defer l.Close()
+
+	env := object.NewEnvironment()
+	env.Set("answer", object.NewInteger(42))
+	go Serve(l, ServerConfig{Env: env, Timeout: 5 * time.Second})
+	addr := l.Addr().String()
+
+	// one connection recursing forever must not take the others down
+	recursing, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer recursing.Close()
+	io.WriteString(recursing, "let f = fn(n) { f(n + 1) }; f(0)\nanswer\n:quit\n")
+	if got := serveInput(t, addr, "answer + 1\n"); !strings.Contains(got, "43") {
+		t.Errorf("expected the other connection to keep working, got=%q", got)
+	}
+
+	out, err := io.ReadAll(recursing)
+	if err != nil {
+		t.Fatalf("could not read: %s", err)
+	}
+	got := string(out)
+	for _, want := range []string{"ERROR: call depth exceeded: more than 1000 nested calls", "42\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q. got=%q", want, got)
+		}
+	}
+	if got := serveInput(t, addr, "let s = \"x\"; for (i in 0..100) { s = s + s }\n"); !strings.Contains(got, "ERROR: memory limit exceeded") {
+		t.Errorf("expected the default memory limit, got=%q", got)
+	}
+}
+
+func TestServeRecoversPanics(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen: %s", err)
+	}
+	defer l.Close()
+
+	env := object.NewEnvironment()
+	env.Set("answer", object.NewInteger(42))
+	env.Set("boom", &object.Builtin{Fn: func(args ...object.Object) object.Object { panic("boom") }})
+	go Serve(l, ServerConfig{Env: env, Timeout: 5 * time.Second})
+	addr := l.Addr().String()
+
+	// the connection gets an error and can go on
+	got := serveInput(t, addr, "boom()\nanswer\n")
+	for _, want := range []string{"internal error: boom", "42\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q. got=%q", want, got)
+		}
+	}
+	if got := serveInput(t, addr, "answer + 1\n"); !strings.Contains(got, "43") {
+		t.Errorf("expected the server to keep serving, got=%q", got)
+	}
+}
@@ -0,0 +1,398 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// The evaluation side of the REPL without any input or output, so GUIs,
+// notebooks and tests can drive a session themselves
+// All inputs share one scope on top of env, a let stays around for the
+// next input and a failed input is undone as a whole
+type Session struct {
+	// The bindings every input can use (e.g. the prelude)
+	env *object.Environment
+	// One scope for the whole session, so a let on one line can be used on the next
+	scope *object.Environment
+	// The inputs that evaluated without an error
+	inputs []string
+	// The values of the inputs which had one, bound to $1, $2, ...
+	results []object.Object
+	// The inputs which bound something, newest last, see Undo
+	definitions []definition
+	// Names removed with Undefine which the inputs still use, saving the
+	// inputs would bring them back
+	removed []string
+
+	// The limits and sandbox every input is evaluated with
+	Options evaluator.Options
+	// The modules the inputs imported, unless Options has its own
+	modules *evaluator.Modules
+	// Closed by Reset and Close, the generators of the inputs live until then
+	generatorsStop chan struct{}
+	// Counts the evaluated nodes into Result.Nodes, it slows the evaluation down a bit
+	CountNodes bool
+	nodes      atomic.Int64
+
+	// What runs the inputs, the evaluator unless it's set
+	Engine Engine
+	// Compiled and run before the first input on the VM, e.g. the
+	// prelude. The evaluator gets its bindings from env instead
+	VMPrelude []*ast.Program
+	// Made by the first input on the VM
+	vm *vmSession
+}
+
+type Result struct {
+	// nil for inputs without a value, e.g. a let statement
+	Value    object.Object
+	Duration time.Duration
+	// Only counted with Session.CountNodes
+	Nodes int64
+}
+
+// Returned when the input didn't parse, nothing was evaluated then
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parser errors: " + strings.Join(e.Errors, "; ")
+}
+
+// Returned when the evaluation ended with an error, the bindings made by
+// the input are rolled back
+type RuntimeError struct {
+	Err *object.Error
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Message
+}
+
+func NewSession(env *object.Environment) *Session {
+	s := &Session{env: env}
+	s.Reset()
+	return s
+}
+
+// The scope the inputs are evaluated in
+func (s *Session) Env() *object.Environment {
+	return s.scope
+}
+
+// Forgets everything the inputs defined, env is kept
+func (s *Session) Reset() {
+	s.scope = object.NewEnclosedEnvironment(s.env)
+	s.inputs = nil
+	s.results = nil
+	s.definitions = nil
+	s.removed = nil
+	s.vm = nil
+	s.modules = evaluator.NewModules()
+	if s.generatorsStop != nil {
+		close(s.generatorsStop)
+	}
+	s.generatorsStop = make(chan struct{})
+}
+
+// Stops the generators the inputs made which are still paused, the
+// session can't be used afterwards
+func (s *Session) Close() {
+	close(s.generatorsStop)
+	s.generatorsStop = nil
+}
+
+// Options with the modules of the session, so an input imports the same
+// module as the ones before it
+func (s *Session) options() evaluator.Options {
+	opts := s.Options
+	if opts.Modules == nil {
+		opts.Modules = s.modules
+	}
+	if opts.GeneratorsStop == nil {
+		// a generator bound by one input is still there for the next ones
+		opts.GeneratorsStop = s.generatorsStop
+	}
+	return opts
+}
+
+// What Undo needs to take back one input
+type definition struct {
+	input string
+	// The scope before the input and the names the input changed
+	before *object.Checkpoint
+	names  []string
+	// The same for the globals of the VM, when the input ran on it
+	vmBefore *vmCheckpoint
+	vmNames  []string
+}
+
+// The inputs that evaluated without an error in the order they were entered,
+// together they recreate the session
+func (s *Session) Inputs() []string {
+	return s.inputs
+}
+
+// The inputs as one script which recreates the session, every input ends
+// with a semicolon so it can't continue the one before it. Inputs which use
+// $n, _ or a name removed with Undefine can't be saved, the script would
+// mean something else
+func (s *Session) Script() (string, error) {
+	var script strings.Builder
+	for _, input := range s.inputs {
+		program, err := parse(input)
+		if err != nil {
+			return "", err
+		}
+		if name, ok := usesResult(program); ok {
+			return "", fmt.Errorf("%q uses %s, the value of an earlier input", summarize(input, 40), name)
+		}
+		script.WriteString(terminated(input))
+		script.WriteString("\n")
+	}
+	for _, name := range s.removed {
+		for _, input := range s.inputs {
+			if program, _ := parse(input); uses(program, name) {
+				return "", fmt.Errorf("%q uses %s, which was removed", summarize(input, 40), name)
+			}
+		}
+	}
+	return script.String(), nil
+}
+
+// The name of the first $n or _ the program uses
+func usesResult(program *ast.Program) (string, bool) {
+	var found string
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && found == "" {
+			if ident.Value == LAST_RESULT || strings.HasPrefix(ident.Value, "$") {
+				found = ident.Value
+			}
+		}
+		return found == ""
+	})
+	return found, found != ""
+}
+
+func uses(program *ast.Program, name string) bool {
+	found := false
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && ident.Value == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// input with a semicolon behind its last statement, on a line of its own
+// when a comment ends the input
+func terminated(input string) string {
+	l := lexer.New(input)
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		last = tok
+	}
+	if last.Type == token.SEMICOLON || last.Type == "" {
+		return input
+	}
+	if comments := l.Comments(); len(comments) > 0 && comments[len(comments)-1].Pos.Line >= last.Pos.Line {
+		return input + "\n;"
+	}
+	return input + ";"
+}
+
+// The values of the inputs so far, the first one is bound to $1
+func (s *Session) Results() []object.Object {
+	return s.results
+}
+
+func resultName(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+// Evaluates one complete input (it may span several lines) and binds
+// the value to _ and the next $n
+func (s *Session) EvalLine(line string) (Result, error) {
+	return s.EvalLineContext(context.Background(), line)
+}
+
+// Like EvalLine but the evaluation stops with a RuntimeError once ctx is cancelled
+func (s *Session) EvalLineContext(ctx context.Context, line string) (Result, error) {
+	before := s.scope.Checkpoint()
+	var vmBefore *vmCheckpoint
+	if s.Engine == VMEngine {
+		if err := s.startVM(ctx); err != nil {
+			return Result{}, err
+		}
+		vmBefore = s.vm.checkpoint()
+	}
+	result, err := s.evaluate(ctx, line)
+	if err != nil {
+		return result, err
+	}
+
+	def := definition{input: line, before: before, names: s.scope.Changed(before), vmBefore: vmBefore}
+	if vmBefore != nil {
+		def.vmNames = s.vm.changed(vmBefore)
+	}
+	if len(def.names) > 0 || len(def.vmNames) > 0 {
+		s.definitions = append(s.definitions, def)
+	}
+	s.inputs = append(s.inputs, line)
+	if result.Value != nil {
+		s.results = append(s.results, result.Value)
+		s.bindResult(LAST_RESULT, result.Value)
+		s.bindResult(resultName(len(s.results)), result.Value)
+	}
+	return result, nil
+}
+
+// Results can be used by the next input whichever engine runs it
+func (s *Session) bindResult(name string, value object.Object) {
+	s.scope.Set(name, value)
+	if s.vm != nil {
+		s.vm.set(name, value)
+	}
+}
+
+// Calls a function value with the Options of the session, e.g. a hook
+// the rc file registered
+func (s *Session) Call(ctx context.Context, fn object.Object, args ...object.Object) (object.Object, error) {
+	result := evaluator.ApplyWithOptions(ctx, fn, args, s.options())
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Err: errObj}
+	}
+	return result, nil
+}
+
+// Removes a binding of the session, bindings of env can't be removed
+// Returns false if the name isn't bound in the session. The inputs which
+// bound nothing else are no longer Inputs, Undo can still take them back
+func (s *Session) Undefine(name string) bool {
+	deleted := s.scope.Delete(name)
+	if s.vm != nil && s.vm.forget(name) {
+		deleted = true
+	}
+	if !deleted {
+		return false
+	}
+
+	s.removed = append(s.removed, name)
+	for _, def := range s.definitions {
+		names := slices.Concat(def.names, def.vmNames)
+		if !slices.Contains(names, name) || !allRemoved(names, s.removed) {
+			continue
+		}
+		for i := len(s.inputs) - 1; i >= 0; i-- {
+			if s.inputs[i] == def.input {
+				s.inputs = append(s.inputs[:i], s.inputs[i+1:]...)
+				break
+			}
+		}
+	}
+	return true
+}
+
+func allRemoved(names, removed []string) bool {
+	for _, name := range names {
+		if !slices.Contains(removed, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Takes back the last input which bound or assigned something, the names
+// it changed get their old values back (or are unbound again) and it's no
+// longer one of the Inputs. Returns the input, false if there is none
+func (s *Session) Undo() (string, bool) {
+	if len(s.definitions) == 0 {
+		return "", false
+	}
+
+	last := s.definitions[len(s.definitions)-1]
+	s.definitions = s.definitions[:len(s.definitions)-1]
+	s.scope.Restore(last.before, last.names...)
+	if last.vmBefore != nil && s.vm != nil {
+		s.vm.restore(last.vmBefore, last.vmNames...)
+	}
+
+	for i := len(s.inputs) - 1; i >= 0; i-- {
+		if s.inputs[i] == last.input {
+			s.inputs = append(s.inputs[:i], s.inputs[i+1:]...)
+			break
+		}
+	}
+	return last.input, true
+}
+
+// Parses and evaluates source in the session scope (or on the VM with
+// its globals), without remembering it as an input or binding _
+func (s *Session) evaluate(ctx context.Context, source string) (Result, error) {
+	program, err := parse(source)
+	if err != nil {
+		return Result{}, err
+	}
+	if s.Engine == VMEngine {
+		return s.runOnVM(ctx, program)
+	}
+	return s.evaluateTree(ctx, program)
+}
+
+func parse(source string) (*ast.Program, error) {
+	// Init the Lexer
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &ParseError{Errors: p.Errors()}
+	}
+	return program, nil
+}
+
+// Evaluates the program with the evaluator whatever the Engine is
+func (s *Session) evaluateTree(ctx context.Context, program *ast.Program) (Result, error) {
+	opts := s.options()
+	if s.CountNodes {
+		s.nodes.Store(0)
+		before := opts.BeforeEval
+		opts.BeforeEval = func(node ast.Node, env *object.Environment) {
+			s.nodes.Add(1)
+			if before != nil {
+				before(node, env)
+			}
+		}
+	}
+
+	// A failed input is undone as a whole, e.g. the a of
+	// "let a = 1; let b = nope;" shouldn't be bound afterwards
+	checkpoint := s.scope.Checkpoint()
+	start := time.Now()
+	evaluated := evaluator.EvalWithOptions(ctx, program, s.scope, opts)
+	result := Result{Value: evaluated, Duration: time.Since(start)}
+	if s.CountNodes {
+		result.Nodes = s.nodes.Load()
+	}
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		s.scope.Rollback(checkpoint)
+		result.Value = nil
+		return result, &RuntimeError{Err: errObj}
+	}
+
+	return result, nil
+}
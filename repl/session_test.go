@@ -0,0 +1,310 @@
+package repl
+
+import (
+	"context"
+	"errors"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"reflect"
+	"testing"
+)
+
+func TestSessionEvalLine(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+
+	result, err := s.EvalLine("let double = fn(x) { x * 2 };")
+	if err != nil || result.Value != nil {
+		t.Fatalf("let should have no value. got=%v, %v", result.Value, err)
+	}
+
+	result, err = s.EvalLine("double(21)")
+	if err != nil {
+		t.Fatalf("EvalLine returned error: %s", err)
+	}
+	testInteger(t, result.Value, 42)
+
+	result, _ = s.EvalLine("_ + 1")
+	testInteger(t, result.Value, 43)
+
+	expected := []string{"let double = fn(x) { x * 2 };", "double(21)", "_ + 1"}
+	if !reflect.DeepEqual(s.Inputs(), expected) {
+		t.Errorf("wrong inputs. expected=%q, got=%q", expected, s.Inputs())
+	}
+}
+
+func TestSessionResults(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+	for _, line := range []string{"1 + 2", "let x = 10;", "x * 2", "nope", "$1 + $2"} {
+		s.EvalLine(line)
+	}
+
+	expected := []int64{3, 20, 23}
+	if len(s.Results()) != len(expected) {
+		t.Fatalf("wrong number of results. expected=%d, got=%d", len(expected), len(s.Results()))
+	}
+	for i, want := range expected {
+		testInteger(t, s.Results()[i], want)
+	}
+
+	s.Reset()
+	if len(s.Results()) != 0 {
+		t.Errorf("Reset should forget the results. got=%d", len(s.Results()))
+	}
+	if _, err := s.EvalLine("$1"); err == nil {
+		t.Errorf("$1 should be gone after Reset")
+	}
+}
+
+func TestSessionUndo(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+	for _, line := range []string{"let f = fn(x) { x };", "let f = fn(x) { x + 1 };", "f(1)", "let g = f;"} {
+		s.EvalLine(line)
+	}
+
+	for _, want := range []string{"let g = f;", "let f = fn(x) { x + 1 };"} {
+		input, ok := s.Undo()
+		if !ok || input != want {
+			t.Errorf("wrong undo. expected=%q, got=%q", want, input)
+		}
+	}
+	if s.Env().HasLocal("g") {
+		t.Errorf("g should be gone after undo")
+	}
+	result, _ := s.EvalLine("f(1)")
+	testInteger(t, result.Value, 1)
+
+	expected := []string{"let f = fn(x) { x };", "f(1)", "f(1)"}
+	if !reflect.DeepEqual(s.Inputs(), expected) {
+		t.Errorf("wrong inputs. expected=%q, got=%q", expected, s.Inputs())
+	}
+
+	if !s.Undefine("f") || s.Undefine("f") {
+		t.Errorf("f should be removed exactly once")
+	}
+	s.Undo()
+	if _, ok := s.Undo(); ok {
+		t.Errorf("there should be nothing left to undo")
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+
+	_, err := s.EvalLine("let = 1")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || len(parseErr.Errors) == 0 {
+		t.Errorf("expected a ParseError, got=%v", err)
+	}
+
+	_, err = s.EvalLine("let a = 1; a + true")
+	var runtimeErr *RuntimeError
+	if !errors.As(err, &runtimeErr) || runtimeErr.Err.Message != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("expected a RuntimeError, got=%v", err)
+	}
+	if s.Env().HasLocal("a") {
+		t.Errorf("the failed input should have been rolled back")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.EvalLineContext(ctx, "for (x in 0..100) { x }"); !errors.As(err, &runtimeErr) {
+		t.Errorf("expected a cancelled evaluation, got=%v", err)
+	}
+
+	if len(s.Inputs()) != 0 {
+		t.Errorf("failed inputs should not be remembered. got=%q", s.Inputs())
+	}
+}
+
+func TestSessionCountNodes(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+
+	result, _ := s.EvalLine("1 + 2")
+	if result.Nodes != 0 {
+		t.Errorf("nodes should only be counted with CountNodes. got=%d", result.Nodes)
+	}
+
+	s.CountNodes = true
+	result, _ = s.EvalLine("1 + 2")
+	if result.Nodes != 5 {
+		t.Errorf("wrong number of nodes. expected=5, got=%d", result.Nodes)
+	}
+}
+
+func TestSessionReset(t *testing.T) {
+	env := object.NewEnvironment()
+	env.Set("base", object.NewInteger(1))
+	s := NewSession(env)
+
+	s.EvalLine("let x = 1;")
+	s.Reset()
+	if s.Env().HasLocal("x") || len(s.Inputs()) != 0 {
+		t.Errorf("Reset should forget the session")
+	}
+	result, _ := s.EvalLine("base")
+	testInteger(t, result.Value, 1)
+}
+
+func TestSessionGenerators(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+	s.EvalLine("let g = fn*() { yield 1; yield 2; yield 3 };")
+	s.EvalLine("let it = g();")
+
+	// the generator lives on between the inputs
+	for _, want := range []int64{1, 2, 3} {
+		result, err := s.EvalLine("next(it)")
+		if err != nil {
+			t.Fatalf("EvalLine returned error: %s", err)
+		}
+		testInteger(t, result.Value, want)
+	}
+
+	// until the session is reset
+	s.EvalLine("let it = g();")
+	s.EvalLine("next(it)")
+	it, _ := s.Env().Get("it")
+	s.Reset()
+	if _, value, ok := it.(*object.Generator).Next(); ok {
+		t.Errorf("expected a stopped generator after Reset, got=%v", value)
+	}
+}
+
+func testInteger(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+	integer, ok := obj.(*object.Integer)
+	if !ok || integer.Value != expected {
+		t.Errorf("expected integer %d, got=%v", expected, obj)
+	}
+}
+
+func TestSessionOnVM(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+	s.Engine = VMEngine
+	s.VMPrelude = []*ast.Program{parser.New(lexer.New("let double = fn(x) { x * 2 };")).ParseProgram()}
+
+	result, err := s.EvalLine("let a = double(3);")
+	if err != nil || result.Value != nil {
+		t.Fatalf("let should have no value. got=%v, %v", result.Value, err)
+	}
+	for _, tt := range []struct {
+		input    string
+		expected int64
+	}{
+		{"a + 1", 7},
+		{"_ * 2", 14},
+		{"let f = fn(x) { x + a }; f(1)", 7},
+		{"$1 + $2 + $3", 28},
+		{"a = 10; f(0)", 10},
+	} {
+		result, err := s.EvalLine(tt.input)
+		if err != nil {
+			t.Fatalf("%q: EvalLine returned error: %s", tt.input, err)
+		}
+		testInteger(t, result.Value, tt.expected)
+	}
+
+	// a failed input is undone, its lets and assignments
+	for _, tt := range []struct {
+		input    string
+		expected string
+	}{
+		{"let b = 1; a = 0; 1 / 0", "division by zero"},
+		{"b", "undefined variable b"},
+		{"let c = 1; nope", "undefined variable nope"},
+		{"c", "undefined variable c"},
+	} {
+		_, err := s.EvalLine(tt.input)
+		var runtimeErr *RuntimeError
+		if !errors.As(err, &runtimeErr) || runtimeErr.Err.Message != tt.expected {
+			t.Errorf("%q: expected a RuntimeError %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+	result, _ = s.EvalLine("a")
+	testInteger(t, result.Value, 10)
+
+	// the evaluator has bindings of its own
+	s.Engine = EvaluatorEngine
+	if _, err := s.EvalLine("a"); err == nil {
+		t.Errorf("a of the vm should not be defined in the evaluator")
+	}
+
+	s.Engine = VMEngine
+	s.Options.MaxSteps = 100
+	_, err = s.EvalLine("for (i in 0..1000) { i }")
+	if err == nil || err.Error() != "instruction budget exceeded: more than 100 instructions" {
+		t.Errorf("expected the budget to stop the loop, got=%v", err)
+	}
+
+	// the builtins which need a capability are there, in the sandbox too
+	s.Options = evaluator.Options{Deterministic: true}
+	result, err = s.EvalLine("now()")
+	if err != nil {
+		t.Fatalf("now() returned error: %s", err)
+	}
+	testInteger(t, result.Value, 0)
+	s.Options = evaluator.Options{Disabled: evaluator.Filesystem}
+	_, err = s.EvalLine(`readFile("x")`)
+	if err == nil || err.Error() != "builtin readFile is disabled: no filesystem access" {
+		t.Errorf("expected readFile to be disabled, got=%v", err)
+	}
+
+	s.Options = evaluator.Options{MaxDepth: 10}
+	_, err = s.EvalLine("let r = fn(n) { if (n == 0) { 0 } else { r(n - 1) } }; r(100)")
+	if err == nil || err.Error() != "call depth exceeded: more than 10 nested calls" {
+		t.Errorf("expected the depth limit to stop the recursion, got=%v", err)
+	}
+	s.Options = evaluator.Options{MaxMemory: 1000}
+	_, err = s.EvalLine(`let s = ""; for (i in 0..1000) { s = s + "abc" }`)
+	if err == nil || err.Error() != "memory limit exceeded: more than 1000 bytes allocated" {
+		t.Errorf("expected the memory limit to stop the loop, got=%v", err)
+	}
+
+	s.Reset()
+	if _, err := s.EvalLine("a"); err == nil {
+		t.Errorf("a should be gone after Reset")
+	}
+}
+
+func TestSessionUndoOnVM(t *testing.T) {
+	s := NewSession(object.NewEnvironment())
+	s.Engine = VMEngine
+	s.VMPrelude = []*ast.Program{parser.New(lexer.New("let double = fn(x) { x * 2 };")).ParseProgram()}
+
+	for _, line := range []string{"let x = 1;", "x = 2;", "x + 1", "let y = x;"} {
+		if _, err := s.EvalLine(line); err != nil {
+			t.Fatalf("%q: EvalLine returned error: %s", line, err)
+		}
+	}
+
+	for _, want := range []string{"let y = x;", "x = 2;"} {
+		input, ok := s.Undo()
+		if !ok || input != want {
+			t.Errorf("wrong undo. expected=%q, got=%q", want, input)
+		}
+	}
+	if _, err := s.EvalLine("y"); err == nil || err.Error() != "undefined variable y" {
+		t.Errorf("y should be gone after undo, got=%v", err)
+	}
+	result, _ := s.EvalLine("x + $2")
+	testInteger(t, result.Value, 4)
+
+	if !s.Undefine("x") || s.Undefine("x") {
+		t.Errorf("x should be removed exactly once")
+	}
+	if _, err := s.EvalLine("x"); err == nil || err.Error() != "undefined variable x" {
+		t.Errorf("x should be gone after Undefine, got=%v", err)
+	}
+	if s.Undefine("double") {
+		t.Errorf("the prelude can't be removed")
+	}
+
+	if input, ok := s.Undo(); !ok || input != "let x = 1;" {
+		t.Errorf("wrong undo. expected=%q, got=%q", "let x = 1;", input)
+	}
+	if _, ok := s.Undo(); ok {
+		t.Errorf("there should be nothing left to undo")
+	}
+}
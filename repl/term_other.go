@@ -0,0 +1,18 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// Raw mode is only implemented for linux, other systems read plain lines
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this system")
+}
+
+func terminalSize(fd int) (width, height int, err error) {
+	return 0, 0, errors.New("terminal size is not supported on this system")
+}
@@ -0,0 +1,60 @@
+package repl
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Colors and cursor movements don't belong into a log file
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[a-zA-Z]`)
+
+// Writes the inputs and outputs of a session to a log, every line starts
+// with the time it was written at
+type transcript struct {
+	mu sync.Mutex
+	w  io.Writer
+	// Set when the last output ended with a newline, the next one gets a timestamp
+	lineStart bool
+}
+
+func newTranscript(w io.Writer) *transcript {
+	t := &transcript{w: w, lineStart: true}
+	t.Write([]byte("# session started\n"))
+	return t
+}
+
+func (t *transcript) stamp() string {
+	return time.Now().Format("2006-01-02 15:04:05") + " "
+}
+
+// Logs one line the user entered together with its prompt
+func (t *transcript) input(prompt, line string) {
+	t.Write([]byte(prompt + line + "\n"))
+}
+
+// Everything the REPL prints goes through here as well
+func (t *transcript) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	text := escapeSequence.ReplaceAllString(string(p), "")
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if line == "" {
+			continue
+		}
+		if t.lineStart {
+			b.WriteString(t.stamp())
+		}
+		b.WriteString(line)
+		t.lineStart = strings.HasSuffix(line, "\n")
+	}
+
+	if _, err := io.WriteString(t.w, b.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
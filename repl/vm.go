@@ -0,0 +1,181 @@
+package repl
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/vm"
+	"slices"
+	"time"
+)
+
+// What runs the inputs of a session, :engine switches it
+type Engine int
+
+const (
+	// Walks the syntax tree of every input, see evaluator.Eval
+	EvaluatorEngine Engine = iota
+	// Compiles every input and runs it on the VM, long loops run faster
+	// The VM has globals of its own, a let of one engine isn't seen by
+	// the other
+	VMEngine
+)
+
+func (e Engine) String() string {
+	if e == VMEngine {
+		return "vm"
+	}
+	return "evaluator"
+}
+
+// The engine of a name String gives, false for an unknown one
+func ParseEngine(name string) (Engine, bool) {
+	switch name {
+	case "evaluator":
+		return EvaluatorEngine, true
+	case "vm":
+		return VMEngine, true
+	}
+	return EvaluatorEngine, false
+}
+
+// What the VM keeps between the inputs: the globals, constants and
+// builtins the compiler knows about and the values of the globals
+type vmSession struct {
+	state   *compiler.State
+	globals []object.Object
+	// The globals of the prelude come first, like env they can't be removed
+	numPrelude int
+}
+
+// Makes the VM of the session with the prelude, unless there is one
+func (s *Session) startVM(ctx context.Context) error {
+	if s.vm != nil {
+		return nil
+	}
+
+	v := &vmSession{state: compiler.NewState(), globals: make([]object.Object, vm.GlobalsSize)}
+	for _, prelude := range s.VMPrelude {
+		if _, err := v.run(ctx, prelude, s.Options); err != nil {
+			return fmt.Errorf("could not compile the prelude: %s", err)
+		}
+	}
+	v.numPrelude = v.state.NumGlobals()
+	s.vm = v
+	return nil
+}
+
+// Compiles the program and runs it on the VM of the session
+func (s *Session) runOnVM(ctx context.Context, program *ast.Program) (Result, error) {
+	if err := s.startVM(ctx); err != nil {
+		return Result{}, err
+	}
+
+	start := time.Now()
+	value, err := s.vm.run(ctx, program, s.Options)
+	result := Result{Value: value, Duration: time.Since(start)}
+	if err != nil {
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			errObj = &object.Error{Message: err.Error()}
+		}
+		return result, &RuntimeError{Err: errObj}
+	}
+	return result, nil
+}
+
+// An input which doesn't compile or ends with an error is undone as a
+// whole like in the evaluator: its definitions are forgotten and the
+// globals it set get their old values back
+// The value is nil when the program doesn't end with an expression
+func (v *vmSession) run(ctx context.Context, program *ast.Program, opts evaluator.Options) (object.Object, error) {
+	// readFile, now, ... are builtins of the VM like any other
+	builtins := evaluator.BuiltinsWithSystem(opts.Builtins, opts)
+
+	comp := compiler.NewWithState(v.state, compiler.Options{Builtins: builtins})
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	bytecode := comp.Bytecode()
+
+	// the new globals start out unset, a failed input may have left a value
+	clear(v.globals[v.state.NumGlobals():len(bytecode.Globals)])
+	before := append([]object.Object{}, v.globals[:len(bytecode.Globals)]...)
+
+	machine := vm.NewWithBuiltinsAndGlobals(bytecode, builtins, v.globals)
+	if err := machine.RunWithOptions(ctx, vmOptions(opts)); err != nil {
+		copy(v.globals, before)
+		return nil, err
+	}
+	v.state = comp.State()
+
+	if len(program.Statements) == 0 {
+		return nil, nil
+	}
+	if _, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement); !ok {
+		return nil, nil
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+// The limits of the evaluator's options the VM has too
+func vmOptions(opts evaluator.Options) vm.Options {
+	return vm.Options{MaxInstructions: opts.MaxSteps, MaxDepth: opts.MaxDepth, MaxMemory: opts.MaxMemory}
+}
+
+// The globals before an input, what Undo needs to take it back on the VM
+type vmCheckpoint struct {
+	state   *compiler.State
+	globals []object.Object
+}
+
+func (v *vmSession) checkpoint() *vmCheckpoint {
+	return &vmCheckpoint{state: v.state, globals: append([]object.Object{}, v.globals[:v.state.NumGlobals()]...)}
+}
+
+// The globals an input defined or set since c, like Environment.Changed
+func (v *vmSession) changed(c *vmCheckpoint) []string {
+	var names []string
+	for i, name := range v.state.Globals() {
+		if name == "" {
+			continue
+		}
+		if i >= len(c.globals) || v.globals[i] != c.globals[i] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Gives the names their values of c back, the ones defined since then
+// are forgotten
+func (v *vmSession) restore(c *vmCheckpoint, names ...string) {
+	known := c.state.Globals()
+	for _, name := range names {
+		index := slices.Index(known, name)
+		if index >= 0 {
+			v.globals[index] = c.globals[index]
+			continue
+		}
+		v.forget(name)
+	}
+}
+
+// Removes a global, false if the inputs never defined it
+func (v *vmSession) forget(name string) bool {
+	index := slices.Index(v.state.Globals(), name)
+	if index < v.numPrelude {
+		return false
+	}
+	v.state, _ = v.state.Forget(name)
+	v.globals[index] = nil
+	return true
+}
+
+// Binds a global the inputs didn't define, e.g. _
+func (v *vmSession) set(name string, value object.Object) {
+	v.globals[v.state.DefineGlobal(name)] = value
+}
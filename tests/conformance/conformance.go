@@ -0,0 +1,123 @@
+// Package conformance holds Monkey programs together with their expected
+// results, so every implementation of the language (the evaluator and the
+// VM) can be checked and benchmarked against the same corpus
+package conformance
+
+import (
+	"monkey/object"
+	"testing"
+)
+
+// Runs a Monkey program and returns the value of its last statement
+// Parser errors should be returned as an *object.Error
+type Engine func(input string) object.Object
+
+// A program and what its result looks like when inspected,
+// errors are expected as "ERROR: message"
+type Case struct {
+	Name     string
+	Input    string
+	Expected string
+}
+
+var Cases = []Case{
+	// integers and booleans
+	{"integer", "5", "5"},
+	{"arithmetic", "(5 + 10 * 2 + 15 / 3) * 2 + -10", "50"},
+	{"comparison", "1 < 2 == true", "true"},
+	{"bang", "!!5", "true"},
+	{"division by zero", "1 / 0", "ERROR: division by zero"},
+
+	// bindings and control flow
+	{"let", "let a = 5; let b = a * 2; b", "10"},
+	{"const", "const c = 1; c = 2", "ERROR: cannot reassign const c"},
+	{"if", "if (1 > 2) { 10 } else { 20 }", "20"},
+	{"if without else", "if (false) { 10 }", "null"},
+	{"empty block", "let x = if (true) {}; x", "null"},
+	{"nested return", "if (10 > 1) { if (10 > 1) { return 10; } return 1; }", "10"},
+	{"identifier before its let", "foobar; let foobar = 1", "ERROR: identifier not found: foobar"},
+	{"type mismatch", "5 + true", "ERROR: type mismatch: INTEGER + BOOLEAN"},
+	{"assignment", "let x = 1; x = x + 1; x", "2"},
+	{"for loop", "let s = 0; for (i in 1..5) { s = s + i }; s", "10"},
+
+	// functions
+	{"call", "let add = fn(a, b) { a + b }; add(1, 2)", "3"},
+	{"closure", "let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)", "5"},
+	{"recursion", "let f = fn(n) { if (n == 0) { 0 } else { n + f(n - 1) } }; f(10)", "55"},
+	{"empty body", "let f = fn() { let a = 1; }; [f()]", "[null]"},
+	{"wrong arguments", "fn(x) { x }(1, 2)", "ERROR: wrong number of arguments: want=1, got=2"},
+
+	// strings, arrays and hashes
+	{"string concatenation", `"Hello" + " " + "World!"`, "Hello World!"},
+	{"template", `let name = "Monkey"; "Hi ${name}!"`, "Hi Monkey!"},
+	{"array index", "[1, 2, 3][1]", "2"},
+	{"array out of range", "[1, 2, 3][3]", "null"},
+	{"array equality", "[1, [2]] == [1, [2]]", "true"},
+	{"hash", `{"one": 1, "two": 2}["two"]`, "2"},
+	{"hash member", `let h = {"a": {"b": 3}}; h.a.b`, "3"},
+	{"hash order", `{"b": 2, "a": 1}`, `{a: 1, b: 2}`},
+	{"hash literal order", `let s = ""; let k = fn(x) { s = s + x; x }; {k("b"): k("1"), k("a"): k("2")}; s`, "b1a2"},
+	{"duplicate hash key", `{"a": 1, "b": 0, "a": 2}["a"]`, "2"},
+	{"nullish", `let h = {}; h["x"] ?? 7`, "7"},
+	{"optional chain", `let h = {}; h["x"]?.a.b`, "null"},
+	{"optional chain call", `let h = {}; h.x?.f(1)[0] ?? 3`, "3"},
+	{"optional chain on a value", `let h = {"x": {}}; h.x?.a.b`, "ERROR: member access not supported: NULL.b"},
+	{"optional chain in parentheses", `let h = {}; (h.x?.y).z`, "ERROR: member access not supported: NULL.z"},
+	{"optional chain in parentheses call", `let h = {}; (h.x?.f)(1)`, "ERROR: not a function: NULL"},
+
+	// builtins
+	{"len", `len("four") + len([1, 2])`, "6"},
+	{"push", "push([1], 2)", "[1, 2]"},
+	{"rest", "rest([1, 2, 3])", "[2, 3]"},
+	{"keys", `keys({"b": 1, "a": 2})`, `[a, b]`},
+	{"len error", "len(1)", "ERROR: argument to `len` not supported, got INTEGER"},
+}
+
+// Programs which take a while, used by the benchmarks
+var Benchmarks = []Case{
+	{"fib", `
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(20)
+`, "6765"},
+	{"string building", `
+let s = "";
+for (i in 0..2000) { s = s + "x" };
+len(s)
+`, "2000"},
+	{"hash heavy", `
+let h = {};
+for (i in 0..300) { h = {"count": (h["count"] ?? 0) + i, "last": i} };
+h["count"]
+`, "44850"},
+	{"array building", `
+let a = [];
+for (i in 0..1000) { a = push(a, i * i) };
+len(a)
+`, "1000"},
+}
+
+// Checks the engine against every case
+func Run(t *testing.T, engine Engine) {
+	for _, tc := range append(Cases, Benchmarks...) {
+		t.Run(tc.Name, func(t *testing.T) {
+			result := engine(tc.Input)
+			if result == nil {
+				t.Fatalf("no result for %q", tc.Input)
+			}
+			if result.Inspect() != tc.Expected {
+				t.Errorf("wrong result for %q. want=%q, got=%q", tc.Input, tc.Expected, result.Inspect())
+			}
+		})
+	}
+}
+
+// Benchmarks the engine with every program in Benchmarks
+func Benchmark(b *testing.B, engine Engine) {
+	for _, tc := range Benchmarks {
+		b.Run(tc.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				engine(tc.Input)
+			}
+		})
+	}
+}
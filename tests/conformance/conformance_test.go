@@ -0,0 +1,92 @@
+package conformance
+
+import (
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"strings"
+	"testing"
+)
+
+func evaluate(input string) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &object.Error{Message: strings.Join(p.Errors(), "\n")}
+	}
+
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+func TestEvaluator(t *testing.T) {
+	Run(t, evaluate)
+}
+
+func BenchmarkEvaluator(b *testing.B) {
+	Benchmark(b, evaluate)
+}
+
+func runVM(input string) object.Object {
+	return compileAndRun(input, compiler.Options{}, vm.New)
+}
+
+func runOptimizedVM(input string) object.Object {
+	return compileAndRun(input, compiler.Options{Optimize: true}, vm.New)
+}
+
+func runRegisterVM(input string) object.Object {
+	return compileAndRun(input, compiler.Options{Optimize: true}, func(b *compiler.Bytecode) *vm.VM {
+		return vm.NewRegisterVM(b, object.DefaultBuiltins)
+	})
+}
+
+// Compiles and runs the program in the VM, compiler and VM errors are
+// returned as the evaluator would
+func compileAndRun(input string, opts compiler.Options, newVM func(*compiler.Bytecode) *vm.VM) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &object.Error{Message: strings.Join(p.Errors(), "\n")}
+	}
+
+	comp := compiler.NewWithOptions(opts)
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	if err := compiler.Verify(comp.Bytecode()); err != nil {
+		return &object.Error{Message: "doesn't verify: " + err.Error()}
+	}
+
+	machine := newVM(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+	return machine.LastPoppedStackElem()
+}
+
+func TestVM(t *testing.T) {
+	Run(t, runVM)
+}
+
+func BenchmarkVM(b *testing.B) {
+	Benchmark(b, runVM)
+}
+
+func TestOptimizedVM(t *testing.T) {
+	Run(t, runOptimizedVM)
+}
+
+func BenchmarkOptimizedVM(b *testing.B) {
+	Benchmark(b, runOptimizedVM)
+}
+
+func TestRegisterVM(t *testing.T) {
+	Run(t, runRegisterVM)
+}
+
+func BenchmarkRegisterVM(b *testing.B) {
+	Benchmark(b, runRegisterVM)
+}
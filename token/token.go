@@ -1,5 +1,10 @@
 package token
 
+import (
+	"sort"
+	"strconv"
+)
+
 // A string is easy to debug and use
 // Not as performant as byte or int though
 type TokenType string
@@ -7,15 +12,39 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	// Where the token starts in the source, set by the lexer
+	Pos Position
+}
+
+// Line and column start at 1, the zero value means the position is unknown
+// (e.g. for nodes the parser made up itself)
+type Position struct {
+	Line   int
+	Column int
+	// The file, when it's not the one the program is run from, e.g.
+	// <prelude>/list.monkey for the standard library
+	File string
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+// 3:14
+func (p Position) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	// Never returned by NextToken, see Lexer.Comments
+	COMMENT = "COMMENT"
 
 	// Identifiers + literals
-	IDENT = "IDENT" // add, foo, x, y
-	INT   = "INT"
+	IDENT  = "IDENT" // add, foo, x, y
+	INT    = "INT"
+	STRING = "STRING"
+	// A string with ${...} in it, the Literal is the raw source between the quotes
+	TEMPLATE = "TEMPLATE"
 
 	// Operators
 	ASSIGN   = "="
@@ -31,33 +60,65 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	NULLISH      = "??"
+	OPTIONAL_DOT = "?."
+	RANGE        = ".."
+
 	// Delimiters
 	COMMA     = ","
 	SEMICOLON = ";"
+	COLON     = ":"
+	DOT       = "."
 
-	LPAREN = "("
-	RPAREN = ")"
-	LBRACE = "{"
-	RBRACE = "}"
+	LPAREN   = "("
+	RPAREN   = ")"
+	LBRACE   = "{"
+	RBRACE   = "}"
+	LBRACKET = "["
+	RBRACKET = "]"
 
 	// Keywords
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
+	CONST    = "CONST"
 	TRUE     = "TRUE"
 	FALSE    = "FALSE"
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	FOR      = "FOR"
+	IN       = "IN"
+	YIELD    = "YIELD"
+	SPAWN    = "SPAWN"
+	LAZY     = "LAZY"
 )
 
 var keywords = map[string]TokenType{
 	"fn":     FUNCTION,
 	"let":    LET,
+	"const":  CONST,
 	"true":   TRUE,
 	"false":  FALSE,
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"import": IMPORT,
+	"for":    FOR,
+	"in":     IN,
+	"yield":  YIELD,
+	"spawn":  SPAWN,
+	"lazy":   LAZY,
+}
+
+// All keywords in alphabetical order
+func Keywords() []string {
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func LookupIdent(ident string) TokenType {
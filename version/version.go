@@ -0,0 +1,47 @@
+// The version of the interpreter, release builds set it with
+// go build -ldflags "-X monkey/version.Version=v1.2.0"
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// dev for builds which didn't set it
+var Version = "dev"
+
+// monkey v1.2.0 (go1.23.1 linux/amd64), a dev build shows the commit it
+// was built from if the go tool knows it
+func String() string {
+	v := Version
+	if v == "dev" {
+		if revision := revision(); revision != "" {
+			v += " " + revision
+		}
+	}
+	return "monkey " + v + " (" + runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH + ")"
+}
+
+func revision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	revision, modified := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if revision != "" && modified {
+		revision += "-dirty"
+	}
+	return revision
+}
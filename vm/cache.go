@@ -0,0 +1,67 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/object"
+)
+
+// The inline cache of one OpIndex or OpMember, what it looked up last
+// time. Hashes never change, so the same key in the same hash is the
+// value from before, which is what a loop reading `config.size` or
+// `h["a"]` does every iteration. A new hash with the key from before
+// only skips hashing the key, for a string that's a pass over its
+// bytes. Keys are compared by identity, a name or a string
+// literal is the same constant every time
+// Globals need no cache, the compiler already resolved their names to
+// the index of OpGetGlobal
+type inlineCache struct {
+	key    object.Object
+	hashed object.HashedKey
+	hash   *object.Hash
+	value  object.Object
+}
+
+func (c *inlineCache) lookup(hash *object.Hash, key object.Object) (object.Object, error) {
+	if key != c.key {
+		hashable, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+		c.key = key
+		c.hashed = object.NewHashedKey(hashable.HashKey())
+		c.hash = nil
+	} else if hash == c.hash {
+		return c.value, nil
+	}
+
+	pair, ok := hash.GetHashed(c.hashed)
+	if !ok {
+		pair.Value = Null
+	}
+	c.hash = hash
+	c.value = pair.Value
+	return c.value, nil
+}
+
+// The cache of the instruction at ip in the current frame, made the first
+// time the instruction runs. The register VM has one per instruction in
+// the translated function
+func (vm *VM) inlineCache(ip int) *inlineCache {
+	frame := vm.currentFrame()
+	if frame.rf != nil {
+		return frame.rf.cache(ip)
+	}
+
+	if frame.caches == nil {
+		fn := frame.cl.Fn
+		frame.caches = vm.inlineCaches[fn]
+		if frame.caches == nil {
+			frame.caches = make([]*inlineCache, len(fn.Instructions))
+			vm.inlineCaches[fn] = frame.caches
+		}
+	}
+	if frame.caches[ip] == nil {
+		frame.caches[ip] = &inlineCache{}
+	}
+	return frame.caches[ip]
+}
@@ -0,0 +1,28 @@
+package vm
+
+import (
+	"monkey/code"
+	"monkey/object"
+)
+
+// The state of one call: the closure, where in its instructions the VM
+// is and where its locals start on the stack
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+	// The translation of the closure's function in the register VM, ip is
+	// an index into its instructions then
+	rf *registerFunction
+	// The inline caches of the function by the position of their
+	// instruction, set when the first one is needed
+	caches []*inlineCache
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,169 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"monkey/code"
+	"sort"
+	"text/tabwriter"
+)
+
+// Instructions between two samples of NewProfiler
+const DefaultSampleInterval = 100
+
+// Counts how often each opcode ran and samples which functions are
+// running, pass it in Options.Profiler to enable it
+// Every sample interval instructions the function of the current frame
+// gets a self tick and every function on the stack a total tick, so a
+// function which calls slow ones has a high total but a low self count
+// One profiler can be shared by several runs one after another, the
+// numbers add up
+type Profiler struct {
+	interval int64
+	opcodes  [256]int64
+	// The instructions of the register VM
+	registerOps [256]int64
+	samples     int64
+	self        map[string]int64
+	total       map[string]int64
+}
+
+type OpcodeCount struct {
+	Name  string
+	Count int64
+}
+
+type FunctionTicks struct {
+	Name  string
+	Self  int64
+	Total int64
+}
+
+func NewProfiler() *Profiler {
+	return NewSamplingProfiler(DefaultSampleInterval)
+}
+
+// Samples every interval instructions, 1 samples all of them
+func NewSamplingProfiler(interval int64) *Profiler {
+	if interval < 1 {
+		interval = 1
+	}
+	return &Profiler{
+		interval: interval,
+		self:     map[string]int64{},
+		total:    map[string]int64{},
+	}
+}
+
+// Called before every instruction, executed counts them from the start of
+// the run
+func (p *Profiler) record(vm *VM, op byte, executed int64) {
+	if vm.registers {
+		p.registerOps[op]++
+	} else {
+		p.opcodes[op]++
+	}
+	if executed%p.interval != 0 {
+		return
+	}
+	p.samples++
+
+	p.self[functionName(vm, vm.framesIndex-1)]++
+	seen := map[string]bool{}
+	for i := 0; i < vm.framesIndex; i++ {
+		name := functionName(vm, i)
+		if !seen[name] {
+			seen[name] = true
+			p.total[name]++
+		}
+	}
+}
+
+// Functions are named after the let they are bound to, the main program
+// in the first frame is <main>
+func functionName(vm *VM, frame int) string {
+	switch name := vm.frames[frame].cl.Fn.Name; {
+	case frame == 0:
+		return "<main>"
+	case name != "":
+		return name
+	default:
+		return "<anonymous>"
+	}
+}
+
+// The opcodes which ran sorted by how often, most first. The register
+// VM's instructions are named without the Op in front
+func (p *Profiler) Opcodes() []OpcodeCount {
+	result := []OpcodeCount{}
+	for op, count := range p.opcodes {
+		if count != 0 {
+			result = append(result, OpcodeCount{Name: opName(code.Opcode(op)), Count: count})
+		}
+	}
+	for op, count := range p.registerOps {
+		if count != 0 {
+			result = append(result, OpcodeCount{Name: registerOpName(byte(op)), Count: count})
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// The sampled functions sorted by their self ticks, most first
+func (p *Profiler) Functions() []FunctionTicks {
+	result := make([]FunctionTicks, 0, len(p.total))
+	for name, total := range p.total {
+		result = append(result, FunctionTicks{Name: name, Self: p.self[name], Total: total})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Self != result[j].Self {
+			return result[i].Self > result[j].Self
+		}
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// How many samples were taken, the ticks of the functions are out of it
+func (p *Profiler) Samples() int64 {
+	return p.samples
+}
+
+// Writes both tables in a human readable form
+func (p *Profiler) Report(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "FUNCTION\tSELF\tTOTAL\t(%d samples, one every %d instructions)\n", p.samples, p.interval)
+	for _, fn := range p.Functions() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", fn.Name, percent(fn.Self, p.samples), percent(fn.Total, p.samples))
+	}
+
+	w.Flush()
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "OPCODE\tCOUNT")
+	for _, op := range p.Opcodes() {
+		fmt.Fprintf(w, "%s\t%d\n", op.Name, op.Count)
+	}
+
+	w.Flush()
+}
+
+func percent(n, of int64) string {
+	if of == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(of))
+}
@@ -0,0 +1,90 @@
+package vm
+
+import (
+	"context"
+	"monkey/compiler"
+	"strings"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	input := `
+let square = fn(x) { x * x };
+let sum = 0;
+for (i in 0..10) { sum = sum + square(i) };
+(fn() { sum })()
+`
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	profiler := NewSamplingProfiler(1)
+	vm := New(comp.Bytecode())
+	if err := vm.RunWithOptions(context.Background(), Options{Profiler: profiler}); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testIntegerObject(285, vm.LastPoppedStackElem()); err != nil {
+		t.Errorf("wrong result: %s", err)
+	}
+
+	opcodes := map[string]int64{}
+	var executed int64
+	for _, entry := range profiler.Opcodes() {
+		opcodes[entry.Name] = entry.Count
+		executed += entry.Count
+	}
+	if opcodes["OpMul"] != 10 || opcodes["OpCall"] != 11 || opcodes["OpIterNext"] != 11 {
+		t.Errorf("wrong opcode counts. got=%v", opcodes)
+	}
+	// every instruction is a sample
+	if profiler.Samples() != executed {
+		t.Errorf("wrong number of samples. want=%d, got=%d", executed, profiler.Samples())
+	}
+
+	ticks := map[string]FunctionTicks{}
+	for _, entry := range profiler.Functions() {
+		ticks[entry.Name] = entry
+	}
+	// x, x, OpMul, OpReturnValue per call
+	if ticks["square"].Self != 40 || ticks["square"].Total != 40 {
+		t.Errorf("wrong ticks of square. got=%+v", ticks["square"])
+	}
+	if ticks["<anonymous>"].Self != 2 || ticks["<main>"].Total != executed || len(ticks) != 3 {
+		t.Errorf("wrong ticks. got=%v", ticks)
+	}
+	if ticks["<main>"].Self != executed-42 {
+		t.Errorf("wrong self ticks of main. want=%d, got=%d", executed-42, ticks["<main>"].Self)
+	}
+
+	var out strings.Builder
+	profiler.Report(&out)
+	for _, expected := range []string{"square", "<main>", "OpIterNext", "samples, one every 1 instructions"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("report is missing %q:\n%s", expected, out.String())
+		}
+	}
+}
+
+func TestProfilerSampling(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("for (i in 0..1000) { i }")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	profiler := NewProfiler()
+	for i := 0; i < 2; i++ {
+		if err := New(comp.Bytecode()).RunWithOptions(context.Background(), Options{Profiler: profiler}); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	}
+
+	var executed int64
+	for _, entry := range profiler.Opcodes() {
+		executed += entry.Count
+	}
+	// the numbers of both runs add up
+	if want := 2 * (executed / 2 / DefaultSampleInterval); profiler.Samples() != want {
+		t.Errorf("wrong number of samples. want=%d, got=%d", want, profiler.Samples())
+	}
+}
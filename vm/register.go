@@ -0,0 +1,655 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/code"
+	"monkey/object"
+	"strings"
+)
+
+// The register instruction set, NewRegisterVM runs it. A function's
+// stack bytecode is translated into it on its first call: every slot of
+// the operand stack becomes a register of the frame, after the locals,
+// and an operand can name a local or a constant directly. So `x + 1`
+// is one Add of the local x and the constant instead of pushing both
+// and adding them
+type registerOp byte
+
+const (
+	// a = b
+	regMove registerOp = iota
+	// a = b op c
+	regAdd
+	regSub
+	regMul
+	regDiv
+	regEqual
+	regNotEqual
+	regGreaterThan
+	regLessThan
+	regRange
+	// a = op b
+	regMinus
+	regBang
+	// The value of b is the last popped one, see LastPoppedStackElem
+	regPop
+
+	// a = global b, global a = b
+	regGetGlobal
+	regSetGlobal
+	// local a = b, into its cell when it has one
+	regSetLocal
+
+	// Go to a, to b unless a is truthy, to b unless register a is null
+	regJump
+	regJumpIfFalsy
+	regJumpNotNull
+
+	// a = an iterator over b
+	regIter
+	// The next element of the iterator in a goes to the b registers after
+	// it, jumps to c once there is none
+	regIterNext
+
+	// Calls the function in a with the b registers after it, the result
+	// goes to a
+	regCall
+	regReturn
+	regReturnNull
+
+	// a = a closure of the function constant b with the c cells from a on
+	regClosure
+	// a = free b, free a = b
+	regGetFree
+	regSetFree
+	// a = the cell of local b or free b
+	regCaptureLocal
+	regCaptureFree
+	// Unsets b locals from a on
+	regClearLocals
+
+	// a = builtin b
+	regGetBuiltin
+
+	// a = an array, hash or template of the b registers from a on
+	regArray
+	regHash
+	regTemplate
+	// a = b[c]
+	regIndex
+	// a = b.c and b?.c with the name constant c
+	regMember
+	regOptionalMember
+)
+
+var registerOpNames = map[registerOp]string{
+	regMove: "Move",
+
+	regAdd:         "Add",
+	regSub:         "Sub",
+	regMul:         "Mul",
+	regDiv:         "Div",
+	regEqual:       "Equal",
+	regNotEqual:    "NotEqual",
+	regGreaterThan: "GreaterThan",
+	regLessThan:    "LessThan",
+	regRange:       "Range",
+	regMinus:       "Minus",
+	regBang:        "Bang",
+	regPop:         "Pop",
+
+	regGetGlobal: "GetGlobal",
+	regSetGlobal: "SetGlobal",
+	regSetLocal:  "SetLocal",
+
+	regJump:        "Jump",
+	regJumpIfFalsy: "JumpIfFalsy",
+	regJumpNotNull: "JumpNotNull",
+
+	regIter:     "Iter",
+	regIterNext: "IterNext",
+
+	regCall:       "Call",
+	regReturn:     "Return",
+	regReturnNull: "ReturnNull",
+
+	regClosure:      "Closure",
+	regGetFree:      "GetFree",
+	regSetFree:      "SetFree",
+	regCaptureLocal: "CaptureLocal",
+	regCaptureFree:  "CaptureFree",
+	regClearLocals:  "ClearLocals",
+
+	regGetBuiltin: "GetBuiltin",
+
+	regArray:          "Array",
+	regHash:           "Hash",
+	regTemplate:       "Template",
+	regIndex:          "Index",
+	regMember:         "Member",
+	regOptionalMember: "OptionalMember",
+}
+
+// The stack opcodes of the register ones computing the same
+var binaryOpcodes = map[registerOp]code.Opcode{
+	regAdd:         code.OpAdd,
+	regSub:         code.OpSub,
+	regMul:         code.OpMul,
+	regDiv:         code.OpDiv,
+	regEqual:       code.OpEqual,
+	regNotEqual:    code.OpNotEqual,
+	regGreaterThan: code.OpGreaterThan,
+	regLessThan:    code.OpLessThan,
+	regRange:       code.OpRange,
+}
+
+var binaryRegisterOps = map[code.Opcode]registerOp{}
+
+func init() {
+	for rop, op := range binaryOpcodes {
+		binaryRegisterOps[op] = rop
+	}
+}
+
+// An operand which reads a value is a register when it's 0 or more and
+// constant -1-operand otherwise
+type registerInstruction struct {
+	op      registerOp
+	a, b, c int
+}
+
+func constantOperand(index int) int {
+	return -1 - index
+}
+
+type registerFunction struct {
+	instructions []registerInstruction
+	numLocals    int
+	// The locals and the registers of the operand stack
+	numRegisters int
+	// By the index of the instruction, see inlineCache
+	caches []*inlineCache
+	// By the index of the instruction, the position of the stack
+	// instruction it was translated from for the line table
+	sources []int
+}
+
+func (rf *registerFunction) cache(ip int) *inlineCache {
+	if rf.caches[ip] == nil {
+		rf.caches[ip] = &inlineCache{}
+	}
+	return rf.caches[ip]
+}
+
+// One instruction per line like code.Instructions, constant operands are
+// written k0, k1, ...
+func (rf *registerFunction) String() string {
+	var out strings.Builder
+	for i, ins := range rf.instructions {
+		fmt.Fprintf(&out, "%04d %s", i, registerOpNames[ins.op])
+		for _, operand := range ins.operands() {
+			if operand.constant {
+				fmt.Fprintf(&out, " k%d", -1-operand.value)
+			} else {
+				fmt.Fprintf(&out, " %d", operand.value)
+			}
+		}
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+type listedOperand struct {
+	value    int
+	constant bool
+}
+
+// The operands an instruction has and which of them can be constants
+func (ins registerInstruction) operands() []listedOperand {
+	reg := func(n int) listedOperand { return listedOperand{value: n} }
+	val := func(n int) listedOperand { return listedOperand{value: n, constant: n < 0} }
+
+	switch ins.op {
+	case regReturnNull:
+		return nil
+	case regJump:
+		return []listedOperand{reg(ins.a)}
+	case regPop, regReturn:
+		return []listedOperand{val(ins.a)}
+	case regMove, regMinus, regBang, regSetGlobal, regSetLocal, regIter, regSetFree:
+		return []listedOperand{reg(ins.a), val(ins.b)}
+	case regJumpIfFalsy:
+		return []listedOperand{val(ins.a), reg(ins.b)}
+	case regIndex:
+		return []listedOperand{reg(ins.a), val(ins.b), val(ins.c)}
+	case regMember, regOptionalMember:
+		return []listedOperand{reg(ins.a), val(ins.b), reg(ins.c)}
+	case regIterNext, regClosure:
+		return []listedOperand{reg(ins.a), reg(ins.b), reg(ins.c)}
+	case regGetGlobal, regJumpNotNull, regCall, regGetFree, regCaptureLocal,
+		regCaptureFree, regClearLocals, regGetBuiltin, regArray, regHash, regTemplate:
+		return []listedOperand{reg(ins.a), reg(ins.b)}
+	default:
+		return []listedOperand{reg(ins.a), val(ins.b), val(ins.c)}
+	}
+}
+
+// True, false and null come after the constants of the program, so they
+// can be operands like any other constant
+func registerConstants(constants []object.Object) []object.Object {
+	return append(append([]object.Object{}, constants...), True, False, Null)
+}
+
+// What's on the operand stack while translating: a value in its register
+// or one which isn't loaded yet, a local or a constant
+type stackEntry struct {
+	kind  entryKind
+	value int
+}
+
+type entryKind int
+
+const (
+	inRegister entryKind = iota
+	localEntry
+	constantEntry
+)
+
+type translator struct {
+	fn        *object.CompiledFunction
+	constants int
+	list      []*translatedInstruction
+	depths    map[int]int
+	targets   map[int]bool
+
+	stack []stackEntry
+	out   []registerInstruction
+	// The stack instruction being translated and where each one of out
+	// comes from
+	source  int
+	sources []int
+	// Where each instruction of the stack bytecode starts in out
+	positions map[int]int
+	// The instructions with a jump operand, it's a position in the stack
+	// bytecode until all of them are translated
+	jumps []int
+}
+
+type translatedInstruction struct {
+	op       code.Opcode
+	operands []int
+	pos      int
+	next     int
+}
+
+// Translates a function, numConstants is how many constants the program
+// has, true, false and null come after them
+func translate(fn *object.CompiledFunction, numConstants int) (*registerFunction, error) {
+	t := &translator{fn: fn, constants: numConstants, positions: map[int]int{}}
+	if err := t.decode(); err != nil {
+		return nil, err
+	}
+	maxDepth, err := t.computeDepths()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, in := range t.list {
+		depth, reachable := t.depths[in.pos]
+		if !reachable {
+			t.positions[in.pos] = len(t.out)
+			continue
+		}
+		t.source = in.pos
+		if t.targets[in.pos] {
+			// a jump leaves everything in the registers, so code falling
+			// through to it has to as well
+			t.flush(len(t.stack))
+			t.stack = t.stack[:0]
+			for i := 0; i < depth; i++ {
+				t.stack = append(t.stack, stackEntry{kind: inRegister, value: t.register(i)})
+			}
+		}
+		t.positions[in.pos] = len(t.out)
+		t.instruction(in)
+	}
+	t.positions[len(fn.Instructions)] = len(t.out)
+
+	for _, i := range t.jumps {
+		ins := &t.out[i]
+		switch ins.op {
+		case regJump:
+			ins.a = t.positions[ins.a]
+		case regJumpIfFalsy, regJumpNotNull:
+			ins.b = t.positions[ins.b]
+		case regIterNext:
+			ins.c = t.positions[ins.c]
+		}
+	}
+
+	return &registerFunction{
+		instructions: t.out,
+		numLocals:    fn.NumLocals,
+		numRegisters: fn.NumLocals + maxDepth,
+		caches:       make([]*inlineCache, len(t.out)),
+		sources:      t.sources,
+	}, nil
+}
+
+func (t *translator) decode() error {
+	ins := t.fn.Instructions
+	t.targets = map[int]bool{}
+	for i := 0; i < len(ins); {
+		_, operands, width, err := code.ReadInstruction(ins, i)
+		if err != nil {
+			return err
+		}
+		op := code.Opcode(ins[i])
+		for j, kind := range code.OperandKinds(op) {
+			if kind == code.JumpOperand {
+				t.targets[operands[j]] = true
+			}
+		}
+		t.list = append(t.list, &translatedInstruction{op: op, operands: operands, pos: i, next: i + width})
+		i += width
+	}
+	return nil
+}
+
+// How many values are on the stack before every reachable instruction,
+// the compiler leaves the same number on every path to an instruction
+func (t *translator) computeDepths() (int, error) {
+	byPos := map[int]*translatedInstruction{}
+	for _, in := range t.list {
+		byPos[in.pos] = in
+	}
+
+	t.depths = map[int]int{}
+	maxDepth := 0
+	work := []int{0}
+	t.depths[0] = 0
+	if len(t.list) == 0 {
+		return 0, nil
+	}
+
+	visit := func(pos, depth int) error {
+		if pos == len(t.fn.Instructions) {
+			return nil
+		}
+		if _, ok := byPos[pos]; !ok {
+			return fmt.Errorf("jump to %d is not an instruction", pos)
+		}
+		if known, ok := t.depths[pos]; ok {
+			if known != depth {
+				return fmt.Errorf("%d values on the stack at %d on one path and %d on another", known, pos, depth)
+			}
+			return nil
+		}
+		t.depths[pos] = depth
+		work = append(work, pos)
+		return nil
+	}
+
+	for len(work) > 0 {
+		in := byPos[work[len(work)-1]]
+		work = work[:len(work)-1]
+		depth := t.depths[in.pos]
+
+		pops, pushes := code.StackEffect(in.op, in.operands)
+		if depth < pops {
+			return 0, fmt.Errorf("%s at %d takes %d values from a stack of %d", opName(in.op), in.pos, pops, depth)
+		}
+		after := depth - pops + pushes
+		maxDepth = max(maxDepth, after)
+
+		var err error
+		switch in.op {
+		case code.OpJump:
+			err = visit(in.operands[0], after)
+		case code.OpJumpNotTruthy, code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+			code.OpGreaterThanJumpNotTruthy, code.OpLessThanJumpNotTruthy:
+			if err = visit(in.operands[0], after); err == nil {
+				err = visit(in.next, after)
+			}
+		case code.OpJumpNotNull:
+			// the value stays when it jumps
+			if err = visit(in.operands[0], depth); err == nil {
+				err = visit(in.next, after)
+			}
+		case code.OpIterNext:
+			// the iterator is popped when it's done
+			if err = visit(in.operands[1], depth-1); err == nil {
+				err = visit(in.next, after)
+			}
+		case code.OpReturnValue, code.OpReturn:
+		default:
+			err = visit(in.next, after)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return maxDepth, nil
+}
+
+func opName(op code.Opcode) string {
+	if def, err := code.Lookup(byte(op)); err == nil {
+		return def.Name
+	}
+	return fmt.Sprintf("opcode %d", op)
+}
+
+// The register of the stack slot
+func (t *translator) register(slot int) int {
+	return t.fn.NumLocals + slot
+}
+
+func (t *translator) emit(op registerOp, a, b, c int) {
+	t.out = append(t.out, registerInstruction{op: op, a: a, b: b, c: c})
+	t.sources = append(t.sources, t.source)
+}
+
+func (t *translator) emitJump(op registerOp, a, b, c int) {
+	t.jumps = append(t.jumps, len(t.out))
+	t.emit(op, a, b, c)
+}
+
+func (t *translator) push(kind entryKind, value int) {
+	t.stack = append(t.stack, stackEntry{kind: kind, value: value})
+}
+
+// Pushes what's now in the register of the next slot
+func (t *translator) pushRegister() int {
+	r := t.register(len(t.stack))
+	t.push(inRegister, r)
+	return r
+}
+
+// The operand of the value on top, which is popped
+func (t *translator) pop() int {
+	e := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+	if e.kind == constantEntry {
+		return constantOperand(e.value)
+	}
+	// a local's register is its index
+	return e.value
+}
+
+// Loads the n values below the top into their registers
+func (t *translator) flush(n int) {
+	for i := len(t.stack) - n; i < len(t.stack); i++ {
+		t.load(i)
+	}
+}
+
+func (t *translator) load(i int) {
+	e := t.stack[i]
+	if e.kind == inRegister {
+		return
+	}
+	r := t.register(i)
+	if e.kind == localEntry {
+		t.emit(regMove, r, e.value, 0)
+	} else {
+		t.emit(regMove, r, constantOperand(e.value), 0)
+	}
+	t.stack[i] = stackEntry{kind: inRegister, value: r}
+}
+
+// A local is about to change, what was read from it before has to be
+// loaded. Negative loads every local, e.g. before a call which could
+// change one through its cell
+func (t *translator) loadLocals(start, count int) {
+	for i, e := range t.stack {
+		if e.kind == localEntry && (count < 0 || (e.value >= start && e.value < start+count)) {
+			t.load(i)
+		}
+	}
+}
+
+func (t *translator) top() int {
+	return t.register(len(t.stack) - 1)
+}
+
+func (t *translator) instruction(in *translatedInstruction) {
+	switch in.op {
+	case code.OpConstant:
+		t.push(constantEntry, in.operands[0])
+	case code.OpTrue:
+		t.push(constantEntry, t.constants)
+	case code.OpFalse:
+		t.push(constantEntry, t.constants+1)
+	case code.OpNull:
+		t.push(constantEntry, t.constants+2)
+	case code.OpGetLocal:
+		t.push(localEntry, in.operands[0])
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpEqual, code.OpNotEqual,
+		code.OpGreaterThan, code.OpLessThan, code.OpRange, code.OpIndex:
+		t.binary(in.op)
+
+	// a superinstruction is what it's fused of, the operands of a register
+	// instruction already name the local and the constant
+	case code.OpGetLocalConstantAdd, code.OpGetLocalConstantSub:
+		operation, _ := code.FusedOperation(in.op)
+		t.push(localEntry, in.operands[0])
+		t.push(constantEntry, in.operands[1])
+		t.binary(operation)
+	case code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+		code.OpGreaterThanJumpNotTruthy, code.OpLessThanJumpNotTruthy:
+		operation, _ := code.FusedOperation(in.op)
+		t.binary(operation)
+		t.jumpNotTruthy(in.operands[0])
+
+	case code.OpMinus, code.OpBang, code.OpIter:
+		operand := t.pop()
+		dst := t.pushRegister()
+		op := map[code.Opcode]registerOp{code.OpMinus: regMinus, code.OpBang: regBang, code.OpIter: regIter}[in.op]
+		t.emit(op, dst, operand, 0)
+
+	case code.OpMember:
+		operand := t.pop()
+		dst := t.pushRegister()
+		op := regMember
+		if in.operands[1] == 1 {
+			op = regOptionalMember
+		}
+		t.emit(op, dst, operand, in.operands[0])
+
+	case code.OpPop:
+		t.emit(regPop, t.pop(), 0, 0)
+
+	case code.OpGetGlobal:
+		t.emit(regGetGlobal, t.pushRegister(), in.operands[0], 0)
+	case code.OpSetGlobal:
+		t.emit(regSetGlobal, in.operands[0], t.pop(), 0)
+	case code.OpSetLocal:
+		value := t.pop()
+		t.loadLocals(in.operands[0], 1)
+		t.emit(regSetLocal, in.operands[0], value, 0)
+	case code.OpGetFree:
+		t.emit(regGetFree, t.pushRegister(), in.operands[0], 0)
+	case code.OpSetFree:
+		// the cell can be one of a local's
+		value := t.pop()
+		t.loadLocals(0, -1)
+		t.emit(regSetFree, in.operands[0], value, 0)
+	case code.OpCaptureLocal:
+		t.emit(regCaptureLocal, t.pushRegister(), in.operands[0], 0)
+	case code.OpCaptureFree:
+		t.emit(regCaptureFree, t.pushRegister(), in.operands[0], 0)
+	case code.OpClearLocals:
+		t.loadLocals(in.operands[0], in.operands[1])
+		t.emit(regClearLocals, in.operands[0], in.operands[1], 0)
+	case code.OpGetBuiltin:
+		t.emit(regGetBuiltin, t.pushRegister(), in.operands[0], 0)
+
+	case code.OpJump:
+		t.flush(len(t.stack))
+		t.emitJump(regJump, in.operands[0], 0, 0)
+	case code.OpJumpNotTruthy:
+		t.jumpNotTruthy(in.operands[0])
+	case code.OpJumpNotNull:
+		t.flush(len(t.stack))
+		t.emitJump(regJumpNotNull, t.top(), in.operands[0], 0)
+		t.stack = t.stack[:len(t.stack)-1]
+	case code.OpIterNext:
+		t.flush(len(t.stack))
+		t.emitJump(regIterNext, t.top(), in.operands[0], in.operands[1])
+		for i := 0; i < in.operands[0]; i++ {
+			t.pushRegister()
+		}
+
+	case code.OpCall:
+		// the function and its arguments are in registers next to each
+		// other, and what they could change is read before
+		t.flush(len(t.stack))
+		fn := t.register(len(t.stack) - 1 - in.operands[0])
+		t.stack = t.stack[:len(t.stack)-in.operands[0]]
+		t.emit(regCall, fn, in.operands[0], 0)
+	case code.OpReturnValue:
+		t.emit(regReturn, t.pop(), 0, 0)
+	case code.OpReturn:
+		t.emit(regReturnNull, 0, 0, 0)
+
+	case code.OpClosure:
+		t.collect(regClosure, in.operands[1], in.operands[0])
+	case code.OpArray:
+		t.collect(regArray, in.operands[0], 0)
+	case code.OpHash:
+		t.collect(regHash, in.operands[0], 0)
+	case code.OpTemplate:
+		t.collect(regTemplate, in.operands[0], 0)
+	}
+}
+
+// Pops both sides and pushes the result in a register
+func (t *translator) binary(op code.Opcode) {
+	right := t.pop()
+	left := t.pop()
+	dst := t.pushRegister()
+	if op == code.OpIndex {
+		t.emit(regIndex, dst, left, right)
+	} else {
+		t.emit(binaryRegisterOps[op], dst, left, right)
+	}
+}
+
+func (t *translator) jumpNotTruthy(target int) {
+	t.flush(len(t.stack) - 1)
+	t.emitJump(regJumpIfFalsy, t.pop(), target, 0)
+}
+
+// An instruction which makes one value of the n on top, in the registers
+// from a on
+func (t *translator) collect(op registerOp, n, operand int) {
+	t.flush(n)
+	t.stack = t.stack[:len(t.stack)-n]
+	dst := t.pushRegister()
+	if op == regClosure {
+		t.emit(op, dst, operand, n)
+	} else {
+		t.emit(op, dst, n, 0)
+	}
+}
@@ -0,0 +1,136 @@
+package vm
+
+import (
+	"context"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			// the locals and the constant are operands of Add
+			input: "fn(x, y) { let z = x + 1; z * y }",
+			expected: []string{
+				"0000 Add 3 0 k0",
+				"0001 SetLocal 2 3",
+				"0002 Mul 3 2 1",
+				"0003 Return 3",
+			},
+		},
+		{
+			// what's left of ?? and the elements of an array are loaded
+			// into their registers first
+			input: "fn(a) { a ?? [a, 1] }",
+			expected: []string{
+				"0000 Move 1 0",
+				"0001 JumpNotNull 1 5",
+				"0002 Move 1 0",
+				"0003 Move 2 k0",
+				"0004 Array 1 2",
+				"0005 Return 1",
+			},
+		},
+		{
+			// the argument is read before the call, which could change it
+			input: "fn(a, f) { a + f() }",
+			expected: []string{
+				"0000 Move 2 0",
+				"0001 Move 3 1",
+				"0002 Call 3 0",
+				"0003 Add 2 2 3",
+				"0004 Return 2",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		var fn *object.CompiledFunction
+		for _, c := range bytecode.Constants {
+			if c, ok := c.(*object.CompiledFunction); ok {
+				fn = c
+			}
+		}
+
+		rf, err := translate(fn, len(bytecode.Constants))
+		if err != nil {
+			t.Fatalf("%q: translation error: %s", tt.input, err)
+		}
+		expected := strings.Join(tt.expected, "\n") + "\n"
+		if rf.String() != expected {
+			t.Errorf("%q: wrong instructions.\nwant=\n%s\ngot=\n%s", tt.input, expected, rf)
+		}
+	}
+}
+
+func TestTranslateErrors(t *testing.T) {
+	tests := []struct {
+		instructions []code.Instructions
+		expected     string
+	}{
+		{
+			[]code.Instructions{code.Make(code.OpPop)},
+			"can't translate a function to registers: OpPop at 0 takes 1 values from a stack of 0",
+		},
+		{
+			[]code.Instructions{code.Make(code.OpJump, 1)},
+			"can't translate a function to registers: jump to 1 is not an instruction",
+		},
+		{
+			// one value on the stack when it jumps, none when it doesn't
+			[]code.Instructions{
+				code.Make(code.OpTrue),
+				code.Make(code.OpTrue),
+				code.Make(code.OpJumpNotTruthy, 6),
+				code.Make(code.OpPop),
+				code.Make(code.OpNull),
+			},
+			"can't translate a function to registers: 1 values on the stack at 6 on one path and 0 on another",
+		},
+	}
+
+	for _, tt := range tests {
+		bytecode := &compiler.Bytecode{}
+		for _, ins := range tt.instructions {
+			bytecode.Instructions = append(bytecode.Instructions, ins...)
+		}
+
+		err := NewRegisterVM(bytecode, object.DefaultBuiltins).Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestRegisterProfiler(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("let f = fn(x) { x + 1 }; f(1)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	profiler := NewSamplingProfiler(1)
+	opts := Options{Profiler: profiler}
+	if err := NewRegisterVM(comp.Bytecode(), object.DefaultBuiltins).RunWithOptions(context.Background(), opts); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	opcodes := map[string]int64{}
+	for _, entry := range profiler.Opcodes() {
+		opcodes[entry.Name] = entry.Count
+	}
+	if opcodes["Add"] != 1 || opcodes["Call"] != 1 || opcodes["OpAdd"] != 0 {
+		t.Errorf("wrong opcode counts. got=%v", opcodes)
+	}
+}
@@ -0,0 +1,345 @@
+package vm
+
+import (
+	"fmt"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+// Like NewWithBuiltins but runs the program on the register instruction
+// set, see registerOp. It gives the same results and errors as the stack
+// VM, every function is translated the first time it's called
+func NewRegisterVM(bytecode *compiler.Bytecode, builtins *object.Builtins) *VM {
+	vm := NewWithBuiltins(bytecode, builtins)
+	vm.registers = true
+	vm.registerConstants = registerConstants(bytecode.Constants)
+	vm.registerFunctions = map[*object.CompiledFunction]*registerFunction{}
+	return vm
+}
+
+// The translation of a function, done once per VM
+func (vm *VM) registerFunction(fn *object.CompiledFunction) (*registerFunction, error) {
+	if rf, ok := vm.registerFunctions[fn]; ok {
+		return rf, nil
+	}
+	rf, err := translate(fn, len(vm.constants))
+	if err != nil {
+		name := fn.Name
+		if name == "" {
+			name = "a function"
+		}
+		return nil, fmt.Errorf("can't translate %s to registers: %s", name, err)
+	}
+	vm.registerFunctions[fn] = rf
+	return rf, nil
+}
+
+// The value of an operand, a local which is a cell gives the cell's value
+func (vm *VM) value(base, operand int) object.Object {
+	if operand < 0 {
+		return vm.registerConstants[-1-operand]
+	}
+	switch v := vm.stack[base+operand].(type) {
+	case nil:
+		return Null
+	case *object.Cell:
+		return orNull(v.Value)
+	default:
+		return v
+	}
+}
+
+func (vm *VM) runRegisters() error {
+	main := vm.frames[0]
+	rf, err := vm.registerFunction(main.cl.Fn)
+	if err != nil {
+		return err
+	}
+	if rf.numRegisters > StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	main.rf = rf
+
+	frame := vm.currentFrame()
+	instructions := frame.rf.instructions
+	base := frame.basePointer
+	regs := vm.stack
+
+	for frame.ip < len(instructions)-1 {
+		frame.ip++
+		ins := &instructions[frame.ip]
+
+		if vm.limited {
+			if err := vm.beforeInstruction(byte(ins.op)); err != nil {
+				return err
+			}
+		}
+
+		switch ins.op {
+		case regMove:
+			regs[base+ins.a] = vm.value(base, ins.b)
+
+		case regAdd, regSub, regMul, regDiv, regEqual, regNotEqual, regGreaterThan, regLessThan, regRange:
+			left := vm.value(base, ins.b)
+			right := vm.value(base, ins.c)
+
+			var result object.Object
+			var err error
+			l, lok := left.(*object.Integer)
+			r, rok := right.(*object.Integer)
+			if lok && rok {
+				result, err = binaryIntegerOperation(binaryOpcodes[ins.op], l.Value, r.Value)
+			} else {
+				result, err = binaryOperation(binaryOpcodes[ins.op], left, right)
+			}
+			if err != nil {
+				return err
+			}
+			if err := vm.track(result); err != nil {
+				return err
+			}
+			regs[base+ins.a] = result
+
+		case regMinus:
+			result, err := minusOperator(vm.value(base, ins.b))
+			if err != nil {
+				return err
+			}
+			regs[base+ins.a] = result
+
+		case regBang:
+			regs[base+ins.a] = bangOperator(vm.value(base, ins.b))
+
+		case regPop:
+			vm.lastPopped = vm.value(base, ins.a)
+
+		case regGetGlobal:
+			value := vm.globals[ins.b]
+			if value == nil {
+				return fmt.Errorf("identifier not found: %s", vm.globalName(ins.b))
+			}
+			regs[base+ins.a] = value
+
+		case regSetGlobal:
+			vm.globals[ins.a] = vm.value(base, ins.b)
+
+		case regSetLocal:
+			value := vm.value(base, ins.b)
+			if cell, ok := regs[base+ins.a].(*object.Cell); ok {
+				cell.Value = value
+			} else {
+				regs[base+ins.a] = value
+			}
+
+		case regJump:
+			frame.ip = ins.a - 1
+
+		case regJumpIfFalsy:
+			if !isTruthy(vm.value(base, ins.a)) {
+				frame.ip = ins.b - 1
+			}
+
+		case regJumpNotNull:
+			if regs[base+ins.a] != Null {
+				frame.ip = ins.b - 1
+			}
+
+		case regIter:
+			it, err := newIterator(vm.value(base, ins.b))
+			if err != nil {
+				return err
+			}
+			regs[base+ins.a] = it
+
+		case regIterNext:
+			key, value, done, err := regs[base+ins.a].(*iterator).next(ins.b)
+			if err != nil {
+				return err
+			}
+			if done {
+				frame.ip = ins.c - 1
+				continue
+			}
+			if ins.b == 2 {
+				regs[base+ins.a+1] = key
+				regs[base+ins.a+2] = value
+			} else {
+				regs[base+ins.a+1] = value
+			}
+
+		case regCall:
+			if err := vm.registerCall(base+ins.a, ins.b); err != nil {
+				return err
+			}
+			frame = vm.currentFrame()
+			instructions = frame.rf.instructions
+			base = frame.basePointer
+
+		case regReturn, regReturnNull:
+			var value object.Object = Null
+			if ins.op == regReturn {
+				value = vm.value(base, ins.a)
+			}
+
+			// a return in the main program ends it with its value
+			if vm.framesIndex == 1 {
+				vm.lastPopped = value
+				return nil
+			}
+
+			returned := vm.popFrame()
+			regs[returned.basePointer-1] = value
+
+			frame = vm.currentFrame()
+			instructions = frame.rf.instructions
+			base = frame.basePointer
+
+		case regClosure:
+			constant := vm.constants[ins.b]
+			function, ok := constant.(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("not a function: %+v", constant)
+			}
+			free := make([]object.Object, ins.c)
+			copy(free, regs[base+ins.a:base+ins.a+ins.c])
+
+			closure := &object.Closure{Fn: function, Free: free}
+			if err := vm.track(closure); err != nil {
+				return err
+			}
+			regs[base+ins.a] = closure
+
+		case regGetFree:
+			cell := frame.cl.Free[ins.b].(*object.Cell)
+			regs[base+ins.a] = orNull(cell.Value)
+
+		case regSetFree:
+			cell := frame.cl.Free[ins.a].(*object.Cell)
+			cell.Value = vm.value(base, ins.b)
+
+		case regCaptureLocal:
+			slot := &regs[base+ins.b]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+			regs[base+ins.a] = cell
+
+		case regCaptureFree:
+			regs[base+ins.a] = frame.cl.Free[ins.b]
+
+		case regClearLocals:
+			clear(regs[base+ins.a : base+ins.a+ins.b])
+
+		case regGetBuiltin:
+			builtin := vm.builtins[ins.b]
+			if builtin == nil {
+				return fmt.Errorf("identifier not found: %s", vm.builtinNames[ins.b])
+			}
+			regs[base+ins.a] = builtin
+
+		case regArray:
+			elements := make([]object.Object, ins.b)
+			copy(elements, regs[base+ins.a:base+ins.a+ins.b])
+			array := &object.Array{Elements: elements}
+			if err := vm.track(array); err != nil {
+				return err
+			}
+			regs[base+ins.a] = array
+
+		case regHash:
+			hash, err := buildHash(regs[base+ins.a : base+ins.a+ins.b])
+			if err != nil {
+				return err
+			}
+			if err := vm.track(hash); err != nil {
+				return err
+			}
+			regs[base+ins.a] = hash
+
+		case regTemplate:
+			template := joinTemplate(regs[base+ins.a : base+ins.a+ins.b])
+			if err := vm.track(template); err != nil {
+				return err
+			}
+			regs[base+ins.a] = template
+
+		case regIndex:
+			result, err := indexExpression(vm.value(base, ins.b), vm.value(base, ins.c), vm.inlineCache(frame.ip))
+			if err != nil {
+				return err
+			}
+			if err := vm.track(result); err != nil {
+				return err
+			}
+			regs[base+ins.a] = result
+
+		case regMember, regOptionalMember:
+			name := vm.constants[ins.c].(*object.String)
+			result, err := memberExpression(vm.value(base, ins.b), name, ins.op == regOptionalMember, vm.inlineCache(frame.ip))
+			if err != nil {
+				return err
+			}
+			regs[base+ins.a] = result
+
+		default:
+			return fmt.Errorf("register instruction %d can't be run", ins.op)
+		}
+	}
+
+	return nil
+}
+
+// The function is in the register fn, its arguments in the ones after
+// it. A closure gets a frame whose registers start with the arguments,
+// a builtin runs right away
+func (vm *VM) registerCall(fn, numArgs int) error {
+	switch callee := vm.stack[fn].(type) {
+	case *object.Closure:
+		if numArgs != callee.Fn.NumParameters {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+				callee.Fn.NumParameters, numArgs)
+		}
+		if err := vm.checkCall(callee.Fn); err != nil {
+			return err
+		}
+		rf, err := vm.registerFunction(callee.Fn)
+		if err != nil {
+			return err
+		}
+
+		frame := NewFrame(callee, fn+1)
+		if frame.basePointer+rf.numRegisters > StackSize {
+			return fmt.Errorf("stack overflow")
+		}
+		frame.rf = rf
+		vm.pushFrame(frame)
+
+		// a function's locals start out unset
+		clear(vm.stack[frame.basePointer+numArgs : frame.basePointer+rf.numLocals])
+		return nil
+
+	case *object.Builtin:
+		result := callee.Fn(vm.stack[fn+1 : fn+1+numArgs]...)
+		if err, ok := result.(*object.Error); ok {
+			return err
+		}
+		if err := vm.track(result); err != nil {
+			return err
+		}
+		vm.stack[fn] = orNull(result)
+		return nil
+
+	default:
+		return fmt.Errorf("not a function: %s", vm.stack[fn].Type())
+	}
+}
+
+// The opcodes of Profiler.Opcodes when it ran in the register VM
+func registerOpName(op byte) string {
+	if name, ok := registerOpNames[registerOp(op)]; ok {
+		return name
+	}
+	return fmt.Sprintf("register instruction %d", op)
+}
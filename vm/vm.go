@@ -0,0 +1,1063 @@
+// Runs the bytecode of the compiler package on a stack of operands
+// instead of walking the AST, or on registers after translating it (see
+// NewRegisterVM). The results and error messages are the same as the
+// evaluator's
+package vm
+
+import (
+	"context"
+	"fmt"
+	"monkey/code"
+	"monkey/compiler"
+	"monkey/object"
+	"monkey/token"
+	"strings"
+)
+
+// How many values fit on the operand stack, pushing more is an error
+const StackSize = 2048
+
+// OpGetGlobal and OpSetGlobal have a two byte operand
+const GlobalsSize = 65536
+
+// How deep calls can nest, the main program takes the first frame
+const MaxFrames = 1024
+
+// Rough size in bytes of a frame without its locals, for Options.MaxMemory
+const frameSize = 64
+
+// How often a run looks whether its context was cancelled, in executed
+// instructions
+const cancelCheckInterval = 1024
+
+var (
+	True  = object.TRUE
+	False = object.FALSE
+	Null  = object.NULL
+)
+
+type VM struct {
+	constants []object.Object
+
+	globals     []object.Object
+	globalNames []string
+
+	// By the index of OpGetBuiltin, nil for a name the registry doesn't
+	// have
+	builtins     []*object.Builtin
+	builtinNames []string
+
+	stack []object.Object
+	// Always points to the next free slot, the top of the stack is stack[sp-1]
+	sp int
+
+	frames      []*Frame
+	framesIndex int
+
+	// The inline caches of each function, see inlineCache
+	inlineCaches map[*object.CompiledFunction][]*inlineCache
+
+	// Set by NewRegisterVM, the stack holds the registers of the frames
+	// then. True, false and null are constants too, see registerConstants
+	registers         bool
+	registerConstants []object.Object
+	registerFunctions map[*object.CompiledFunction]*registerFunction
+	lastPopped        object.Object
+
+	// Only set while running, limited when there's anything to check or
+	// record before every instruction
+	opts      Options
+	ctx       context.Context
+	done      <-chan struct{}
+	limited   bool
+	executed  int64
+	allocated int64
+}
+
+// Limits for a run, the zero value is the same as calling Run
+type Options struct {
+	// Abort with an error after this many executed instructions, 0 means
+	// no limit. Like the evaluator's MaxSteps it stops untrusted code
+	// which would loop forever
+	MaxInstructions int64
+
+	// Abort with an error once this many calls are nested, 0 leaves only
+	// the limit of MaxFrames. Like the evaluator's MaxDepth
+	MaxDepth int
+
+	// Abort with an error once roughly this many bytes were allocated for
+	// values and frames, 0 means no limit. Like the evaluator's MaxMemory
+	// it counts everything the run allocated, not only what's still in use
+	MaxMemory int64
+
+	// Counts the opcodes and samples the functions which run, see
+	// Profiler. It slows the VM down, only set it to find out what's slow
+	Profiler *Profiler
+}
+
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithBuiltins(bytecode, object.DefaultBuiltins)
+}
+
+// Runs the bytecode with other builtins than the default ones, e.g. a
+// puts which writes somewhere else
+func NewWithBuiltins(bytecode *compiler.Bytecode, builtins *object.Builtins) *VM {
+	fns := make([]*object.Builtin, len(bytecode.Builtins))
+	for i, name := range bytecode.Builtins {
+		fns[i], _ = builtins.Lookup(name)
+	}
+
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    bytecode.NumLocals,
+		Lines:        bytecode.Lines,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		globals:     make([]object.Object, GlobalsSize),
+		globalNames: bytecode.Globals,
+
+		builtins:     fns,
+		builtinNames: bytecode.Builtins,
+
+		stack: make([]object.Object, StackSize),
+		// the locals of the main program's loops are at the bottom
+		sp: mainFn.NumLocals,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		inlineCaches: map[*object.CompiledFunction][]*inlineCache{},
+	}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Runs the bytecode with the globals of an earlier run, how the REPL
+// keeps the values of its lines
+func NewWithGlobalsState(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	return NewWithBuiltinsAndGlobals(bytecode, object.DefaultBuiltins, s)
+}
+
+// Like NewWithGlobalsState with other builtins, see NewWithBuiltins
+func NewWithBuiltinsAndGlobals(bytecode *compiler.Bytecode, builtins *object.Builtins, s []object.Object) *VM {
+	vm := NewWithBuiltins(bytecode, builtins)
+	vm.globals = s
+	return vm
+}
+
+// Sets the global of that name before Run, e.g. the ARGV of a script
+// Reports whether the program has such a global
+func (vm *VM) SetGlobal(name string, value object.Object) bool {
+	for i, global := range vm.globalNames {
+		if global == name {
+			vm.globals[i] = value
+			return true
+		}
+	}
+	return false
+}
+
+func (vm *VM) StackTop() object.Object {
+	if vm.sp == 0 {
+		return nil
+	}
+	return vm.stack[vm.sp-1]
+}
+
+// The value of the last expression statement, popping doesn't clear the
+// slot so it's still there after Run. The REPL prints it
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.registers {
+		return vm.lastPopped
+	}
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// Like Run but stops with an error once ctx is cancelled, which is looked
+// at every few instructions
+func (vm *VM) RunContext(ctx context.Context) error {
+	return vm.RunWithOptions(ctx, Options{})
+}
+
+// Like RunContext but with the limits of opts, the instructions are
+// counted from the start of this run
+func (vm *VM) RunWithOptions(ctx context.Context, opts Options) error {
+	vm.opts = opts
+	vm.ctx = ctx
+	vm.done = ctx.Done()
+	vm.limited = opts.MaxInstructions > 0 || vm.done != nil || opts.Profiler != nil
+	vm.executed = 0
+	vm.allocated = 0
+
+	var err error
+	if vm.registers {
+		err = vm.runRegisters()
+	} else {
+		err = vm.run()
+	}
+	if err != nil {
+		return vm.runtimeError(err)
+	}
+	return nil
+}
+
+// Every error of a run is an *object.Error with the position of the
+// instruction which failed, from the line table of its function, and the
+// calls it happened in. The position of a builtin's error is the one of
+// its call, like in the evaluator
+func (vm *VM) runtimeError(err error) *object.Error {
+	e, ok := err.(*object.Error)
+	if !ok {
+		e = &object.Error{Message: err.Error()}
+	}
+	if e.Exit {
+		return e
+	}
+
+	e.Trace = make([]object.TraceEntry, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		e.Trace = append(e.Trace, object.TraceEntry{Function: functionName(vm, i), Pos: vm.framePosition(i)})
+	}
+	if !e.Pos.IsValid() {
+		e.Pos = e.Trace[0].Pos
+	}
+	return e
+}
+
+// Where in the source a frame is, from the line table of its function
+func (vm *VM) framePosition(i int) token.Position {
+	frame := vm.frames[i]
+	if frame.ip < 0 {
+		return token.Position{}
+	}
+	offset := frame.ip
+	if frame.rf != nil {
+		offset = frame.rf.sources[frame.ip]
+	}
+	return frame.cl.Fn.Lines.Position(offset)
+}
+
+// Checks the limits and feeds the profiler, returns an error once the run
+// has to stop early. A context cancelled before the run stops it before
+// the first instruction
+func (vm *VM) beforeInstruction(op byte) error {
+	if vm.done != nil && vm.executed%cancelCheckInterval == 0 {
+		select {
+		case <-vm.done:
+			return fmt.Errorf("evaluation cancelled: %s", vm.ctx.Err())
+		default:
+		}
+	}
+	vm.executed++
+	if vm.opts.MaxInstructions > 0 && vm.executed > vm.opts.MaxInstructions {
+		return fmt.Errorf("instruction budget exceeded: more than %d instructions", vm.opts.MaxInstructions)
+	}
+	if vm.opts.Profiler != nil {
+		vm.opts.Profiler.record(vm, op, vm.executed)
+	}
+	return nil
+}
+
+// Adds bytes to what the run allocated, returns an error once it's more
+// than Options.MaxMemory
+func (vm *VM) allocate(bytes int64) error {
+	if vm.opts.MaxMemory <= 0 {
+		return nil
+	}
+	vm.allocated += bytes
+	if vm.allocated > vm.opts.MaxMemory {
+		return fmt.Errorf("memory limit exceeded: more than %d bytes allocated", vm.opts.MaxMemory)
+	}
+	return nil
+}
+
+// Accounts for a value the run created, see object.ApproxSize
+func (vm *VM) track(obj object.Object) error {
+	if vm.opts.MaxMemory <= 0 {
+		return nil
+	}
+	return vm.allocate(object.ApproxSize(obj))
+}
+
+// Checks the limits of a call which would get the next frame
+func (vm *VM) checkCall(fn *object.CompiledFunction) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("call depth exceeded: more than %d nested calls", MaxFrames-1)
+	}
+	if vm.opts.MaxDepth > 0 && vm.framesIndex > vm.opts.MaxDepth {
+		return fmt.Errorf("call depth exceeded: more than %d nested calls", vm.opts.MaxDepth)
+	}
+	return vm.allocate(frameSize + int64(fn.NumLocals)*object.PointerSize)
+}
+
+func (vm *VM) run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		if vm.limited {
+			if err := vm.beforeInstruction(byte(op)); err != nil {
+				return err
+			}
+		}
+
+		switch op {
+		case code.OpConstant:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			if err := vm.push(vm.constants[constIndex]); err != nil {
+				return err
+			}
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan, code.OpRange:
+			right := vm.pop()
+			left := vm.pop()
+
+			result, err := binaryOperation(op, left, right)
+			if err != nil {
+				return err
+			}
+			if err := vm.track(result); err != nil {
+				return err
+			}
+			if err := vm.push(result); err != nil {
+				return err
+			}
+
+		case code.OpTrue:
+			if err := vm.push(True); err != nil {
+				return err
+			}
+
+		case code.OpFalse:
+			if err := vm.push(False); err != nil {
+				return err
+			}
+
+		case code.OpBang:
+			if err := vm.push(bangOperator(vm.pop())); err != nil {
+				return err
+			}
+
+		case code.OpMinus:
+			result, err := minusOperator(vm.pop())
+			if err != nil {
+				return err
+			}
+			if err := vm.push(result); err != nil {
+				return err
+			}
+
+		case code.OpPop:
+			vm.pop()
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			condition := vm.pop()
+			if !isTruthy(condition) {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpNull:
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			value := vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := value.(*object.Cell); ok {
+				value = cell.Value
+			}
+			if err := vm.push(orNull(value)); err != nil {
+				return err
+			}
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			if err := vm.pushClosure(int(constIndex), int(numFree)); err != nil {
+				return err
+			}
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			if err := vm.push(orNull(cell.Value)); err != nil {
+				return err
+			}
+
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cell := vm.currentFrame().cl.Free[freeIndex].(*object.Cell)
+			cell.Value = vm.pop()
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			cell, ok := (*slot).(*object.Cell)
+			if !ok {
+				cell = &object.Cell{Value: *slot}
+				*slot = cell
+			}
+			if err := vm.push(cell); err != nil {
+				return err
+			}
+
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.push(vm.currentFrame().cl.Free[freeIndex]); err != nil {
+				return err
+			}
+
+		case code.OpClearLocals:
+			start := int(code.ReadUint8(ins[ip+1:]))
+			count := int(code.ReadUint8(ins[ip+2:]))
+			vm.currentFrame().ip += 2
+
+			base := vm.currentFrame().basePointer + start
+			clear(vm.stack[base : base+count])
+
+		case code.OpIter:
+			it, err := newIterator(vm.pop())
+			if err != nil {
+				return err
+			}
+			if err := vm.push(it); err != nil {
+				return err
+			}
+
+		case code.OpIterNext:
+			variables := int(code.ReadUint8(ins[ip+1:]))
+			end := int(code.ReadUint16(ins[ip+2:]))
+			vm.currentFrame().ip += 3
+
+			key, value, done, err := vm.stack[vm.sp-1].(*iterator).next(variables)
+			if err != nil {
+				return err
+			}
+			if done {
+				vm.pop()
+				vm.currentFrame().ip = end - 1
+				continue
+			}
+			if variables == 2 {
+				if err := vm.push(key); err != nil {
+					return err
+				}
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			value := vm.globals[globalIndex]
+			if value == nil {
+				return fmt.Errorf("identifier not found: %s", vm.globalName(int(globalIndex)))
+			}
+			if err := vm.push(value); err != nil {
+				return err
+			}
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			if err := vm.executeCall(int(numArgs)); err != nil {
+				return err
+			}
+
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			builtin := vm.builtins[builtinIndex]
+			if builtin == nil {
+				return fmt.Errorf("identifier not found: %s", vm.builtinNames[builtinIndex])
+			}
+			if err := vm.push(builtin); err != nil {
+				return err
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			elements := make([]object.Object, numElements)
+			copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+			vm.sp = vm.sp - numElements
+
+			array := &object.Array{Elements: elements}
+			if err := vm.track(array); err != nil {
+				return err
+			}
+			if err := vm.push(array); err != nil {
+				return err
+			}
+
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			hash, err := buildHash(vm.stack[vm.sp-numElements : vm.sp])
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numElements
+
+			if err := vm.track(hash); err != nil {
+				return err
+			}
+			if err := vm.push(hash); err != nil {
+				return err
+			}
+
+		case code.OpIndex:
+			index := vm.pop()
+			left := vm.pop()
+
+			result, err := indexExpression(left, index, vm.inlineCache(ip))
+			if err != nil {
+				return err
+			}
+			if err := vm.track(result); err != nil {
+				return err
+			}
+			if err := vm.push(result); err != nil {
+				return err
+			}
+
+		case code.OpMember:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			optional := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			name := vm.constants[nameIndex].(*object.String)
+			result, err := memberExpression(vm.pop(), name, optional == 1, vm.inlineCache(ip))
+			if err != nil {
+				return err
+			}
+			if err := vm.push(result); err != nil {
+				return err
+			}
+
+		case code.OpTemplate:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			template := joinTemplate(vm.stack[vm.sp-numParts : vm.sp])
+			vm.sp = vm.sp - numParts
+
+			if err := vm.track(template); err != nil {
+				return err
+			}
+			if err := vm.push(template); err != nil {
+				return err
+			}
+
+		case code.OpJumpNotNull:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if vm.stack[vm.sp-1] != Null {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
+			}
+
+		case code.OpGetLocalConstantAdd, code.OpGetLocalConstantSub:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			constIndex := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+
+			left := vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if cell, ok := left.(*object.Cell); ok {
+				left = cell.Value
+			}
+			operation := fusedOperations[op]
+			result, err := fusedOperation(operation, orNull(left), vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+			if err := vm.track(result); err != nil {
+				return err
+			}
+			if err := vm.push(result); err != nil {
+				return err
+			}
+
+		case code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+			code.OpGreaterThanJumpNotTruthy, code.OpLessThanJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			right := vm.pop()
+			left := vm.pop()
+			operation := fusedOperations[op]
+			result, err := fusedOperation(operation, left, right)
+			if err != nil {
+				return err
+			}
+			if result != True {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+
+			// a return in the main program ends it with its value
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(returnValue); err != nil {
+				return err
+			}
+
+		case code.OpReturn:
+			frame := vm.popFrame()
+			vm.sp = frame.basePointer - 1
+
+			if err := vm.push(Null); err != nil {
+				return err
+			}
+
+		default:
+			def, err := code.Lookup(byte(op))
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("%s can't be run yet", def.Name)
+		}
+	}
+
+	return nil
+}
+
+var operators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+	code.OpRange:       "..",
+}
+
+// Checks the types in the same order as the evaluator's infix expressions
+// so both give the same result or error
+func binaryOperation(op code.Opcode, left, right object.Object) (object.Object, error) {
+	leftType := left.Type()
+	rightType := right.Type()
+
+	switch {
+	case leftType == object.INTEGER_OBJ && rightType == object.INTEGER_OBJ:
+		return binaryIntegerOperation(op, left.(*object.Integer).Value, right.(*object.Integer).Value)
+	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
+		return binaryStringOperation(op, left, right)
+	case op == code.OpEqual:
+		return nativeBoolToBooleanObject(object.Equals(left, right)), nil
+	case op == code.OpNotEqual:
+		return nativeBoolToBooleanObject(!object.Equals(left, right)), nil
+	case leftType != rightType:
+		return nil, fmt.Errorf("type mismatch: %s %s %s", leftType, operators[op], rightType)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", leftType, operators[op], rightType)
+	}
+}
+
+// code.FusedOperation of every superinstruction, looking it up in a map
+// would take about as long as the dispatch it saves
+var fusedOperations [256]code.Opcode
+
+func init() {
+	for op := 0; op < len(fusedOperations); op++ {
+		if operation, ok := code.FusedOperation(code.Opcode(op)); ok {
+			fusedOperations[op] = operation
+		}
+	}
+}
+
+// binaryOperation for the superinstructions, which are in the hot loops
+// where both sides are mostly integers
+func fusedOperation(op code.Opcode, left, right object.Object) (object.Object, error) {
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			return binaryIntegerOperation(op, l.Value, r.Value)
+		}
+	}
+	return binaryOperation(op, left, right)
+}
+
+// Overflowing wraps around, the evaluator's default
+func binaryIntegerOperation(op code.Opcode, leftValue, rightValue int64) (object.Object, error) {
+	switch op {
+	case code.OpAdd:
+		return object.NewInteger(leftValue + rightValue), nil
+	case code.OpSub:
+		return object.NewInteger(leftValue - rightValue), nil
+	case code.OpMul:
+		return object.NewInteger(leftValue * rightValue), nil
+	case code.OpDiv:
+		if rightValue == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return object.NewInteger(leftValue / rightValue), nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(leftValue == rightValue), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(leftValue != rightValue), nil
+	case code.OpGreaterThan:
+		return nativeBoolToBooleanObject(leftValue > rightValue), nil
+	case code.OpLessThan:
+		return nativeBoolToBooleanObject(leftValue < rightValue), nil
+	case code.OpRange:
+		return &object.Range{Start: leftValue, End: rightValue}, nil
+	default:
+		return nil, fmt.Errorf("unknown integer operator: %d", op)
+	}
+}
+
+func binaryStringOperation(op code.Opcode, left, right object.Object) (object.Object, error) {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpAdd:
+		return &object.String{Value: leftValue + rightValue}, nil
+	case code.OpEqual:
+		return nativeBoolToBooleanObject(leftValue == rightValue), nil
+	case code.OpNotEqual:
+		return nativeBoolToBooleanObject(leftValue != rightValue), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), operators[op], right.Type())
+	}
+}
+
+// The function is on the stack below its arguments
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// The arguments become the first locals of the new frame
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	fn := cl.Fn
+
+	if numArgs != fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			fn.NumParameters, numArgs)
+	}
+	if err := vm.checkCall(fn); err != nil {
+		return err
+	}
+
+	frame := NewFrame(cl, vm.sp-numArgs)
+	if frame.basePointer+fn.NumLocals > StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	vm.pushFrame(frame)
+
+	// a function's locals start out unset, not with what an earlier call
+	// left there
+	for i := vm.sp; i < frame.basePointer+fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+	vm.sp = frame.basePointer + fn.NumLocals
+
+	return nil
+}
+
+// A builtin runs right away, an error it returns stops the program like
+// one of the VM's own
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := vm.stack[vm.sp-numArgs : vm.sp]
+
+	result := builtin.Fn(args...)
+	vm.sp = vm.sp - numArgs - 1
+
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	if err := vm.track(result); err != nil {
+		return err
+	}
+	return vm.push(orNull(result))
+}
+
+// The cells to capture are on the stack, OpCaptureLocal and
+// OpCaptureFree put them there
+func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]object.Object, numFree)
+	copy(free, vm.stack[vm.sp-numFree:vm.sp])
+	vm.sp = vm.sp - numFree
+
+	closure := &object.Closure{Fn: function, Free: free}
+	if err := vm.track(closure); err != nil {
+		return err
+	}
+	return vm.push(closure)
+}
+
+// A variable which is read before its let ran, e.g. a closure calling
+// one defined further down too early
+func orNull(obj object.Object) object.Object {
+	if obj == nil {
+		return Null
+	}
+	return obj
+}
+
+// What OpIter leaves on the stack for OpIterNext
+type iterator struct {
+	object.Iterator
+	// Looping over a hash with one variable gives its keys
+	hash bool
+}
+
+func (it *iterator) Type() object.ObjectType { return "ITERATOR" }
+func (it *iterator) Inspect() string         { return "iterator" }
+
+func newIterator(iterable object.Object) (object.Object, error) {
+	it, ok := iterable.(object.Iterable)
+	if !ok {
+		return nil, fmt.Errorf("cannot iterate over %s", iterable.Type())
+	}
+	_, isHash := iterable.(*object.Hash)
+
+	return &iterator{Iterator: it.Iterator(), hash: isHash}, nil
+}
+
+// The next element, value is the loop's only variable when there's one
+// and the key the first one of two. done once there are no more
+func (it *iterator) next(variables int) (key, value object.Object, done bool, err error) {
+	key, value, ok := it.Next()
+	if !ok {
+		if stopper, ok := it.Iterator.(object.Stopper); ok {
+			stopper.Stop()
+		}
+		return nil, nil, true, nil
+	}
+	if err, ok := value.(*object.Error); ok {
+		return nil, nil, false, err
+	}
+
+	if variables != 2 && it.hash {
+		return nil, key, false, nil
+	}
+	return key, value, false, nil
+}
+
+// The keys and values in turns
+func buildHash(elements []object.Object) (object.Object, error) {
+	hash := &object.Hash{}
+
+	for i := 0; i < len(elements); i += 2 {
+		key := elements[i]
+		value := elements[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+		}
+
+		hash = hash.Set(hashKey.HashKey(), object.HashPair{Key: key, Value: value})
+	}
+
+	return hash, nil
+}
+
+// Out of bounds access and missing keys give null like in the evaluator
+func indexExpression(left, index object.Object, cache *inlineCache) (object.Object, error) {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return Null, nil
+		}
+		return elements[i], nil
+	case left.Type() == object.HASH_OBJ:
+		return cache.lookup(left.(*object.Hash), index)
+	default:
+		return nil, fmt.Errorf("index operator not supported: %s", left.Type())
+	}
+}
+
+// For hashes foo.bar is the same as foo["bar"], foo?.bar is null when foo
+// is
+func memberExpression(obj object.Object, name *object.String, optional bool, cache *inlineCache) (object.Object, error) {
+	if optional && obj == Null {
+		return Null, nil
+	}
+	hash, ok := obj.(*object.Hash)
+	if !ok {
+		return nil, fmt.Errorf("member access not supported: %s.%s", obj.Type(), name.Value)
+	}
+	return cache.lookup(hash, name)
+}
+
+// The parts converted like str() does
+func joinTemplate(parts []object.Object) object.Object {
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(object.ToString(part))
+	}
+	return &object.String{Value: out.String()}
+}
+
+func (vm *VM) globalName(index int) string {
+	if index < len(vm.globalNames) {
+		return vm.globalNames[index]
+	}
+	return fmt.Sprintf("global %d", index)
+}
+
+func bangOperator(operand object.Object) object.Object {
+	switch operand {
+	case True:
+		return False
+	case False, Null:
+		return True
+	default:
+		return False
+	}
+}
+
+func minusOperator(operand object.Object) (object.Object, error) {
+	if operand.Type() != object.INTEGER_OBJ {
+		return nil, fmt.Errorf("unknown operator: -%s", operand.Type())
+	}
+
+	value := operand.(*object.Integer).Value
+	return object.NewInteger(-value), nil
+}
+
+// Like in the evaluator only false and null are falsy
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return True
+	}
+	return False
+}
+
+// A program nesting deeper than StackSize gets an error instead of
+// writing past the end of the stack
+func (vm *VM) push(o object.Object) error {
+	if vm.sp >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
@@ -0,0 +1,1207 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+	"time"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"-5", -5},
+		{"-10", -10},
+		{"1..5 == 1..5", true},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		// wraps around like the evaluator by default
+		{"9223372036854775807 + 1", -9223372036854775808},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"(1 < 2) == true", true},
+		{"(1 > 2) == false", true},
+		{"1 == true", false},
+		{"1 != true", true},
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!5", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 }", Null},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"!(if (false) { 5; })", true},
+		{"if (true) { 1; 2 }", 2},
+		{"if (true) {}", Null},
+		{"let x = 1; if (true) { x }", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"const one = 1; one", 1},
+		{"let one = 1; let one = one + 1; one", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; (x = 5) + 1", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let s = 0; for (i in 1..5) { s = s + i }; s", 10},
+		{"for (i in 0..3) { i }", Null},
+		{"let s = 0; for (i in 0..3) { for (j in 0..3) { s = s + i * j } }; s", 9},
+		{"let s = 0; for (i, c in \"abc\") { s = s + i }; s", 3},
+		{"let s = \"\"; for (c in \"abc\") { s = c + s }; s", "cba"},
+		{"let t = 0; for (i in 0..3) { let d = i * 2; t = t + d }; t", 6},
+		// the loop variable hides the global
+		{"let i = 9; for (i in 0..3) {}; i", 9},
+		{"if (true) { for (i in 0..1) { 5 } }", Null},
+		// one variable gives the keys of a hash
+		{`let s = ""; for (k in {"a": 1, "b": 2}) { s = s + k }; s`, "ab"},
+		{`let s = 0; for (k, v in {"a": 1, "b": 2}) { s = s + v }; s`, 3},
+		{"let s = 0; for (x in [1, 2, 3]) { s = s + x }; s", 6},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithoutArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let fivePlusTen = fn() { 5 + 10; };
+			fivePlusTen();
+			`,
+			expected: 15,
+		},
+		{
+			input: `
+			let one = fn() { 1; };
+			let two = fn() { 2; };
+			one() + two()
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let a = fn() { 1 };
+			let b = fn() { a() + 1 };
+			let c = fn() { b() + 1 };
+			c();
+			`,
+			expected: 3,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionsWithReturnStatement(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let earlyExit = fn() { return 99; 100; };
+			earlyExit();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let earlyExit = fn() { return 99; return 100; };
+			earlyExit();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let find = fn() { for (i in 0..10) { if (i == 3) { return i } }; 0 };
+			find() + find();
+			`,
+			expected: 6,
+		},
+		{
+			// a return in the main program ends it
+			input:    "if (10 > 1) { if (10 > 1) { return 10; } return 1; }",
+			expected: 10,
+		},
+		{
+			input:    "for (i in 0..3) { return 7 }; 8",
+			expected: 7,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionsWithoutReturnValue(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let noReturn = fn() { };
+			noReturn();
+			`,
+			expected: Null,
+		},
+		{
+			input: `
+			let noReturn = fn() { };
+			let noReturnTwo = fn() { noReturn(); };
+			noReturn();
+			noReturnTwo();
+			`,
+			expected: Null,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFirstClassFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let returnsOne = fn() { 1; };
+			let returnsOneReturner = fn() { returnsOne; };
+			returnsOneReturner()();
+			`,
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let one = fn() { let one = 1; one };
+			one();
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			oneAndTwo();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+			oneAndTwo() + threeAndFour();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let firstFoobar = fn() { let foobar = 50; foobar; };
+			let secondFoobar = fn() { let foobar = 100; foobar; };
+			firstFoobar() + secondFoobar();
+			`,
+			expected: 150,
+		},
+		{
+			input: `
+			let globalSeed = 50;
+			let minusOne = fn() {
+				let num = 1;
+				globalSeed - num;
+			}
+			let minusTwo = fn() {
+				let num = 2;
+				globalSeed - num;
+			}
+			minusOne() + minusTwo();
+			`,
+			expected: 97,
+		},
+		{
+			input: `
+			let sum = fn(n) { let s = 0; for (i in 0..n) { s = s + i }; s };
+			sum(5) + sum(3);
+			`,
+			expected: 13,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let identity = fn(a) { a; };
+			identity(4);
+			`,
+			expected: 4,
+		},
+		{
+			input: `
+			let sum = fn(a, b) { a + b; };
+			sum(1, 2);
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let sum = fn(a, b) {
+				let c = a + b;
+				c;
+			};
+			sum(1, 2) + sum(3, 4);`,
+			expected: 10,
+		},
+		{
+			input: `
+			let globalNum = 10;
+
+			let sum = fn(a, b) {
+				let c = a + b;
+				c + globalNum;
+			};
+
+			let outer = fn() {
+				sum(1, 2) + sum(3, 4) + globalNum;
+			};
+
+			outer() + globalNum;
+			`,
+			expected: 50,
+		},
+		{
+			input: `
+			let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+			fib(15);
+			`,
+			expected: 610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let newClosure = fn(a) {
+				fn() { a; };
+			};
+			let closure = newClosure(99);
+			closure();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let newAdder = fn(a, b) {
+				fn(c) { a + b + c };
+			};
+			let adder = newAdder(1, 2);
+			adder(8);
+			`,
+			expected: 11,
+		},
+		{
+			input: `
+			let newAdder = fn(a, b) {
+				let c = a + b;
+				fn(d) { c + d };
+			};
+			let adder = newAdder(1, 2);
+			adder(8);
+			`,
+			expected: 11,
+		},
+		{
+			input: `
+			let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+			expected: 14,
+		},
+		{
+			input: `
+			let a = 1;
+			let newAdderOuter = fn(b) {
+				fn(c) {
+					fn(d) { a + b + c + d };
+				};
+			};
+			let newAdderInner = newAdderOuter(2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+			expected: 14,
+		},
+		{
+			input: `
+			let newClosure = fn(a, b) {
+				let one = fn() { a; };
+				let two = fn() { b; };
+				fn() { one() + two(); };
+			};
+			let closure = newClosure(9, 90);
+			closure();
+			`,
+			expected: 99,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+// The closures share the variables with the function defining them, like
+// the evaluator's environments do
+func TestCapturedVariables(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let counter = fn() { let n = 0; fn() { n = n + 1; n } };
+			let c = counter();
+			c(); c(); c()
+			`,
+			expected: 3,
+		},
+		{
+			input:    "fn() { let x = 1; let f = fn() { x }; x = 2; f() }()",
+			expected: 2,
+		},
+		{
+			input:    "fn(x) { let set = fn(v) { x = v }; set(5); x }(1)",
+			expected: 5,
+		},
+		{
+			// both closures see the other one although it's defined later
+			input: `
+			fn() {
+				let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+				let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+				even(10)
+			}()
+			`,
+			expected: true,
+		},
+		{
+			input: `
+			let wrapper = fn() {
+				let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+				countDown(1);
+			};
+			wrapper();
+			`,
+			expected: 0,
+		},
+		{
+			// every iteration has its own i
+			input: `
+			let a = 0; let b = 0;
+			for (i in 0..2) {
+				let f = fn() { i };
+				if (i == 0) { a = f } else { b = f }
+			};
+			a() * 10 + b()
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			let fs = fn() {
+				let first = 0;
+				for (i in 0..3) { let j = i * 2; if (i == 1) { first = fn() { j } } };
+				first
+			};
+			fs()()
+			`,
+			expected: 2,
+		},
+	}
+
+	runVmTests(t, tests)
+
+	// the evaluator agrees
+	for _, tt := range tests {
+		evaluated := evaluator.Eval(parse(tt.input), object.NewEnvironment())
+		testExpectedObject(t, tt.input, tt.expected, evaluated)
+	}
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+		{`"a" == "a"`, true},
+		{`"a" != "a"`, false},
+		{`"a" == 1`, false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHashLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"{}", map[object.HashKey]int64{}},
+		{
+			"{1: 2, 2: 3}",
+			map[object.HashKey]int64{
+				object.NewInteger(1).HashKey(): 2,
+				object.NewInteger(2).HashKey(): 3,
+			},
+		},
+		{
+			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+			map[object.HashKey]int64{
+				object.NewInteger(2).HashKey(): 4,
+				object.NewInteger(6).HashKey(): 16,
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", Null},
+		{"[1, 2, 3][99]", Null},
+		{"[1][-1]", Null},
+		{"{1: 1, 2: 2}[1]", 1},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"{1: 1}[0]", Null},
+		{"{}[0]", Null},
+		{`let h = {"a": {"b": 3}}; h.a.b`, 3},
+		{`let h = {}; h.a`, Null},
+		{`let h = {}; h.a?.b`, Null},
+		{`let h = {}; h.a?.b.c["d"](1)`, Null},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTemplateLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{`"plain"`, "plain"},
+		{`let name = "Monkey"; "Hi ${name}!"`, "Hi Monkey!"},
+		{`"${1 + 2} ${true} ${[1, "a"]}"`, "3 true [1, a]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestNullishExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"1 ?? 2", 1},
+		{"false ?? 2", false},
+		{"{}[0] ?? 2", 2},
+		// the right side doesn't run when it isn't needed
+		{"let n = 0; let f = fn() { n = n + 1 }; 1 ?? f(); n", 0},
+		{"let n = 0; let f = fn() { n = n + 1 }; {}[0] ?? f(); n", 1},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestInlineCaches(t *testing.T) {
+	tests := []vmTestCase{
+		{`let h = {"a": 1}; let s = 0; for (i in 0..3) { s = s + h.a + h["a"] }; s`, 6},
+		// one call site with other hashes and keys
+		{`let f = fn(h, k) { h[k] }; f({"a": 1}, "a") + f({"a": 2}, "a") + f({"a": 2, "b": 3}, "b")`, 6},
+		{`let f = fn(h) { h.a ?? 10 }; f({"a": 1}) + f({}) + f({"a": 100})`, 111},
+		{`let h = {1: 10, 2: 20}; let s = 0; for (i in 0..4) { s = s + (h[i] ?? 1) }; s`, 32},
+		{`let f = fn(h) { h.a }; let h = {"a": 1}; let g = set(h, "a", 2); f(h) + f(g) + f(h)`, 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSuperinstructions(t *testing.T) {
+	tests := []vmTestCase{
+		{"fn(n) { n + 1 }(1)", 2},
+		{`fn(s) { s + "b" }("a")`, "ab"},
+		{"fn(n) { let f = fn() { n }; n - 1 }(1)", 0},
+		{"fn(n) { if (n < 2) { 1 } else { 2 } }(1)", 1},
+		{"fn(n) { if (n > 2) { 1 } else { 2 } }(1)", 2},
+		{`fn(s) { if (s == "a") { 1 } }("a")`, 1},
+		{"fn(n) { if (n != 1) { 1 } }(1)", Null},
+		{"let sum = fn(n) { if (n == 0) { return 0 }; n + sum(n - 1) }; sum(10)", 55},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len({"a": 1})`, 1},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, Null},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, Null},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, Null},
+		{`push([], 1)`, []int{1}},
+		{`str(5) + "!"`, "5!"},
+		{`has({"a": 1}, "a")`, true},
+		{`let f = fn(a) { push(a, len(a)) }; f(f([0]))`, []int{0, 1, 2}},
+		// a let shadows the builtin
+		{`let len = fn(x) { 42 }; len([])`, 42},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("exit(3)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	var exit *object.Error
+	if !errors.As(err, &exit) || !exit.Exit || exit.Code != 3 {
+		t.Errorf("expected exit(3), got=%v", err)
+	}
+}
+
+func TestNewWithBuiltins(t *testing.T) {
+	var out strings.Builder
+	builtins := evaluator.BuiltinsWithOutput(nil, &out)
+
+	comp := compiler.NewWithOptions(compiler.Options{Builtins: builtins})
+	if err := comp.Compile(parse(`puts("a", 1); len`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := NewWithBuiltins(comp.Bytecode(), builtins)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if out.String() != "a\n1\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	// compiled for other builtins than the vm has
+	vm = NewWithBuiltins(comp.Bytecode(), object.NewBuiltins())
+	err := vm.Run()
+	if err == nil || err.Error() != "identifier not found: puts" {
+		t.Errorf("expected puts to be missing, got=%v", err)
+	}
+}
+
+func TestInstructionBudget(t *testing.T) {
+	tests := []struct {
+		input string
+		max   int64
+		err   string
+	}{
+		// OpConstant, OpPop
+		{"1", 2, ""},
+		{"1; 2", 2, "instruction budget exceeded: more than 2 instructions"},
+		{"for (x in 0..9223372036854775807) { x }", 1000, "instruction budget exceeded: more than 1000 instructions"},
+		{"let f = fn() { f() }; f()", 100, "instruction budget exceeded: more than 100 instructions"},
+		{"1; 2", 0, ""},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err := New(comp.Bytecode()).RunWithOptions(context.Background(), Options{MaxInstructions: tt.max})
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.err {
+			t.Errorf("%q with at most %d instructions: want=%q, got=%v", tt.input, tt.max, tt.err, err)
+		}
+	}
+}
+
+func TestRunContextCancellation(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancelTimeout()
+
+	tests := []struct {
+		ctx      context.Context
+		input    string
+		expected string
+	}{
+		{cancelled, "1", "evaluation cancelled: context canceled"},
+		{timeout, "let n = 0; for (x in 0..9223372036854775807) { n = n + 1 }",
+			"evaluation cancelled: context deadline exceeded"},
+		{timeout, "for (x in 0..9223372036854775807) { fn() { x }() }",
+			"evaluation cancelled: context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		for _, newVM := range []func(*compiler.Bytecode) *VM{New, newRegisterVM} {
+			err := newVM(comp.Bytecode()).RunContext(tt.ctx)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("%q: want=%q, got=%v", tt.input, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 + true", "type mismatch: INTEGER + BOOLEAN"},
+		{"true + false", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"true > false", "unknown operator: BOOLEAN > BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{`"a" - "b"`, "unknown operator: STRING - STRING"},
+		{"let f = fn() { foobar }; f(); let foobar = 1", "identifier not found: foobar"},
+		{"let a = b; let b = 1", "identifier not found: b"},
+		{"for (i in 5) {}", "cannot iterate over INTEGER"},
+		{`"a".."b"`, "unknown operator: STRING .. STRING"},
+		{"1..true", "type mismatch: INTEGER .. BOOLEAN"},
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"fn(a) { a; }();", "wrong number of arguments: want=1, got=0"},
+		{"fn(a, b) { a + b; }(1);", "wrong number of arguments: want=2, got=1"},
+		{"1()", "not a function: INTEGER"},
+		{"len(1)", "argument to `len` not supported, got INTEGER"},
+		{`len("a", "b")`, "wrong number of arguments. got=2, want=1"},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`error("failed")`, "failed"},
+		{"1[0]", "index operator not supported: INTEGER"},
+		{"{}[[]]", "unusable as hash key: ARRAY"},
+		{"{[]: 1}", "unusable as hash key: ARRAY"},
+		{"1.a", "member access not supported: INTEGER.a"},
+		{"let h = {}; h.a.b", "member access not supported: NULL.b"},
+		// the inline cache of h[k] has the key 1 when it gets []
+		{"let f = fn(h, k) { h[k] }; f({1: 1}, 1); f({1: 1}, [])", "unusable as hash key: ARRAY"},
+		// superinstructions of the optimizer
+		{`fn(a) { a - 1 }("a")`, "type mismatch: STRING - INTEGER"},
+		{"fn(a) { if (a > 1) { 1 } }(true)", "type mismatch: BOOLEAN > INTEGER"},
+		// a global, the optimizer folds constants
+		{"let a = 1; " + strings.Repeat("a + (", StackSize) + "a" + strings.Repeat(")", StackSize), "stack overflow"},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		// the evaluator agrees, also on where the error is
+		var evaluated object.Object = &object.Error{}
+		if len(tt.input) <= 100 {
+			evaluated = evaluator.Eval(program, object.NewEnvironment())
+			if evaluated.Inspect() != "ERROR: "+tt.expected {
+				t.Errorf("the evaluator gives %q for %q", evaluated.Inspect(), tt.input)
+			}
+		}
+
+		for _, mode := range vmModes {
+			comp := compiler.NewWithOptions(compiler.Options{Optimize: mode.optimize})
+			if err := comp.Compile(program); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			vm := mode.new(comp.Bytecode())
+			err := vm.Run()
+			if err == nil {
+				t.Fatalf("expected an error for %q (%s)", tt.input, mode.name)
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("wrong error (%s). want=%q, got=%q", mode.name, tt.expected, err)
+			}
+
+			pos := err.(*object.Error).Pos
+			if expected, ok := evaluated.(*object.Error); ok && expected.Pos.IsValid() && pos != expected.Pos {
+				t.Errorf("wrong position for %q (%s). want=%s, got=%s", tt.input, mode.name, expected.Pos, pos)
+			}
+		}
+	}
+}
+
+func TestErrorTrace(t *testing.T) {
+	program := parse("let f = fn(x) {\n  x + true\n};\nlet g = fn() { f(1) };\ng()")
+	expected := "[{f 2:5} {g 4:17} {<main> 5:2}]"
+
+	for _, mode := range vmModes {
+		comp := compiler.NewWithOptions(compiler.Options{Optimize: mode.optimize})
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err, ok := mode.new(comp.Bytecode()).Run().(*object.Error)
+		if !ok {
+			t.Fatalf("expected an *object.Error (%s), got=%T", mode.name, err)
+		}
+		if err.Pos.String() != "2:5" {
+			t.Errorf("wrong position (%s). want=2:5, got=%s", mode.name, err.Pos)
+		}
+		if trace := fmt.Sprint(err.Trace); trace != expected {
+			t.Errorf("wrong trace (%s). want=%s, got=%s", mode.name, expected, trace)
+		}
+	}
+}
+
+// Decode verifies what it reads, so no change to a compiled program can
+// make the VM panic, a corrupted one runs into an error at worst
+func TestCorruptedBytecode(t *testing.T) {
+	input := `
+	let make = fn(n) { let total = 0; for (i in 0..n) { total = total + i }; fn(x) { total + x } };
+	let h = {"a": [1, 2, 3]};
+	let f = make(len(h.a));
+	for (k, v in h) { f(len(v)) }
+	h.a[1] ?? f(2)`
+
+	for _, mode := range vmModes {
+		comp := compiler.NewWithOptions(compiler.Options{Optimize: mode.optimize})
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		var buf bytes.Buffer
+		if err := compiler.Encode(&buf, comp.Bytecode()); err != nil {
+			t.Fatalf("encode error: %s", err)
+		}
+		encoded := buf.Bytes()
+
+		for i := len(compiler.Magic) + 1; i < len(encoded); i++ {
+			for _, b := range []byte{0, 1, 2, 0xff, encoded[i] + 1, encoded[i] - 1} {
+				corrupted := append([]byte{}, encoded...)
+				corrupted[i] = b
+				bytecode, err := compiler.Decode(bytes.NewReader(corrupted))
+				if err != nil {
+					continue
+				}
+				func() {
+					defer func() {
+						if r := recover(); r != nil {
+							t.Errorf("byte %d set to %d panics (%s): %v", i, b, mode.name, r)
+						}
+					}()
+					mode.new(bytecode).RunWithOptions(context.Background(), Options{MaxInstructions: 10000})
+				}()
+			}
+		}
+	}
+}
+
+func TestCallDepth(t *testing.T) {
+	// without arguments and locals, so the frames run out before the stack
+	program := parse("let f = fn() { f() }; f()")
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	expected := fmt.Sprintf("call depth exceeded: more than %d nested calls", MaxFrames-1)
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+
+	// with an argument the stack runs out first
+	comp = compiler.New()
+	if err := comp.Compile(parse("let f = fn(n) { f(n + 1) }; f(0)")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "stack overflow" {
+		t.Errorf("wrong error. want=%q, got=%v", "stack overflow", err)
+	}
+}
+
+func TestDepthAndMemoryLimits(t *testing.T) {
+	tests := []struct {
+		input string
+		opts  Options
+		err   string
+	}{
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(9)", Options{MaxDepth: 10}, ""},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10)", Options{MaxDepth: 10},
+			"call depth exceeded: more than 10 nested calls"},
+		{`let s = ""; for (i in 0..10) { s = s + "abc" }; s`, Options{MaxMemory: 1000}, ""},
+		{`let s = ""; for (i in 0..1000) { s = s + "abc" }; s`, Options{MaxMemory: 1000},
+			"memory limit exceeded: more than 1000 bytes allocated"},
+		{"let xs = []; for (i in 0..1000) { xs = push(xs, i) }; xs", Options{MaxMemory: 10000},
+			"memory limit exceeded: more than 10000 bytes allocated"},
+	}
+
+	for _, tt := range tests {
+		for _, mode := range vmModes {
+			comp := compiler.NewWithOptions(compiler.Options{Optimize: mode.optimize})
+			if err := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+
+			err := mode.new(comp.Bytecode()).RunWithOptions(context.Background(), tt.opts)
+			got := ""
+			if err != nil {
+				got = err.(*object.Error).Message
+			}
+			if got != tt.err {
+				t.Errorf("%q (%s): want=%q, got=%v", tt.input, mode.name, tt.err, err)
+			}
+		}
+	}
+}
+
+func BenchmarkArithmetic(b *testing.B) {
+	input := strings.Repeat("(1 + 2 * 3 - 4 / 2) * 5 == 25; ", 100)
+	program := parse(input)
+
+	b.Run("vm", func(b *testing.B) {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			b.Fatalf("compiler error: %s", err)
+		}
+		bytecode := comp.Bytecode()
+
+		for i := 0; i < b.N; i++ {
+			if err := New(bytecode).Run(); err != nil {
+				b.Fatalf("vm error: %s", err)
+			}
+		}
+	})
+
+	b.Run("evaluator", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			evaluator.Eval(program, object.NewEnvironment())
+		}
+	})
+}
+
+// A recursive function and a loop, where the optimized program runs
+// superinstructions
+func BenchmarkLoops(b *testing.B) {
+	program := parse(`
+let fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) };
+let count = fn(n) { let c = 0; for (i in 1..n) { if (i != 0) { c = c + 1 } }; c };
+fib(20) + count(10000)
+`)
+
+	for _, mode := range vmModes {
+		b.Run(mode.name, func(b *testing.B) {
+			comp := compiler.NewWithOptions(compiler.Options{Optimize: mode.optimize})
+			if err := comp.Compile(program); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+
+			for i := 0; i < b.N; i++ {
+				if err := mode.new(bytecode).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHashLookups(b *testing.B) {
+	program := parse(`
+let config = {"size": 2, "names": {"a": 1}};
+let s = 0;
+for (i in 1..10000) { s = s + config.size + config["names"].a };
+s
+`)
+
+	for _, mode := range vmModes {
+		b.Run(mode.name, func(b *testing.B) {
+			comp := compiler.NewWithOptions(compiler.Options{Optimize: mode.optimize})
+			if err := comp.Compile(program); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+
+			for i := 0; i < b.N; i++ {
+				if err := mode.new(bytecode).Run(); err != nil {
+					b.Fatalf("vm error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+// Every way to compile and run a program
+var vmModes = []struct {
+	name     string
+	optimize bool
+	new      func(*compiler.Bytecode) *VM
+}{
+	{"stack", false, New},
+	{"optimized", true, New},
+	{"register", false, newRegisterVM},
+	{"optimized register", true, newRegisterVM},
+}
+
+func newRegisterVM(bytecode *compiler.Bytecode) *VM {
+	return NewRegisterVM(bytecode, object.DefaultBuiltins)
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		// the optimized program and the register vm give the same result
+		for _, mode := range vmModes {
+			comp := compiler.NewWithOptions(compiler.Options{Optimize: mode.optimize})
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			// what the compiler makes passes the checks of decoded programs
+			if err := compiler.Verify(comp.Bytecode()); err != nil {
+				t.Fatalf("%q (%s) doesn't verify: %s", tt.input, mode.name, err)
+			}
+
+			vm := mode.new(comp.Bytecode())
+			err = vm.Run()
+			if err != nil {
+				t.Fatalf("vm error (%s): %s", mode.name, err)
+			}
+
+			stackElem := vm.LastPoppedStackElem()
+
+			testExpectedObject(t, tt.input+" ("+mode.name+")", tt.expected, stackElem)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("%s: testIntegerObject failed: %s", input, err)
+		}
+
+	case bool:
+		err := testBooleanObject(expected, actual)
+		if err != nil {
+			t.Errorf("%s: testBooleanObject failed: %s", input, err)
+		}
+
+	case string:
+		err := testStringObject(expected, actual)
+		if err != nil {
+			t.Errorf("%s: testStringObject failed: %s", input, err)
+		}
+
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%s: object is not Null: %T (%+v)", input, actual, actual)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("%s: object not Array: %T (%+v)", input, actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("%s: wrong num of elements. want=%d, got=%d",
+				input, len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("%s: testIntegerObject failed: %s", input, err)
+			}
+		}
+
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("%s: object is not Hash. got=%T (%+v)", input, actual, actual)
+			return
+		}
+
+		if hash.Len() != len(expected) {
+			t.Errorf("%s: hash has wrong number of pairs. want=%d, got=%d",
+				input, len(expected), hash.Len())
+			return
+		}
+
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Get(expectedKey)
+			if !ok {
+				t.Errorf("%s: no pair for given key in pairs", input)
+				continue
+			}
+
+			err := testIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("%s: testIntegerObject failed: %s", input, err)
+			}
+		}
+	}
+}
+
+func testStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+	}
+
+	return nil
+}